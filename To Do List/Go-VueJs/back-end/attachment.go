@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"to-do-list/handlers"
+)
+
+const (
+	ATTACHMENT_STORAGE_LOCAL = "local"
+	ATTACHMENT_STORAGE_S3    = "s3"
+
+	DEFAULT_ATTACHMENT_DIR      = "attachments"
+	DEFAULT_MAX_ATTACHMENT_SIZE = 10 << 20
+	DEFAULT_ATTACHMENT_TYPES    = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain,application/zip"
+)
+
+// setupAttachments reads ATTACHMENT_STORAGE, local for a directory of ATTACHMENT_DIR or s3 for the bucket of
+// ATTACHMENT_S3_BUCKET. Attachments are disabled when it is not set
+func setupAttachments() handlers.AttachmentStore {
+	switch storage := getEnv("ATTACHMENT_STORAGE", ""); storage {
+	case "":
+		return nil
+	case ATTACHMENT_STORAGE_LOCAL:
+		dir := getEnv("ATTACHMENT_DIR", DEFAULT_ATTACHMENT_DIR)
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			fatal("Creating ATTACHMENT_DIR failed", "error", err)
+		}
+		slog.Info("Attachments stored on disk", "dir", dir)
+		return handlers.LocalStore{Dir: dir}
+	case ATTACHMENT_STORAGE_S3:
+		bucket := getEnv("ATTACHMENT_S3_BUCKET", "")
+		if bucket == "" {
+			fatal("ATTACHMENT_S3_BUCKET must be set when ATTACHMENT_STORAGE is s3")
+		}
+		endpoint := getEnv("ATTACHMENT_S3_ENDPOINT", "s3.amazonaws.com")
+		client, err := minio.New(endpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(getEnv("ATTACHMENT_S3_ACCESS_KEY", ""), getEnvOrFile("ATTACHMENT_S3_SECRET_KEY"), ""),
+			Secure: getEnvBool("ATTACHMENT_S3_TLS", true),
+			Region: getEnv("ATTACHMENT_S3_REGION", ""),
+		})
+		if err != nil {
+			fatal("Invalid ATTACHMENT_S3_ENDPOINT", "error", err)
+		}
+		slog.Info("Attachments stored in S3", "endpoint", endpoint, "bucket", bucket)
+		return handlers.S3Store{Client: client, Bucket: bucket}
+	default:
+		fatal("ATTACHMENT_STORAGE must be local or s3", "storage", storage)
+		return nil
+	}
+}
+
+// setupAttachmentTypes reads the comma separated content types ATTACHMENT_TYPES allows
+func setupAttachmentTypes() map[string]bool {
+	types := make(map[string]bool)
+	for _, contentType := range strings.Split(getEnv("ATTACHMENT_TYPES", DEFAULT_ATTACHMENT_TYPES), ",") {
+		if contentType = strings.ToLower(strings.TrimSpace(contentType)); contentType != "" {
+			types[contentType] = true
+		}
+	}
+	return types
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	// Short, a session gets new tokens from its refresh token
+	DEFAULT_TOKEN_TTL = 15 * time.Minute
+	// HS256 keys shorter than the hash are easier to brute force
+	MIN_JWT_SECRET_LENGTH = 32
+)
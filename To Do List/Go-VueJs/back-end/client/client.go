@@ -0,0 +1,378 @@
+// Package client calls the to-do list REST API from other Go services
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_RETRIES = 3
+	DEFAULT_RETRY_DELAY = 200 * time.Millisecond
+	// Retry-After above this is not waited for, the error is returned instead
+	MAX_RETRY_DELAY = 10 * time.Second
+	// The version of the API the client speaks
+	API_PREFIX = "/api/v1"
+)
+
+// Errors matched by errors.Is on an *APIError
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+	// The server requires a version on Update
+	ErrVersionRequired = errors.New("version required")
+)
+
+// APIError is a failed response of the API
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	// Reason of a validation error
+	Detail string
+	// Fields that failed validation
+	Fields []FieldError
+}
+
+// FieldError is a field that failed validation and the rule it broke, like required or max_length
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("to-do list API: %d %s: %s", e.Status, e.Code, e.Detail)
+	}
+	return fmt.Sprintf("to-do list API: %d %s", e.Status, e.Code)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrValidation:
+		return e.Code == "VALIDATION_ERROR"
+	case ErrConflict:
+		return e.Status == http.StatusConflict || e.Status == http.StatusPreconditionFailed
+	case ErrVersionRequired:
+		return e.Status == http.StatusPreconditionRequired
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	}
+	return false
+}
+
+type Recurrence struct {
+	Frequency string `json:"frequency"`
+	Interval  int    `json:"interval,omitempty"`
+}
+
+type Todo struct {
+	ID           int                    `json:"id,omitempty"`
+	Title        string                 `json:"title,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	IsDone       bool                   `json:"is_done"`
+	Status       string                 `json:"status,omitempty"`
+	Archived     bool                   `json:"archived"`
+	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
+	Source       string                 `json:"source,omitempty"`
+	Version      int                    `json:"version,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Tags         []string               `json:"tags"`
+	Priority     string                 `json:"priority,omitempty"`
+	ProjectID    *int                   `json:"project_id,omitempty"`
+	Recurrence   *Recurrence            `json:"recurrence,omitempty"`
+	NextDueDate  *time.Time             `json:"next_due_date,omitempty"`
+	RemindAt     *time.Time             `json:"remind_at,omitempty"`
+	CreatedAt    *time.Time             `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time             `json:"updated_at,omitempty"`
+	DueDate      *time.Time             `json:"due_date,omitempty"`
+	SnoozedUntil *time.Time             `json:"snoozed_until,omitempty"`
+}
+
+type Pagination struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Page   int `json:"page"`
+	Pages  int `json:"pages"`
+}
+
+// Page is one page of List
+type Page struct {
+	Todos      []Todo
+	Pagination Pagination
+}
+
+// ListOptions filter and page List, zero values are left out
+type ListOptions struct {
+	Limit  int
+	Offset int
+	// Field to sort by, a leading - sorts descending
+	Sort      string
+	IsDone    *bool
+	Status    string
+	ProjectID *int
+	Priority  string
+	Tags      []string
+	// Substring of the title or description
+	Query           string
+	IncludeArchived bool
+}
+
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		values.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	if o.IsDone != nil {
+		values.Set("is_done", strconv.FormatBool(*o.IsDone))
+	}
+	if o.Status != "" {
+		values.Set("status", o.Status)
+	}
+	if o.ProjectID != nil {
+		values.Set("project_id", strconv.Itoa(*o.ProjectID))
+	}
+	if o.Priority != "" {
+		values.Set("priority", o.Priority)
+	}
+	for _, tag := range o.Tags {
+		values.Add("tag", tag)
+	}
+	if o.Query != "" {
+		values.Set("q", o.Query)
+	}
+	if o.IncludeArchived {
+		values.Set("include_archived", "true")
+	}
+	return values
+}
+
+// TodoClient calls the API at BaseURL, e.g. "http://localhost:8080"
+type TodoClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Login token or API key of the user, sent as "Authorization: Bearer"
+	Token string
+	// Sent as X-API-Key when the server requires one
+	APIKey string
+
+	// Failed idempotent requests are retried this often with exponential backoff, not at all when negative
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// NewTodoClient returns a client of the API at baseURL logged in with token, with the default retries
+func NewTodoClient(baseURL, token string) *TodoClient {
+	return &TodoClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Token:      token,
+		MaxRetries: DEFAULT_MAX_RETRIES,
+		RetryDelay: DEFAULT_RETRY_DELAY,
+	}
+}
+
+// envelope is the Response every endpoint answers with
+type envelope struct {
+	Data    json.RawMessage `json:"data"`
+	Meta    json.RawMessage `json:"meta"`
+	Status  int             `json:"status"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Error   string          `json:"error"`
+	Errors  []FieldError    `json:"errors"`
+}
+
+// List returns a page of the to-do list of the user
+func (c *TodoClient) List(ctx context.Context, opts ListOptions) (*Page, error) {
+	path := "/todo"
+	if query := opts.values().Encode(); query != "" {
+		path += "?" + query
+	}
+	response, err := c.do(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{}
+	if err := json.Unmarshal(response.Data, &page.Todos); err != nil {
+		return nil, err
+	}
+	if len(response.Meta) > 0 {
+		if err := json.Unmarshal(response.Meta, &page.Pagination); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func (c *TodoClient) Get(ctx context.Context, id int) (*Todo, error) {
+	return c.todo(ctx, http.MethodGet, "/todo/"+strconv.Itoa(id), nil, nil)
+}
+
+// Create sends an Idempotency-Key, so its retries get the to-do list of the first attempt instead of creating another
+func (c *TodoClient) Create(ctx context.Context, todo Todo) (*Todo, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Idempotency-Key", hex.EncodeToString(key))
+	return c.todo(ctx, http.MethodPost, "/todo", todo, header)
+}
+
+// Update replaces the to-do list, failing with ErrConflict unless it's still at todo.Version when that is set
+// A server with REQUIRE_IF_MATCH fails it with ErrVersionRequired when todo.Version isn't set
+func (c *TodoClient) Update(ctx context.Context, todo Todo) (*Todo, error) {
+	header := http.Header{}
+	if todo.Version != 0 {
+		header.Set("If-Match", strconv.Quote(strconv.Itoa(todo.Version)))
+	}
+	return c.todo(ctx, http.MethodPut, "/todo/"+strconv.Itoa(todo.ID), todo, header)
+}
+
+// Delete moves the to-do list to the trash
+func (c *TodoClient) Delete(ctx context.Context, id int) error {
+	_, err := c.do(ctx, http.MethodDelete, "/todo/"+strconv.Itoa(id), nil, nil)
+	return err
+}
+
+func (c *TodoClient) todo(ctx context.Context, method, path string, body interface{}, header http.Header) (*Todo, error) {
+	response, err := c.do(ctx, method, path, body, header)
+	if err != nil {
+		return nil, err
+	}
+	var todo Todo
+	if err := json.Unmarshal(response.Data, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// do sends the request, retrying network errors, 429 and 5xx of idempotent methods and of POST with an Idempotency-Key
+func (c *TodoClient) do(ctx context.Context, method, path string, body interface{}, header http.Header) (*envelope, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	retries := c.MaxRetries
+	if method == http.MethodPost && header.Get("Idempotency-Key") == "" {
+		retries = 0
+	}
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		response, wait, err := c.send(ctx, method, path, payload, header)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return response, err
+		}
+
+		if wait == 0 {
+			wait = delay
+			delay *= 2
+		}
+		if wait > MAX_RETRY_DELAY {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send makes one attempt, also returning how long the server asked to wait before the next
+func (c *TodoClient) send(ctx context.Context, method, path string, payload []byte, header http.Header) (*envelope, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+API_PREFIX+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, wait, err
+	}
+	// The status of the envelope is authoritative, older servers answer HTTP 200 on errors too
+	var response envelope
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, wait, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	if response.Status == 0 {
+		response.Status = resp.StatusCode
+	}
+	if response.Status >= 300 {
+		detail := response.Error
+		if detail == "" && response.Code == "VALIDATION_ERROR" {
+			detail = response.Message
+		}
+		return nil, wait, &APIError{Status: response.Status, Code: response.Code, Message: response.Message, Detail: detail, Fields: response.Errors}
+	}
+	return &response, wait, nil
+}
+
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500
+	}
+	// Cancelled requests stay cancelled, other transport errors may pass on the next attempt
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
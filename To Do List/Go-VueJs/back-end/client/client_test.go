@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/api/v1/todo" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.URL.RawQuery; got != "is_done=false&limit=10&tag=home&tag=work" {
+			t.Errorf("query = %q", got)
+		}
+		w.Write([]byte(`{"data":[{"id":1,"title":"Buy milk","is_done":false,"tags":["home"]}],"meta":{"total":11,"limit":10,"offset":0,"page":1,"pages":2},"status":200,"message":"Success"}`))
+	}))
+	defer server.Close()
+
+	isDone := false
+	page, err := NewTodoClient(server.URL, "secret").List(context.Background(), ListOptions{Limit: 10, IsDone: &isDone, Tags: []string{"home", "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Todos) != 1 || page.Todos[0].Title != "Buy milk" || page.Pagination.Pages != 2 {
+		t.Errorf("page = %+v", page)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"data":null,"status":404,"code":"NOT_FOUND","message":"Failed"}`))
+		case http.MethodPost:
+			w.Write([]byte(`{"data":{},"status":400,"code":"VALIDATION_ERROR","message":"title is required","errors":[{"field":"title","rule":"required","message":"title is required"}]}`))
+		}
+	}))
+	defer server.Close()
+	client := NewTodoClient(server.URL, "secret")
+
+	if _, err := client.Get(context.Background(), 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get err = %v, want ErrNotFound", err)
+	}
+	_, err := client.Create(context.Background(), Todo{})
+	var apiErr *APIError
+	if !errors.Is(err, ErrValidation) || !errors.As(err, &apiErr) || apiErr.Detail != "title is required" || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "title" {
+		t.Errorf("Create err = %v, want the validation error", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	attempts := 0
+	keys := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Method == http.MethodPost {
+			keys[r.Header.Get("Idempotency-Key")] = true
+		}
+		if attempts < 3 {
+			w.Write([]byte(`{"data":null,"status":500,"code":"DB_ERROR","message":"Failed"}`))
+			return
+		}
+		if r.Method == http.MethodPut && r.Header.Get("If-Match") != `"4"` {
+			t.Errorf("If-Match = %q", r.Header.Get("If-Match"))
+		}
+		w.Write([]byte(`{"data":{"id":1,"title":"Buy oat milk","version":5},"status":200,"message":"Success"}`))
+	}))
+	defer server.Close()
+
+	client := NewTodoClient(server.URL, "secret")
+	client.RetryDelay = time.Millisecond
+	todo, err := client.Update(context.Background(), Todo{ID: 1, Title: "Buy oat milk", Version: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 || todo.Version != 5 {
+		t.Errorf("attempts = %d, version = %d, want 3 attempts and version 5", attempts, todo.Version)
+	}
+
+	// Every attempt of a create has the same key, so the server creates it once
+	attempts = 0
+	if _, err := client.Create(context.Background(), Todo{Title: "Buy milk"}); err != nil || attempts != 3 {
+		t.Errorf("Create err = %v after %d attempts, want success after 3", err, attempts)
+	}
+	if len(keys) != 1 || keys[""] {
+		t.Errorf("Idempotency-Keys = %v, want one key", keys)
+	}
+}
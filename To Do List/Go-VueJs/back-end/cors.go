@@ -0,0 +1,24 @@
+package main
+
+import (
+	"slices"
+
+	"to-do-list/handlers"
+)
+
+// setupCORS reads the policy from CORS_ALLOW_ORIGIN, CORS_ALLOW_METHODS, CORS_ALLOW_HEADERS, CORS_EXPOSE_HEADERS,
+// CORS_MAX_AGE and CORS_ALLOW_CREDENTIALS. Credentials can't be combined with any origin, browsers reject that
+func setupCORS() *handlers.CORSPolicy {
+	policy := handlers.NewCORSPolicy(
+		getEnv("CORS_ALLOW_ORIGIN", "*"),
+		getEnv("CORS_ALLOW_METHODS", handlers.DEFAULT_CORS_METHODS),
+		getEnv("CORS_ALLOW_HEADERS", handlers.DEFAULT_CORS_HEADERS),
+		getEnv("CORS_EXPOSE_HEADERS", handlers.DEFAULT_CORS_EXPOSE_HEADERS),
+		getEnvDuration("CORS_MAX_AGE", handlers.DEFAULT_CORS_MAX_AGE),
+		getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+	)
+	if policy.AllowCredentials && slices.Contains(policy.Origins, "*") {
+		fatal("CORS_ALLOW_CREDENTIALS needs the origins listed in CORS_ALLOW_ORIGIN instead of *")
+	}
+	return policy
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Code of the PostgreSQL SSLRequest message
+const POSTGRES_SSL_REQUEST = 80877103
+
+// buildTLSConfig follows the libpq sslmode semantics, with an optional root CA file, client certificate and minimum TLS
+// version
+func buildTLSConfig(sslMode, rootCertFile, certFile, keyFile, minVersion, host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host}
+
+	switch minVersion {
+	case "", "1.2":
+		config.MinVersion = tls.VersionTLS12
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported DB_TLS_MIN_VERSION %q", minVersion)
+	}
+
+	if rootCertFile != "" {
+		pem, err := os.ReadFile(rootCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading DB_SSLROOTCERT: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("DB_SSLROOTCERT has no valid certificate")
+		}
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("DB_SSLCERT and DB_SSLKEY must be set together")
+	} else if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading DB_SSLCERT and DB_SSLKEY: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch sslMode {
+	case "verify-full":
+	case "require", "verify-ca":
+		// Like libpq, require with a root CA behaves as verify-ca
+		config.InsecureSkipVerify = true
+		if sslMode == "verify-ca" || config.RootCAs != nil {
+			config.VerifyPeerCertificate = verifyChain(config.RootCAs)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DB_SSLMODE %q", sslMode)
+	}
+	return config, nil
+}
+
+// verifyChain checks the server certificate against the roots without checking the host name
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
+
+// tlsDialer negotiates TLS itself, so pq (which can't take a tls.Config) sees a plain connection
+type tlsDialer struct {
+	config *tls.Config
+}
+
+func (d tlsDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialTimeout(network, address, 0)
+}
+
+func (d tlsDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], POSTGRES_SSL_REQUEST)
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if response[0] != 'S' {
+		conn.Close()
+		return nil, errors.New("database server does not support TLS")
+	}
+
+	tlsConn := tls.Client(conn, d.config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+type tlsConnector struct {
+	dsn    string
+	dialer tlsDialer
+}
+
+func (c tlsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pq.DialOpen(c.dialer, c.dsn)
+}
+
+func (c tlsConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
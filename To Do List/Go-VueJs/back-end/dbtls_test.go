@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// certificateDER reads the certificate of a PEM file written by writeCertificate
+func certificateDER(t *testing.T, certFile string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	return block.Bytes
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	caFile, keyFile := writeCertificate(t)
+	otherCert, otherKey := writeCertificate(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	tests := []struct {
+		name       string
+		sslMode    string
+		rootCert   string
+		cert, key  string
+		minVersion string
+		err        string
+		// The certificate is only checked against the CA, the host name is skipped
+		verifyCA bool
+		minTLS   uint16
+	}{
+		{name: "verify-full", sslMode: "verify-full", minTLS: tls.VersionTLS12},
+		{name: "verify-full with a CA", sslMode: "verify-full", rootCert: caFile, minTLS: tls.VersionTLS12},
+		{name: "require encrypts without checking", sslMode: "require", minTLS: tls.VersionTLS12},
+		{name: "require with a CA is verify-ca", sslMode: "require", rootCert: caFile, verifyCA: true, minTLS: tls.VersionTLS12},
+		{name: "verify-ca", sslMode: "verify-ca", rootCert: caFile, verifyCA: true, minTLS: tls.VersionTLS12},
+		{name: "verify-ca with the system roots", sslMode: "verify-ca", verifyCA: true, minTLS: tls.VersionTLS12},
+		{name: "client certificate", sslMode: "verify-full", rootCert: caFile, cert: caFile, key: keyFile, minTLS: tls.VersionTLS12},
+		{name: "TLS 1.3", sslMode: "verify-full", minVersion: "1.3", minTLS: tls.VersionTLS13},
+		{name: "TLS 1.1", sslMode: "verify-full", minVersion: "1.1", err: "DB_TLS_MIN_VERSION"},
+		{name: "disable", sslMode: "disable", err: "DB_SSLMODE"},
+		{name: "prefer", sslMode: "prefer", err: "DB_SSLMODE"},
+		{name: "unreadable CA", sslMode: "verify-ca", rootCert: missing, err: "reading DB_SSLROOTCERT"},
+		{name: "CA without a certificate", sslMode: "verify-ca", rootCert: notPEM, err: "no valid certificate"},
+		{name: "certificate without its key", sslMode: "verify-full", cert: caFile, err: "set together"},
+		{name: "key without its certificate", sslMode: "verify-full", key: keyFile, err: "set together"},
+		{name: "key of another certificate", sslMode: "verify-full", cert: caFile, key: otherKey, err: "loading DB_SSLCERT"},
+		{name: "unreadable certificate", sslMode: "verify-full", cert: missing, key: keyFile, err: "loading DB_SSLCERT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := buildTLSConfig(tt.sslMode, tt.rootCert, tt.cert, tt.key, tt.minVersion, "db.example.com")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.ServerName != "db.example.com" || config.MinVersion != tt.minTLS {
+				t.Errorf("server name %q, min version %x", config.ServerName, config.MinVersion)
+			}
+			if (tt.rootCert != "") != (config.RootCAs != nil) {
+				t.Errorf("root CAs = %v with DB_SSLROOTCERT %q", config.RootCAs, tt.rootCert)
+			}
+			if hasCert := len(config.Certificates) == 1; hasCert != (tt.cert != "") {
+				t.Errorf("%d client certificates with DB_SSLCERT %q", len(config.Certificates), tt.cert)
+			}
+			if verifyFull := tt.sslMode == "verify-full"; config.InsecureSkipVerify == verifyFull {
+				t.Errorf("InsecureSkipVerify = %v with sslmode %s", config.InsecureSkipVerify, tt.sslMode)
+			}
+			if (config.VerifyPeerCertificate != nil) != tt.verifyCA {
+				t.Fatalf("checks the chain itself = %v, want %v", config.VerifyPeerCertificate != nil, tt.verifyCA)
+			}
+			if tt.verifyCA && tt.rootCert != "" {
+				if err := config.VerifyPeerCertificate([][]byte{certificateDER(t, caFile)}, nil); err != nil {
+					t.Errorf("certificate of the CA refused: %v", err)
+				}
+				if err := config.VerifyPeerCertificate([][]byte{certificateDER(t, otherCert)}, nil); err == nil {
+					t.Error("certificate of another CA accepted")
+				}
+				if err := config.VerifyPeerCertificate(nil, nil); err == nil {
+					t.Error("no certificate accepted")
+				}
+			}
+		})
+	}
+}
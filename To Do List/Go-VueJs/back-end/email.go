@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"time"
+
+	"to-do-list/service"
+)
+
+const DEFAULT_SMTP_PORT = "587"
+
+var dueSoonTemplate = template.Must(template.New("due_soon").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<p>Hi {{.Username}},</p>
+<p>This is your reminder for <strong>{{.Todo.Title}}</strong>{{with .Todo.DueDate}}, due {{.Format "Mon 2 Jan 2006 15:04 MST"}}{{end}}.</p>
+{{with .Todo.Description}}<p>{{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+// smtpNotifier emails reminders to the address of their owner
+type smtpNotifier struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	location *time.Location
+
+	// smtp.SendMail, replaced in tests
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// newSMTPNotifier reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM, nil when SMTP_HOST is not set
+func newSMTPNotifier(location *time.Location) *smtpNotifier {
+	host := getEnv("SMTP_HOST", "")
+	if host == "" {
+		return nil
+	}
+	notifier := &smtpNotifier{
+		addr:     net.JoinHostPort(host, getEnv("SMTP_PORT", DEFAULT_SMTP_PORT)),
+		from:     getEnv("SMTP_FROM", ""),
+		location: location,
+		send:     smtp.SendMail,
+	}
+	if notifier.from == "" {
+		fatal("SMTP_FROM must be set when SMTP_HOST is")
+	}
+	// PlainAuth refuses to send the password over a connection without TLS, except to localhost
+	if username := getEnv("SMTP_USERNAME", ""); username != "" {
+		notifier.auth = smtp.PlainAuth("", username, getEnvOrFile("SMTP_PASSWORD"), host)
+	}
+	return notifier
+}
+
+func (n *smtpNotifier) Notify(ctx context.Context, reminder service.Reminder) error {
+	if reminder.Email == "" {
+		slog.WarnContext(ctx, "Reminder not emailed, the user has no email", "todo_id", reminder.Todo.ID, "user_id", reminder.UserID)
+		return nil
+	}
+	if reminder.Todo.DueDate != nil {
+		due := reminder.Todo.DueDate.In(n.location)
+		reminder.Todo.DueDate = &due
+	}
+
+	var body bytes.Buffer
+	if err := dueSoonTemplate.Execute(&body, reminder); err != nil {
+		return err
+	}
+	subject := mime.QEncoding.Encode("utf-8", "Reminder: "+reminder.Todo.Title)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s", n.from, reminder.Email, subject, body.String())
+	return n.send(n.addr, n.auth, n.from, []string{reminder.Email}, []byte(msg))
+}
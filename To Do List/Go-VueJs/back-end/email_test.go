@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+func TestSMTPNotifier(t *testing.T) {
+	var (
+		sentTo []string
+		sent   string
+	)
+	notifier := &smtpNotifier{
+		addr:     "mail.example.com:587",
+		from:     "todo@example.com",
+		location: time.UTC,
+		send: func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			sentTo, sent = to, string(msg)
+			return nil
+		},
+	}
+
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	reminder := service.Reminder{UserID: testUserID, Username: "ana", Email: "ana@example.com", Todo: service.Todo{ID: 1, Title: "Pay <rent>", DueDate: &due}}
+	if err := notifier.Notify(context.Background(), reminder); err != nil {
+		t.Fatal(err)
+	}
+	if len(sentTo) != 1 || sentTo[0] != "ana@example.com" {
+		t.Errorf("to = %v, want ana@example.com", sentTo)
+	}
+	for _, want := range []string{"Subject: Reminder: Pay <rent>\r\n", "Content-Type: text/html", "Hi ana", "Pay &lt;rent&gt;", "due Fri 1 Mar 2024 09:30 UTC"} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("message is missing %q:\n%s", want, sent)
+		}
+	}
+
+	// Users without an email are skipped instead of retried
+	sentTo = nil
+	reminder.Email = ""
+	if err := notifier.Notify(context.Background(), reminder); err != nil || sentTo != nil {
+		t.Errorf("without email: err = %v, sent to %v", err, sentTo)
+	}
+}
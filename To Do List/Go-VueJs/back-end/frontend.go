@@ -0,0 +1,37 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+// The Vue app built into frontend/dist, e.g. with "vite build --outDir ../back-end/frontend/dist --emptyOutDir". Only
+// the .gitkeep is committed, a binary built without the app serves the API alone
+//
+//go:embed all:frontend/dist
+var frontendFS embed.FS
+
+// setupFrontend returns the app of FRONTEND_DIR, a directory served as it changes during development, else the one
+// embedded in the binary. Nil when the binary has none
+func setupFrontend() fs.FS {
+	if dir := getEnv("FRONTEND_DIR", ""); dir != "" {
+		fsys := os.DirFS(dir)
+		if _, err := fs.Stat(fsys, "index.html"); err != nil {
+			fatal("FRONTEND_DIR has no index.html", "dir", dir, "error", err)
+		}
+		slog.Info("Frontend served from disk", "dir", dir)
+		return fsys
+	}
+
+	fsys, err := fs.Sub(frontendFS, "frontend/dist")
+	if err != nil {
+		fatal("Reading the embedded frontend failed", "error", err)
+	}
+	if _, err := fs.Stat(fsys, "index.html"); err != nil {
+		slog.Info("The binary is built without the frontend, serving the API only")
+		return nil
+	}
+	return fsys
+}
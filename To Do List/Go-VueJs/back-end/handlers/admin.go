@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"to-do-list/service"
+)
+
+// Admin commands run against the database of the settings like migrate, without going through the HTTP API
+const (
+	COMMAND_SEED   = "seed"
+	COMMAND_USER   = "user"
+	COMMAND_TODO   = "todo"
+	COMMAND_EXPORT = "export"
+
+	USER_CREATE        = "create"
+	USER_DISABLE       = "disable"
+	USER_ENABLE        = "enable"
+	TODO_PURGE_DELETED = "purge-deleted"
+
+	DEFAULT_SEED_COUNT = 100
+	DEFAULT_SEED_USER  = "demo"
+	MAX_SEED_COUNT     = 100000
+)
+
+var errUserNotFound = errors.New("user not found")
+
+// AdminCommand is the action and the flags of an admin command
+type AdminCommand struct {
+	// USER_CREATE, USER_DISABLE or USER_ENABLE of user, TODO_PURGE_DELETED of todo
+	Action   string
+	Username string
+	Email    string
+	// The password of user create is the first line of stdin, else a random one is printed
+	PasswordStdin bool
+	Count         int
+	// Only the to-do list deleted longer ago than this are purged, zero purges the whole trash
+	OlderThan time.Duration
+	// EXPORT_FORMAT_CSV or EXPORT_FORMAT_JSON, to Output or stdout when it is empty
+	Format string
+	Output string
+}
+
+// ParseAdminCommand reads the action, the flags and the username of an admin command. The username of user comes
+// before or after the flags
+func ParseAdminCommand(args []string) (AdminCommand, error) {
+	var command AdminCommand
+	name, rest := args[0], args[1:]
+	switch name {
+	case COMMAND_USER, COMMAND_TODO:
+		if len(rest) == 0 || strings.HasPrefix(rest[0], "-") {
+			return AdminCommand{}, fmt.Errorf("%s needs an action", name)
+		}
+		command.Action, rest = rest[0], rest[1:]
+		name += " " + command.Action
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	switch name {
+	case COMMAND_SEED:
+		flags.StringVar(&command.Username, "user", DEFAULT_SEED_USER, "")
+		flags.IntVar(&command.Count, "count", DEFAULT_SEED_COUNT, "")
+	case COMMAND_USER + " " + USER_CREATE:
+		flags.StringVar(&command.Email, "email", "", "")
+		flags.BoolVar(&command.PasswordStdin, "password-stdin", false, "")
+	case COMMAND_USER + " " + USER_DISABLE, COMMAND_USER + " " + USER_ENABLE:
+	case COMMAND_TODO + " " + TODO_PURGE_DELETED:
+		flags.DurationVar(&command.OlderThan, "older-than", 0, "")
+	case COMMAND_EXPORT:
+		flags.StringVar(&command.Username, "user", "", "")
+		flags.StringVar(&command.Format, "format", EXPORT_FORMAT_CSV, "")
+		flags.StringVar(&command.Output, "output", "", "")
+	default:
+		return AdminCommand{}, fmt.Errorf("unknown %s command %q", args[0], command.Action)
+	}
+	if err := flags.Parse(rest); err != nil {
+		return AdminCommand{}, fmt.Errorf("%s: %w", name, err)
+	}
+	rest = flags.Args()
+	if args[0] == COMMAND_USER {
+		if len(rest) == 0 {
+			return AdminCommand{}, fmt.Errorf("%s needs the username", name)
+		}
+		command.Username = rest[0]
+		if err := flags.Parse(rest[1:]); err != nil {
+			return AdminCommand{}, fmt.Errorf("%s: %w", name, err)
+		}
+		rest = flags.Args()
+	}
+	if len(rest) > 0 {
+		return AdminCommand{}, fmt.Errorf("%s takes no more arguments, got %q", name, rest)
+	}
+
+	switch {
+	case args[0] == COMMAND_SEED && (command.Count < 1 || command.Count > MAX_SEED_COUNT):
+		return AdminCommand{}, fmt.Errorf("seed count must be between 1 and %d", MAX_SEED_COUNT)
+	case args[0] == COMMAND_EXPORT && command.Username == "":
+		return AdminCommand{}, errors.New("export needs the user")
+	case args[0] == COMMAND_EXPORT && command.Format != EXPORT_FORMAT_CSV && command.Format != EXPORT_FORMAT_JSON:
+		return AdminCommand{}, fmt.Errorf("export format must be %s or %s", EXPORT_FORMAT_CSV, EXPORT_FORMAT_JSON)
+	case command.OlderThan < 0:
+		return AdminCommand{}, errors.New("purge-deleted older-than must not be negative")
+	}
+	return command, nil
+}
+
+// RunAdmin runs the admin command of the name, reading a password from stdin and printing what it did to stdout
+func (conf *Config) RunAdmin(ctx context.Context, name string, command AdminCommand, stdin io.Reader, stdout io.Writer) error {
+	switch name {
+	case COMMAND_SEED:
+		return conf.seed(ctx, stdout, command.Username, command.Count)
+	case COMMAND_USER:
+		switch command.Action {
+		case USER_CREATE:
+			return conf.adminCreateUser(ctx, stdin, stdout, command)
+		case USER_DISABLE:
+			return conf.disableUser(ctx, stdout, command.Username)
+		case USER_ENABLE:
+			return conf.enableUser(ctx, stdout, command.Username)
+		}
+	case COMMAND_TODO:
+		return conf.adminPurgeDeleted(ctx, stdout, command.OlderThan)
+	case COMMAND_EXPORT:
+		return conf.adminExport(ctx, stdout, command)
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// lookupUser is the id of the user with the username, errUserNotFound when there is none
+func (conf *Config) lookupUser(ctx context.Context, username string) (int, error) {
+	userID, err := conf.users().Lookup(ctx, username)
+	if err == service.ErrNotFound {
+		return 0, fmt.Errorf("%w: %s", errUserNotFound, username)
+	}
+	return userID, err
+}
+
+// randomPassword is a password of 128 random bits for the users the commands create
+func randomPassword() (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func (conf *Config) adminCreateUser(ctx context.Context, stdin io.Reader, stdout io.Writer, command AdminCommand) error {
+	credentials := Credentials{Username: command.Username, Email: command.Email}
+	generated := !command.PasswordStdin
+	if command.PasswordStdin {
+		scanner := bufio.NewScanner(stdin)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return errors.New("no password on stdin")
+		}
+		credentials.Password = strings.TrimSuffix(scanner.Text(), "\r")
+	} else {
+		var err error
+		if credentials.Password, err = randomPassword(); err != nil {
+			return err
+		}
+	}
+	if err := validateCredentials(credentials); err != nil {
+		return err
+	}
+
+	user, err := conf.createUser(ctx, credentials)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("username %s is taken", credentials.Username)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Created user %s with id %d\n", user.Username, user.ID)
+	if generated {
+		fmt.Fprintf(stdout, "Password: %s\n", credentials.Password)
+	}
+	return nil
+}
+
+// disableUser stops the user from signing in and revokes the sessions of the user, the API keys are refused while the
+// user is disabled. A login token without a session stays valid until it expires, at most TOKEN_TTL
+func (conf *Config) disableUser(ctx context.Context, stdout io.Writer, username string) error {
+	userID, err := conf.lookupUser(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := conf.users().Disable(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Disabled user %s, revoked %d sessions\n", username, revoked)
+	return nil
+}
+
+// enableUser lets a disabled user sign in again, the revoked sessions stay revoked
+func (conf *Config) enableUser(ctx context.Context, stdout io.Writer, username string) error {
+	userID, err := conf.lookupUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := conf.users().Enable(ctx, userID); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Enabled user %s\n", username)
+	return nil
+}
+
+// Words the titles of the seeded to-do list are made of
+var (
+	seedVerbs      = []string{"Buy", "Call", "Email", "Fix", "Plan", "Review", "Clean", "Book", "Pay", "Write"}
+	seedObjects    = []string{"milk", "the dentist", "the landlord", "the bike", "the trip", "the report", "the garage", "a table", "the bills", "a thank-you note"}
+	seedTags       = []string{"home", "work", "errands", "health", "finance"}
+	seedPriorities = []string{service.PRIORITY_LOW, service.PRIORITY_MEDIUM, service.PRIORITY_MEDIUM, service.PRIORITY_HIGH, service.PRIORITY_URGENT}
+)
+
+// seed creates count to-do list of random titles, priorities, tags and due dates for the user, which is created with a
+// random password when it doesn't exist. They go through TodoService like the ones of the API
+func (conf *Config) seed(ctx context.Context, stdout io.Writer, username string, count int) error {
+	userID, err := conf.lookupUser(ctx, username)
+	if errors.Is(err, errUserNotFound) {
+		var password string
+		if password, err = randomPassword(); err != nil {
+			return err
+		}
+		var user service.User
+		if user, err = conf.createUser(ctx, Credentials{Username: username, Password: password}); err != nil {
+			return err
+		}
+		userID = user.ID
+		fmt.Fprintf(stdout, "Created user %s with id %d and password %s\n", username, userID, password)
+	} else if err != nil {
+		return err
+	}
+
+	random := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	now := time.Now().In(conf.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, conf.Location)
+	todos := conf.todos()
+	for i := 0; i < count; i++ {
+		todo := service.Todo{
+			Title:    seedVerbs[random.Intn(len(seedVerbs))] + " " + seedObjects[random.Intn(len(seedObjects))],
+			Source:   SOURCE_API,
+			Priority: seedPriorities[random.Intn(len(seedPriorities))],
+			Tags:     service.Tags{},
+		}
+		for _, tag := range seedTags {
+			if random.Intn(4) == 0 {
+				todo.Tags = append(todo.Tags, tag)
+			}
+		}
+		// Half are due, from a week ago to a month ahead
+		if random.Intn(2) == 0 {
+			due := today.AddDate(0, 0, random.Intn(38)-7)
+			todo.DueDate = &due
+		}
+		if err := todos.Create(ctx, userID, &todo); err != nil {
+			return fmt.Errorf("seeding to-do list %d: %w", i+1, err)
+		}
+	}
+	fmt.Fprintf(stdout, "Seeded %d to-do list for user %s\n", count, username)
+	return nil
+}
+
+// adminPurgeDeleted empties the trash of every user of the to-do list deleted longer ago than olderThan, and deletes
+// the files of the purged to-do lists like the trash purge of the server
+func (conf *Config) adminPurgeDeleted(ctx context.Context, stdout io.Writer, olderThan time.Duration) error {
+	purged, err := conf.store().PurgeDeleted(ctx, time.Now().Add(-olderThan))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Purged %d deleted to-do list\n", purged)
+
+	if conf.Attachments != nil {
+		deleted, err := conf.deleteOrphanAttachments(ctx)
+		if err != nil {
+			return fmt.Errorf("deleting attachments of purged to-do list: %w", err)
+		}
+		fmt.Fprintf(stdout, "Deleted %d attachments\n", deleted)
+	}
+	return nil
+}
+
+// adminExport writes the to-do list of the user which aren't deleted in the format of GET /todo/export
+func (conf *Config) adminExport(ctx context.Context, stdout io.Writer, command AdminCommand) error {
+	userID, err := conf.lookupUser(ctx, command.Username)
+	if err != nil {
+		return err
+	}
+
+	rows, err := conf.queries().Export(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if command.Output == "" {
+		return conf.writeExport(stdout, command.Format, rows)
+	}
+	file, err := os.Create(command.Output)
+	if err != nil {
+		return err
+	}
+	if err := conf.writeExport(file, command.Format, rows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
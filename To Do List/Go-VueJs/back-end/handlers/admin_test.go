@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+func TestParseAdminCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    AdminCommand
+		invalid bool
+	}{
+		{args: []string{"seed"}, want: AdminCommand{Username: DEFAULT_SEED_USER, Count: DEFAULT_SEED_COUNT}},
+		{args: []string{"seed", "--count", "5", "-user", "ana"}, want: AdminCommand{Username: "ana", Count: 5}},
+		{args: []string{"user", "create", "ana", "-email", "ana@example.com"}, want: AdminCommand{Action: USER_CREATE, Username: "ana", Email: "ana@example.com"}},
+		{args: []string{"user", "create", "-password-stdin", "ana"}, want: AdminCommand{Action: USER_CREATE, Username: "ana", PasswordStdin: true}},
+		{args: []string{"user", "disable", "ana"}, want: AdminCommand{Action: USER_DISABLE, Username: "ana"}},
+		{args: []string{"todo", "purge-deleted", "-older-than", "720h"}, want: AdminCommand{Action: TODO_PURGE_DELETED, OlderThan: 720 * time.Hour}},
+		{args: []string{"export", "-user", "ana", "-format", "json", "-output", "ana.json"}, want: AdminCommand{Username: "ana", Format: EXPORT_FORMAT_JSON, Output: "ana.json"}},
+		{args: []string{"seed", "-count", "0"}, invalid: true},
+		{args: []string{"seed", "extra"}, invalid: true},
+		{args: []string{"user"}, invalid: true},
+		{args: []string{"user", "delete", "ana"}, invalid: true},
+		{args: []string{"user", "disable"}, invalid: true},
+		{args: []string{"user", "disable", "ana", "bob"}, invalid: true},
+		{args: []string{"todo", "purge-deleted", "-older-than", "-1h"}, invalid: true},
+		{args: []string{"export"}, invalid: true},
+		{args: []string{"export", "-user", "ana", "-format", "xml"}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			got, err := ParseAdminCommand(tt.args)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("err = %v, want invalid %t", err, tt.invalid)
+			}
+			if got != tt.want {
+				t.Errorf("command = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	ctx := context.Background()
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+		command, err := ParseAdminCommand(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout bytes.Buffer
+		if err := conf.RunAdmin(ctx, args[0], command, strings.NewReader(stdin), &stdout); err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		return stdout.String()
+	}
+
+	if out := run("correct horse\n", "user", "create", "ana", "-password-stdin"); !strings.HasPrefix(out, "Created user ana") || strings.Contains(out, "Password") {
+		t.Errorf("user create printed %q", out)
+	}
+	if out := run("", "seed", "-user", "ana", "-count", "5"); out != "Seeded 5 to-do list for user ana\n" {
+		t.Errorf("seed printed %q", out)
+	}
+	var todos []service.Todo
+	if err := json.Unmarshal([]byte(run("", "export", "-user", "ana", "-format", "json")), &todos); err != nil || len(todos) != 5 {
+		t.Fatalf("exported %d to-do list (%v)", len(todos), err)
+	}
+
+	// The trash of every user is emptied
+	if _, err := conf.Database.Exec("UPDATE todo SET deleted_at = $1 WHERE id = $2", time.Now().Add(-time.Hour), todos[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if out := run("", "todo", "purge-deleted", "-older-than", "48h"); out != "Purged 0 deleted to-do list\n" {
+		t.Errorf("purge-deleted printed %q", out)
+	}
+	if out := run("", "todo", "purge-deleted"); out != "Purged 1 deleted to-do list\n" {
+		t.Errorf("purge-deleted printed %q", out)
+	}
+
+	// A disabled user can't log in
+	run("", "user", "disable", "ana")
+	login := func() int {
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"username":"ana","password":"correct horse"}`)))
+		return rec.Code
+	}
+	if status := login(); status != http.StatusForbidden {
+		t.Errorf("login of the disabled user = %d", status)
+	}
+	run("", "user", "enable", "ana")
+	if status := login(); status != http.StatusOK {
+		t.Errorf("login of the enabled user = %d", status)
+	}
+}
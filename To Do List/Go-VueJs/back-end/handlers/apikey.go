@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"to-do-list/service"
+)
+
+const (
+	// API_KEY_PREFIX starts every API key, which tells it apart from a login token
+	API_KEY_PREFIX = "tdl_"
+	// The start of the key kept to tell the keys of a user apart, the rest is only known to its holder
+	API_KEY_HINT_LENGTH     = 12
+	MAX_API_KEY_NAME_LENGTH = 100
+
+	// A read key only makes GET and HEAD requests, a write key acts as the user
+	SCOPE_READ  = "read"
+	SCOPE_WRITE = "write"
+)
+
+func validateAPIKey(key service.APIKey) error {
+	var errs service.FieldErrors
+	errs.CheckLength("name", key.Name, true, MAX_API_KEY_NAME_LENGTH)
+	if key.Scope != SCOPE_READ && key.Scope != SCOPE_WRITE {
+		errs = append(errs, service.NewFieldError("scope", service.RULE_ONE_OF, "scope must be %s or %s", SCOPE_READ, SCOPE_WRITE))
+	}
+	return errs.Err()
+}
+
+// apiKeyFrom returns the API key of the request, as the bearer or in X-API-Key, which wins over a login token. When
+// API_KEY is set its X-API-Key is the key of the server, so the one of the user goes in the bearer
+func apiKeyFrom(r *http.Request, bearer string) (string, bool) {
+	if key := strings.TrimPrefix(bearer, "Bearer "); strings.HasPrefix(key, API_KEY_PREFIX) {
+		return key, true
+	}
+	if key := r.Header.Get("X-API-Key"); strings.HasPrefix(key, API_KEY_PREFIX) {
+		return key, true
+	}
+	return "", false
+}
+
+// apiKeys is the APIKeyRepository of the handlers
+func (conf *Config) apiKeys() *service.APIKeyRepository {
+	return &service.APIKeyRepository{DB: conf.Database, Driver: conf.DBDriver}
+}
+
+// apiKeyRefusal is why an API key of scope may not make the request, empty when it may
+func apiKeyRefusal(scope string, r *http.Request) string {
+	// A key creating keys could outlive its own revocation, or widen its scope
+	if path := unversionedPath(r.URL.Path); path == "/apikeys" || strings.HasPrefix(path, "/apikeys/") {
+		return "API keys are managed with a login token"
+	}
+	if scope == SCOPE_READ && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "the API key is read-only"
+	}
+	return ""
+}
+
+// getAPIKeys lists the API keys of the user, oldest first, without the keys themselves
+func (conf *Config) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := conf.apiKeys().List(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, keys, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// createAPIKey issues a key for the user with a read scope unless asked for write. The response is the only time
+// the key is shown
+func (conf *Config) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var input service.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	// Only the name and the scope are the client's
+	key := service.APIKey{Name: input.Name, Scope: input.Scope}
+	if key.Scope == "" {
+		key.Scope = SCOPE_READ
+	}
+	if err := validateAPIKey(key); err != nil {
+		buildValidationResponse(w, key, err)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	key.Key = API_KEY_PREFIX + hex.EncodeToString(secret)
+	key.Hint = key.Key[:API_KEY_HINT_LENGTH]
+	key.CreatedAt = time.Now().UTC()
+
+	if err := conf.apiKeys().Create(r.Context(), currentUser(r), &key); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, key, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// revokeAPIKey deletes an API key of the user, the next request with it is unauthorized
+func (conf *Config) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := conf.apiKeys().Revoke(r.Context(), currentUser(r), keyID); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO api_key(user_id, name, scope, key_hash, hint, created_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING id")).
+		WithArgs(testUserID, "backup script", SCOPE_READ, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	_, response := serve(t, conf, http.MethodPost, "/apikeys", `{"name":"backup script"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	var key service.APIKey
+	decodeData(t, response, &key)
+	if key.ID != 4 || key.Scope != SCOPE_READ || !strings.HasPrefix(key.Key, API_KEY_PREFIX) || key.Hint != key.Key[:API_KEY_HINT_LENGTH] {
+		t.Errorf("key = %+v", key)
+	}
+
+	for _, body := range []string{`{"name":""}`, `{"name":"sync","scope":"admin"}`, `[]`} {
+		_, response = serve(t, conf, http.MethodPost, "/apikeys", body)
+		checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM api_key WHERE id = $1 AND user_id = $2")).
+		WithArgs(4, testUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	_, response := serve(t, conf, http.MethodDelete, "/apikeys/4", "")
+	checkResponse(t, response, http.StatusOK, "")
+
+	// A key of another user
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM api_key WHERE id = $1 AND user_id = $2")).
+		WithArgs(5, testUserID).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, response = serve(t, conf, http.MethodDelete, "/apikeys/5", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	_, response = serve(t, conf, http.MethodDelete, "/apikeys/abc", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequireUserAPIKey(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	handler := conf.requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := userFromContext(r.Context())
+		buildResponse(w, userID, http.StatusOK, MESSAGE_SUCCESS)
+	}))
+
+	const key = API_KEY_PREFIX + "0123456789abcdef"
+	expectKey := func(scope string, lastUsedAt interface{}) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, scope, last_used_at FROM api_key WHERE key_hash = $1 AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)")).
+			WithArgs(service.APIKeyHash(key)).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scope", "last_used_at"}).AddRow(4, 7, scope, lastUsedAt))
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		setup  func()
+		status int
+	}{
+		{
+			name: "bearer", method: http.MethodPost, path: "/todo", header: "Authorization",
+			setup: func() {
+				expectKey(SCOPE_WRITE, nil)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE api_key SET last_used_at = $2 WHERE id = $1")).WithArgs(4, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "X-API-Key used lately", method: http.MethodGet, path: "/todo", header: "X-API-Key",
+			setup:  func() { expectKey(SCOPE_READ, time.Now().UTC()) },
+			status: http.StatusOK,
+		},
+		{
+			name: "read key writing", method: http.MethodDelete, path: "/todo/1", header: "X-API-Key",
+			setup:  func() { expectKey(SCOPE_READ, time.Now().UTC()) },
+			status: http.StatusForbidden,
+		},
+		{
+			name: "managing keys", method: http.MethodGet, path: "/apikeys", header: "Authorization",
+			setup:  func() { expectKey(SCOPE_WRITE, time.Now().UTC()) },
+			status: http.StatusForbidden,
+		},
+		{
+			name: "revoked", method: http.MethodGet, path: "/todo", header: "Authorization",
+			setup: func() {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM api_key WHERE key_hash = $1")).WithArgs(service.APIKeyHash(key)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scope", "last_used_at"}))
+			},
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header == "Authorization" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			} else {
+				req.Header.Set(tt.header, key)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+			}
+			if response.Status != tt.status {
+				t.Errorf("status = %d, want %d", response.Status, tt.status)
+			}
+			if tt.status == http.StatusOK && response.Data != float64(7) {
+				t.Errorf("user = %v, want 7", response.Data)
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"to-do-list/service"
+)
+
+// ArchiveDoneTodos periodically archives to-do list that have been done for longer than age, until ctx is done
+func (conf *Config) ArchiveDoneTodos(ctx context.Context, interval, age time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Archive job stopped")
+			return
+		case <-ticker.C:
+		}
+
+		archived, err := conf.store().ArchiveDoneBefore(ctx, time.Now().Add(-age))
+		if err != nil {
+			slog.Error("Archive job failed", "error", err)
+			continue
+		}
+		slog.Info("Archived done to-do list", "count", len(archived))
+	}
+}
+
+func (conf *Config) archiveTodo(w http.ResponseWriter, r *http.Request) {
+	conf.setArchived(w, r, true)
+}
+
+func (conf *Config) unarchiveTodo(w http.ResponseWriter, r *http.Request) {
+	conf.setArchived(w, r, false)
+}
+
+// setArchived archives or unarchives a to-do list whether it's done or not, doing it twice is a no-op
+func (conf *Config) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	todo, err := conf.store().SetArchived(r.Context(), currentUser(r), todoID, archived)
+	if err == service.ErrTodoNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	conf.todos().Publish(r.Context(), service.EVENT_UPDATED, currentUser(r), todo)
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// archiveCompletedTodos archives every done to-do list of the user at once, returning how many were archived
+func (conf *Config) archiveCompletedTodos(w http.ResponseWriter, r *http.Request) {
+	todos, err := conf.store().ArchiveDone(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	conf.todos().Publish(r.Context(), service.EVENT_UPDATED, currentUser(r), todos...)
+
+	buildResponse(w, BulkResult{Updated: len(todos)}, http.StatusOK, MESSAGE_SUCCESS)
+}
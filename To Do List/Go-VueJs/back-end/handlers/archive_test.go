@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestSetArchived(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		archived bool
+		found    bool
+		status   int
+		code     string
+	}{
+		{name: "archive", target: "/todo/1/archive", archived: true, found: true, status: http.StatusOK},
+		{name: "unarchive", target: "/todo/1/unarchive", archived: false, found: true, status: http.StatusOK},
+		{name: "not found", target: "/todo/1/archive", archived: true, status: http.StatusNotFound, code: CODE_NOT_FOUND},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			mock.ExpectBegin()
+			query := mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE")).WithArgs(1, testUserID)
+			if !tt.found {
+				query.WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			} else {
+				query.WillReturnRows(archivedRow(sqlmock.NewRows(todoColumns), 1, !tt.archived))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET archived = $1")).
+					WithArgs(tt.archived, 1).
+					WillReturnRows(archivedRow(sqlmock.NewRows(todoColumns), 1, tt.archived))
+				expectHistory(mock, service.EVENT_UPDATED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			}
+
+			_, response := serve(t, conf, http.MethodPost, tt.target, "")
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSetArchivedOfInvalidID(t *testing.T) {
+	for _, target := range []string{"/todo/abc/archive", "/todo/abc/unarchive"} {
+		t.Run(target, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, http.MethodPost, target, "")
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestArchiveCompletedTodos(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	rows := sqlmock.NewRows(todoColumns)
+	archivedRow(rows, 1, true)
+	archivedRow(rows, 2, true)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET archived = TRUE, updated_at = now() WHERE is_done AND NOT archived AND deleted_at IS NULL AND user_id = $1")).
+		WithArgs(testUserID).
+		WillReturnRows(rows)
+	expectHistory(mock, service.EVENT_UPDATED)
+	expectHistory(mock, service.EVENT_UPDATED)
+	mock.ExpectCommit()
+	expectAudience(mock)
+
+	_, response := serve(t, conf, http.MethodPost, "/todo/archive-completed", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var result BulkResult
+	decodeData(t, response, &result)
+	if result.Updated != 2 {
+		t.Errorf("updated = %d, want 2", result.Updated)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// archivedRow adds a done to-do list which is archived or not
+func archivedRow(rows *sqlmock.Rows, id int, archived bool) *sqlmock.Rows {
+	now := time.Now()
+	return rows.AddRow(id, "Buy milk", "", true, archived, now, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_DONE, nil)
+}
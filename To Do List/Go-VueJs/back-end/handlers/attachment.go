@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+
+	"to-do-list/service"
+)
+
+const (
+	MAX_ATTACHMENT_FILENAME_LENGTH = 255
+
+	// Bytes of an upload its content type is detected from, all that http.DetectContentType reads
+	ATTACHMENT_SNIFF_LENGTH = 512
+
+	// Smallest part of an S3 multipart upload, an upload of unknown size buffers one part at a time
+	S3_PART_SIZE = 5 << 20
+
+	// Files of purged to-do list deleted per pass of the trash purge
+	ORPHAN_ATTACHMENT_BATCH = 100
+)
+
+// AttachmentStore keeps the files attached to to-do list by key, their metadata is in the attachment table
+type AttachmentStore interface {
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalStore keeps the files in a directory of the server, which must be shared by every instance
+type LocalStore struct {
+	Dir string
+}
+
+// Put writes to a temporary file first, so a failed upload never leaves a partial file under key
+func (s LocalStore) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	file, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(s.Dir, key))
+}
+
+func (s LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, key))
+}
+
+func (s LocalStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(filepath.Join(s.Dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// S3Store keeps the files in a bucket of S3 or of a compatible storage like MinIO
+type S3Store struct {
+	Client *minio.Client
+	Bucket string
+}
+
+func (s S3Store) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	_, err := s.Client.PutObject(ctx, s.Bucket, key, content, -1, minio.PutObjectOptions{ContentType: contentType, PartSize: S3_PART_SIZE})
+	return err
+}
+
+// Open checks the object exists, otherwise its error would only come with the first read
+func (s S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.Client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s S3Store) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+var errAttachmentTooLarge = errors.New("attachment is too large")
+
+// sizeLimitedReader fails once more than max bytes are read, counting them in n
+type sizeLimitedReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		return n, errAttachmentTooLarge
+	}
+	return n, err
+}
+
+// requireAttachments answers 501 when ATTACHMENT_STORAGE is not set
+func (conf *Config) requireAttachments(w http.ResponseWriter) bool {
+	if conf.Attachments == nil {
+		buildErrorResponse(w, nil, http.StatusNotImplemented, CODE_UNAVAILABLE, "attachments are disabled, ATTACHMENT_STORAGE is not set")
+		return false
+	}
+	return true
+}
+
+// attachments is the AttachmentRepository of the handlers
+func (conf *Config) attachments() *service.AttachmentRepository {
+	return &service.AttachmentRepository{DB: conf.Database}
+}
+
+// uploadAttachment stores the "file" field of a multipart form as an attachment of the to-do list. The file is streamed
+// to the store as it arrives, its content type is detected from its first bytes and must be one of ATTACHMENT_TYPES
+func (conf *Config) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if !conf.requireAttachments(w) {
+		return
+	}
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if owned, err := conf.queries().Accessible(r.Context(), currentUser(r), todoID, service.ROLE_EDITOR); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !owned {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "body must be a multipart form")
+		return
+	}
+	var part io.Reader
+	attachment := service.Attachment{}
+	for part == nil {
+		next, err := reader.NextPart()
+		if err != nil {
+			buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "file is required")
+			return
+		}
+		if next.FormName() == "file" {
+			part, attachment.Filename = next, next.FileName()
+		}
+	}
+	if attachment.Filename == "" {
+		attachment.Filename = "attachment"
+	}
+	if len(attachment.Filename) > MAX_ATTACHMENT_FILENAME_LENGTH {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("filename must not be longer than %d bytes", MAX_ATTACHMENT_FILENAME_LENGTH))
+		return
+	}
+
+	head := make([]byte, ATTACHMENT_SNIFF_LENGTH)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "reading file failed")
+		return
+	}
+	attachment.ContentType = http.DetectContentType(head[:n])
+	if mediaType, _, _ := mime.ParseMediaType(attachment.ContentType); !conf.AttachmentTypes[mediaType] {
+		buildErrorResponse(w, nil, http.StatusUnsupportedMediaType, CODE_VALIDATION_ERROR, fmt.Sprintf("file of type %s is not allowed", mediaType))
+		return
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	storageKey := hex.EncodeToString(key)
+	content := &sizeLimitedReader{r: io.MultiReader(bytes.NewReader(head[:n]), part), max: conf.MaxAttachmentSize}
+	if err := conf.Attachments.Put(r.Context(), storageKey, content, attachment.ContentType); err != nil {
+		conf.deleteAttachmentFile(r.Context(), storageKey)
+		if content.n > content.max {
+			buildErrorResponse(w, nil, http.StatusRequestEntityTooLarge, CODE_VALIDATION_ERROR, fmt.Sprintf("file must not be larger than %d bytes", conf.MaxAttachmentSize))
+			return
+		}
+		slog.ErrorContext(r.Context(), "Storing attachment failed", "error", err)
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	attachment.Size = content.n
+
+	if err := conf.attachments().Create(r.Context(), currentUser(r), todoID, &attachment, storageKey); err == service.ErrNotFound {
+		conf.deleteAttachmentFile(r.Context(), storageKey)
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		conf.deleteAttachmentFile(r.Context(), storageKey)
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, attachment, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// getAttachments lists the attachments of a to-do list of the user in the order they were uploaded
+func (conf *Config) getAttachments(w http.ResponseWriter, r *http.Request) {
+	if !conf.requireAttachments(w) {
+		return
+	}
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if owned, err := conf.queries().Accessible(r.Context(), currentUser(r), todoID, service.ROLE_VIEWER); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !owned {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	attachments, err := conf.attachments().List(r.Context(), todoID)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, attachments, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// downloadAttachment streams the file of an attachment. It is always downloaded rather than shown, so an uploaded file
+// never runs in the page of the app
+func (conf *Config) downloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if !conf.requireAttachments(w) {
+		return
+	}
+	todoID, todoOK := pathID(r, "id")
+	attachmentID, attachmentOK := pathID(r, "attachmentID")
+	if !todoOK || !attachmentOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	attachment, storageKey, err := conf.attachments().Find(r.Context(), currentUser(r), todoID, attachmentID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	file, err := conf.Attachments.Open(r.Context(), storageKey)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Opening attachment failed", "attachment_id", attachmentID, "error", err)
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, file); err != nil {
+		slog.ErrorContext(r.Context(), "Downloading attachment failed", "attachment_id", attachmentID, "error", err)
+	}
+}
+
+// deleteAttachment removes an attachment of a to-do list of the user with its file
+func (conf *Config) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	if !conf.requireAttachments(w) {
+		return
+	}
+	todoID, todoOK := pathID(r, "id")
+	attachmentID, attachmentOK := pathID(r, "attachmentID")
+	if !todoOK || !attachmentOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	storageKey, err := conf.attachments().Delete(r.Context(), currentUser(r), todoID, attachmentID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	conf.deleteAttachmentFile(r.Context(), storageKey)
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// deleteAttachmentFile only logs a failure, the file is left behind without a row pointing to it
+func (conf *Config) deleteAttachmentFile(ctx context.Context, storageKey string) {
+	if err := conf.Attachments.Delete(ctx, storageKey); err != nil {
+		slog.WarnContext(ctx, "Deleting attachment file failed", "storage_key", storageKey, "error", err)
+	}
+}
+
+// deleteOrphanAttachments deletes the files of the to-do list which were purged, whose todo_id was set to NULL. A row
+// is only deleted once its file is, so a failed deletion is retried on the next pass
+func (conf *Config) deleteOrphanAttachments(ctx context.Context) (int, error) {
+	orphans, err := conf.attachments().Orphans(ctx, ORPHAN_ATTACHMENT_BATCH)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for id, storageKey := range orphans {
+		if err := conf.Attachments.Delete(ctx, storageKey); err != nil {
+			return deleted, err
+		}
+		if err := conf.attachments().DeleteOrphan(ctx, id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
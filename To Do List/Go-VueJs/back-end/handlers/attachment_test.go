@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+// newAttachmentConfig returns a test Config storing attachments in a temporary directory
+func newAttachmentConfig(t *testing.T) (*Config, sqlmock.Sqlmock, string) {
+	t.Helper()
+
+	conf, mock := newTestConfig(t)
+	dir := t.TempDir()
+	conf.Attachments = LocalStore{Dir: dir}
+	conf.MaxAttachmentSize = 1024
+	conf.AttachmentTypes = map[string]bool{"text/plain": true, "image/png": true}
+	return conf, mock, dir
+}
+
+// sendAttachment uploads content as the file of POST /todo/1/attachments of testUserID
+func sendAttachment(t *testing.T, conf *Config, filename, content string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/todo/1/attachments", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return rec, response
+}
+
+func expectTodoAccessible(mock sqlmock.Sqlmock, role string, accessible bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM todo WHERE id = $1 AND "+service.TodoAccess("", "$2", role)+" AND deleted_at IS NULL)")).
+		WithArgs(1, testUserID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(accessible))
+}
+
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestUploadAttachment(t *testing.T) {
+	conf, mock, dir := newAttachmentConfig(t)
+	expectTodoAccessible(mock, service.ROLE_EDITOR, true)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO attachment(todo_id, filename, content_type, size, storage_key)")).
+		WithArgs(1, testUserID, "list.txt", "text/plain; charset=utf-8", int64(9), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "todo_id", "created_at"}).AddRow(4, 1, time.Now()))
+
+	_, response := sendAttachment(t, conf, "list.txt", "milk eggs")
+	checkResponse(t, response, http.StatusCreated, "")
+	var attachment service.Attachment
+	decodeData(t, response, &attachment)
+	if attachment.ID != 4 || attachment.Filename != "list.txt" || attachment.Size != 9 {
+		t.Errorf("attachment = %+v", attachment)
+	}
+	files := storedFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("stored files %v, want the upload", files)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, files[0])); string(content) != "milk eggs" {
+		t.Errorf("stored %q", content)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUploadAttachmentRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		status  int
+	}{
+		{name: "too large", content: strings.Repeat("milk ", 300), status: http.StatusRequestEntityTooLarge},
+		{name: "not allowed type", content: "<html><script>alert(1)</script></html>", status: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock, dir := newAttachmentConfig(t)
+			expectTodoAccessible(mock, service.ROLE_EDITOR, true)
+
+			_, response := sendAttachment(t, conf, "file.txt", tt.content)
+			checkResponse(t, response, tt.status, CODE_VALIDATION_ERROR)
+			if files := storedFiles(t, dir); len(files) != 0 {
+				t.Errorf("stored files %v, want none", files)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUploadAttachmentErrors(t *testing.T) {
+	conf, mock, _ := newAttachmentConfig(t)
+	expectTodoAccessible(mock, service.ROLE_EDITOR, false)
+	_, response := sendAttachment(t, conf, "list.txt", "milk")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	conf.Attachments = nil
+	_, response = sendAttachment(t, conf, "list.txt", "milk")
+	checkResponse(t, response, http.StatusNotImplemented, CODE_UNAVAILABLE)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAttachmentsOfInvalidIDs(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{method: http.MethodGet, target: "/todo/abc/attachments"},
+		{method: http.MethodGet, target: "/todo/1/attachments/abc"},
+		{method: http.MethodDelete, target: "/todo/abc/attachments/4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			conf, mock, _ := newAttachmentConfig(t)
+
+			_, response := serve(t, conf, tt.method, tt.target, "")
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	conf, mock, dir := newAttachmentConfig(t)
+	if err := os.WriteFile(filepath.Join(dir, "abc"), []byte("milk eggs"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.filename, a.content_type, a.size, a.storage_key FROM attachment a JOIN todo t")).
+		WithArgs(1, testUserID, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"filename", "content_type", "size", "storage_key"}).AddRow("list.txt", "text/plain; charset=utf-8", 9, "abc"))
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/1/attachments/4", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "milk eggs" {
+		t.Fatalf("GET = %d %q", rec.Code, rec.Body.String())
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); disposition != "attachment; filename=list.txt" {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("Content-Length") != "9" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteOrphanAttachments(t *testing.T) {
+	conf, mock, dir := newAttachmentConfig(t)
+	if err := os.WriteFile(filepath.Join(dir, "abc"), []byte("milk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, storage_key FROM attachment WHERE todo_id IS NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "storage_key"}).AddRow(4, "abc"))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM attachment WHERE id = $1")).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	deleted, err := conf.deleteOrphanAttachments(context.Background())
+	if err != nil || deleted != 1 {
+		t.Fatalf("deleteOrphanAttachments() = %d, %v", deleted, err)
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("stored files %v, want none", files)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
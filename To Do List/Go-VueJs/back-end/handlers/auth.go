@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"to-do-list/service"
+)
+
+const (
+	MIN_PASSWORD_LENGTH = 8
+	// bcrypt ignores anything past 72 bytes
+	MAX_PASSWORD_BYTES = 72
+	// Compared to the password of a login without a user, at the cost of the hashes of the registration
+	DUMMY_PASSWORD_HASH = "$2a$10$.WwEBE8QKtDKS2jGqB/GEuU0qIMxSRbG44VwfMwsfMErB0G.TwShy"
+)
+
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Optional on registration, reminders are emailed to it
+	Email string `json:"email,omitempty"`
+}
+
+type Token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Exchanged at POST /auth/refresh for new tokens, only when the server has a REFRESH_TOKEN_TTL
+	RefreshToken     string     `json:"refresh_token,omitempty"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+}
+
+type userKey struct{}
+
+// userFromContext returns the id of the user authenticated by requireUser
+func userFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userKey{}).(int)
+	return userID, ok
+}
+
+func validateCredentials(credentials Credentials) error {
+	if length := utf8.RuneCountInString(credentials.Username); length < service.MIN_USERNAME_LENGTH || length > service.MAX_USERNAME_LENGTH {
+		return fmt.Errorf("username must be between %d and %d characters", service.MIN_USERNAME_LENGTH, service.MAX_USERNAME_LENGTH)
+	}
+	if strings.TrimSpace(credentials.Username) != credentials.Username {
+		return errors.New("username must not start or end with spaces")
+	}
+	if utf8.RuneCountInString(credentials.Password) < MIN_PASSWORD_LENGTH {
+		return fmt.Errorf("password must be at least %d characters", MIN_PASSWORD_LENGTH)
+	}
+	if len(credentials.Password) > MAX_PASSWORD_BYTES {
+		return fmt.Errorf("password must be at most %d bytes", MAX_PASSWORD_BYTES)
+	}
+	if credentials.Email != "" {
+		if address, err := mail.ParseAddress(credentials.Email); err != nil || address.Address != credentials.Email {
+			return errors.New("email must be a plain address like ana@example.com")
+		}
+	}
+	return nil
+}
+
+func (conf *Config) register(w http.ResponseWriter, r *http.Request) {
+	var credentials Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	if err := validateCredentials(credentials); err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	user, err := conf.createUser(r.Context(), credentials)
+	if isUniqueViolation(err) {
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_CONFLICT, "username is taken")
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, user, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// users is the UserRepository of the handlers
+func (conf *Config) users() *service.UserRepository {
+	return &service.UserRepository{DB: conf.Database, Driver: conf.DBDriver}
+}
+
+// createUser stores a user of the validated credentials with the bcrypt hash of the password, a taken username is a
+// unique violation
+func (conf *Config) createUser(ctx context.Context, credentials Credentials) (service.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return service.User{}, err
+	}
+
+	user := service.User{Username: credentials.Username, Email: credentials.Email}
+	err = conf.users().Create(ctx, &user, string(hash))
+	return user, err
+}
+
+func (conf *Config) login(w http.ResponseWriter, r *http.Request) {
+	var credentials Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	userID, hash, err := conf.users().PasswordHash(r.Context(), credentials.Username)
+	if err != nil && err != service.ErrNotFound {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	// Unknown users and wrong passwords get the same answer, after as long a comparison. Users of an OAuth provider only
+	// have no password
+	found := err == nil && hash != ""
+	if !found {
+		hash = DUMMY_PASSWORD_HASH
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(credentials.Password)) != nil || !found {
+		buildResponse(w, nil, http.StatusUnauthorized, MESSAGE_FAILED)
+		return
+	}
+
+	token, err := conf.signIn(r, userID)
+	if err == errUserDisabled {
+		buildErrorResponse(w, nil, http.StatusForbidden, CODE_UNAUTHORIZED, err.Error())
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	buildResponse(w, token, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) issueToken(userID int, now time.Time) (Token, error) {
+	return conf.issueSessionToken(userID, 0, now)
+}
+
+// issueSessionToken is issueToken for a session, its id is the JWT ID and the token ends with it
+func (conf *Config) issueSessionToken(userID, sessionID int, now time.Time) (Token, error) {
+	expiresAt := now.Add(conf.TokenTTL)
+	claims := jwt.RegisteredClaims{
+		Subject:   fmt.Sprint(userID),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	if sessionID != 0 {
+		claims.ID = fmt.Sprint(sessionID)
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(conf.JWTSecret)
+	return Token{Token: signed, ExpiresAt: expiresAt}, err
+}
+
+// parseToken checks the signature and expiry of a token and returns its user
+func (conf *Config) parseToken(signed string) (int, error) {
+	userID, _, err := conf.parseSessionToken(signed)
+	return userID, err
+}
+
+// parseSessionToken is parseToken with the session of the token, 0 for a token without one
+func (conf *Config) parseSessionToken(signed string) (int, int, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(signed, &claims, func(token *jwt.Token) (interface{}, error) {
+		return conf.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var userID, sessionID int
+	if _, err := fmt.Sscan(claims.Subject, &userID); err != nil || userID <= 0 {
+		return 0, 0, errors.New("invalid token subject")
+	}
+	if claims.ID != "" {
+		if _, err := fmt.Sscan(claims.ID, &sessionID); err != nil || sessionID <= 0 {
+			return 0, 0, errors.New("invalid token session")
+		}
+	}
+	return userID, sessionID, nil
+}
+
+// currentUser is the user of the request, 0 when nobody is logged in which owns no to-do list
+func currentUser(r *http.Request) int {
+	userID, _ := userFromContext(r.Context())
+	return userID
+}
+
+// isPublic lists the paths reachable without logging in, under /api/v1 or not. /metrics takes the X-Admin-Key instead
+func isPublic(path string) bool {
+	path = unversionedPath(path)
+	return strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/shared/") || path == "/todo/calendar.ics" || isProbe(path) || path == "/capabilities" || path == "/openapi.json" || path == "/docs" || path == "/metrics"
+}
+
+// requireUser rejects requests without a valid "Authorization: Bearer <token>" or API key and passes the user on in
+// the context. The WebSocket at /ws may pass the token as ?access_token= instead
+func (conf *Config) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bearer := r.Header.Get("Authorization")
+		if token := r.URL.Query().Get("access_token"); bearer == "" && token != "" && unversionedPath(r.URL.Path) == "/ws" {
+			bearer = "Bearer " + token
+		}
+		var userID int
+		if key, ok := apiKeyFrom(r, bearer); ok {
+			var scope string
+			var err error
+			if userID, scope, err = conf.apiKeys().Authenticate(r.Context(), key); err == service.ErrInvalidAPIKey {
+				conf.unauthorized(w, r)
+				return
+			} else if err != nil {
+				buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+				return
+			}
+			if refusal := apiKeyRefusal(scope, r); refusal != "" {
+				buildErrorResponse(w, nil, http.StatusForbidden, CODE_UNAUTHORIZED, refusal)
+				return
+			}
+		} else {
+			if !strings.HasPrefix(bearer, "Bearer ") {
+				conf.unauthorized(w, r)
+				return
+			}
+			var (
+				sessionID int
+				err       error
+			)
+			if userID, sessionID, err = conf.parseSessionToken(strings.TrimPrefix(bearer, "Bearer ")); err != nil {
+				conf.unauthorized(w, r)
+				return
+			}
+			if err := conf.checkSession(r.Context(), userID, sessionID); err == errSessionRevoked {
+				conf.unauthorized(w, r)
+				return
+			} else if err != nil {
+				buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+				return
+			}
+		}
+		setRequestUser(r.Context(), userID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, userID)))
+	})
+}
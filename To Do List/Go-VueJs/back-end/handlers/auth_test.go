@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testJWTSecret = []byte("test-secret-of-at-least-32-bytes!!")
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "success",
+			body: `{"username":"ana","password":"correct horse","email":"ana@example.com"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users(username, password_hash, email)")).
+					WithArgs("ana", sqlmock.AnyArg(), "ana@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "invalid email",
+			body:   `{"username":"ana","password":"correct horse","email":"Ana <ana@example.com>"}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+		},
+		{
+			name:   "short password",
+			body:   `{"username":"ana","password":"short"}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+		},
+		{
+			name: "username taken",
+			body: `{"username":"ana","password":"correct horse"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users")).WillReturnError(&pq.Error{Code: "23505"})
+			},
+			status: http.StatusConflict,
+			code:   CODE_CONFLICT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodPost, "/auth/register", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	// Comparing to it takes as long as to the hash of a user, and no password matches it
+	if cost, err := bcrypt.Cost([]byte(DUMMY_PASSWORD_HASH)); err != nil || cost != bcrypt.DefaultCost {
+		t.Errorf("cost = %d, %v, want %d", cost, err, bcrypt.DefaultCost)
+	}
+	for _, password := range []string{"", "correct horse"} {
+		if err := bcrypt.CompareHashAndPassword([]byte(DUMMY_PASSWORD_HASH), []byte(password)); err != bcrypt.ErrMismatchedHashAndPassword {
+			t.Errorf("comparing %q = %v", password, err)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		found      bool
+		noPassword bool
+		disabled   bool
+		status     int
+	}{
+		{name: "success", password: "correct horse", found: true, status: http.StatusOK},
+		{name: "wrong password", password: "battery staple", found: true, status: http.StatusUnauthorized},
+		{name: "unknown user", password: "correct horse", status: http.StatusUnauthorized},
+		{name: "user of an OAuth provider", password: "", found: true, noPassword: true, status: http.StatusUnauthorized},
+		{name: "disabled", password: "correct horse", found: true, disabled: true, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			rows := sqlmock.NewRows([]string{"id", "password_hash"})
+			if tt.noPassword {
+				rows.AddRow(7, "")
+			} else if tt.found {
+				rows.AddRow(7, string(hash))
+			}
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash FROM users WHERE username = $1")).WithArgs("ana").WillReturnRows(rows)
+			if tt.found && tt.password == "correct horse" {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT disabled_at IS NOT NULL FROM users WHERE id = $1")).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(tt.disabled))
+			}
+
+			body, _ := json.Marshal(Credentials{Username: "ana", Password: tt.password})
+			_, response := serve(t, conf, http.MethodPost, "/auth/login", string(body))
+			checkResponse(t, response, tt.status, errorCode(tt.status))
+
+			if tt.status == http.StatusOK {
+				var token Token
+				decodeData(t, response, &token)
+				if userID, err := conf.parseToken(token.Token); err != nil || userID != 7 {
+					t.Errorf("token is for user %d (%v), want 7", userID, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	conf := &Config{JWTSecret: testJWTSecret, TokenTTL: time.Hour}
+	handler := conf.requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := userFromContext(r.Context())
+		buildResponse(w, userID, http.StatusOK, MESSAGE_SUCCESS)
+	}))
+
+	valid, _ := conf.issueToken(7, time.Now())
+	expired, _ := conf.issueToken(7, time.Now().Add(-2*time.Hour))
+	forged, _ := (&Config{JWTSecret: []byte("another-secret-of-at-least-32-bytes"), TokenTTL: time.Hour}).issueToken(7, time.Now())
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{name: "valid token", path: "/todo", token: valid.Token, status: http.StatusOK},
+		{name: "no token", path: "/todo", status: http.StatusUnauthorized},
+		{name: "expired token", path: "/todo", token: expired.Token, status: http.StatusUnauthorized},
+		{name: "forged token", path: "/todo", token: forged.Token, status: http.StatusUnauthorized},
+		{name: "login", path: "/auth/login", status: http.StatusOK},
+		{name: "health check", path: "/healthz", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+			}
+			if response.Status != tt.status {
+				t.Errorf("status = %d, want %d", response.Status, tt.status)
+			}
+		})
+	}
+}
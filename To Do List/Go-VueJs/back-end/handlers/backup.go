@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"to-do-list/service"
+)
+
+// isAdmin checks the X-Admin-Key header, admin endpoints are disabled when ADMIN_API_KEY is not set
+func (conf *Config) isAdmin(r *http.Request) bool {
+	key := r.Header.Get("X-Admin-Key")
+	return conf.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(conf.AdminKey)) == 1
+}
+
+// backups is the BackupRepository of the handlers
+func (conf *Config) backups() *service.BackupRepository {
+	return &service.BackupRepository{DB: conf.Database}
+}
+
+// getBackup streams every table owned by the users as one JSON document, POST /todo/import restores its to-do list
+func (conf *Config) getBackup(w http.ResponseWriter, r *http.Request) {
+	if !conf.isAdmin(r) {
+		buildResponse(w, nil, http.StatusForbidden, MESSAGE_FAILED)
+		return
+	}
+
+	snapshot, err := conf.backups().Snapshot(r.Context())
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	defer snapshot.Close()
+	version, err := snapshot.SchemaVersion(r.Context())
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=todo-backup.json")
+
+	header, _ := json.Marshal(map[string]interface{}{
+		"schema_version": version,
+		"created_at":     time.Now().UTC().Format(time.RFC3339),
+	})
+	// Reopen the header object so the tables can be appended to it
+	w.Write(header[:len(header)-1])
+
+	for _, table := range snapshot.Tables() {
+		w.Write([]byte(`,"` + table + `":[`))
+		if err := streamRows(r.Context(), w, snapshot, table); err != nil {
+			// The status is already sent, so leave a marker a restore will refuse
+			slog.ErrorContext(r.Context(), "Backup failed", "table", table, "error", err)
+			w.Write([]byte(`],"error":"backup incomplete"}`))
+			return
+		}
+		w.Write([]byte(`]`))
+	}
+	w.Write([]byte(`}`))
+}
+
+// streamRows writes each row of the table as a comma separated JSON value without buffering the table
+func streamRows(ctx context.Context, w http.ResponseWriter, snapshot *service.BackupSnapshot, table string) error {
+	written := 0
+	return snapshot.Each(ctx, table, func(value interface{}) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if written > 0 {
+			w.Write([]byte(","))
+		}
+		w.Write(data)
+		written++
+		return nil
+	})
+}
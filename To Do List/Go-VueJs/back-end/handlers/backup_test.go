@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+// backupOf dumps the to-do list of rows, owned by the user of the first column, through GET /todo/backup
+func backupOf(t *testing.T, rows *sqlmock.Rows) []byte {
+	t.Helper()
+	conf, mock := newTestConfig(t)
+	conf.AdminKey = "admin-secret"
+
+	latest, err := service.LatestSchemaVersion(service.DB_DRIVER_POSTGRES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("SET LOCAL statement_timeout = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(latest))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, " + service.TODO_COLUMNS + " FROM todo ORDER BY id")).WillReturnRows(rows)
+	mock.ExpectQuery("FROM template ORDER BY id").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "user_id"}))
+	mock.ExpectQuery("FROM template_item ORDER BY id").WillReturnRows(sqlmock.NewRows([]string{"id", "template_id", "title", "description"}))
+	for _, table := range service.BackupTables {
+		rows := sqlmock.NewRows([]string{"row_to_json"})
+		if table.Name == "users" {
+			rows.AddRow([]byte(`{"id":1,"username":"test","email":null,"created_at":"2024-01-02T10:00:00+00:00","disabled_at":null}`))
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT row_to_json(t) FROM (SELECT " + table.Columns + " FROM " + table.Name + " ")).WillReturnRows(rows)
+	}
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/backup", nil)
+	req.Header.Set("X-Admin-Key", "admin-secret")
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Body.Bytes()
+}
+
+// restore uploads the backup to POST /todo/import, as the admin when adminKey is set
+func restore(t *testing.T, conf *Config, backup []byte, adminKey string) Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "todo-backup.json")
+	part.Write(backup)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/todo/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if adminKey != "" {
+		req.Header.Set("X-Admin-Key", adminKey)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return response
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	dueDate := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+	rows := sqlmock.NewRows(append([]string{"user_id"}, todoColumns...)).
+		AddRow(testUserID, 1, "Buy milk", "", false, false, nil, SOURCE_API, 3, []byte(`{"aisle":"dairy"}`), now, now, dueDate, nil, []byte("{shop}"), service.PRIORITY_HIGH, nil, nil, nil, service.STATUS_BACKLOG, nil).
+		AddRow(2, 2, "Pay rent", "", true, false, now, SOURCE_API, 2, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_DONE, nil).
+		AddRow(99, 3, "Of a deleted user", "", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil)
+	backup := backupOf(t, rows)
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(backup, &document); err != nil {
+		t.Fatalf("backup %s: %v", backup, err)
+	}
+	for _, table := range []string{"schema_version", "todo", "template", "users", "project_member", "todo_item", "todo_comment", "todo_history", "attachment"} {
+		if _, ok := document[table]; !ok {
+			t.Errorf("backup has no %s", table)
+		}
+	}
+	var todos []service.BackupTodo
+	json.Unmarshal(document["todo"], &todos)
+	if len(todos) != 3 || todos[1].UserID == nil || *todos[1].UserID != 2 {
+		t.Fatalf("backed up %s", document["todo"])
+	}
+
+	conf, _ := newSQLiteConfig(t)
+	conf.AdminKey = "admin-secret"
+	if _, err := conf.Database.Exec("INSERT INTO users(id, username, password_hash) VALUES(2, 'other', '')"); err != nil {
+		t.Fatal(err)
+	}
+
+	response := restore(t, conf, backup, "")
+	checkResponse(t, response, http.StatusForbidden, CODE_UNAUTHORIZED)
+
+	response = restore(t, conf, backup, "admin-secret")
+	checkResponse(t, response, http.StatusOK, "")
+	var report ImportReport
+	decodeData(t, response, &report)
+	if report.Imported != 2 || report.Failed != 1 || report.Rows[2].Status != http.StatusBadRequest || report.Rows[2].Errors[0].Field != "user_id" {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// Each to-do list is back with its owner
+	_, response = serve(t, conf, http.MethodGet, "/todo", "")
+	var restored []service.Todo
+	decodeData(t, response, &restored)
+	if len(restored) != 1 || restored[0].Title != "Buy milk" || restored[0].Priority != service.PRIORITY_HIGH || restored[0].Metadata["aisle"] != "dairy" || restored[0].DueDate == nil || !restored[0].DueDate.Equal(dueDate) {
+		t.Errorf("restored %+v for the test user", restored)
+	}
+	var title string
+	var isDone bool
+	if err := conf.Database.QueryRow("SELECT title, is_done FROM todo WHERE user_id = 2").Scan(&title, &isDone); err != nil || title != "Pay rent" || !isDone {
+		t.Errorf("restored %q, %v for user 2: %v", title, isDone, err)
+	}
+
+	// A backup which failed halfway is refused
+	incomplete := append(backup[:len(backup)-1:len(backup)-1], []byte(`,"error":"backup incomplete"}`)...)
+	response = restore(t, conf, incomplete, "admin-secret")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"to-do-list/service"
+)
+
+const MAX_BATCH_SIZE = 500
+
+// Index of the item which failed a batch, the whole batch is rolled back
+type BatchError struct {
+	Index int `json:"index"`
+}
+
+type BulkResult struct {
+	Updated int `json:"updated"`
+}
+
+const (
+	OP_CREATE   = "create"
+	OP_UPDATE   = "update"
+	OP_DELETE   = "delete"
+	OP_COMPLETE = "complete"
+)
+
+// BatchOperation is one step of an operations batch, update applies Patch like PATCH /todo/{id}
+type BatchOperation struct {
+	Op    string             `json:"op"`
+	ID    int                `json:"id,omitempty"`
+	Todo  *service.Todo      `json:"todo,omitempty"`
+	Patch *service.TodoPatch `json:"patch,omitempty"`
+}
+
+type BatchOperations struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult is the outcome of one operation, failed ones are rolled back on their own
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Fields that failed validation, with Code VALIDATION_ERROR
+	Errors []service.FieldError `json:"errors,omitempty"`
+	Todo   *service.Todo        `json:"todo,omitempty"`
+}
+
+// addTodoBatch creates all the to-do list of a spreadsheet import in one transaction
+// A {"operations": [...]} body runs a mix of operations instead, see runOperations
+func (conf *Config) addTodoBatch(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		var batch BatchOperations
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch.Operations) == 0 {
+			buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+			return
+		}
+		conf.runOperations(w, r, batch.Operations)
+		return
+	}
+
+	var newTodos []service.Todo
+	if err := json.Unmarshal(body, &newTodos); err != nil || len(newTodos) == 0 {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	if len(newTodos) > MAX_BATCH_SIZE {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("batch must not have more than %d items", MAX_BATCH_SIZE))
+		return
+	}
+
+	for i := range newTodos {
+		newTodos[i].Source = SOURCE_IMPORT
+		if newTodos[i].Priority == "" {
+			newTodos[i].Priority = service.PRIORITY_MEDIUM
+		}
+		if err := service.ValidateTodo(newTodos[i]); err != nil {
+			buildValidationResponse(w, BatchError{Index: i}, err)
+			return
+		}
+	}
+
+	todos, err := conf.store().CreateAll(r.Context(), currentUser(r), newTodos)
+	var failed service.BatchItemError
+	if errors.As(err, &failed) {
+		buildResponse(w, BatchError{Index: failed.Index}, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	conf.todos().Publish(r.Context(), service.EVENT_CREATED, currentUser(r), todos...)
+
+	buildResponse(w, todos, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// runOperations runs the operations in one transaction, each within a savepoint so a failed one doesn't undo the others
+func (conf *Config) runOperations(w http.ResponseWriter, r *http.Request, operations []BatchOperation) {
+	if len(operations) > MAX_BATCH_SIZE {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("batch must not have more than %d items", MAX_BATCH_SIZE))
+		return
+	}
+
+	results := make([]BatchResult, len(operations))
+	events := make([]string, len(operations))
+	err := conf.store().InSavepoints(r.Context(), len(operations), func(tx *sql.Tx, i int) error {
+		var err error
+		results[i], events[i], err = conf.runOperation(r.Context(), tx, currentUser(r), operations[i])
+		results[i].Index, results[i].Op = i, operations[i].Op
+		if err != nil {
+			results[i].Status, results[i].Code, results[i].Error = operationError(err)
+			results[i].Errors = fieldErrors(err)
+			results[i].Todo, events[i] = nil, ""
+		}
+		return err
+	})
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	for i, event := range events {
+		if event != "" {
+			conf.todos().Publish(r.Context(), event, currentUser(r), *results[i].Todo)
+		}
+	}
+
+	buildResponse(w, results, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// runOperation runs one operation within tx, returning its result and the change event to publish on commit
+func (conf *Config) runOperation(ctx context.Context, tx *sql.Tx, userID int, operation BatchOperation) (BatchResult, string, error) {
+	switch operation.Op {
+	case OP_CREATE:
+		if operation.Todo == nil {
+			return BatchResult{}, "", service.ValidationError{Err: errors.New("create needs a todo")}
+		}
+		todo := *operation.Todo
+		todo.Source = SOURCE_API
+		if err := conf.todosInTx(tx).Create(ctx, userID, &todo); err != nil {
+			return BatchResult{}, "", err
+		}
+		return BatchResult{Status: http.StatusCreated, Todo: &todo}, service.EVENT_CREATED, nil
+
+	case OP_UPDATE, OP_COMPLETE:
+		done := true
+		patch := service.TodoPatch{IsDone: &done}
+		if operation.Op == OP_UPDATE {
+			if operation.Patch == nil {
+				return BatchResult{}, "", service.ValidationError{Err: errors.New("update needs a patch")}
+			}
+			patch = *operation.Patch
+		}
+		existingTodo, updatedTodo, err := conf.todosInTx(tx).Patch(ctx, userID, operation.ID, patch)
+		if err != nil {
+			return BatchResult{}, "", err
+		}
+		return BatchResult{Status: http.StatusOK, Todo: &updatedTodo}, service.UpdateEvent(existingTodo, updatedTodo), nil
+
+	case OP_DELETE:
+		todo, err := conf.todosInTx(tx).Delete(ctx, userID, operation.ID)
+		if err != nil {
+			return BatchResult{}, "", err
+		}
+		return BatchResult{Status: http.StatusOK, Todo: &service.Todo{ID: todo.ID}}, service.EVENT_DELETED, nil
+	}
+	return BatchResult{}, "", service.ValidationError{Err: fmt.Errorf("op must be one of %s, %s, %s or %s", OP_CREATE, OP_UPDATE, OP_DELETE, OP_COMPLETE)}
+}
+
+// operationError maps the error of an operation to what its handler would have answered
+func operationError(err error) (int, string, string) {
+	var invalid service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error()
+	case err == service.ErrTodoNotFound:
+		return http.StatusNotFound, CODE_NOT_FOUND, err.Error()
+	case err == service.ErrTodoLocked:
+		return http.StatusConflict, CODE_TODO_LOCKED, err.Error()
+	case err == service.ErrVersionConflict:
+		return http.StatusConflict, CODE_VERSION_CONFLICT, err.Error()
+	}
+	return http.StatusInternalServerError, CODE_DB_ERROR, MESSAGE_FAILED
+}
+
+func (conf *Config) completeAllTodos(w http.ResponseWriter, r *http.Request) {
+	conf.setAllDone(w, r, true)
+}
+
+func (conf *Config) incompleteAllTodos(w http.ResponseWriter, r *http.Request) {
+	conf.setAllDone(w, r, false)
+}
+
+// setAllDone marks every to-do list of the user which isn't deleted as done or not done, returning how many changed
+func (conf *Config) setAllDone(w http.ResponseWriter, r *http.Request, isDone bool) {
+	todos, err := conf.store().SetAllDone(r.Context(), currentUser(r), isDone, conf.StatusTransitions)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	// Only to-do list which changed are returned, so all of them were completed or reopened
+	event := service.EVENT_UPDATED
+	if isDone {
+		event = service.EVENT_COMPLETED
+	}
+	conf.todos().Publish(r.Context(), event, currentUser(r), todos...)
+
+	buildResponse(w, BulkResult{Updated: len(todos)}, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestSetAllDone(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		isDone  bool
+		rows    int
+		dbError error
+		status  int
+		code    string
+	}{
+		{name: "complete all", target: "/todo/complete-all", isDone: true, rows: 3, status: http.StatusOK},
+		{name: "incomplete all", target: "/todo/incomplete-all", isDone: false, rows: 2, status: http.StatusOK},
+		{name: "nothing to change", target: "/todo/complete-all", isDone: true, status: http.StatusOK},
+		{name: "database error", target: "/todo/complete-all", isDone: true, dbError: errDatabase, status: http.StatusInternalServerError, code: CODE_DB_ERROR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			mock.ExpectBegin()
+			status := service.STATUS_BACKLOG
+			if tt.isDone {
+				status = service.STATUS_DONE
+			}
+			query := mock.ExpectQuery(regexp.QuoteMeta("SELECT "+service.TODO_COLUMNS+" FROM todo WHERE is_done <> $1 AND user_id = $2 AND deleted_at IS NULL AND status = ANY($3) FOR UPDATE")).
+				WithArgs(tt.isDone, testUserID, sqlmock.AnyArg())
+			if tt.dbError != nil {
+				query.WillReturnError(tt.dbError)
+				mock.ExpectRollback()
+			} else {
+				existing, updated := sqlmock.NewRows(todoColumns), sqlmock.NewRows(todoColumns)
+				for i := 1; i <= tt.rows; i++ {
+					todoRow(existing, i, "Todo", !tt.isDone)
+					todoRow(updated, i, "Todo", tt.isDone)
+				}
+				query.WillReturnRows(existing)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET is_done = $1, status = $4")).WithArgs(tt.isDone, testUserID, sqlmock.AnyArg(), status).WillReturnRows(updated)
+				event := service.EVENT_UPDATED
+				if tt.isDone {
+					event = service.EVENT_COMPLETED
+				}
+				for i := 1; i <= tt.rows; i++ {
+					expectHistory(mock, event)
+				}
+				mock.ExpectCommit()
+				if tt.rows > 0 {
+					expectAudience(mock)
+				}
+			}
+
+			_, response := serve(t, conf, http.MethodPost, tt.target, "")
+			checkResponse(t, response, tt.status, tt.code)
+			if tt.dbError == nil {
+				var result BulkResult
+				decodeData(t, response, &result)
+				if result.Updated != tt.rows {
+					t.Errorf("updated = %d, want %d", result.Updated, tt.rows)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestBatchOperations(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT operation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo(title")).
+		WithArgs("Buy milk", "", SOURCE_API, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, testUserID, nil, nil, nil).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 5, "Buy milk", false))
+	expectHistory(mock, service.EVENT_CREATED)
+	mock.ExpectExec("RELEASE SAVEPOINT operation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT operation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET deleted_at = now()")).WithArgs(9, testUserID).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT operation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT operation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT operation").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	expectAudience(mock)
+
+	_, response := serve(t, conf, http.MethodPost, "/todo/batch", `{"operations":[{"op":"create","todo":{"title":"Buy milk"}},{"op":"delete","id":9},{"op":"archive","id":1}]}`)
+	checkResponse(t, response, http.StatusOK, "")
+
+	var results []BatchResult
+	decodeData(t, response, &results)
+	want := []struct {
+		status int
+		code   string
+	}{{http.StatusCreated, ""}, {http.StatusNotFound, CODE_NOT_FOUND}, {http.StatusBadRequest, CODE_VALIDATION_ERROR}}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %d", results, len(want))
+	}
+	for i, result := range results {
+		if result.Index != i || result.Status != want[i].status || result.Code != want[i].code {
+			t.Errorf("result %d = %+v, want status %d and code %q", i, result, want[i].status, want[i].code)
+		}
+	}
+	if results[0].Todo == nil || results[0].Todo.ID != 5 {
+		t.Errorf("created todo = %+v, want id 5", results[0].Todo)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+// isFull reports whether every slot of the broadcaster is taken, giving back the one it took otherwise
+func isFull(b *service.Broadcaster) bool {
+	release, ok := b.Subscribe()
+	if ok {
+		release()
+	}
+	return !ok
+}
+
+func TestSubscriberCap(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.Changes = service.NewBroadcaster(2)
+
+	// Long polls which wait until they are cancelled take up the slots
+	ctx, cancel := context.WithCancel(context.Background())
+	var polls sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		polls.Add(1)
+		go func() {
+			defer polls.Done()
+			req := httptest.NewRequest(http.MethodGet, "/todo?wait=1m", nil)
+			req = req.WithContext(context.WithValue(ctx, userKey{}, testUserID))
+			conf.Router.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	for deadline := time.Now().Add(time.Second); !isFull(conf.Changes); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the long polls didn't take up the slots")
+		}
+	}
+
+	for _, target := range []string{"/todo?wait=1m", "/ws"} {
+		_, response := serve(t, conf, http.MethodGet, target, "")
+		checkResponse(t, response, http.StatusServiceUnavailable, CODE_UNAVAILABLE)
+	}
+
+	// A client which went away gives back its slot
+	cancel()
+	polls.Wait()
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, ok := conf.Changes.Subscribe()
+		if !ok {
+			t.Fatalf("subscribing %d after the disconnect failed", i+1)
+		}
+		releases = append(releases, release)
+	}
+	for _, release := range releases {
+		release()
+	}
+}
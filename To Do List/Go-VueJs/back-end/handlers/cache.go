@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"to-do-list/service"
+)
+
+const (
+
+	// Time Redis gets per request before the request is served from the database
+	CACHE_REDIS_TIMEOUT = 100 * time.Millisecond
+
+	// Larger responses go to the client without being cached
+	MAX_CACHED_RESPONSE = 1 << 20
+)
+
+// ResponseCache keeps the responses of the read endpoints in Redis per user. Each user has a generation which every
+// write increments, the cached responses of older generations are no longer read and expire with their TTL
+type ResponseCache struct {
+	Client *redis.Client
+}
+
+// cachedResponse is a response as it was written by the handler, without the headers of the middlewares
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func generationKey(userID int) string {
+	return "cache:generation:" + strconv.Itoa(userID)
+}
+
+// generation is the current generation of the cached responses of userID, "0" before the first write
+func (c *ResponseCache) generation(ctx context.Context, userID int) (string, error) {
+	generation, err := c.Client.Get(ctx, generationKey(userID)).Result()
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return generation, err
+}
+
+// invalidate drops every cached response of userID. It runs after the write is committed, so a response read from the
+// database before the commit is stored under the old generation
+func (c *ResponseCache) invalidate(userID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), CACHE_REDIS_TIMEOUT)
+	defer cancel()
+	if err := c.Client.Incr(ctx, generationKey(userID)).Err(); err != nil {
+		slog.Warn("Invalidating cached responses failed", "user_id", userID, "error", err)
+	}
+}
+
+// handler serves GET requests of next from the cache and caches its 200 responses for ttl. Long polls and streams are
+// never cached, the ETag of a cached response still answers If-None-Match with 304
+func (c *ResponseCache) handler(next http.HandlerFunc, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query(); query.Has("wait") || query.Get("stream") == "true" {
+			next(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), CACHE_REDIS_TIMEOUT)
+		defer cancel()
+		userID := currentUser(r)
+		generation, err := c.generation(ctx, userID)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Response cache failed, not caching", "error", err)
+			next(w, r)
+			return
+		}
+		// The Accept header picks the format, which the URL only does with ?format=, and X-Features may change the response
+		key := "cache:" + strconv.Itoa(userID) + ":" + generation + ":" + responseFormat(w) + ":" + strings.Join(requestFeatures(r), ",") + ":" + r.URL.RequestURI()
+
+		var response cachedResponse
+		if data, err := c.Client.Get(ctx, key).Bytes(); err == nil && json.Unmarshal(data, &response) == nil {
+			w.Header().Set("X-Cache", "HIT")
+			writeCachedResponse(w, r, response)
+			return
+		}
+
+		// Without the conditional headers the handler writes the whole response, which is then cached
+		uncached := r.Clone(r.Context())
+		uncached.Header.Del("If-None-Match")
+		buffered := &bufferedResponseWriter{header: make(http.Header), status: http.StatusOK, w: w}
+		next(buffered, uncached)
+		response = cachedResponse{Status: buffered.status, Header: buffered.header, Body: buffered.body.Bytes()}
+
+		if response.Status == http.StatusOK && len(response.Body) <= MAX_CACHED_RESPONSE {
+			if data, err := json.Marshal(response); err == nil {
+				ctx, cancel := context.WithTimeout(r.Context(), CACHE_REDIS_TIMEOUT)
+				defer cancel()
+				if err := c.Client.Set(ctx, key, data, ttl).Err(); err != nil {
+					slog.WarnContext(r.Context(), "Caching response failed", "error", err)
+				}
+			}
+		}
+		w.Header().Set("X-Cache", "MISS")
+		writeCachedResponse(w, r, response)
+	}
+}
+
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, response cachedResponse) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	if etag := response.Header.Get("ETag"); etag != "" && notModified(w, r, etag) {
+		return
+	}
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
+
+// middleware invalidates the cached responses of the user after every request which may have changed its data, and
+// of everyone else told of a change meanwhile, e.g. the owner of the to-do list an editor of its project changed
+func (c *ResponseCache) middleware(changes *service.Broadcaster, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		cursor := changes.Cursor()
+		next.ServeHTTP(w, r)
+
+		invalidated := map[int]bool{0: true}
+		if userID := currentUser(r); !invalidated[userID] {
+			c.invalidate(userID)
+			invalidated[userID] = true
+		}
+		for _, event := range changes.Since(cursor, 0).Events {
+			if !invalidated[event.UserID] {
+				c.invalidate(event.UserID)
+				invalidated[event.UserID] = true
+			}
+		}
+	})
+}
+
+// FollowChanges invalidates the cached responses of the users whose to-do list changed outside of a request of theirs,
+// by the gRPC API or the recurrences, until ctx is done
+func (c *ResponseCache) FollowChanges(ctx context.Context, changes *service.Broadcaster) {
+	cursor := changes.Cursor()
+	for ctx.Err() == nil {
+		batch := changes.Wait(ctx, cursor, 0)
+		cursor = batch.Cursor
+
+		invalidated := make(map[int]bool)
+		for _, event := range batch.Events {
+			if !invalidated[event.UserID] {
+				c.invalidate(event.UserID)
+				invalidated[event.UserID] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+
+	"to-do-list/service"
+)
+
+func TestResponseCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	conf, mock := newTestConfig(t)
+	conf.Cache = &ResponseCache{Client: client}
+	conf.CacheTodoTTL = time.Minute
+	conf.Router = mux.NewRouter()
+	conf.routes()
+	handler := chain(conf.Router, conf.invalidateCache)
+
+	expectGet := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+" AND deleted_at IS NULL")).WithArgs(1, testUserID).
+			WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo_item WHERE todo_id = $1")).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}))
+	}
+	send := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/todo/1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	expectGet()
+	first := send(http.MethodGet, "")
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" || first.Header().Get("ETag") == "" {
+		t.Fatalf("first GET = %d, X-Cache %q, ETag %q", first.Code, first.Header().Get("X-Cache"), first.Header().Get("ETag"))
+	}
+
+	// Served without the database
+	second := send(http.MethodGet, "")
+	if second.Code != http.StatusOK || second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() {
+		t.Errorf("second GET = %d, X-Cache %q, body %q", second.Code, second.Header().Get("X-Cache"), second.Body.String())
+	}
+	if rec := send(http.MethodGet, first.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with the ETag = %d, want 304", rec.Code)
+	}
+
+	// The DELETE fails, the cache is invalidated anyway
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE todo SET deleted_at").WillReturnError(errDatabase)
+	mock.ExpectRollback()
+	send(http.MethodDelete, "")
+	expectGet()
+	if rec := send(http.MethodGet, ""); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET after a write = X-Cache %q, want MISS", rec.Header().Get("X-Cache"))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResponseCacheFollowsChanges(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	cache := &ResponseCache{Client: client}
+	changes := service.NewBroadcaster(service.DEFAULT_MAX_SUBSCRIBERS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.FollowChanges(ctx, changes)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Published by the gRPC API, outside of a request of the user, again until the follower has started
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		changes.Publish(service.EVENT_CREATED, testUserID, 1, nil)
+		if generation, _ := cache.generation(ctx, testUserID); generation != "0" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("change event didn't invalidate the cache")
+		}
+	}
+}
+
+func TestResponseCacheUnavailable(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	server.Close()
+
+	handler := (&ResponseCache{Client: client}).handler(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+	}, time.Minute)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/todo", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "" {
+		t.Errorf("GET without Redis = %d, X-Cache %q, want served uncached", rec.Code, rec.Header().Get("X-Cache"))
+	}
+}
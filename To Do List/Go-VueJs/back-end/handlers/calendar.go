@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"to-do-list/service"
+)
+
+const (
+	// Components of the calendar feed, events show up in every calendar app and to-dos carry the completion
+	CALENDAR_EVENT = "vevent"
+	CALENDAR_TODO  = "vtodo"
+
+	// RFC 5545 folds content lines longer than this many octets
+	ICS_LINE_LENGTH = 75
+
+	ICS_DATE_LAYOUT = "20060102"
+	ICS_TIME_LAYOUT = "20060102T150405Z"
+)
+
+// RFC 5545 ranks its priorities from 1, the highest, to 9
+var icsPriorities = map[string]int{service.PRIORITY_URGENT: 1, service.PRIORITY_HIGH: 3, service.PRIORITY_MEDIUM: 5, service.PRIORITY_LOW: 9}
+
+// calendarTokenHash is what users store of a feed token, the token is only known to the calendar app
+func calendarTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createCalendarToken creates (or replaces) the token of the calendar feed of the user, the feed URL has it because
+// calendar apps can't log in
+func (conf *Config) createCalendarToken(w http.ResponseWriter, r *http.Request) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	share := Share{Token: hex.EncodeToString(token)}
+
+	if err := conf.users().SetCalendarToken(r.Context(), currentUser(r), calendarTokenHash(share.Token)); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	share.URL = scheme + "://" + r.Host + API_V1_PREFIX + "/todo/calendar.ics?token=" + share.Token
+
+	buildResponse(w, share, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// revokeCalendarToken stops the calendar feed of the user until a new token is created
+func (conf *Config) revokeCalendarToken(w http.ResponseWriter, r *http.Request) {
+	if err := conf.users().RevokeCalendarToken(r.Context(), currentUser(r)); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getCalendar is public, the token of the feed is the permission to read. It writes the to-do list with a due date as
+// all-day events, or timed ones when the due date isn't midnight in APP_TIMEZONE, leaving out the done ones. With
+// ?component=vtodo they are to-dos instead, the done ones included as completed
+func (conf *Config) getCalendar(w http.ResponseWriter, r *http.Request) {
+	component := r.URL.Query().Get("component")
+	if component == "" {
+		component = CALENDAR_EVENT
+	}
+	if component != CALENDAR_EVENT && component != CALENDAR_TODO {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("component must be %s or %s", CALENDAR_EVENT, CALENDAR_TODO))
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	userID, err := conf.users().CalendarUser(r.Context(), calendarTokenHash(token))
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	rows, err := conf.queries().Calendar(r.Context(), userID, component == CALENDAR_TODO)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=todo.ics")
+
+	calendar := icsWriter{w: bufio.NewWriter(w)}
+	calendar.line("BEGIN", "VCALENDAR")
+	calendar.line("VERSION", "2.0")
+	calendar.line("PRODID", "-//to-do-list//calendar//EN")
+	calendar.line("CALSCALE", "GREGORIAN")
+	calendar.line("X-WR-CALNAME", icsText("To-do list"))
+	for rows.Next() {
+		conf.writeCalendarEntry(&calendar, component, r.Host, rows.Todo())
+	}
+	err = rows.Err()
+
+	// The 200 is already sent, without END:VCALENDAR the calendar app rejects the cut short feed
+	if err == nil {
+		calendar.line("END", "VCALENDAR")
+	}
+	if flushErr := calendar.w.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Writing calendar feed failed", "error", err)
+	}
+}
+
+func (conf *Config) writeCalendarEntry(calendar *icsWriter, component, host string, todo service.Todo) {
+	name := strings.ToUpper(component)
+	calendar.line("BEGIN", name)
+	calendar.line("UID", fmt.Sprintf("todo-%d@%s", todo.ID, host))
+	stamp := time.Now()
+	if todo.UpdatedAt != nil {
+		stamp = *todo.UpdatedAt
+	}
+	calendar.line("DTSTAMP", stamp.UTC().Format(ICS_TIME_LAYOUT))
+	calendar.line("LAST-MODIFIED", stamp.UTC().Format(ICS_TIME_LAYOUT))
+	calendar.line("SEQUENCE", strconv.Itoa(todo.Version))
+	calendar.line("SUMMARY", icsText(todo.Title))
+	if todo.Description != "" {
+		calendar.line("DESCRIPTION", icsText(todo.Description))
+	}
+	if len(todo.Tags) > 0 {
+		categories := make([]string, len(todo.Tags))
+		for i, tag := range todo.Tags {
+			categories[i] = icsText(tag)
+		}
+		calendar.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	if priority, ok := icsPriorities[todo.Priority]; ok {
+		calendar.line("PRIORITY", strconv.Itoa(priority))
+	}
+
+	// A due date at midnight is a day, not a time of it
+	due := todo.DueDate.In(conf.Location)
+	property := "DTSTART"
+	if component == CALENDAR_TODO {
+		property = "DUE"
+	}
+	if due.Hour() == 0 && due.Minute() == 0 && due.Second() == 0 {
+		calendar.line(property+";VALUE=DATE", due.Format(ICS_DATE_LAYOUT))
+	} else {
+		calendar.line(property, due.UTC().Format(ICS_TIME_LAYOUT))
+	}
+
+	if component == CALENDAR_TODO {
+		if todo.IsDone {
+			calendar.line("STATUS", "COMPLETED")
+			if todo.CompletedAt != nil {
+				calendar.line("COMPLETED", todo.CompletedAt.UTC().Format(ICS_TIME_LAYOUT))
+			}
+		} else {
+			calendar.line("STATUS", "NEEDS-ACTION")
+		}
+	}
+	calendar.line("END", name)
+}
+
+// icsText escapes the characters RFC 5545 gives a meaning in TEXT values
+func icsText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(value)
+}
+
+// icsWriter writes content lines ending in CRLF, folding them at ICS_LINE_LENGTH octets without splitting a character
+type icsWriter struct {
+	w *bufio.Writer
+}
+
+func (c *icsWriter) line(name, value string) {
+	line := name + ":" + value
+	limit := ICS_LINE_LENGTH
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		c.w.WriteString(line[:cut])
+		c.w.WriteString("\r\n ")
+		line = line[cut:]
+		// The space in front of a continuation counts towards its length
+		limit = ICS_LINE_LENGTH - 1
+	}
+	c.w.WriteString(line)
+	c.w.WriteString("\r\n")
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetCalendar(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	updated := time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC)
+	allDay := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	timed := time.Date(2030, 1, 3, 14, 30, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM users WHERE calendar_token_hash = $1")).WithArgs(calendarTokenHash("s3cret")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testUserID))
+	mock.ExpectQuery(regexp.QuoteMeta("AND due_date IS NOT NULL AND is_done = FALSE ORDER BY due_date, id")).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows(todoColumns).
+			AddRow(1, "Buy milk, eggs; bread", "Oat\nnot cow", false, false, nil, SOURCE_API, 3, []byte("{}"), updated, updated, allDay, nil, []byte("{shop}"), service.PRIORITY_URGENT, nil, nil, nil, service.STATUS_BACKLOG, nil).
+			AddRow(2, strings.Repeat("é", 50), "", false, false, nil, SOURCE_API, 1, []byte("{}"), updated, updated, timed, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil))
+
+	// Public, calendar apps send no credentials
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todo/calendar.ics?token=s3cret", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("GET = %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:todo-1@example.com\r\n",
+		"SEQUENCE:3\r\n",
+		`SUMMARY:Buy milk\, eggs\; bread` + "\r\n",
+		`DESCRIPTION:Oat\nnot cow` + "\r\n",
+		"PRIORITY:1\r\n",
+		"DTSTART;VALUE=DATE:20300102\r\n",
+		"DTSTART:20300103T143000Z\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("calendar has no %q:\n%s", want, body)
+		}
+	}
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > ICS_LINE_LENGTH {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+	if unfolded := strings.ReplaceAll(body, "\r\n ", ""); !strings.Contains(unfolded, "SUMMARY:"+strings.Repeat("é", 50)+"\r\n") {
+		t.Errorf("folded summary doesn't unfold to the title:\n%s", body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetCalendarTodos(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	completed := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM users WHERE calendar_token_hash = $1")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testUserID))
+	mock.ExpectQuery(regexp.QuoteMeta("AND due_date IS NOT NULL ORDER BY due_date, id")).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows(todoColumns).
+			AddRow(1, "Buy milk", "", true, false, completed, SOURCE_API, 2, []byte("{}"), completed, completed, due, nil, []byte("{}"), service.PRIORITY_LOW, nil, nil, nil, service.STATUS_DONE, nil))
+
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todo/calendar.ics?token=s3cret&component=vtodo", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"BEGIN:VTODO\r\n", "DUE;VALUE=DATE:20300102\r\n", "STATUS:COMPLETED\r\n", "COMPLETED:20300101T090000Z\r\n", "PRIORITY:9\r\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("calendar has no %q:\n%s", want, body)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetCalendarErrors(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM users WHERE calendar_token_hash = $1")).WithArgs(calendarTokenHash("revoked")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	for target, status := range map[string]int{
+		"/todo/calendar.ics":                          http.StatusNotFound,
+		"/todo/calendar.ics?token=revoked":            http.StatusNotFound,
+		"/todo/calendar.ics?token=s3cret&component=x": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != status {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, status)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateCalendarToken(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET calendar_token_hash = $2 WHERE id = $1")).WithArgs(testUserID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, response := serve(t, conf, http.MethodPost, "/todo/calendar/token", "")
+	checkResponse(t, response, http.StatusCreated, "")
+	var share Share
+	decodeData(t, response, &share)
+	if len(share.Token) != 64 || share.URL != "http://example.com/api/v1/todo/calendar.ics?token="+share.Token {
+		t.Errorf("token = %+v", share)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+
+	"to-do-list/service"
+)
+
+type Capabilities struct {
+	Timezone      string   `json:"timezone"`
+	Sources       []string `json:"sources"`
+	LockCompleted bool     `json:"lock_completed"`
+	RequireMatch  bool     `json:"require_if_match"`
+	AutoArchive   bool     `json:"auto_archive"`
+	ArchiveAfter  string   `json:"archive_after,omitempty"`
+	Backup        bool     `json:"backup"`
+	Webhooks      bool     `json:"webhooks"`
+	Attachments   bool     `json:"attachments"`
+	MaxAttachment int64    `json:"max_attachment_size,omitempty"`
+	LongPoll      bool     `json:"long_poll"`
+	MaxLongPoll   string   `json:"max_long_poll_wait"`
+	Select        bool     `json:"select"`
+	Recurrence    []string `json:"recurrence_frequencies"`
+	MaxFilterTree int      `json:"max_filter_depth"`
+	MaxPageSize   int      `json:"max_page_size"`
+	Pagination    string   `json:"pagination_style"`
+	ExportFormats []string `json:"export_formats"`
+	Features      []string `json:"features"`
+
+	// Every request needs the X-API-Key of API_KEY besides the login of the user
+	RequireAPIKey bool `json:"require_api_key"`
+
+	// Moves between statuses of STATUS_TRANSITIONS, left out when every move is allowed
+	Transitions service.StatusTransitions `json:"status_transitions,omitempty"`
+
+	// Providers of GET /auth/oauth/{provider}, left out when none is configured
+	OAuthProviders []string `json:"oauth_providers,omitempty"`
+}
+
+// getCapabilities describes the optional features enabled by the current config. The backup, the webhooks, the
+// attachments and the jobs archiving the to-do list only run on Postgres, see v1Routes and main
+func (conf *Config) getCapabilities(w http.ResponseWriter, r *http.Request) {
+	postgres := conf.DBDriver != service.DB_DRIVER_SQLITE && conf.DBDriver != service.DB_DRIVER_MYSQL
+	capabilities := Capabilities{
+		Timezone:      conf.Location.String(),
+		Sources:       []string{SOURCE_API, SOURCE_IMPORT, SOURCE_EMAIL, SOURCE_WEB, service.SOURCE_TEMPLATE, SOURCE_GRPC},
+		LockCompleted: conf.LockCompleted,
+		RequireMatch:  conf.RequireIfMatch,
+		AutoArchive:   postgres && conf.ArchiveAfter > 0,
+		Backup:        postgres && conf.AdminKey != "",
+		Webhooks:      postgres,
+		Attachments:   postgres && conf.Attachments != nil,
+		// A write timeout cutting the wait short leaves the clients polling
+		LongPoll:    conf.Changes != nil && (conf.WriteTimeout <= 0 || conf.WriteTimeout > MAX_LONG_POLL_WAIT),
+		MaxLongPoll: MAX_LONG_POLL_WAIT.String(),
+		// selectMiddleware runs on the routes of every driver
+		Select:         true,
+		Recurrence:     []string{service.FREQUENCY_DAILY, service.FREQUENCY_WEEKLY, service.FREQUENCY_MONTHLY},
+		MaxFilterTree:  service.MAX_FILTER_DEPTH,
+		MaxPageSize:    MAX_LIMIT,
+		Pagination:     conf.PaginationStyle,
+		ExportFormats:  []string{EXPORT_FORMAT_CSV, EXPORT_FORMAT_JSON},
+		Features:       featureNames(),
+		RequireAPIKey:  conf.APIKey != "",
+		Transitions:    conf.StatusTransitions,
+		OAuthProviders: conf.OAuth.names(),
+	}
+	if !postgres {
+		// GET /todo/export and its formats need Postgres
+		capabilities.ExportFormats = []string{}
+	}
+	if capabilities.Pagination == "" {
+		capabilities.Pagination = PAGINATION_STYLE_BODY
+	}
+	if capabilities.Attachments {
+		capabilities.MaxAttachment = conf.MaxAttachmentSize
+	}
+	if capabilities.AutoArchive {
+		capabilities.ArchiveAfter = conf.ArchiveAfter.String()
+	}
+
+	buildResponse(w, capabilities, http.StatusOK, MESSAGE_SUCCESS)
+}
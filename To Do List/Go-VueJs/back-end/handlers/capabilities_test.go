@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.AdminKey = "admin-secret"
+	conf.APIKey = "shared-secret"
+	var capabilities Capabilities
+	_, response := serve(t, conf, http.MethodGet, "/capabilities", "")
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &capabilities)
+	if !capabilities.Backup || !capabilities.Webhooks || capabilities.Attachments || capabilities.AutoArchive || !capabilities.LongPoll || !capabilities.RequireAPIKey {
+		t.Errorf("on Postgres %+v", capabilities)
+	}
+	if capabilities.MaxPageSize != MAX_LIMIT || len(capabilities.ExportFormats) != 2 || capabilities.Pagination != PAGINATION_STYLE_BODY {
+		t.Errorf("page size %d, export formats %v, pagination %q", capabilities.MaxPageSize, capabilities.ExportFormats, capabilities.Pagination)
+	}
+
+	// The jobs and the routes of Postgres are off on SQLite whatever the config
+	sqlite, _ := newSQLiteConfig(t)
+	sqlite.AdminKey = "admin-secret"
+	sqlite.ArchiveAfter = 24 * time.Hour
+	var portable Capabilities
+	_, response = serve(t, sqlite, http.MethodGet, "/capabilities", "")
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &portable)
+	if portable.Backup || portable.Webhooks || portable.AutoArchive || portable.RequireAPIKey || len(portable.ExportFormats) != 0 || portable.MaxPageSize != MAX_LIMIT {
+		t.Errorf("on SQLite %+v", portable)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"to-do-list/service"
+)
+
+func validateItem(item service.Item) error {
+	var errs service.FieldErrors
+	errs.CheckLength("title", item.Title, true, service.MAX_TITLE_LENGTH)
+	return errs.Err()
+}
+
+// checklists is the ChecklistRepository of the handlers
+func (conf *Config) checklists() *service.ChecklistRepository {
+	return &service.ChecklistRepository{DB: conf.Database}
+}
+
+// addItem appends an item to the checklist of a to-do list of the user
+func (conf *Config) addItem(w http.ResponseWriter, r *http.Request) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var newItem service.Item
+	if err := json.NewDecoder(r.Body).Decode(&newItem); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateItem(newItem); err != nil {
+		buildValidationResponse(w, newItem, err)
+		return
+	}
+
+	if err := conf.checklists().Add(r.Context(), currentUser(r), todoID, &newItem); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, newItem, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// updateItem replaces the title and completion of an item
+func (conf *Config) updateItem(w http.ResponseWriter, r *http.Request) {
+	todoID, todoOK := pathID(r, "id")
+	itemID, itemOK := pathID(r, "itemID")
+	if !todoOK || !itemOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var updatedItem service.Item
+	if err := json.NewDecoder(r.Body).Decode(&updatedItem); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateItem(updatedItem); err != nil {
+		buildValidationResponse(w, updatedItem, err)
+		return
+	}
+
+	if err := conf.checklists().Update(r.Context(), currentUser(r), todoID, itemID, &updatedItem); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, updatedItem, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) deleteItem(w http.ResponseWriter, r *http.Request) {
+	todoID, todoOK := pathID(r, "id")
+	itemID, itemOK := pathID(r, "itemID")
+	if !todoOK || !itemOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	deletedItem, err := conf.checklists().Delete(r.Context(), currentUser(r), todoID, itemID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, deletedItem, http.StatusOK, MESSAGE_SUCCESS)
+}
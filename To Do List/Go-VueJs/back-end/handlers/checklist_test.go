@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestAddItem(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "success",
+			body: `{"title":"Oat milk"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo_item(todo_id, title, is_done) SELECT id, $3, $4 FROM todo WHERE id = $1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR))).
+					WithArgs(1, testUserID, "Oat milk", false).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "missing title",
+			body:   `{"title":" "}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+		},
+		{
+			name: "to-do list of another user",
+			body: `{"title":"Oat milk"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo_item")).WillReturnError(sql.ErrNoRows)
+			},
+			status: http.StatusNotFound,
+			code:   CODE_NOT_FOUND,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodPost, "/todo/1/items", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestItemsOfInvalidIDs(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{method: http.MethodPost, target: "/todo/abc/items"},
+		{method: http.MethodPut, target: "/todo/1/items/abc"},
+		{method: http.MethodDelete, target: "/todo/abc/items/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, tt.method, tt.target, `{"title":"Oat milk"}`)
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+const (
+	MAX_COMMENT_LENGTH = 5000
+
+	// Relations GET /todo/{id}?include= embeds in the to-do list
+	INCLUDE_COMMENTS = "comments"
+)
+
+func validateComment(comment service.Comment) error {
+	var errs service.FieldErrors
+	errs.CheckLength("body", comment.Body, true, MAX_COMMENT_LENGTH)
+	return errs.Err()
+}
+
+// parseInclude reads the comma separated relations of ?include=, only comments is known
+func parseInclude(r *http.Request) (map[string]bool, error) {
+	include := make(map[string]bool)
+	for _, name := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		} else if name != INCLUDE_COMMENTS {
+			return nil, fmt.Errorf("include must be %s", INCLUDE_COMMENTS)
+		}
+		include[name] = true
+	}
+	return include, nil
+}
+
+// comments is the CommentRepository of the handlers
+func (conf *Config) comments() *service.CommentRepository {
+	return &service.CommentRepository{DB: conf.Database}
+}
+
+// renderComments fills in the HTML of the bodies of the comments for ?render=html
+func renderComments(comments []service.Comment) {
+	for i := range comments {
+		comments[i].BodyHTML = renderMarkdown(comments[i].Body)
+	}
+}
+
+// addComment comments on a to-do list of the user as the user, with the rendered body for ?render=html
+func (conf *Config) addComment(w http.ResponseWriter, r *http.Request) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	render, err := parseRender(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+	var input service.Comment
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	// Only the body is the client's, the author is the user
+	newComment := service.Comment{Body: input.Body}
+	if err := validateComment(newComment); err != nil {
+		buildValidationResponse(w, newComment, err)
+		return
+	}
+
+	if err := conf.comments().Add(r.Context(), currentUser(r), todoID, &newComment); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	if render {
+		newComment.BodyHTML = renderMarkdown(newComment.Body)
+	}
+
+	buildResponse(w, newComment, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// getComments lists the comments of a to-do list of the user, oldest first, with the rendered bodies for ?render=html
+func (conf *Config) getComments(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	render, err := parseRender(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	if exists, err := conf.queries().Accessible(r.Context(), currentUser(r), todoID, service.ROLE_VIEWER); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !exists {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	comments, err := conf.comments().List(r.Context(), todoID)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	if render {
+		renderComments(comments)
+	}
+
+	buildResponse(w, comments, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// deleteComment removes a comment of a to-do list of the user
+func (conf *Config) deleteComment(w http.ResponseWriter, r *http.Request) {
+	todoID, todoOK := pathID(r, "id")
+	commentID, commentOK := pathID(r, "commentID")
+	if !todoOK || !commentOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	if err := conf.comments().Delete(r.Context(), currentUser(r), todoID, commentID); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+var commentColumns = []string{"id", "todo_id", "author_id", "username", "body", "created_at"}
+
+func TestAddComment(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo_comment(todo_id, author_id, body) SELECT id, $2, $3 FROM todo WHERE id = $1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR))).
+		WithArgs(1, testUserID, "Use **oat** milk").
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(3, 1, testUserID, "ada", "Use **oat** milk", time.Now()))
+
+	_, response := serve(t, conf, http.MethodPost, "/todo/1/comments?render=html", `{"body":"Use **oat** milk","author_id":99,"body_html":"<script>"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	var comment service.Comment
+	decodeData(t, response, &comment)
+	if comment.ID != 3 || comment.AuthorID != testUserID || comment.Author != "ada" || comment.BodyHTML != "<p>Use <strong>oat</strong> milk</p>\n" {
+		t.Errorf("comment = %+v", comment)
+	}
+
+	_, response = serve(t, conf, http.MethodPost, "/todo/1/comments", `{"body":"  "}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	_, response = serve(t, conf, http.MethodPost, "/todo/abc/comments", `{"body":"Use oat milk"}`)
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetComments(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM todo WHERE id = $1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+" AND deleted_at IS NULL)")).
+		WithArgs(1, testUserID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo_comment c JOIN users u ON u.id = c.author_id WHERE c.todo_id = $1 ORDER BY c.id")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(3, 1, testUserID, "ada", "First", time.Now()).AddRow(4, 1, testUserID, "ada", "Second", time.Now()))
+
+	_, response := serve(t, conf, http.MethodGet, "/todo/1/comments", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var comments []service.Comment
+	decodeData(t, response, &comments)
+	if len(comments) != 2 || comments[0].Body != "First" || comments[0].BodyHTML != "" {
+		t.Errorf("comments = %+v", comments)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetTodoIncludeComments(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+" AND deleted_at IS NULL")).WithArgs(1, testUserID).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo_item WHERE todo_id = $1")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo_comment c")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(3, 1, testUserID, "ada", "Oat", time.Now()))
+
+	_, response := serve(t, conf, http.MethodGet, "/todo/1?include=comments", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var todo service.Todo
+	decodeData(t, response, &todo)
+	if len(todo.Comments) != 1 || todo.Comments[0].Body != "Oat" {
+		t.Errorf("comments = %+v", todo.Comments)
+	}
+
+	_, response = serve(t, conf, http.MethodGet, "/todo/1?include=attachments", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM todo_comment c USING todo t")).WithArgs(1, testUserID, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM todo_comment c USING todo t")).WithArgs(1, testUserID, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, response := serve(t, conf, http.MethodDelete, "/todo/1/comments/3", "")
+	checkResponse(t, response, http.StatusOK, "")
+	_, response = serve(t, conf, http.MethodDelete, "/todo/1/comments/4", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+	_, response = serve(t, conf, http.MethodDelete, "/todo/1/comments/abc", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
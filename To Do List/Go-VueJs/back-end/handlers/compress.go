@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Smaller responses aren't worth the gzip header and the CPU, they fit in a packet anyway
+const GZIP_MIN_SIZE = 1024
+
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+
+// compressible lists the content types worth compressing, media and archives are compressed already
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return mediaType == "application/json" || mediaType == "application/xml" || mediaType == "application/yaml" || mediaType == "application/javascript"
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, "gzip;q=0" refuses it
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// addVary lists value in the Vary header unless it is there already, a handler may have set its own
+func addVary(header http.Header, value string) {
+	for _, line := range header.Values("Vary") {
+		for _, field := range strings.Split(line, ",") {
+			if field = strings.TrimSpace(field); field == "*" || strings.EqualFold(field, value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// gzipResponseWriter holds the start of a response back until it knows whether it is large enough to compress
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	started bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	// Informational responses like 103 Early Hints go out as they come, the final one follows
+	if status < http.StatusOK {
+		gw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if gw.status != 0 {
+		return
+	}
+	gw.status = status
+	// Without a body there is nothing to compress
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		gw.start(false)
+	}
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+	if !gw.started {
+		gw.buf = append(gw.buf, p...)
+		if len(gw.buf) >= GZIP_MIN_SIZE {
+			if err := gw.start(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(p)
+	}
+	return gw.ResponseWriter.Write(p)
+}
+
+// start sends the header, with the gzip encoding when the response is large and of a compressible type, then the
+// body held back so far
+func (gw *gzipResponseWriter) start(large bool) error {
+	gw.started = true
+	header := gw.Header()
+	if large && gw.status != http.StatusPartialContent && header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		addVary(header, "Accept-Encoding")
+		// The gzipped bytes differ from the ones the strong ETag names, a weak one still matches If-None-Match and
+		// carries the version of If-Match
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		gw.gz = gzipWriters.Get().(*gzip.Writer)
+		gw.gz.Reset(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what is held back, a streamed response is compressed as it goes
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.started {
+		if gw.status == 0 {
+			gw.status = http.StatusOK
+		}
+		gw.start(true)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// close ends the response, one smaller than GZIP_MIN_SIZE goes out as it is
+func (gw *gzipResponseWriter) close() {
+	if !gw.started && gw.status != 0 {
+		gw.start(false)
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+		gzipWriters.Put(gw.gz)
+		gw.gz = nil
+	}
+}
+
+// compressMiddleware gzips the responses for clients accepting it, polling a large to-do list then downloads a fraction
+// of it. WebSocket upgrades are passed through, the connection is taken over instead of written to
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
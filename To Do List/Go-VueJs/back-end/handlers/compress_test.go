@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat("Buy milk. ", GZIP_MIN_SIZE)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		body           string
+		gzipped        bool
+	}{
+		{name: "large JSON", acceptEncoding: "gzip, deflate, br", contentType: "application/json", status: http.StatusOK, body: large, gzipped: true},
+		{name: "small JSON", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusOK, body: `{"status":200}`},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0, identity", contentType: "application/json", status: http.StatusOK, body: large},
+		{name: "no Accept-Encoding", contentType: "application/json", status: http.StatusOK, body: large},
+		{name: "binary attachment", acceptEncoding: "gzip", contentType: "image/png", status: http.StatusOK, body: large},
+		{name: "not modified", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusNotModified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				// Written in pieces, like the rows of a stream
+				for i := 0; i < len(tt.body); i += 100 {
+					w.Write([]byte(tt.body[i:min(i+100, len(tt.body))]))
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Vary = %q", vary)
+			}
+			body := rec.Body.String()
+			if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.gzipped {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.gzipped)
+			} else if gzipped {
+				reader, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(data)
+			}
+			if body != tt.body {
+				t.Errorf("body has %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestCompressMiddlewareFlush(t *testing.T) {
+	handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+		w.(http.Flusher).Flush()
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// A stream is compressed from its first flush, whatever its size
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("flushed = %v, Content-Encoding = %q", rec.Flushed, rec.Header().Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(reader); err != nil || string(data) != "data: {}\n\n" {
+		t.Errorf("body = %q (%v)", data, err)
+	}
+}
+
+func TestCompressMiddlewareETag(t *testing.T) {
+	for _, size := range []int{GZIP_MIN_SIZE, 10} {
+		handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"3-abc"`)
+			// Replaces the Vary of the middleware
+			w.Header().Set("Vary", "Accept")
+			w.Write([]byte(strings.Repeat(" ", size)))
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/todo/1", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+		want := `"3-abc"`
+		if gzipped {
+			want = `W/"3-abc"`
+		}
+		if etag := rec.Header().Get("ETag"); etag != want {
+			t.Errorf("ETag of %d bytes = %q, want %q", size, etag, want)
+		}
+		if vary := strings.Join(rec.Header().Values("Vary"), ", "); gzipped && vary != "Accept, Accept-Encoding" {
+			t.Errorf("Vary of %d bytes = %q", size, vary)
+		}
+	}
+
+	// A response already varying by Accept-Encoding doesn't list it twice
+	handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Vary", "Origin, accept-encoding")
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todo", nil))
+	if vary := rec.Header().Values("Vary"); len(vary) != 1 {
+		t.Errorf("Vary = %q", vary)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"gzip":               true,
+		"deflate, GZIP;q=.5": true,
+		"*":                  true,
+		"br":                 false,
+		"gzip;q=0":           false,
+		"gzip; q=0.000":      false,
+		"":                   false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
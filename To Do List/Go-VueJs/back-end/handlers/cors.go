@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_CORS_METHODS = "GET, POST, PUT, PATCH, DELETE"
+	DEFAULT_CORS_HEADERS = "Content-Type, Authorization, If-Match, Idempotency-Key, X-Features, X-Admin-Key, X-API-Key, X-Request-ID"
+	// Response headers the front-end reads besides the CORS-safelisted ones
+	DEFAULT_CORS_EXPOSE_HEADERS = "ETag, Last-Modified, Deprecation, Link, Idempotent-Replayed, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Content-Disposition, X-Request-ID, X-Total-Count"
+	DEFAULT_CORS_MAX_AGE        = 10 * time.Minute
+)
+
+// CORSPolicy lets the front-end on other origins call the API. Lists hold canonical header names and upper case
+// methods, a "*" origin or header allows any
+type CORSPolicy struct {
+	Origins          []string
+	methods          []string
+	headers          []string
+	exposeHeaders    string
+	maxAge           time.Duration
+	AllowCredentials bool
+}
+
+// NewCORSPolicy takes comma separated lists like CORS_ALLOW_ORIGIN and friends
+func NewCORSPolicy(origins, methods, headers, exposeHeaders string, maxAge time.Duration, allowCredentials bool) *CORSPolicy {
+	return &CORSPolicy{
+		Origins:          SplitList(origins, func(s string) string { return strings.TrimRight(s, "/") }),
+		methods:          SplitList(methods, strings.ToUpper),
+		headers:          SplitList(headers, http.CanonicalHeaderKey),
+		exposeHeaders:    strings.Join(SplitList(exposeHeaders, strings.TrimSpace), ", "),
+		maxAge:           maxAge,
+		AllowCredentials: allowCredentials,
+	}
+}
+
+func SplitList(list string, normalize func(string) string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, normalize(item))
+		}
+	}
+	return items
+}
+
+// allowsOrigin reports whether a browser on origin may call the API, a nil policy allows none
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	return p != nil && (slices.Contains(p.Origins, "*") || slices.Contains(p.Origins, origin))
+}
+
+func (p *CORSPolicy) allowsHeaders(requested string) bool {
+	if slices.Contains(p.headers, "*") {
+		return true
+	}
+	for _, header := range SplitList(requested, http.CanonicalHeaderKey) {
+		if !slices.Contains(p.headers, header) {
+			return false
+		}
+	}
+	return true
+}
+
+// middleware adds the CORS headers for allowed origins and answers their preflight requests itself, before the API
+// key and login checks a preflight can't pass. Requests of other origins get no CORS headers, so the browser blocks them
+func (p *CORSPolicy) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		header := w.Header()
+		if !slices.Contains(p.Origins, "*") {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !p.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if slices.Contains(p.Origins, "*") {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if p.exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A disallowed method or header gets the preflight answer without the allow lists, which the browser refuses
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		requested := r.Header.Get("Access-Control-Request-Headers")
+		if slices.Contains(p.methods, method) && p.allowsHeaders(requested) {
+			header.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+			if slices.Contains(p.headers, "*") {
+				header.Set("Access-Control-Allow-Headers", requested)
+			} else {
+				header.Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+			}
+			if p.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
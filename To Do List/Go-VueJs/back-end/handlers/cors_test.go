@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.APIKey = "s3cret"
+	conf.CORS = NewCORSPolicy("https://app.example.com, https://admin.example.com/", DEFAULT_CORS_METHODS, DEFAULT_CORS_HEADERS, DEFAULT_CORS_EXPOSE_HEADERS, DEFAULT_CORS_MAX_AGE, true)
+	handler := chain(conf.Router, conf.middlewares()...)
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{name: "allowed", origin: "https://app.example.com", method: "PATCH", headers: "content-type, if-match", allowed: true},
+		{name: "second origin", origin: "https://admin.example.com", method: "DELETE", allowed: true},
+		{name: "unknown origin", origin: "https://evil.example.com", method: "PATCH"},
+		{name: "method not allowed", origin: "https://app.example.com", method: "TRACE"},
+		{name: "header not allowed", origin: "https://app.example.com", method: "PUT", headers: "X-Secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Preflights carry no API key or token, they must be answered before those are checked
+			req := httptest.NewRequest(http.MethodOptions, "/todo/1", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+				t.Errorf("preflight = %d %q, want an empty 204", rec.Code, rec.Body.String())
+			}
+			allowed := rec.Header().Get("Access-Control-Allow-Methods") != ""
+			if allowed != tt.allowed {
+				t.Errorf("allowed = %t, want %t, headers %v", allowed, tt.allowed, rec.Header())
+			}
+			if tt.allowed {
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.origin {
+					t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+				}
+				if rec.Header().Get("Access-Control-Allow-Credentials") != "true" || rec.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("headers = %v, want credentials and the max age", rec.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	policy := NewCORSPolicy("*", DEFAULT_CORS_METHODS, DEFAULT_CORS_HEADERS, DEFAULT_CORS_EXPOSE_HEADERS, 0, false)
+	handler := policy.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != DEFAULT_CORS_EXPOSE_HEADERS {
+		t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, DEFAULT_CORS_EXPOSE_HEADERS)
+	}
+
+	// Same-origin and non-browser clients send no Origin and get no CORS headers
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todo", nil))
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q without an Origin", got)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	conf, _ := newTestConfig(t)
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		// /api/v1 is the server of the document, the unversioned aliases are the same paths
+		path, _ := route.GetPathTemplate()
+		path = unversionedPath(path)
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is missing from openapi.json", method, path)
+			}
+		}
+		return nil
+	})
+}
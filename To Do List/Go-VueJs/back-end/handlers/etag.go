@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"to-do-list/service"
+)
+
+// todoETag is the version followed by a hash of the encoded to-do list, which also changes when only the checklist does
+// The version in front lets the ETag be sent back as If-Match of PUT and PATCH
+func todoETag(todo service.Todo) (string, error) {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + strconv.Itoa(todo.Version) + "-" + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// todosETag is a hash of a page of to-do list and the total, which a deletion on another page still changes
+func todosETag(todos []service.Todo, total int) (string, error) {
+	data, err := json.Marshal(todos)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append(data, strconv.Itoa(total)...))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// setLastModified sets Last-Modified to the latest update of the to-do list. It only informs, If-Modified-Since isn't
+// answered with 304: to the second, and blind to checklists and deletions, it would miss changes the ETag doesn't
+func setLastModified(w http.ResponseWriter, todos ...service.Todo) {
+	var latest time.Time
+	for _, todo := range todos {
+		if todo.UpdatedAt != nil && todo.UpdatedAt.After(latest) {
+			latest = *todo.UpdatedAt
+		}
+	}
+	if !latest.IsZero() {
+		w.Header().Set("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, weak comparison as RFC 7232 asks for GET
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag and answers 304 without a body when the client already has this version
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"to-do-list/service"
+)
+
+const (
+	// Recorded events are kept this long for reconnecting clients to catch up
+	EVENT_RETENTION = 7 * 24 * time.Hour
+	// A stream checks for recorded events this often even without a wake-up
+	SSE_POLL_INTERVAL = time.Second
+	// A comment goes out after this long without events, so proxies keep the stream open
+	SSE_KEEPALIVE_INTERVAL = 15 * time.Second
+	SSE_BATCH_SIZE         = 100
+)
+
+// events is the EventRepository of the recorder and the event streams
+func (conf *Config) events() *service.EventRepository {
+	return &service.EventRepository{DB: conf.Database}
+}
+
+// RecordEvents follows the change events and stores them in todo_event for the event streams, until ctx is done
+func (conf *Config) RecordEvents(ctx context.Context) {
+	cursor := conf.Changes.Cursor()
+	var pruned time.Time
+
+	for ctx.Err() == nil {
+		changes := conf.Changes.Wait(ctx, cursor, 0)
+		cursor = changes.Cursor
+
+		for _, event := range changes.Events {
+			payload, err := json.Marshal(event.Todo)
+			if err != nil {
+				slog.Error("Encoding event payload failed", "error", err)
+				continue
+			}
+			if err := conf.events().Record(ctx, event.UserID, event.Type, event.TodoID, payload); err != nil {
+				slog.Error("Recording event failed", "error", err)
+			}
+		}
+
+		if time.Since(pruned) > time.Hour {
+			if err := conf.events().Prune(ctx, time.Now().Add(-EVENT_RETENTION)); err != nil {
+				slog.Error("Pruning events failed", "error", err)
+			}
+			pruned = time.Now()
+		}
+	}
+	slog.Info("Event recorder stopped")
+}
+
+// streamTodoEvents sends the recorded change events of the user as Server-Sent Events
+// A reconnecting client gets the events after its Last-Event-ID first, without one the stream starts from now
+func (conf *Config) streamTodoEvents(w http.ResponseWriter, r *http.Request) {
+	userID := currentUser(r)
+
+	var (
+		lastID int64
+		err    error
+	)
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if lastID, err = strconv.ParseInt(v, 10, 64); err != nil || lastID < 0 {
+			buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "Last-Event-ID must be an event id")
+			return
+		}
+	} else if lastID, err = conf.events().LastID(r.Context(), userID); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	release, ok := conf.Changes.Subscribe()
+	if !ok {
+		buildResponse(w, nil, http.StatusServiceUnavailable, MESSAGE_FAILED)
+		return
+	}
+	defer release()
+
+	// The stream outlives the server's write timeout
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	ctx := r.Context()
+	cursor := conf.Changes.Cursor()
+	lastWrite := time.Now()
+	for ctx.Err() == nil {
+		sent, err := conf.writeTodoEvents(ctx, w, userID, &lastID)
+		if err == nil && sent == 0 && time.Since(lastWrite) >= SSE_KEEPALIVE_INTERVAL {
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+			sent = 1
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Event stream failed", "error", err)
+			}
+			return
+		}
+		if sent > 0 {
+			controller.Flush()
+			lastWrite = time.Now()
+		}
+		// A full batch means more are waiting
+		if sent == SSE_BATCH_SIZE {
+			continue
+		}
+
+		// The recorder stores an event shortly after it's published, so the wait is bounded
+		wait, stop := context.WithTimeout(ctx, SSE_POLL_INTERVAL)
+		cursor = conf.Changes.Wait(wait, cursor, userID).Cursor
+		stop()
+	}
+}
+
+// writeTodoEvents writes the next batch of recorded events after lastID and advances it
+func (conf *Config) writeTodoEvents(ctx context.Context, w http.ResponseWriter, userID int, lastID *int64) (int, error) {
+	events, err := conf.events().After(ctx, userID, *lastID, SSE_BATCH_SIZE)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, event := range events {
+		payload := event.Payload
+		// Recorded as the to-do list are stored, the setting of the timestamps applies as the events are sent
+		if conf.NullTimestamps {
+			if payload, err = marshalResponse(json.RawMessage(payload), true); err != nil {
+				return sent, err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload); err != nil {
+			return sent, err
+		}
+		*lastID = event.ID
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestStreamTodoEvents(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	query := regexp.QuoteMeta("SELECT id, type, payload FROM todo_event WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3")
+	mock.ExpectQuery(query).
+		WithArgs(testUserID, 41, SSE_BATCH_SIZE).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "payload"}).
+			AddRow(42, service.EVENT_CREATED, []byte(`{"id":7}`)).
+			AddRow(43, service.EVENT_COMPLETED, []byte(`{"id":7,"is_done":true}`)))
+	// The stream ends on the next failed poll
+	mock.ExpectQuery(query).WithArgs(testUserID, 43, SSE_BATCH_SIZE).WillReturnError(errors.New("connection lost"))
+
+	req := httptest.NewRequest("GET", "/todo/events", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	want := "id: 42\nevent: created\ndata: {\"id\":7}\n\nid: 43\nevent: completed\ndata: {\"id\":7,\"is_done\":true}\n\n"
+	if rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamTodoEventsInvalidLastEventID(t *testing.T) {
+	conf, _ := newTestConfig(t)
+
+	req := httptest.NewRequest("GET", "/todo/events", nil)
+	req.Header.Set("Last-Event-ID", "latest")
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+}
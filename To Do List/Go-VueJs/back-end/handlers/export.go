@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"to-do-list/service"
+)
+
+var exportHeader = []string{"id", "title", "description", "is_done", "priority", "tags", "due_date", "completed_at", "created_at", "updated_at"}
+
+const (
+	EXPORT_FORMAT_CSV  = "csv"
+	EXPORT_FORMAT_JSON = "json"
+)
+
+var exportContentTypes = map[string]string{
+	EXPORT_FORMAT_CSV:  "text/csv; charset=utf-8",
+	EXPORT_FORMAT_JSON: "application/json",
+}
+
+// exportTodos writes the to-do list selected by the same filters as GET /todo as a CSV file, or with ?format=json as a
+// JSON array of the to-do list. The rows are written as they are read, the file is never held in memory
+func (conf *Config) exportTodos(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = EXPORT_FORMAT_CSV
+	}
+	if format != EXPORT_FORMAT_CSV && format != EXPORT_FORMAT_JSON {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("format must be %s or %s", EXPORT_FORMAT_CSV, EXPORT_FORMAT_JSON))
+		return
+	}
+	filter, err := conf.parseListFilter(r)
+	if err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	sort, err := parseSort(r)
+	if err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	rows, err := conf.queries().Select(r.Context(), filter, sort)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", "attachment; filename=todos."+format)
+	err = conf.writeExport(w, format, rows)
+
+	// The 200 is already sent, so the file is just cut short
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Exporting to-do list failed", "format", format, "error", err)
+	}
+}
+
+// writeExport writes the to-do list of rows in the format, to the response or to the file of the export command
+func (conf *Config) writeExport(w io.Writer, format string, rows *service.TodoRows) error {
+	if format == EXPORT_FORMAT_JSON {
+		return writeJSONExport(w, rows, conf.NullTimestamps)
+	}
+	return conf.writeCSVExport(w, rows)
+}
+
+func (conf *Config) writeCSVExport(w io.Writer, rows *service.TodoRows) error {
+	writer := csv.NewWriter(w)
+	writer.Write(exportHeader)
+	for rows.Next() {
+		todo := rows.Todo()
+		writer.Write([]string{
+			strconv.Itoa(todo.ID),
+			todo.Title,
+			todo.Description,
+			strconv.FormatBool(todo.IsDone),
+			todo.Priority,
+			strings.Join(todo.Tags, ";"),
+			conf.formatExportTime(todo.DueDate),
+			conf.formatExportTime(todo.CompletedAt),
+			conf.formatExportTime(todo.CreatedAt),
+			conf.formatExportTime(todo.UpdatedAt),
+		})
+	}
+	err := rows.Err()
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	return err
+}
+
+// writeJSONExport writes the to-do list as they are in the responses of the API, without the envelope. A failure leaves
+// the array unterminated, so a cut short file doesn't parse
+func writeJSONExport(w io.Writer, rows *service.TodoRows, nullTimestamps bool) error {
+	buffered := bufio.NewWriter(w)
+	buffered.WriteString("[")
+	for i := 0; rows.Next(); i++ {
+		data, err := marshalResponse(rows.Todo(), nullTimestamps)
+		if err != nil {
+			buffered.Flush()
+			return err
+		}
+		if i > 0 {
+			buffered.WriteString(",")
+		}
+		buffered.WriteString("\n")
+		buffered.Write(data)
+	}
+	if err := rows.Err(); err != nil {
+		buffered.Flush()
+		return err
+	}
+	buffered.WriteString("\n]\n")
+	return buffered.Flush()
+}
+
+func (conf *Config) formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(conf.Location).Format(time.RFC3339)
+}
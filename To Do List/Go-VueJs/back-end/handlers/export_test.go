@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestExportTodos(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	rows := sqlmock.NewRows(todoColumns).
+		AddRow(1, "Groceries", `milk, eggs and "good" bread`, false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{home,errands}"), service.PRIORITY_HIGH, nil, nil, nil, service.STATUS_BACKLOG, nil)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND is_done = $2 AND archived = FALSE ORDER BY position IS NULL, position, id")).
+		WithArgs(testUserID, false).
+		WillReturnRows(rows)
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/export?is_done=false", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=todos.csv" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want header and one row", len(records))
+	}
+	row := records[1]
+	if row[2] != `milk, eggs and "good" bread` {
+		t.Errorf("description = %q, want it to survive the comma and quotes", row[2])
+	}
+	if row[5] != "home;errands" {
+		t.Errorf("tags = %q", row[5])
+	}
+	if row[8] != "2024-03-01T09:30:00Z" {
+		t.Errorf("created_at = %q", row[8])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportTodosJSON(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	rows := sqlmock.NewRows(todoColumns)
+	todoRow(rows, 1, "Groceries", false)
+	todoRow(rows, 2, "Call mum", true)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND archived = FALSE ORDER BY position IS NULL, position, id")).
+		WithArgs(testUserID).
+		WillReturnRows(rows)
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/export?format=json", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=todos.json" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	var todos []service.Todo
+	if err := json.Unmarshal(rec.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	if len(todos) != 2 || todos[0].Title != "Groceries" || !todos[1].IsDone || len(todos[0].Tags) != 1 {
+		t.Errorf("exported %+v", todos)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	_, response := serve(t, conf, http.MethodGet, "/todo/export?format=xml", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+}
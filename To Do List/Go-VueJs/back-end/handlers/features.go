@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Flags of the X-Features header
+const (
+	// GET /todo also sends the total of the list in the X-Total-Count header, for clients paging by the headers
+	FEATURE_TOTAL_COUNT = "total-count"
+)
+
+// Only registered flags are honored, with a short description of what they change
+var registeredFeatures = map[string]string{
+	FEATURE_TOTAL_COUNT: "GET /todo sends the total of the list in the X-Total-Count header",
+}
+
+// hasFeature reports whether the request opted into a registered flag
+func hasFeature(r *http.Request, name string) bool {
+	return slices.Contains(requestFeatures(r), name)
+}
+
+// requestFeatures lists the registered flags the request opted into, sorted, the unknown names are ignored
+func requestFeatures(r *http.Request) []string {
+	var features []string
+	for _, header := range r.Header.Values("X-Features") {
+		for _, flag := range strings.Split(header, ",") {
+			name := strings.ToLower(strings.TrimSpace(flag))
+			if _, ok := registeredFeatures[name]; ok && !slices.Contains(features, name) {
+				features = append(features, name)
+			}
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+func featureNames() []string {
+	names := make([]string, 0, len(registeredFeatures))
+	for name := range registeredFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
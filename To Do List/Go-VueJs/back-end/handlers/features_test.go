@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHasFeature(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    bool
+	}{
+		{name: "no header"},
+		{name: "on", headers: []string{FEATURE_TOTAL_COUNT}, want: true},
+		{name: "among others", headers: []string{"bogus, Total-Count "}, want: true},
+		{name: "second header", headers: []string{"bogus", FEATURE_TOTAL_COUNT}, want: true},
+		{name: "unknown only", headers: []string{"bogus,new-shape"}},
+		{name: "prefix", headers: []string{"total"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+			for _, header := range tt.headers {
+				req.Header.Add("X-Features", header)
+			}
+			if got := hasFeature(req, FEATURE_TOTAL_COUNT); got != tt.want {
+				t.Errorf("hasFeature = %v, want %v", got, tt.want)
+			}
+			if hasFeature(req, "bogus") {
+				t.Error("honored the unregistered bogus flag")
+			}
+		})
+	}
+}
+
+func TestTotalCountFeature(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	for _, title := range []string{"Buy milk", "Pay rent", "Call mum"} {
+		_, response := serve(t, conf, http.MethodPost, "/todo", `{"title":"`+title+`"}`)
+		checkResponse(t, response, http.StatusCreated, "")
+	}
+
+	tests := []struct {
+		name     string
+		features string
+		want     string
+	}{
+		{name: "off"},
+		{name: "on", features: FEATURE_TOTAL_COUNT, want: "3"},
+		{name: "unknown", features: "bogus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todo?limit=2", nil)
+			if tt.features != "" {
+				req.Header.Set("X-Features", tt.features)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+			rec := httptest.NewRecorder()
+			conf.Router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK || rec.Header().Get("X-Total-Count") != tt.want {
+				t.Errorf("status %d, X-Total-Count %q, want %q", rec.Code, rec.Header().Get("X-Total-Count"), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Vite names the files of assets/ after their hash, a changed file gets a new name
+const FRONTEND_ASSETS_DIR = "assets/"
+
+// isFrontendPath reports whether the path may be a file or a client-side route of the app. The paths under /api
+// never are, an unknown one is a 404 of the API rather than the app
+func isFrontendPath(path string) bool {
+	return path != "/api" && !strings.HasPrefix(path, "/api/")
+}
+
+// frontend serves the app for the GET requests no route of the API matches, before the authentication: the files are
+// public, the app calls the API with the token of the user. The unversioned aliases of the API win over client-side
+// routes of the same path
+func (r *Config) frontend(next http.Handler) http.Handler {
+	if r.Frontend == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if (req.Method != http.MethodGet && req.Method != http.MethodHead) || !isFrontendPath(req.URL.Path) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		// A path of the API with another method matches too, its 405 is left to the router
+		var match mux.RouteMatch
+		if r.Router.Match(req, &match) && match.MatchErr != mux.ErrNotFound {
+			next.ServeHTTP(w, req)
+			return
+		}
+		r.serveFrontend(w, req)
+	})
+}
+
+// serveFrontend answers with the file of the path, or index.html for a client-side route. A missing file with an
+// extension is a 404, a stale page asking for the assets of an old build mustn't get HTML instead
+func (r *Config) serveFrontend(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(path.Clean(req.URL.Path), "/")
+	if file, ok := openFrontendFile(r.Frontend, name); ok {
+		defer file.Close()
+		if strings.HasPrefix(name, FRONTEND_ASSETS_DIR) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		serveFrontendFile(w, req, name, file)
+		return
+	}
+	if path.Ext(name) != "" {
+		http.NotFound(w, req)
+		return
+	}
+
+	file, ok := openFrontendFile(r.Frontend, "index.html")
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	defer file.Close()
+	// Revalidated, so a deployment reaches the browsers on their next page load
+	w.Header().Set("Cache-Control", "no-cache")
+	serveFrontendFile(w, req, "index.html", file)
+}
+
+// openFrontendFile opens a regular file of the app, the root and dotfiles like the .gitkeep of the build directory
+// aren't files of the app
+func openFrontendFile(fsys fs.FS, name string) (fs.File, bool) {
+	if name == "" || name == "." || strings.HasPrefix(path.Base(name), ".") {
+		return nil, false
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil, false
+	}
+	return file, true
+}
+
+// serveFrontendFile writes the file with the Content-Type of its name, answering Range and conditional requests. The
+// files of embed.FS and os.DirFS seek
+func serveFrontendFile(w http.ResponseWriter, req *http.Request, name string, file fs.File) {
+	info, err := file.Stat()
+	seeker, ok := file.(io.ReadSeeker)
+	if err != nil || !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, req, name, info.ModTime(), seeker)
+}
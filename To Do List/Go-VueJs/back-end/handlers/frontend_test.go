@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFrontend(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.APIKey = "s3cret"
+	conf.Frontend = fstest.MapFS{
+		"index.html":           {Data: []byte("<!doctype html><div id=app></div>")},
+		"favicon.ico":          {Data: []byte("icon")},
+		"assets/index-4f2a.js": {Data: []byte("console.log('app')")},
+		".gitkeep":             {},
+	}
+	handler := chain(conf.Router, conf.middlewares()...)
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		status       int
+		body         string
+		cacheControl string
+	}{
+		{name: "root", target: "/", status: http.StatusOK, body: "<!doctype html>", cacheControl: "no-cache"},
+		{name: "client-side route", target: "/projects/3/board", status: http.StatusOK, body: "<!doctype html>", cacheControl: "no-cache"},
+		{name: "asset", target: "/assets/index-4f2a.js", status: http.StatusOK, body: "console.log", cacheControl: "public, max-age=31536000, immutable"},
+		{name: "file", target: "/favicon.ico", status: http.StatusOK, body: "icon"},
+		{name: "missing asset", target: "/assets/index-0000.js", status: http.StatusNotFound},
+		{name: "dotfile", target: "/.gitkeep", status: http.StatusNotFound},
+		// The API keeps its authentication, the API_KEY is missing
+		{name: "unknown path of the API", target: "/api/v1/nope", status: http.StatusUnauthorized},
+		{name: "route of the API", target: "/api/v1/todo", status: http.StatusUnauthorized},
+		{name: "other method", method: http.MethodPost, target: "/projects/3/board", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.body != "" && !strings.HasPrefix(rec.Body.String(), tt.body) {
+				t.Errorf("body = %q", rec.Body.String())
+			}
+			if tt.body == "" && strings.Contains(rec.Body.String(), "<div id=app>") {
+				t.Error("the app answered")
+			}
+			if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", cacheControl, tt.cacheControl)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+
+	"to-do-list/service"
+)
+
+// Nested queries deeper than this are rejected, e.g. project → todos → tags → todos → project
+const MAX_GRAPHQL_DEPTH = 8
+
+const graphqlSchema = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	scalar Time
+
+	type Query {
+		todos(isDone: Boolean, projectId: Int, tag: String, limit: Int = 20, offset: Int = 0): [Todo!]!
+		todo(id: Int!): Todo
+		tags: [Tag!]!
+		projects: [Project!]!
+		project(id: Int!): Project
+	}
+
+	type Mutation {
+		createTodo(input: TodoInput!): Todo!
+		setTodoDone(id: Int!, isDone: Boolean!): Todo
+		deleteTodo(id: Int!): Boolean!
+		createProject(name: String!): Project!
+	}
+
+	input TodoInput {
+		title: String!
+		description: String
+		priority: String
+		dueDate: Time
+		tags: [String!]
+		projectId: Int
+	}
+
+	type Todo {
+		id: Int!
+		title: String!
+		description: String!
+		isDone: Boolean!
+		status: String!
+		priority: String!
+		dueDate: Time
+		completedAt: Time
+		createdAt: Time
+		updatedAt: Time
+		tags: [Tag!]!
+		project: Project
+		items: [Item!]!
+	}
+
+	type Item {
+		id: Int!
+		title: String!
+		isDone: Boolean!
+	}
+
+	type Tag {
+		name: String!
+		count: Int!
+		todos: [Todo!]!
+	}
+
+	type Project {
+		id: Int!
+		name: String!
+		createdAt: Time
+		todos(isDone: Boolean): [Todo!]!
+	}
+`
+
+// graphqlHandler serves the schema over POST /graphql, the resolvers read the user from the request context
+func (conf *Config) graphqlHandler() http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{conf: conf}, graphql.MaxDepth(MAX_GRAPHQL_DEPTH))
+	return &relay.Handler{Schema: schema}
+}
+
+// graphqlFailed logs a database error and hides it from the client
+func graphqlFailed(err error) error {
+	slog.Error("GraphQL query failed", "error", err)
+	return errors.New(MESSAGE_FAILED)
+}
+
+func graphqlTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+type graphqlResolver struct {
+	conf *Config
+}
+
+// findTodos returns the to-do list of the user matching the filter
+func (conf *Config) findTodos(ctx context.Context, filter service.OwnFilter, limit, offset int32) ([]*todoResolver, error) {
+	userID, _ := userFromContext(ctx)
+	found, err := conf.queries().Own(ctx, userID, filter, int(limit), int(offset))
+	if err != nil {
+		return nil, graphqlFailed(err)
+	}
+
+	todos := make([]*todoResolver, len(found))
+	for i := range found {
+		todos[i] = &todoResolver{conf: conf, todo: found[i]}
+	}
+	return todos, nil
+}
+
+func (g *graphqlResolver) Todos(ctx context.Context, args struct {
+	IsDone    *bool
+	ProjectID *int32
+	Tag       *string
+	Limit     int32
+	Offset    int32
+}) ([]*todoResolver, error) {
+	if args.Limit < 1 || args.Limit > MAX_LIMIT || args.Offset < 0 {
+		return nil, fmt.Errorf("limit must be between 1 and %d and offset not negative", MAX_LIMIT)
+	}
+
+	filter := service.OwnFilter{IsDone: args.IsDone, Tag: args.Tag}
+	if args.ProjectID != nil {
+		projectID := int(*args.ProjectID)
+		filter.ProjectID = &projectID
+	}
+	return g.conf.findTodos(ctx, filter, args.Limit, args.Offset)
+}
+
+func (g *graphqlResolver) Todo(ctx context.Context, args struct{ ID int32 }) (*todoResolver, error) {
+	id := int(args.ID)
+	todos, err := g.conf.findTodos(ctx, service.OwnFilter{ID: &id}, 1, 0)
+	if err != nil || len(todos) == 0 {
+		return nil, err
+	}
+	return todos[0], nil
+}
+
+func (g *graphqlResolver) Tags(ctx context.Context) ([]*tagResolver, error) {
+	userID, _ := userFromContext(ctx)
+	counts, err := g.conf.queries().Tags(ctx, userID)
+	if err != nil {
+		return nil, graphqlFailed(err)
+	}
+
+	tags := make([]*tagResolver, len(counts))
+	for i := range counts {
+		count := int32(counts[i].Count)
+		tags[i] = &tagResolver{conf: g.conf, name: counts[i].Name, count: &count}
+	}
+	return tags, nil
+}
+
+func (g *graphqlResolver) Projects(ctx context.Context) ([]*projectResolver, error) {
+	userID, _ := userFromContext(ctx)
+	owned, err := g.conf.projects().List(ctx, userID)
+	if err != nil {
+		return nil, graphqlFailed(err)
+	}
+
+	projects := make([]*projectResolver, len(owned))
+	for i := range owned {
+		projects[i] = &projectResolver{conf: g.conf, project: owned[i]}
+	}
+	return projects, nil
+}
+
+func (g *graphqlResolver) Project(ctx context.Context, args struct{ ID int32 }) (*projectResolver, error) {
+	return g.conf.findProject(ctx, int(args.ID))
+}
+
+// findProject returns the project of the user, nil when there is none
+func (conf *Config) findProject(ctx context.Context, id int) (*projectResolver, error) {
+	userID, _ := userFromContext(ctx)
+	project, err := conf.projects().GetOwned(ctx, userID, id)
+	if err == service.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, graphqlFailed(err)
+	}
+	return &projectResolver{conf: conf, project: project}, nil
+}
+
+type todoInput struct {
+	Title       string
+	Description *string
+	Priority    *string
+	DueDate     *graphql.Time
+	Tags        *[]string
+	ProjectID   *int32
+}
+
+func (g *graphqlResolver) CreateTodo(ctx context.Context, args struct{ Input todoInput }) (*todoResolver, error) {
+	userID, _ := userFromContext(ctx)
+	todo := service.Todo{Title: args.Input.Title, Source: SOURCE_API, Priority: service.PRIORITY_MEDIUM}
+	if args.Input.Description != nil {
+		todo.Description = *args.Input.Description
+	}
+	if args.Input.Priority != nil {
+		todo.Priority = *args.Input.Priority
+	}
+	if args.Input.DueDate != nil {
+		todo.DueDate = &args.Input.DueDate.Time
+	}
+	if args.Input.Tags != nil {
+		todo.Tags = service.Tags(*args.Input.Tags)
+	}
+	if args.Input.ProjectID != nil {
+		projectID := int(*args.Input.ProjectID)
+		todo.ProjectID = &projectID
+	}
+
+	var invalid service.ValidationError
+	if err := g.conf.todos().Create(ctx, userID, &todo); errors.As(err, &invalid) {
+		return nil, err
+	} else if err != nil {
+		return nil, graphqlFailed(err)
+	}
+	return &todoResolver{conf: g.conf, todo: todo}, nil
+}
+
+// SetTodoDone completes or reopens the to-do list, nil when the user has no such to-do list
+func (g *graphqlResolver) SetTodoDone(ctx context.Context, args struct {
+	ID     int32
+	IsDone bool
+}) (*todoResolver, error) {
+	userID, _ := userFromContext(ctx)
+	todo, err := g.conf.todos().SetDone(ctx, userID, int(args.ID), args.IsDone)
+	if err == service.ErrTodoNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, graphqlFailed(err)
+	}
+	return &todoResolver{conf: g.conf, todo: todo}, nil
+}
+
+// DeleteTodo soft deletes the to-do list like DELETE /todo/{id}, false when the user has no such to-do list
+func (g *graphqlResolver) DeleteTodo(ctx context.Context, args struct{ ID int32 }) (bool, error) {
+	userID, _ := userFromContext(ctx)
+	if _, err := g.conf.todos().Delete(ctx, userID, int(args.ID)); err == service.ErrTodoNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, graphqlFailed(err)
+	}
+	return true, nil
+}
+
+func (g *graphqlResolver) CreateProject(ctx context.Context, args struct{ Name string }) (*projectResolver, error) {
+	userID, _ := userFromContext(ctx)
+	project := service.Project{Name: args.Name}
+	if err := validateProject(project); err != nil {
+		return nil, err
+	}
+	if err := g.conf.projects().Create(ctx, userID, &project); err != nil {
+		return nil, graphqlFailed(err)
+	}
+	return &projectResolver{conf: g.conf, project: project}, nil
+}
+
+type todoResolver struct {
+	conf *Config
+	todo service.Todo
+}
+
+func (t *todoResolver) ID() int32                  { return int32(t.todo.ID) }
+func (t *todoResolver) Title() string              { return t.todo.Title }
+func (t *todoResolver) Description() string        { return t.todo.Description }
+func (t *todoResolver) IsDone() bool               { return t.todo.IsDone }
+func (t *todoResolver) Status() string             { return t.todo.Status }
+func (t *todoResolver) Priority() string           { return t.todo.Priority }
+func (t *todoResolver) DueDate() *graphql.Time     { return graphqlTime(t.todo.DueDate) }
+func (t *todoResolver) CompletedAt() *graphql.Time { return graphqlTime(t.todo.CompletedAt) }
+func (t *todoResolver) CreatedAt() *graphql.Time   { return graphqlTime(t.todo.CreatedAt) }
+func (t *todoResolver) UpdatedAt() *graphql.Time   { return graphqlTime(t.todo.UpdatedAt) }
+
+func (t *todoResolver) Tags() []*tagResolver {
+	tags := make([]*tagResolver, len(t.todo.Tags))
+	for i, name := range t.todo.Tags {
+		tags[i] = &tagResolver{conf: t.conf, name: name}
+	}
+	return tags
+}
+
+func (t *todoResolver) Project(ctx context.Context) (*projectResolver, error) {
+	if t.todo.ProjectID == nil {
+		return nil, nil
+	}
+	return t.conf.findProject(ctx, *t.todo.ProjectID)
+}
+
+// Items are the checklist of the to-do list
+func (t *todoResolver) Items(ctx context.Context) ([]*itemResolver, error) {
+	checklist, err := t.conf.checklists().Load(ctx, t.todo.ID)
+	if err != nil {
+		return nil, graphqlFailed(err)
+	}
+	items := make([]*itemResolver, len(checklist.Items))
+	for i := range checklist.Items {
+		items[i] = &itemResolver{item: checklist.Items[i]}
+	}
+	return items, nil
+}
+
+type itemResolver struct {
+	item service.Item
+}
+
+func (i *itemResolver) ID() int32     { return int32(i.item.ID) }
+func (i *itemResolver) Title() string { return i.item.Title }
+func (i *itemResolver) IsDone() bool  { return i.item.IsDone }
+
+type tagResolver struct {
+	conf *Config
+	name string
+
+	// Known when listed by Query.tags, counted on demand otherwise
+	count *int32
+}
+
+func (t *tagResolver) Name() string { return t.name }
+
+func (t *tagResolver) Count(ctx context.Context) (int32, error) {
+	if t.count != nil {
+		return *t.count, nil
+	}
+	userID, _ := userFromContext(ctx)
+	count, err := t.conf.queries().TagCount(ctx, userID, t.name)
+	if err != nil {
+		return 0, graphqlFailed(err)
+	}
+	return int32(count), nil
+}
+
+func (t *tagResolver) Todos(ctx context.Context) ([]*todoResolver, error) {
+	return t.conf.findTodos(ctx, service.OwnFilter{Tag: &t.name}, MAX_LIMIT, 0)
+}
+
+type projectResolver struct {
+	conf    *Config
+	project service.Project
+}
+
+func (p *projectResolver) ID() int32                { return int32(p.project.ID) }
+func (p *projectResolver) Name() string             { return p.project.Name }
+func (p *projectResolver) CreatedAt() *graphql.Time { return graphqlTime(p.project.CreatedAt) }
+
+func (p *projectResolver) Todos(ctx context.Context, args struct{ IsDone *bool }) ([]*todoResolver, error) {
+	return p.conf.findTodos(ctx, service.OwnFilter{ProjectID: &p.project.ID, IsDone: args.IsDone}, MAX_LIMIT, 0)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// serveGraphQL posts the query as testUserID and decodes the GraphQL response
+func serveGraphQL(t *testing.T, conf *Config, query string) (data map[string]interface{}, errs []struct{ Message string }) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	var response struct {
+		Data   map[string]interface{}
+		Errors []struct{ Message string }
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return response.Data, response.Errors
+}
+
+func TestGraphQLNestedTodos(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND NOT archived AND is_done = $2 ORDER BY id LIMIT $3 OFFSET $4")).
+		WithArgs(testUserID, false, 20, 0).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, title, is_done FROM todo_item WHERE todo_id = $1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(3, "Oat milk", true))
+
+	data, errs := serveGraphQL(t, conf, `{ todos(isDone: false) { title items { title isDone } tags { name } } }`)
+	if len(errs) > 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	got, _ := json.Marshal(data)
+	want := `{"todos":[{"items":[{"isDone":true,"title":"Oat milk"}],"tags":[{"name":"work"}],"title":"Buy milk"}]}`
+	if string(got) != want {
+		t.Errorf("data = %s, want %s", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGraphQLCreateTodoInvalid(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	_, errs := serveGraphQL(t, conf, `mutation { createTodo(input: {title: "Pay rent", priority: "critical"}) { id } }`)
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "priority must be one of") {
+		t.Errorf("errors = %v, want the priority validation error", errs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,318 @@
+package handlers
+
+//go:generate protoc --proto_path=../proto --go_out=.. --go_opt=module=to-do-list --go-grpc_out=.. --go-grpc_opt=module=to-do-list todo.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"to-do-list/service"
+	"to-do-list/todopb"
+)
+
+// todoServer serves the TodoService of proto/todo.proto on the same storage as the REST handlers
+type todoServer struct {
+	todopb.UnimplementedTodoServiceServer
+	conf *Config
+}
+
+// grpcServerOptions recover panics and authenticate every call, in that order
+func (conf *Config) grpcServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcUnaryRecover, conf.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(grpcStreamRecover, conf.grpcStreamAuth),
+	}
+}
+
+// ServeGRPC serves the TodoService on addr until ctx is done, then drains the in-flight calls. It returns the error
+// of a server which failed before
+func (conf *Config) ServeGRPC(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening for gRPC on %s: %w", addr, err)
+	}
+
+	server := grpc.NewServer(conf.grpcServerOptions()...)
+	todopb.RegisterTodoServiceServer(server, &todoServer{conf: conf})
+
+	failed := make(chan error, 1)
+	go func() {
+		slog.Info("gRPC server listening", "addr", addr)
+		if err := server.Serve(listener); err != nil {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+	// Streams may outlast the shutdown timeout, they are cut off then
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(conf.ShutdownTimeout):
+		server.Stop()
+	}
+	slog.Info("gRPC server stopped")
+	return nil
+}
+
+// grpcUser checks the API key and the login token in the metadata like the HTTP middleware and returns the context of the user
+func (conf *Config) grpcUser(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if conf.APIKey != "" {
+		if key := first("x-api-key"); key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(conf.APIKey)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid x-api-key")
+		}
+	}
+
+	bearer := first("authorization")
+	if !strings.HasPrefix(bearer, "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	userID, sessionID, err := conf.parseSessionToken(strings.TrimPrefix(bearer, "Bearer "))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	if err := conf.checkSession(ctx, userID, sessionID); err == errSessionRevoked {
+		return nil, status.Error(codes.Unauthenticated, "the session of the bearer token is revoked")
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, "checking the session failed")
+	}
+	return context.WithValue(ctx, userKey{}, userID), nil
+}
+
+func (conf *Config) grpcUnaryAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := conf.grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (conf *Config) grpcStreamAuth(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := conf.grpcUser(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &userStream{ServerStream: stream, ctx: ctx})
+}
+
+// userStream carries the context of the user into stream handlers
+type userStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *userStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcUnaryRecover answers a panic of a call with Internal and logs its stack, grpc-go would crash the process
+func grpcUnaryRecover(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+	defer recoverGRPC(ctx, info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func grpcStreamRecover(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverGRPC(stream.Context(), info.FullMethod, &err)
+	return handler(srv, stream)
+}
+
+func recoverGRPC(ctx context.Context, method string, err *error) {
+	if p := recover(); p != nil {
+		slog.ErrorContext(ctx, "gRPC handler panicked", "method", method, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+		*err = status.Error(codes.Internal, MESSAGE_FAILED)
+	}
+}
+
+// grpcFailed logs a database error and hides it from the client
+func grpcFailed(err error) error {
+	slog.Error("gRPC call failed", "error", err)
+	return status.Error(codes.Internal, MESSAGE_FAILED)
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromTimestamp(t *timestamppb.Timestamp) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.AsTime()
+	return &v
+}
+
+func fromProjectID(id *int64) *int {
+	if id == nil {
+		return nil
+	}
+	v := int(*id)
+	return &v
+}
+
+func todoMessage(todo service.Todo) *todopb.Todo {
+	message := &todopb.Todo{
+		Id:          int64(todo.ID),
+		Title:       todo.Title,
+		Description: todo.Description,
+		IsDone:      todo.IsDone,
+		Priority:    todo.Priority,
+		Tags:        todo.Tags,
+		DueDate:     timestamp(todo.DueDate),
+		CompletedAt: timestamp(todo.CompletedAt),
+		CreatedAt:   timestamp(todo.CreatedAt),
+		UpdatedAt:   timestamp(todo.UpdatedAt),
+		Version:     int64(todo.Version),
+	}
+	if todo.ProjectID != nil {
+		projectID := int64(*todo.ProjectID)
+		message.ProjectId = &projectID
+	}
+	return message
+}
+
+// todoError maps an error of the TodoService to its status
+func todoError(err error) error {
+	var invalid service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return invalidArgument(err)
+	case err == service.ErrTodoNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case err == service.ErrTodoLocked:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err == service.ErrVersionConflict:
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return grpcFailed(err)
+}
+
+// invalidArgument carries the field errors of err as BadRequest details, like Response.Errors
+func invalidArgument(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	errs := fieldErrors(err)
+	if len(errs) == 0 {
+		return st.Err()
+	}
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(errs))
+	for i, fieldErr := range errs {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: fieldErr.Field, Description: fieldErr.Message}
+	}
+	if detailed, detailErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); detailErr == nil {
+		return detailed.Err()
+	}
+	return st.Err()
+}
+
+func (s *todoServer) ListTodos(req *todopb.ListTodosRequest, stream todopb.TodoService_ListTodosServer) error {
+	ctx := stream.Context()
+	userID, _ := userFromContext(ctx)
+
+	filter := service.OwnFilter{IsDone: req.IsDone, ProjectID: fromProjectID(req.ProjectId), IncludeArchived: req.IncludeArchived}
+	if req.Tag != "" {
+		filter.Tag = &req.Tag
+	}
+
+	rows, err := s.conf.queries().OwnRows(ctx, userID, filter)
+	if err != nil {
+		return grpcFailed(err)
+	}
+	defer rows.Close()
+
+	// Rows are sent as they are read, so a large list isn't buffered
+	for rows.Next() {
+		if err := stream.Send(todoMessage(rows.Todo())); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return grpcFailed(err)
+	}
+	return nil
+}
+
+func (s *todoServer) GetTodo(ctx context.Context, req *todopb.GetTodoRequest) (*todopb.Todo, error) {
+	userID, _ := userFromContext(ctx)
+	todo, err := s.conf.todos().Get(ctx, userID, int(req.Id))
+	if err != nil {
+		return nil, todoError(err)
+	}
+	return todoMessage(todo), nil
+}
+
+func (s *todoServer) CreateTodo(ctx context.Context, req *todopb.CreateTodoRequest) (*todopb.Todo, error) {
+	todo := service.Todo{
+		Title:       req.Title,
+		Description: req.Description,
+		Source:      SOURCE_GRPC,
+		Priority:    req.Priority,
+		Tags:        req.Tags,
+		ProjectID:   fromProjectID(req.ProjectId),
+		DueDate:     fromTimestamp(req.DueDate),
+	}
+
+	userID, _ := userFromContext(ctx)
+	if err := s.conf.todos().Create(ctx, userID, &todo); err != nil {
+		return nil, todoError(err)
+	}
+	return todoMessage(todo), nil
+}
+
+func (s *todoServer) UpdateTodo(ctx context.Context, req *todopb.UpdateTodoRequest) (*todopb.Todo, error) {
+	todo := service.Todo{
+		Title:       req.Title,
+		Description: req.Description,
+		IsDone:      req.IsDone,
+		Priority:    req.Priority,
+		Tags:        req.Tags,
+		ProjectID:   fromProjectID(req.ProjectId),
+		DueDate:     fromTimestamp(req.DueDate),
+		Version:     int(req.Version),
+	}
+
+	userID, _ := userFromContext(ctx)
+	if err := s.conf.todos().Replace(ctx, userID, int(req.Id), &todo); err != nil {
+		return nil, todoError(err)
+	}
+	return todoMessage(todo), nil
+}
+
+func (s *todoServer) DeleteTodo(ctx context.Context, req *todopb.DeleteTodoRequest) (*todopb.DeleteTodoResponse, error) {
+	userID, _ := userFromContext(ctx)
+	if _, err := s.conf.todos().Delete(ctx, userID, int(req.Id)); err != nil {
+		return nil, todoError(err)
+	}
+	return &todopb.DeleteTodoResponse{}, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"to-do-list/service"
+	"to-do-list/todopb"
+)
+
+// newTestTodoClient serves the TodoService of conf in memory
+func newTestTodoClient(t *testing.T, conf *Config) todopb.TodoServiceClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(conf.grpcServerOptions()...)
+	todopb.RegisterTodoServiceServer(server, &todoServer{conf: conf})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return todopb.NewTodoServiceClient(conn)
+}
+
+func TestGRPCGetTodo(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	client := newTestTodoClient(t, conf)
+
+	if _, err := client.GetTodo(context.Background(), &todopb.GetTodoRequest{Id: 1}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("without a token err = %v, want Unauthenticated", err)
+	}
+
+	token, err := conf.issueToken(testUserID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token.Token)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+" AND deleted_at IS NULL")).
+		WithArgs(1, testUserID).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+	todo, err := client.GetTodo(ctx, &todopb.GetTodoRequest{Id: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Title != "Buy milk" || len(todo.Tags) != 1 || todo.Tags[0] != "work" {
+		t.Errorf("todo = %v, want Buy milk tagged work", todo)
+	}
+
+	if _, err := client.CreateTodo(ctx, &todopb.CreateTodoRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("without a title err = %v, want InvalidArgument", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGRPCRecover(t *testing.T) {
+	captureLogs(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/todo.TodoService/GetTodo"}
+	_, err := grpcUnaryRecover(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("err = %v, want Internal", err)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"to-do-list/service"
+)
+
+const HEALTH_PING_TIMEOUT = 2 * time.Second
+
+const (
+	HEALTH_OK          = "ok"
+	HEALTH_UNAVAILABLE = "unavailable"
+	HEALTH_DRAINING    = "draining"
+)
+
+// Health is the answer of the probes, Checks has the state of each component the probe depends on
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Migration version of the database and the one this build needs
+	Version  *uint `json:"version,omitempty"`
+	Expected uint  `json:"expected,omitempty"`
+}
+
+// isProbe lists the health endpoints, which stay public and are never rate limited
+func isProbe(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/startupz"
+}
+
+// getHealth is the liveness probe, it only tells the process still serves requests so a database outage doesn't restart it
+func (conf *Config) getHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, Health{Status: HEALTH_OK})
+}
+
+// getReady is the readiness probe: the database answers and has every migration, and the server isn't shutting down
+func (conf *Config) getReady(w http.ResponseWriter, r *http.Request) {
+	health := conf.checkHealth(r.Context())
+	if conf.draining.Load() {
+		// Still serving, but the load balancer should send new requests elsewhere
+		health.Status = HEALTH_DRAINING
+	}
+	writeHealth(w, health)
+}
+
+// getStartup is the startup probe, it passes once the database is ready and ignores the drain
+func (conf *Config) getStartup(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, conf.checkHealth(r.Context()))
+}
+
+// checkHealth pings the database and compares its migration version, the details of a failure are only logged
+func (conf *Config) checkHealth(ctx context.Context) Health {
+	ctx, cancel := context.WithTimeout(ctx, HEALTH_PING_TIMEOUT)
+	defer cancel()
+
+	health := Health{Status: HEALTH_OK, Checks: map[string]HealthCheck{}}
+	fail := func(component, reason string, check HealthCheck) {
+		check.Status, check.Error = HEALTH_UNAVAILABLE, reason
+		health.Status, health.Checks[component] = HEALTH_UNAVAILABLE, check
+	}
+
+	if err := conf.Database.PingContext(ctx); err != nil {
+		slog.WarnContext(ctx, "Health check of the database failed", "error", err)
+		fail("database", "unreachable", HealthCheck{})
+		fail("migrations", "unknown", HealthCheck{Expected: conf.SchemaVersion})
+		return health
+	}
+	health.Checks["database"] = HealthCheck{Status: HEALTH_OK}
+
+	version, dirty, err := service.StoredSchemaVersion(ctx, conf.Database)
+	switch {
+	case err == service.ErrNotFound:
+		fail("migrations", "pending", HealthCheck{Expected: conf.SchemaVersion})
+	case err != nil:
+		slog.WarnContext(ctx, "Health check of the migrations failed", "error", err)
+		fail("migrations", "unknown", HealthCheck{Expected: conf.SchemaVersion})
+	case dirty:
+		fail("migrations", "dirty", HealthCheck{Version: &version, Expected: conf.SchemaVersion})
+	// A newer database is fine, it's on the way to a rollout of the next build
+	case version < conf.SchemaVersion:
+		fail("migrations", "pending", HealthCheck{Version: &version, Expected: conf.SchemaVersion})
+	default:
+		health.Checks["migrations"] = HealthCheck{Status: HEALTH_OK, Version: &version, Expected: conf.SchemaVersion}
+	}
+	return health
+}
+
+// writeHealth answers 200 only when everything is ok, the probes only look at the HTTP status
+func writeHealth(w http.ResponseWriter, health Health) {
+	status := http.StatusOK
+	if health.Status != HEALTH_OK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func probe(t *testing.T, conf *Config, path string) (int, Health) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var health Health
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, health
+}
+
+func TestLiveness(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	conf.draining.Store(true)
+
+	// Neither the database nor the drain matter to liveness
+	if code, health := probe(t, conf, "/healthz"); code != http.StatusOK || health.Status != HEALTH_OK {
+		t.Errorf("liveness = %d %+v, want 200 ok", code, health)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    uint
+		dirty      bool
+		draining   bool
+		code       int
+		status     string
+		migrations string
+	}{
+		{name: "ready", version: 29, code: http.StatusOK, status: HEALTH_OK, migrations: HEALTH_OK},
+		{name: "newer database", version: 30, code: http.StatusOK, status: HEALTH_OK, migrations: HEALTH_OK},
+		{name: "pending migration", version: 28, code: http.StatusServiceUnavailable, status: HEALTH_UNAVAILABLE, migrations: HEALTH_UNAVAILABLE},
+		{name: "dirty migration", version: 29, dirty: true, code: http.StatusServiceUnavailable, status: HEALTH_UNAVAILABLE, migrations: HEALTH_UNAVAILABLE},
+		{name: "draining", version: 29, draining: true, code: http.StatusServiceUnavailable, status: HEALTH_DRAINING, migrations: HEALTH_OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			conf.SchemaVersion = 29
+			conf.draining.Store(tt.draining)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT version, dirty FROM schema_migrations")).
+				WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(tt.version, tt.dirty))
+
+			code, health := probe(t, conf, "/readyz")
+			if code != tt.code || health.Status != tt.status {
+				t.Errorf("readiness = %d %q, want %d %q", code, health.Status, tt.code, tt.status)
+			}
+			if got := health.Checks["migrations"]; got.Status != tt.migrations || got.Version == nil || *got.Version != tt.version {
+				t.Errorf("migrations = %+v, want %q at version %d", got, tt.migrations, tt.version)
+			}
+			if health.Checks["database"].Status != HEALTH_OK {
+				t.Errorf("database = %+v, want ok", health.Checks["database"])
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestStartupIgnoresDrain(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	conf.SchemaVersion = 29
+	conf.draining.Store(true)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, dirty FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(29, false))
+
+	if code, health := probe(t, conf, "/startupz"); code != http.StatusOK || health.Status != HEALTH_OK {
+		t.Errorf("startup = %d %+v, want 200 ok", code, health)
+	}
+}
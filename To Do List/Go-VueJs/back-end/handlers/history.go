@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+// getTodoHistory lists the changes of a to-do list the user may view, latest first, also while it's in the trash
+func (conf *Config) getTodoHistory(w http.ResponseWriter, r *http.Request) {
+	entries := make([]service.HistoryEntry, 0)
+
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, entries, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		buildResponse(w, entries, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	entries, total, err := conf.queries().History(r.Context(), currentUser(r), todoID, limit, offset)
+	if err == service.ErrTodoNotFound {
+		buildResponse(w, make([]service.HistoryEntry, 0), http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, make([]service.HistoryEntry, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	conf.buildPaginatedResponse(w, entries, newPagination(r, limit, offset, total), http.StatusOK, MESSAGE_SUCCESS)
+}
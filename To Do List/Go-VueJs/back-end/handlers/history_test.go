@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetTodoHistory(t *testing.T) {
+	t.Run("found", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM todo WHERE id = $1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+")")).
+			WithArgs(1, testUserID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo_history WHERE todo_id = $1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo_history WHERE todo_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3")).
+			WithArgs(1, DEFAULT_LIMIT, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "action", "actor_id", "changes", "created_at"}).
+				AddRow(2, service.EVENT_COMPLETED, testUserID, []byte(`{"is_done":{"from":false,"to":true}}`), time.Now()).
+				AddRow(1, service.EVENT_CREATED, nil, []byte(`{"title":{"from":null,"to":"Buy milk"}}`), time.Now()))
+
+		_, response := serve(t, conf, http.MethodGet, "/todo/1/history", "")
+		checkResponse(t, response, http.StatusOK, "")
+		var entries []service.HistoryEntry
+		decodeData(t, response, &entries)
+		if len(entries) != 2 || entries[0].Action != service.EVENT_COMPLETED || string(entries[0].Changes["is_done"].To) != "true" {
+			t.Errorf("entries = %+v, want the completion first", entries)
+		}
+		if entries[0].ActorID == nil || *entries[0].ActorID != testUserID || entries[1].ActorID != nil {
+			t.Errorf("actors = %v, %v, want the user then a background job", entries[0].ActorID, entries[1].ActorID)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(")).
+			WithArgs(1, testUserID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		_, response := serve(t, conf, http.MethodGet, "/todo/1/history", "")
+		checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"to-do-list/service"
+)
+
+const (
+	MAX_IDEMPOTENCY_KEY_LENGTH = 255
+)
+
+// requestHash identifies the body sent with an Idempotency-Key, so the key can't be reused for another to-do list
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyKeys is the IdempotencyRepository of the handlers
+func (conf *Config) idempotencyKeys() *service.IdempotencyRepository {
+	return &service.IdempotencyRepository{DB: conf.Database, Driver: conf.DBDriver, Todos: conf.todoRepository}
+}
+
+// PruneIdempotencyKeys periodically deletes the expired idempotency keys, until ctx is done
+func (conf *Config) PruneIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Idempotency key pruning stopped")
+			return
+		case <-ticker.C:
+		}
+
+		if err := conf.idempotencyKeys().Prune(ctx); err != nil {
+			slog.Error("Pruning idempotency keys failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestAddTodoIdempotencyKey(t *testing.T) {
+	const body = `{"title":"Buy milk"}`
+	stored := []byte(`{"id":42,"title":"Buy milk","is_done":false,"archived":false,"tags":[]}`)
+
+	expectStored := func(mock sqlmock.Sqlmock, hash string) {
+		query := mock.ExpectQuery(regexp.QuoteMeta("SELECT request_hash, response FROM idempotency_key WHERE user_id = $1 AND key = $2")).
+			WithArgs(testUserID, "retry-1", sqlmock.AnyArg())
+		if hash == "" {
+			query.WillReturnError(sql.ErrNoRows)
+		} else {
+			query.WillReturnRows(sqlmock.NewRows([]string{"request_hash", "response"}).AddRow(hash, stored))
+		}
+	}
+	expectInsert := func(mock sqlmock.Sqlmock, keyStored int64) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo(title")).
+			WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 43, "Buy milk", false))
+		expectHistory(mock, service.EVENT_CREATED)
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_key(user_id, key, request_hash, response)")).
+			WithArgs(testUserID, "retry-1", requestHash([]byte(body)), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, keyStored))
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(mock sqlmock.Sqlmock)
+		status   int
+		code     string
+		wantID   int
+		replayed bool
+	}{
+		{
+			name: "first request",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectStored(mock, "")
+				expectInsert(mock, 1)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusCreated,
+			wantID: 43,
+		},
+		{
+			name:     "retry",
+			setup:    func(mock sqlmock.Sqlmock) { expectStored(mock, requestHash([]byte(body))) },
+			status:   http.StatusCreated,
+			wantID:   42,
+			replayed: true,
+		},
+		{
+			name: "concurrent retry",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectStored(mock, "")
+				expectInsert(mock, 0)
+				mock.ExpectRollback()
+				expectStored(mock, requestHash([]byte(body)))
+			},
+			status:   http.StatusCreated,
+			wantID:   42,
+			replayed: true,
+		},
+		{
+			name:   "different request",
+			setup:  func(mock sqlmock.Sqlmock) { expectStored(mock, requestHash([]byte(`{"title":"Pay rent"}`))) },
+			status: http.StatusConflict,
+			code:   CODE_CONFLICT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			req := httptest.NewRequest(http.MethodPost, "/todo", strings.NewReader(body))
+			req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+			req.Header.Set("Idempotency-Key", "retry-1")
+			rec := httptest.NewRecorder()
+			conf.Router.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			checkResponse(t, response, tt.status, tt.code)
+			if tt.wantID != 0 {
+				var todo service.Todo
+				decodeData(t, response, &todo)
+				if todo.ID != tt.wantID {
+					t.Errorf("id = %d, want %d", todo.ID, tt.wantID)
+				}
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
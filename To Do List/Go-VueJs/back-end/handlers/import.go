@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"to-do-list/service"
+)
+
+const (
+	IMPORT_FORMAT_CSV     = "csv"
+	IMPORT_FORMAT_JSON    = "json"
+	IMPORT_FORMAT_TODOIST = "todoist"
+
+	// Limits of an uploaded file, the part above MAX_IMPORT_MEMORY is buffered in a temporary file
+	MAX_IMPORT_SIZE   = 10 << 20
+	MAX_IMPORT_MEMORY = 1 << 20
+	MAX_IMPORT_ROWS   = 5000
+)
+
+// ImportRow is the outcome of one to-do list of the file. Row is the line a spreadsheet shows for CSV files, the header
+// being row 1, and the position in the array from 1 for JSON files
+type ImportRow struct {
+	Row    int                  `json:"row"`
+	Status int                  `json:"status"`
+	Error  string               `json:"error,omitempty"`
+	Errors []service.FieldError `json:"errors,omitempty"`
+	Todo   *service.Todo        `json:"todo,omitempty"`
+}
+
+type ImportReport struct {
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Rows     []ImportRow `json:"rows"`
+}
+
+// importedTodo is a to-do list read from the file, err is why it can't be imported. A backup restores it to owner,
+// the user importing the file when nil
+type importedTodo struct {
+	row   int
+	todo  service.Todo
+	owner *int
+	err   error
+}
+
+// importTodos creates the to-do list of the file uploaded as the "file" field of a multipart form. The valid rows are
+// imported in one transaction, the invalid ones are reported and skipped. The format is the "format" field, otherwise
+// json for .json files and csv or todoist by the header of the CSV. Only an admin may import a backup of GET
+// /todo/backup, which restores the to-do list to their owners
+func (conf *Config) importTodos(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_IMPORT_SIZE)
+	if err := r.ParseMultipartForm(MAX_IMPORT_MEMORY); err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("body must be a multipart form of at most %d bytes", MAX_IMPORT_SIZE))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "file is required")
+		return
+	}
+	defer file.Close()
+
+	format := r.FormValue("format")
+	if format == "" && strings.EqualFold(filepath.Ext(header.Filename), ".json") {
+		format = IMPORT_FORMAT_JSON
+	}
+	var rows []importedTodo
+	var isBackup bool
+	switch format {
+	case IMPORT_FORMAT_JSON:
+		rows, isBackup, err = parseJSONImport(file)
+	case "", IMPORT_FORMAT_CSV, IMPORT_FORMAT_TODOIST:
+		rows, err = conf.parseCSVImport(file, format)
+	default:
+		err = fmt.Errorf("format must be %s, %s or %s", IMPORT_FORMAT_CSV, IMPORT_FORMAT_JSON, IMPORT_FORMAT_TODOIST)
+	}
+	if err == nil && len(rows) > MAX_IMPORT_ROWS {
+		err = fmt.Errorf("file must not have more than %d to-do list", MAX_IMPORT_ROWS)
+	}
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+	if isBackup && !conf.isAdmin(r) {
+		buildResponse(w, nil, http.StatusForbidden, MESSAGE_FAILED)
+		return
+	}
+
+	report := ImportReport{Rows: make([]ImportRow, 0, len(rows))}
+	var imported []importedTodo
+	err = service.RunInTx(r.Context(), conf.Database, nil, func(tx *sql.Tx) error {
+		todos := conf.todosInTx(tx)
+		for _, row := range rows {
+			result := ImportRow{Row: row.row, Status: http.StatusCreated}
+			isDone := row.todo.IsDone
+			userID := currentUser(r)
+			if row.owner != nil && row.err == nil {
+				// Restored to a user of the database, not a new one
+				userID = *row.owner
+				if exists, err := service.UserExists(r.Context(), tx, userID); err != nil {
+					return err
+				} else if !exists {
+					row.err = service.ValidationError{Err: service.NewFieldError("user_id", service.RULE_EXISTS, "user %d doesn't exist", userID)}
+				}
+			}
+			if row.err == nil {
+				row.err = todos.Create(r.Context(), userID, &row.todo)
+			}
+			// Created without is_done like every new to-do list, so its completion is recorded as such
+			if row.err == nil && isDone {
+				row.todo, row.err = todos.SetDone(r.Context(), userID, row.todo.ID, true)
+			}
+
+			var invalid service.ValidationError
+			if errors.As(row.err, &invalid) {
+				result.Status, result.Error, result.Errors = http.StatusBadRequest, invalid.Error(), fieldErrors(invalid)
+				report.Failed++
+			} else if row.err != nil {
+				return row.err
+			} else {
+				todo := row.todo
+				result.Todo = &todo
+				imported = append(imported, importedTodo{todo: todo, owner: &userID})
+				report.Imported++
+			}
+			report.Rows = append(report.Rows, result)
+		}
+		return nil
+	})
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	for i := range imported {
+		conf.todos().Publish(r.Context(), service.EVENT_CREATED, *imported[i].owner, imported[i].todo)
+	}
+
+	buildResponse(w, report, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// backupDocument is the part of a backup of GET /todo/backup which POST /todo/import restores
+type backupDocument struct {
+	SchemaVersion uint              `json:"schema_version"`
+	Error         string            `json:"error"`
+	Todo          []json.RawMessage `json:"todo"`
+}
+
+// parseJSONImport reads an array of to-do list as GET /todo/export?format=json writes it, ids and times of the export
+// are ignored. A backup of GET /todo/backup gives the owner of each to-do list as well, isBackup tells it apart
+func parseJSONImport(file io.Reader) (rows []importedTodo, isBackup bool, err error) {
+	var document json.RawMessage
+	if err := json.NewDecoder(file).Decode(&document); err != nil {
+		return nil, false, errors.New("file must be a JSON array of to-do list or a backup")
+	}
+	var items []json.RawMessage
+	isBackup = strings.HasPrefix(strings.TrimSpace(string(document)), "{")
+	if isBackup {
+		var backup backupDocument
+		if err := json.Unmarshal(document, &backup); err != nil || backup.SchemaVersion == 0 {
+			return nil, true, errors.New("file must be a JSON array of to-do list or a backup")
+		}
+		if backup.Error != "" {
+			return nil, true, errors.New("the backup is incomplete, it failed while it was written")
+		}
+		// Only Postgres has GET /todo/backup, the version of its schema is the one of the backup on every database
+		latest, err := service.LatestSchemaVersion(service.DB_DRIVER_POSTGRES)
+		if err != nil {
+			return nil, true, err
+		}
+		if backup.SchemaVersion > latest {
+			return nil, true, fmt.Errorf("the backup of schema version %d is newer than the schema version %d of the app", backup.SchemaVersion, latest)
+		}
+		items = backup.Todo
+	} else if err := json.Unmarshal(document, &items); err != nil {
+		return nil, false, errors.New("file must be a JSON array of to-do list or a backup")
+	}
+
+	rows = make([]importedTodo, len(items))
+	for i, item := range items {
+		rows[i].row = i + 1
+		var todo service.Todo
+		if err := json.Unmarshal(item, &todo); err != nil {
+			rows[i].err = service.ValidationError{Err: decodeError(err)}
+			continue
+		}
+		if isBackup {
+			// A to-do list of the time authentication was off has no owner, it goes to the admin importing it
+			var owner struct {
+				UserID *int `json:"user_id"`
+			}
+			json.Unmarshal(item, &owner)
+			rows[i].owner = owner.UserID
+		}
+		rows[i].todo = service.Todo{
+			Title:       todo.Title,
+			Description: todo.Description,
+			IsDone:      todo.IsDone,
+			Source:      SOURCE_IMPORT,
+			Metadata:    todo.Metadata,
+			Tags:        todo.Tags,
+			Priority:    todo.Priority,
+			ProjectID:   todo.ProjectID,
+			Recurrence:  todo.Recurrence,
+			RemindAt:    todo.RemindAt,
+			DueDate:     todo.DueDate,
+		}
+	}
+	return rows, isBackup, nil
+}
+
+// parseCSVImport reads a CSV with a header, either the columns of GET /todo/export or a Todoist CSV export when format
+// is todoist or the header starts with its TYPE and CONTENT columns
+func (conf *Config) parseCSVImport(file io.Reader, format string) ([]importedTodo, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("file must be a CSV with a header")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	_, hasType := columns["type"]
+	_, hasContent := columns["content"]
+	if format == "" && hasType && hasContent {
+		format = IMPORT_FORMAT_TODOIST
+	}
+
+	parse := conf.parseCSVRow
+	if format == IMPORT_FORMAT_TODOIST {
+		if !hasType || !hasContent {
+			return nil, errors.New("a Todoist CSV must have the TYPE and CONTENT columns")
+		}
+		parse = conf.parseTodoistRow
+	} else if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV must have a title column")
+	}
+
+	var rows []importedTodo
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading row %d: %w", line, err)
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		todo, ok, err := parse(value)
+		if !ok {
+			continue
+		}
+		todo.Source = SOURCE_IMPORT
+		rows = append(rows, importedTodo{row: line, todo: todo, err: err})
+	}
+}
+
+// parseCSVRow reads the columns of GET /todo/export, tags are separated by ";" like it writes them
+func (conf *Config) parseCSVRow(value func(column string) string) (service.Todo, bool, error) {
+	var errs service.FieldErrors
+	todo := service.Todo{Title: value("title"), Description: value("description"), Priority: strings.ToLower(value("priority")), Tags: service.Tags{}}
+	if isDone := value("is_done"); isDone != "" {
+		done, err := strconv.ParseBool(isDone)
+		if err != nil {
+			errs = append(errs, service.NewFieldError("is_done", service.RULE_TYPE, "is_done must be true or false"))
+		}
+		todo.IsDone = done
+	}
+	for _, tag := range strings.Split(value("tags"), ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			todo.Tags = append(todo.Tags, tag)
+		}
+	}
+	if dueDate := value("due_date"); dueDate != "" {
+		if due, err := conf.parseImportTime(dueDate); err != nil {
+			errs = append(errs, service.NewFieldError("due_date", service.RULE_TYPE, "due_date must be an RFC 3339 time or a %s date", service.DATE_LAYOUT))
+		} else {
+			todo.DueDate = &due
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return todo, true, service.ValidationError{Err: err}
+	}
+	return todo, true, nil
+}
+
+// Todoist ranks its priorities from 1, the most urgent, to 4
+var todoistPriorities = map[string]string{"1": service.PRIORITY_URGENT, "2": service.PRIORITY_HIGH, "3": service.PRIORITY_MEDIUM, "4": service.PRIORITY_LOW}
+
+// parseTodoistRow reads a task of a Todoist CSV export, its sections and notes are skipped. The @labels of the content
+// become tags, a DATE which isn't a plain date like "every monday" is kept in the todoist_date metadata
+func (conf *Config) parseTodoistRow(value func(column string) string) (service.Todo, bool, error) {
+	if !strings.EqualFold(value("type"), "task") {
+		return service.Todo{}, false, nil
+	}
+
+	todo := service.Todo{Description: value("description"), Priority: service.PRIORITY_MEDIUM, Tags: service.Tags{}}
+	var title []string
+	for _, word := range strings.Fields(value("content")) {
+		if strings.HasPrefix(word, "@") && len(word) > 1 {
+			todo.Tags = append(todo.Tags, word[1:])
+		} else {
+			title = append(title, word)
+		}
+	}
+	todo.Title = strings.Join(title, " ")
+	if priority, ok := todoistPriorities[value("priority")]; ok {
+		todo.Priority = priority
+	}
+	if date := value("date"); date != "" {
+		if due, err := conf.parseImportTime(date); err == nil {
+			todo.DueDate = &due
+		} else {
+			todo.Metadata = service.Metadata{"todoist_date": date}
+		}
+	}
+	return todo, true, nil
+}
+
+// parseImportTime accepts an RFC 3339 time or a date, which is midnight in the timezone of the app
+func (conf *Config) parseImportTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(service.DATE_LAYOUT, value, conf.Location)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+// sendImport uploads content as the file of POST /todo/import of testUserID
+func sendImport(t *testing.T, conf *Config, filename, format, content string) Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if format != "" {
+		form.WriteField("format", format)
+	}
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/todo/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return response
+}
+
+func TestImportTodosCSV(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+
+	// The columns of the export, in another order and with one the import doesn't know
+	content := "title,tags,is_done,due_date,priority,id\n" +
+		"Buy milk,shop;home,false,2030-01-02,high,17\n" +
+		",,,,,18\n" +
+		"\"Call mum, Sunday\",,true,,,19\n" +
+		"Pay rent,,maybe,next week,,20\n"
+	response := sendImport(t, conf, "todos.csv", "", content)
+	checkResponse(t, response, http.StatusOK, "")
+	var report ImportReport
+	decodeData(t, response, &report)
+
+	if report.Imported != 2 || report.Failed != 2 || len(report.Rows) != 4 {
+		t.Fatalf("report = %+v", report)
+	}
+	milk := report.Rows[0]
+	if milk.Row != 2 || milk.Status != http.StatusCreated || milk.Todo.Priority != service.PRIORITY_HIGH || len(milk.Todo.Tags) != 2 || milk.Todo.Source != SOURCE_IMPORT {
+		t.Errorf("row 2 = %+v", milk)
+	}
+	if milk.Todo.DueDate == nil || !milk.Todo.DueDate.Equal(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("due date = %v", milk.Todo.DueDate)
+	}
+	if blank := report.Rows[1]; blank.Row != 3 || blank.Status != http.StatusBadRequest || len(blank.Errors) != 1 || blank.Errors[0].Field != "title" {
+		t.Errorf("row 3 = %+v", blank)
+	}
+	if mum := report.Rows[2]; mum.Todo == nil || mum.Todo.Title != "Call mum, Sunday" || !mum.Todo.IsDone || mum.Todo.CompletedAt == nil {
+		t.Errorf("row 4 = %+v", mum)
+	}
+	if rent := report.Rows[3]; rent.Status != http.StatusBadRequest || len(rent.Errors) != 2 {
+		t.Errorf("row 5 = %+v", rent)
+	}
+
+	_, response = serve(t, conf, http.MethodGet, "/todo?include_archived=true", "")
+	var todos []service.Todo
+	decodeData(t, response, &todos)
+	if len(todos) != 2 {
+		t.Errorf("listed %d to-do list, want the 2 imported", len(todos))
+	}
+}
+
+func TestImportTodosJSON(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+
+	// An export of another server: its ids and times are not kept
+	content := `[{"id":9,"title":"Buy milk","tags":["shop"],"created_at":"2020-01-01T00:00:00Z"},{"title":"Call mum","priority":"critical"},{"title":7}]`
+	response := sendImport(t, conf, "todos.json", "", content)
+	checkResponse(t, response, http.StatusOK, "")
+	var report ImportReport
+	decodeData(t, response, &report)
+
+	if report.Imported != 1 || report.Failed != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if milk := report.Rows[0].Todo; milk.ID == 9 || milk.CreatedAt.Year() == 2020 {
+		t.Errorf("imported %+v, want a new id and creation time", milk)
+	}
+	if typeErr := report.Rows[2]; typeErr.Row != 3 || len(typeErr.Errors) != 1 || typeErr.Errors[0].Rule != service.RULE_TYPE {
+		t.Errorf("row 3 = %+v", typeErr)
+	}
+}
+
+func TestImportTodosErrors(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+
+	for name, upload := range map[string][3]string{
+		"unknown format":   {"todos.xml", "xml", "<todos/>"},
+		"no title column":  {"todos.csv", "", "name,done\nBuy milk,false\n"},
+		"not a JSON array": {"todos.json", "", `{"title":"Buy milk"}`},
+		"todoist columns":  {"todos.csv", IMPORT_FORMAT_TODOIST, "title\nBuy milk\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			response := sendImport(t, conf, upload[0], upload[1], upload[2])
+			checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+		})
+	}
+}
+
+func TestParseTodoistImport(t *testing.T) {
+	conf := &Config{Location: time.UTC}
+	content := "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Errands,,,,,,,,\n" +
+		"task,Buy milk @shop @home,Oat,1,1,Ada (1),,2030-01-02,en,UTC\n" +
+		"note,Ask for the big one,,,,,,,,\n" +
+		"task,Water plants,,4,1,Ada (1),,every monday,en,UTC\n"
+
+	rows, err := conf.parseCSVImport(strings.NewReader(content), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want the 2 tasks", len(rows))
+	}
+	milk := rows[0]
+	if milk.row != 3 || milk.todo.Title != "Buy milk" || milk.todo.Description != "Oat" || milk.todo.Priority != service.PRIORITY_URGENT || strings.Join(milk.todo.Tags, ",") != "shop,home" {
+		t.Errorf("task = %d %+v", milk.row, milk.todo)
+	}
+	if milk.todo.DueDate == nil || !milk.todo.DueDate.Equal(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("due date = %v", milk.todo.DueDate)
+	}
+	if plants := rows[1].todo; plants.Priority != service.PRIORITY_LOW || plants.DueDate != nil || plants.Metadata["todoist_date"] != "every monday" {
+		t.Errorf("task = %+v", plants)
+	}
+}
@@ -0,0 +1,10 @@
+package handlers
+
+import (
+	"to-do-list/service"
+)
+
+// queries is the TodoQueries of the handlers
+func (conf *Config) queries() *service.TodoQueries {
+	return &service.TodoQueries{DB: conf.Database, Driver: conf.DBDriver}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID"
+	// Longer request IDs of the caller are replaced, so a client can't bloat every log line
+	MAX_REQUEST_ID_LENGTH = 128
+)
+
+// ContextHandler adds the request ID, the user and the trace of the context to every record logged with one
+type ContextHandler struct {
+	slog.Handler
+}
+
+func (h ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info := requestInfoFrom(ctx); info != nil {
+		record.AddAttrs(slog.String("request_id", info.ID))
+		if info.UserID != 0 {
+			record.AddAttrs(slog.Int("user_id", info.UserID))
+		}
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h ContextHandler) WithGroup(name string) slog.Handler {
+	return ContextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestInfo is what the logs know about the request, requireUser fills in the user once it's authenticated
+type requestInfo struct {
+	ID     string
+	UserID int
+}
+
+type requestInfoKey struct{}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// setRequestUser records the authenticated user for the log lines of the request
+func setRequestUser(ctx context.Context, userID int) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.UserID = userID
+	}
+}
+
+// requestIDMiddleware keeps the X-Request-ID of the caller, or assigns a new one, and echoes it in the response
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, &requestInfo{ID: id})))
+	})
+}
+
+// validRequestID accepts the printable ASCII IDs that can't forge a log line or a header
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool { return r <= ' ' || r > '~' }) < 0
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs sends the default logger to a buffer of JSON lines for the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(ContextHandler{slog.NewJSONHandler(&buf, nil)}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "assigned"},
+		{name: "propagated", header: "checkout-7f3a", keep: true},
+		{name: "too long", header: strings.Repeat("a", MAX_REQUEST_ID_LENGTH+1)},
+		{name: "forged log line", header: "abc\ninjected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestInfoFrom(r.Context()).ID
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+			if tt.header != "" {
+				req.Header.Set(REQUEST_ID_HEADER, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get(REQUEST_ID_HEADER); got == "" || got != seen {
+				t.Errorf("response ID = %q, handler saw %q", got, seen)
+			}
+			if (seen == tt.header) != tt.keep {
+				t.Errorf("ID = %q, keep %q = %t", seen, tt.header, tt.keep)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+	conf, _ := newTestConfig(t)
+	handler := requestIDMiddleware(loggingMiddleware(conf.requireUser(conf.Router)))
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/abc", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "req-1")
+	token, err := conf.issueToken(testUserID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line struct {
+		Level     string `json:"level"`
+		Msg       string `json:"msg"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		Latency   int64  `json:"latency"`
+		RequestID string `json:"request_id"`
+		UserID    int    `json:"user_id"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("decoding %q: %v", logs.String(), err)
+	}
+	if line.Msg != "Request" || line.Method != http.MethodGet || line.Path != "/todo/abc" || line.Status != http.StatusNotFound {
+		t.Errorf("access log = %+v, want GET /todo/abc with the status of the body", line)
+	}
+	if line.RequestID != "req-1" || line.UserID != testUserID {
+		t.Errorf("access log = %+v, want the request ID and the user", line)
+	}
+}
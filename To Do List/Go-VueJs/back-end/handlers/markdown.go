@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+
+	"to-do-list/service"
+)
+
+const RENDER_HTML = "html"
+
+// Descriptions are CommonMark with the GitHub tables, strikethrough, autolinks and task lists. goldmark already leaves
+// out the raw HTML of a description, the policy removes what could still run a script, like javascript: links
+var (
+	markdown       = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	markdownPolicy = bluemonday.UGCPolicy().AllowAttrs("type", "checked", "disabled").OnElements("input").RequireNoFollowOnLinks(true).AddTargetBlankToFullyQualifiedLinks(true)
+)
+
+// renderMarkdown is the sanitized HTML of a Markdown description, converting into a buffer can't fail
+func renderMarkdown(description string) string {
+	var html bytes.Buffer
+	markdown.Convert([]byte(description), &html)
+	return markdownPolicy.Sanitize(html.String())
+}
+
+// parseRender reports whether the request asks for the rendered descriptions with ?render=html
+func parseRender(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("render") {
+	case "":
+		return false, nil
+	case RENDER_HTML:
+		return true, nil
+	}
+	return false, fmt.Errorf("render must be %s", RENDER_HTML)
+}
+
+// renderDescription fills the description_html of todo from its Markdown description
+func renderDescription(todo *service.Todo) {
+	if todo.Description != "" {
+		todo.DescriptionHTML = renderMarkdown(todo.Description)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        []string
+		unwanted    []string
+	}{
+		{name: "formatting", description: "**Buy** `milk`\n\n- oat\n- soy", want: []string{"<strong>Buy</strong>", "<code>milk</code>", "<li>oat</li>"}},
+		{name: "task list", description: "- [x] milk\n- [ ] eggs", want: []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`}},
+		{name: "link", description: "[shop](https://example.com)", want: []string{`href="https://example.com"`, `rel="nofollow noopener"`, `target="_blank"`}},
+		{name: "raw HTML", description: `<script>alert(1)</script><img src=x onerror=alert(1)>`, unwanted: []string{"<script", "onerror", "<img"}},
+		{name: "javascript link", description: "[click](javascript:alert(1))", unwanted: []string{"javascript:"}},
+		{name: "autolink", description: "see https://example.com", want: []string{`<a href="https://example.com"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := renderMarkdown(tt.description)
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("renderMarkdown(%q) = %q, want %q in it", tt.description, html, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(html, unwanted) {
+					t.Errorf("renderMarkdown(%q) = %q, want no %q", tt.description, html, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTodosRenderHTML(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE")).WillReturnRows(sqlmock.NewRows(todoColumns).
+		AddRow(1, "Buy milk", "*Oat*", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil))
+
+	_, response := serve(t, conf, http.MethodGet, "/todo?render=html", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var todos []service.Todo
+	decodeData(t, response, &todos)
+	if len(todos) != 1 || todos[0].Description != "*Oat*" || todos[0].DescriptionHTML != "<p><em>Oat</em></p>\n" {
+		t.Errorf("todos = %+v", todos)
+	}
+
+	_, response = serve(t, conf, http.MethodGet, "/todo?render=pdf", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Route label of the requests no route matched, so scanners can't blow up the number of series
+const UNMATCHED_ROUTE = "unmatched"
+
+var (
+	MetricsRegistry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "todo",
+		Name:      "http_requests_total",
+		Help:      "Requests served, by route template, method and the status of the response body.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "todo",
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve a request, by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "todo",
+		Name:      "http_requests_in_flight",
+		Help:      "Requests being served, including open event streams.",
+	})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "todo",
+		Name:      "db_query_duration_seconds",
+		Help:      "Time until the database answered a statement, by its first keyword.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		httpRequests, httpDuration, httpInFlight, DBQueryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// getMetrics serves the metrics in the Prometheus text format to the scraper sending the X-Admin-Key, the routes and
+// the counts tell a lot about the users
+func (conf *Config) getMetrics(w http.ResponseWriter, r *http.Request) {
+	if !conf.isAdmin(r) {
+		buildResponse(w, nil, http.StatusForbidden, MESSAGE_FAILED)
+		return
+	}
+	promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// metricsMiddleware counts and times every request by the template of the route it matches
+func (r *Config) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := r.routeOf(req)
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, req)
+
+		httpDuration.WithLabelValues(route, req.Method).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(route, req.Method, strconv.Itoa(rw.statusCode())).Inc()
+	})
+}
+
+// routeOf is the path template of the route matching req, UNMATCHED_ROUTE if there is none
+func (r *Config) routeOf(req *http.Request) string {
+	var match mux.RouteMatch
+	if r.Router.Match(req, &match) && match.Route != nil {
+		if template, err := match.Route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return UNMATCHED_ROUTE
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func sampleCount(t *testing.T, histogram prometheus.Observer) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := histogram.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	handler := conf.metricsMiddleware(conf.Router)
+
+	tests := []struct {
+		target string
+		route  string
+		status string
+	}{
+		// The error is in the body, the HTTP status of the response is 200
+		{target: "/todo/abc", route: "/todo/{id}", status: "404"},
+		{target: "/no/such/route", route: UNMATCHED_ROUTE, status: "404"},
+		{target: "/healthz", route: "/healthz", status: "200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			requests := httpRequests.WithLabelValues(tt.route, http.MethodGet, tt.status)
+			before, durations := testutil.ToFloat64(requests), sampleCount(t, httpDuration.WithLabelValues(tt.route, http.MethodGet))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := testutil.ToFloat64(requests) - before; got != 1 {
+				t.Errorf("requests{route=%q,status=%q} grew by %v, want 1", tt.route, tt.status, got)
+			}
+			if got := sampleCount(t, httpDuration.WithLabelValues(tt.route, http.MethodGet)) - durations; got != 1 {
+				t.Errorf("durations{route=%q} grew by %d, want 1", tt.route, got)
+			}
+			if got := testutil.ToFloat64(httpInFlight); got != 0 {
+				t.Errorf("in flight = %v after the request, want 0", got)
+			}
+		})
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.AdminKey = "admin-secret"
+
+	for _, key := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("X-Admin-Key", key)
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "todo_http_requests_in_flight") {
+			t.Errorf("metrics with key %q = %d %q, want them refused", key, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("X-Admin-Key", "admin-secret")
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "todo_http_requests_in_flight") {
+		t.Errorf("metrics = %d %q, want the todo metrics", rec.Code, rec.Body.String())
+	}
+}
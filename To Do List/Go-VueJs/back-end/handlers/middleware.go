@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// responseWriter records the status code and size of a response for logging
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	// A panic cut the response short after its status was sent, it is logged as a 500
+	aborted bool
+}
+
+// statusCode is the status the client got
+func (rw *responseWriter) statusCode() int {
+	switch {
+	case rw.aborted:
+		return http.StatusInternalServerError
+	case rw.status != 0:
+		return rw.status
+	}
+	return http.StatusOK
+}
+
+// recordAbort marks every responseWriter the writer wraps as cut short
+func recordAbort(w http.ResponseWriter) {
+	for {
+		if rw, ok := w.(*responseWriter); ok {
+			rw.aborted = true
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += n
+	return n, err
+}
+
+// Flush keeps streamed responses working through the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades take over the connection through the wrapper
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer can't be hijacked")
+	}
+	rw.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// middleware wraps a handler with behaviour shared by every request
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in the middlewares, the first one is the outermost and sees the request first
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// recoverMiddleware turns a panic of a handler into a 500 response and logs it with its stack, instead of the
+// server dropping the connection
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// Deliberate aborts, e.g. from httputil.ReverseProxy, keep their meaning for the server
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			slog.ErrorContext(r.Context(), "Handler panicked", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			if rw.status != 0 {
+				// Part of the response is already sent, so it can only be cut short
+				recordAbort(rw)
+				return
+			}
+			buildErrorResponse(rw, nil, http.StatusInternalServerError, CODE_INTERNAL_ERROR, MESSAGE_FAILED)
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// loggingMiddleware logs one line per request with its method, path, status and latency, the request ID and the user
+// come from the context. Failures of the server are logged as errors
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		status, level := rw.statusCode(), slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "Request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", rw.bytes),
+			slog.String("remote", r.RemoteAddr),
+		)
+	})
+}
+
+// apiKeyMiddleware requires the key in "Authorization: Bearer <key>" or X-API-Key, the health probes, shared links and
+// the calendar feed stay public. The requests without it go to refuse
+func apiKeyMiddleware(apiKey string, refuse http.HandlerFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The browser follows the redirects of an OAuth sign-in without the header
+		if path := unversionedPath(r.URL.Path); isProbe(path) || strings.HasPrefix(path, "/shared/") || strings.HasPrefix(path, "/auth/oauth/") || path == "/todo/calendar.ics" || path == "/openapi.json" || path == "/docs" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// X-API-Key goes first, so the Authorization header stays free for the login token of a user
+		key := r.Header.Get("X-API-Key")
+		if bearer := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(bearer, "Bearer ") {
+			key = strings.TrimPrefix(bearer, "Bearer ")
+		}
+		if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			refuse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
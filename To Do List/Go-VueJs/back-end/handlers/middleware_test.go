@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"to-do-list/service"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+	})
+	handler := apiKeyMiddleware("s3cret", func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusUnauthorized, MESSAGE_FAILED)
+	}, next)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{name: "missing key", path: "/todo", status: http.StatusUnauthorized},
+		{name: "wrong key", path: "/todo", header: "X-API-Key", value: "guess", status: http.StatusUnauthorized},
+		{name: "wrong bearer", path: "/todo", header: "Authorization", value: "Bearer guess", status: http.StatusUnauthorized},
+		{name: "correct key", path: "/todo", header: "X-API-Key", value: "s3cret", status: http.StatusOK},
+		{name: "correct bearer", path: "/todo", header: "Authorization", value: "Bearer s3cret", status: http.StatusOK},
+		{name: "health check", path: "/healthz", status: http.StatusOK},
+		{name: "shared link", path: "/shared/abc", status: http.StatusOK},
+		{name: "calendar feed", path: "/todo/calendar.ics", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+			}
+			if response.Status != tt.status {
+				t.Errorf("status = %d, want %d", response.Status, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && response.Message != MESSAGE_FAILED {
+				t.Errorf("message = %q, want %q", response.Message, MESSAGE_FAILED)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") }), tag("outer"), tag("inner"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/todo", nil))
+	if got := strings.Join(order, ","); got != "outer,inner,handler" {
+		t.Errorf("order = %s, want outer,inner,handler", got)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	handler := loggingMiddleware(recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var todos map[int]service.Todo
+		todos[1] = service.Todo{}
+	})))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todo", nil))
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if response.Status != http.StatusInternalServerError || response.Code != CODE_INTERNAL_ERROR {
+		t.Errorf("response = %+v, want a 500 %s", response, CODE_INTERNAL_ERROR)
+	}
+	if !strings.Contains(logs.String(), `"msg":"Handler panicked"`) || !strings.Contains(logs.String(), "middleware_test.go") {
+		t.Errorf("logs = %s, want the panic with its stack", logs)
+	}
+	if !strings.Contains(logs.String(), `"status":500`) {
+		t.Errorf("logs = %s, want the access log of the 500", logs)
+	}
+}
+
+func TestRecoverMiddlewareAbort(t *testing.T) {
+	handler := recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on", p)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/todo", nil))
+}
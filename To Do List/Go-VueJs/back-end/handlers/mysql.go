@@ -0,0 +1,6 @@
+package handlers
+
+const (
+	// Error number of a duplicate value of a unique key
+	MYSQL_ER_DUP_ENTRY = 1062
+)
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+func TestMySQLTodoRepository(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	conf.DBDriver = service.DB_DRIVER_MYSQL
+	repository := conf.todoRepository(nil)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO todo(title, description, source, metadata, due_date, tags, priority, user_id, project_id, recurrence, remind_at) VALUES(?,?,?,?,?,?,?,?,?,?,?)")).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + service.PORTABLE_TODO_COLUMNS + " FROM todo WHERE id = ?")).WithArgs(5).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 5, "Buy milk", false))
+	expectHistory(mock, service.EVENT_CREATED)
+	mock.ExpectCommit()
+	todo := service.Todo{Title: "Buy milk", Priority: service.PRIORITY_MEDIUM}
+	if err := repository.Create(ctx, testUserID, &todo); err != nil || todo.ID != 5 {
+		t.Errorf("Create = %v, id %d", err, todo.ID)
+	}
+
+	// The row is there but has another version
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+service.PORTABLE_TODO_COLUMNS+" FROM todo WHERE id = ? AND user_id = ? AND deleted_at IS NULL FOR UPDATE")).WithArgs(5, testUserID).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 5, "Buy milk", false))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE todo SET title = ?")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	_, _, err := repository.Update(ctx, testUserID, 5, 3, func(existing service.Todo) (service.Todo, error) {
+		existing.Title = "Buy oat milk"
+		return existing, nil
+	})
+	if err != service.ErrVersionConflict {
+		t.Errorf("Update = %v, want a version conflict", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE todo SET deleted_at = NOW(6), updated_at = NOW(6) WHERE id = ? AND user_id = ? AND deleted_at IS NULL")).WithArgs(6, testUserID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if _, err := repository.Delete(ctx, testUserID, 6); err != service.ErrTodoNotFound {
+		t.Errorf("Delete = %v, want not found", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMySQLListTodos(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	conf.DBDriver = service.DB_DRIVER_MYSQL
+	conf.Router = mux.NewRouter()
+	conf.routes()
+
+	// MySQL has no NULLS LAST, the missing due dates go last by IS NULL
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL")).
+		WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT "+service.PORTABLE_TODO_COLUMNS+" FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND archived = FALSE ORDER BY due_date IS NULL, due_date DESC, id LIMIT $2 OFFSET $3")).
+		WithArgs(testUserID, DEFAULT_LIMIT, 0).
+		WillReturnRows(todoRow(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false), 2, "Walk the dog", false))
+
+	_, response := serve(t, conf, http.MethodGet, "/todo?sort=-due_date", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var todos []service.Todo
+	decodeData(t, response, &todos)
+	if len(todos) != 2 {
+		t.Errorf("listed %d to-do lists, want 2", len(todos))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMySQLRoutes(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	conf.DBDriver = service.DB_DRIVER_MYSQL
+	conf.Router = mux.NewRouter()
+	conf.routes()
+
+	// Projects need RETURNING
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/project", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /project answered %d, want 404", rec.Code)
+	}
+
+	// KEY is a reserved word of MySQL
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT request_hash, response FROM idempotency_key WHERE user_id = $1 AND `key` = $2")).
+		WithArgs(testUserID, "retry-1", sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO todo(title")).WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + service.PORTABLE_TODO_COLUMNS + " FROM todo WHERE id = ?")).WithArgs(5).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 5, "Buy milk", false))
+	expectHistory(mock, service.EVENT_CREATED)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_key(user_id, `key`, request_hash, response) VALUES($1, $2, $3, $4) ON DUPLICATE KEY UPDATE")).
+		WithArgs(testUserID, "retry-1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	req := httptest.NewRequest(http.MethodPost, "/todo", strings.NewReader(`{"title":"Buy milk"}`))
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rec = httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Idempotency-Key answered %d, want 201", rec.Code)
+	}
+
+	// The id of the user comes from LAST_INSERT_ID
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users(username, password_hash, email) VALUES($1, $2, $3)")).WillReturnResult(sqlmock.NewResult(9, 1))
+	_, response := serve(t, conf, http.MethodPost, "/auth/register", `{"username":"ada","password":"correct horse battery"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	var user service.User
+	decodeData(t, response, &user)
+	if user.ID != 9 {
+		t.Errorf("user id = %d, want 9", user.ID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats buildResponse encodes the Response envelope in
+const (
+	FORMAT_JSON = "json"
+	FORMAT_XML  = "xml"
+	FORMAT_YAML = "yaml"
+)
+
+// formatMediaTypes are the media types of the Accept header with their format, wildcards get the default JSON
+var formatMediaTypes = map[string]string{
+	"application/json":   FORMAT_JSON,
+	"application/*":      FORMAT_JSON,
+	"*/*":                FORMAT_JSON,
+	"application/xml":    FORMAT_XML,
+	"text/xml":           FORMAT_XML,
+	"application/yaml":   FORMAT_YAML,
+	"application/x-yaml": FORMAT_YAML,
+	"text/yaml":          FORMAT_YAML,
+}
+
+var formatContentTypes = map[string]string{
+	FORMAT_JSON: "application/json",
+	FORMAT_XML:  "application/xml; charset=utf-8",
+	FORMAT_YAML: "application/yaml; charset=utf-8",
+}
+
+// negotiateFormat is the format of ?format=, else the one the Accept header prefers. A browser navigating to the API
+// accepts XML but after HTML, it keeps JSON. Other values of ?format= belong to the handler, like csv of the export
+func negotiateFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format == FORMAT_JSON || format == FORMAT_XML || format == FORMAT_YAML {
+		return format
+	}
+
+	best, bestWeight := FORMAT_JSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "text/html" {
+			return FORMAT_JSON
+		}
+		format, ok := formatMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		weight := 1.0
+		if q, ok := params["q"]; ok {
+			if weight, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		// On a tie the type listed first wins
+		if weight > bestWeight {
+			best, bestWeight = format, weight
+		}
+	}
+	return best
+}
+
+// formatWriter carries the format negotiated for the request and the encoding of the timestamps to buildResponse,
+// which only gets the writer
+type formatWriter struct {
+	http.ResponseWriter
+	format string
+	nulls  bool
+}
+
+func (fw *formatWriter) negotiatedFormat() string { return fw.format }
+func (fw *formatWriter) nullTimestamps() bool     { return fw.nulls }
+
+// Flush keeps streamed responses working through the wrapper
+func (fw *formatWriter) Flush() {
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (fw *formatWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades take over the connection through the wrapper
+func (fw *formatWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer can't be hijacked")
+	}
+	return hijacker.Hijack()
+}
+
+// responseFormat is the format negotiated for the response written to w, the first wrapper knowing it tells
+func responseFormat(w http.ResponseWriter) string {
+	for {
+		if negotiated, ok := w.(interface{ negotiatedFormat() string }); ok && negotiated.negotiatedFormat() != "" {
+			return negotiated.negotiatedFormat()
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return FORMAT_JSON
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// negotiateMiddleware picks the format of the responses of buildResponse. Exports, streams and GraphQL keep theirs
+func (conf *Config) negotiateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		next.ServeHTTP(&formatWriter{ResponseWriter: w, format: negotiateFormat(r), nulls: conf.NullTimestamps}, r)
+	})
+}
+
+// writeBody encodes value in the format negotiated for w. XML and YAML are converted from the JSON encoding, so they
+// have the same field names and order
+func writeBody(w http.ResponseWriter, status int, value interface{}) {
+	format := responseFormat(w)
+	data, err := marshalResponse(value, writesNullTimestamps(w))
+	var node *yaml.Node
+	if format != FORMAT_JSON && err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		node, err = documentNode(decoder)
+	}
+	// The value can't be encoded at all, JSON says so with its empty body as before
+	if err != nil {
+		format = FORMAT_JSON
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.WriteHeader(status)
+	switch format {
+	case FORMAT_XML:
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		writeXMLNode(encoder, "response", node)
+		encoder.Flush()
+	case FORMAT_YAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		encoder.Encode(node)
+		encoder.Close()
+	default:
+		if err == nil {
+			w.Write(append(data, '\n'))
+		}
+	}
+}
+
+// documentNode reads the next JSON value of the decoder into a YAML node, which keeps the order of the fields
+func documentNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if value == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			child, err := documentNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// The closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case json.Number:
+		if strings.ContainsAny(value.String(), ".eE") {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: value.String()}, nil
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: value.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+// writeXMLNode writes node as the element name: the fields of an object are its elements, the values of an array
+// repeated <item> elements and null an empty element. A key which isn't an XML name, like one of the metadata, is
+// written as <entry key="...">
+func writeXMLNode(encoder *xml.Encoder, name string, node *yaml.Node) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := writeXMLNode(encoder, node.Content[i].Value, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := writeXMLNode(encoder, "item", child); err != nil {
+				return err
+			}
+		}
+	default:
+		if node.Tag != "!!null" {
+			if err := encoder.EncodeToken(xml.CharData(node.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// isXMLName reports whether name may be used as an element name as it is
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r) && r != '-' && r != '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   string
+	}{
+		{name: "default", target: "/todo", want: FORMAT_JSON},
+		{name: "wildcard", target: "/todo", accept: "*/*", want: FORMAT_JSON},
+		{name: "XML", target: "/todo", accept: "application/xml", want: FORMAT_XML},
+		{name: "preferred YAML", target: "/todo", accept: "application/json;q=0.5, text/yaml", want: FORMAT_YAML},
+		{name: "first of a tie", target: "/todo", accept: "text/xml, application/json", want: FORMAT_XML},
+		{name: "unsupported", target: "/todo", accept: "text/plain", want: FORMAT_JSON},
+		{name: "browser", target: "/todo", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: FORMAT_JSON},
+		{name: "override", target: "/todo?format=yaml", accept: "application/xml", want: FORMAT_YAML},
+		{name: "format of the export", target: "/todo/export?format=csv", accept: "application/xml", want: FORMAT_XML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := negotiateFormat(req); got != tt.want {
+				t.Errorf("negotiateFormat = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteBodyFormats(t *testing.T) {
+	data := map[string]interface{}{"title": "Milk & eggs", "tags": []string{"home", "shop"}, "my key": nil, "done": false}
+	tests := []struct {
+		format      string
+		contentType string
+		want        []string
+	}{
+		{
+			format: FORMAT_XML, contentType: "application/xml; charset=utf-8",
+			want: []string{`<?xml version="1.0" encoding="UTF-8"?>`, "<response><data><done>false</done>", `<entry key="my key"></entry>`,
+				"<tags><item>home</item><item>shop</item></tags><title>Milk &amp; eggs</title></data><status>200</status>"},
+		},
+		{
+			format: FORMAT_YAML, contentType: "application/yaml; charset=utf-8",
+			want: []string{"data:\n  done: false\n  my key: null\n  tags:\n    - home\n    - shop\n  title: Milk & eggs\nstatus: 200\nmessage: Success\n"},
+		},
+		{
+			format: FORMAT_JSON, contentType: "application/json",
+			want: []string{`{"data":{"done":false,"my key":null,"tags":["home","shop"],"title":"Milk \u0026 eggs"},"status":200,"message":"Success"}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			buildResponse(&formatWriter{ResponseWriter: rec, format: tt.format}, data, http.StatusOK, MESSAGE_SUCCESS)
+			if contentType := rec.Header().Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", contentType, tt.contentType)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body %q doesn't have %q", rec.Body.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestNegotiateMiddlewareSelect(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.Router.HandleFunc("/negotiated", func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, map[string]int{"id": 7}, http.StatusOK, MESSAGE_SUCCESS)
+	})
+	handler := conf.negotiateMiddleware(conf.Router)
+
+	// ?select= reduces the JSON of the handler, then writes the part in the format asked for
+	req := httptest.NewRequest(http.MethodGet, "/negotiated?select=$.data.id", nil)
+	req.Header.Set("Accept", "application/xml")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.HasSuffix(body, "<response>7</response>") || rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("body = %q, Vary = %q", body, rec.Header().Get("Vary"))
+	}
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+
+	"to-do-list/service"
+)
+
+const (
+	OAUTH_GOOGLE = "google"
+	OAUTH_GITHUB = "github"
+
+	// The state and the PKCE verifier of a sign-in in progress, they live in a cookie until the callback
+	OAUTH_STATE_COOKIE = "oauth_state"
+	OAUTH_STATE_TTL    = 10 * time.Minute
+
+	// Bodies of the APIs of the providers are small, anything bigger isn't a user
+	MAX_OAUTH_RESPONSE_BYTES = 1 << 20
+)
+
+// OAuthProvider signs users in with the authorization code flow of one provider
+type OAuthProvider struct {
+	Config oauth2.Config
+	// UserURL is the API of the provider describing the account of a token
+	UserURL  string
+	Identify func(ctx context.Context, client *http.Client, userURL string) (service.OAuthIdentity, error)
+}
+
+// OAuthConfig is the providers users may sign in with and where the sign-in ends
+type OAuthConfig struct {
+	Providers map[string]*OAuthProvider
+	// BaseURL is the public URL of the API the providers redirect back to, the URL of the request when empty
+	BaseURL string
+	// SuccessURL gets the token in its fragment at the end of the sign-in, the token is the JSON response when empty
+	SuccessURL string
+}
+
+// names are the configured providers, sorted
+func (c *OAuthConfig) names() []string {
+	if c == nil {
+		return nil
+	}
+	names := make([]string, 0, len(c.Providers))
+	for name := range c.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getJSON decodes the JSON of a GET to the API of a provider
+func getJSON(ctx context.Context, client *http.Client, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, MAX_OAUTH_RESPONSE_BYTES)).Decode(v)
+}
+
+// IdentifyGoogle reads the OpenID Connect userinfo of the account
+func IdentifyGoogle(ctx context.Context, client *http.Client, userURL string) (service.OAuthIdentity, error) {
+	var user struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := getJSON(ctx, client, userURL, &user); err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	if user.Subject == "" {
+		return service.OAuthIdentity{}, errors.New("userinfo has no sub")
+	}
+	identity := service.OAuthIdentity{Subject: user.Subject, Username: user.Name}
+	if user.EmailVerified {
+		identity.Email = user.Email
+		identity.Username, _, _ = strings.Cut(user.Email, "@")
+	}
+	return identity, nil
+}
+
+// IdentifyGitHub reads the account and its primary email, which only counts when GitHub verified it
+func IdentifyGitHub(ctx context.Context, client *http.Client, userURL string) (service.OAuthIdentity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := getJSON(ctx, client, userURL, &user); err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	if user.ID == 0 {
+		return service.OAuthIdentity{}, errors.New("user has no id")
+	}
+	identity := service.OAuthIdentity{Subject: strconv.FormatInt(user.ID, 10), Username: user.Login}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, userURL+"/emails", &emails); err != nil {
+		return service.OAuthIdentity{}, err
+	}
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			identity.Email = email.Email
+		}
+	}
+	return identity, nil
+}
+
+// oauthProvider is the provider of the path, nil after answering 404 when it isn't configured
+func (conf *Config) oauthProvider(w http.ResponseWriter, r *http.Request) (string, *OAuthProvider) {
+	name := mux.Vars(r)["provider"]
+	if conf.OAuth != nil {
+		if provider, ok := conf.OAuth.Providers[name]; ok {
+			return name, provider
+		}
+	}
+	buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+	return name, nil
+}
+
+// redirectURL is the callback the provider sends the browser back to, registered at the provider. It has the version
+// prefix of the sign-in, the alias without it works as before
+func (conf *Config) redirectURL(r *http.Request, name string) string {
+	base := conf.OAuth.BaseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + versionPrefix(r.URL.Path) + "/auth/oauth/" + name + "/callback"
+}
+
+// startOAuth sends the browser to the provider to sign in
+func (conf *Config) startOAuth(w http.ResponseWriter, r *http.Request) {
+	name, provider := conf.oauthProvider(w, r)
+	if provider == nil {
+		return
+	}
+	authURL, err := conf.beginOAuth(w, r, name, provider, 0)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OAuthLink is where the browser of a signed in user goes to link an account of the provider
+type OAuthLink struct {
+	URL string `json:"url"`
+}
+
+// linkOAuth starts the sign-in with the provider which links its account to the user, whatever its email. The
+// browser follows the url of the response, the cookie carrying the user must come back with the callback
+func (conf *Config) linkOAuth(w http.ResponseWriter, r *http.Request) {
+	name, provider := conf.oauthProvider(w, r)
+	if provider == nil {
+		return
+	}
+	authURL, err := conf.beginOAuth(w, r, name, provider, currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	buildResponse(w, OAuthLink{URL: authURL}, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// beginOAuth returns the URL of the provider to sign in at. The state against forged callbacks and the PKCE verifier
+// stay in a cookie the callback checks, with the user linking the account and its MAC when linkUserID isn't 0
+func (conf *Config) beginOAuth(w http.ResponseWriter, r *http.Request, name string, provider *OAuthProvider, linkUserID int) (string, error) {
+	state := make([]byte, 32)
+	if _, err := rand.Read(state); err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	value := hex.EncodeToString(state) + "." + verifier
+	if linkUserID != 0 {
+		value += "." + strconv.Itoa(linkUserID) + "." + conf.linkMAC(hex.EncodeToString(state), linkUserID)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     OAUTH_STATE_COOKIE,
+		Value:    value,
+		Path:     versionPrefix(r.URL.Path) + "/auth/oauth/" + name,
+		MaxAge:   int(OAUTH_STATE_TTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		// Lax still sends it on the redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	config := provider.Config
+	config.RedirectURL = conf.redirectURL(r, name)
+	return config.AuthCodeURL(hex.EncodeToString(state), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// linkMAC binds the sign-in of state to the user linking the account, the cookie can't be changed to link it to
+// another user
+func (conf *Config) linkMAC(state string, userID int) string {
+	mac := hmac.New(sha256.New, conf.JWTSecret)
+	fmt.Fprintf(mac, "oauth-link.%s.%d", state, userID)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseOAuthState reads the state cookie, linkUserID is 0 unless the sign-in links the account to that user
+func (conf *Config) parseOAuthState(value string) (state, verifier string, linkUserID int, err error) {
+	parts := strings.Split(value, ".")
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], 0, nil
+	case 4:
+		linkUserID, err = strconv.Atoi(parts[2])
+		if err != nil || linkUserID <= 0 || !hmac.Equal([]byte(parts[3]), []byte(conf.linkMAC(parts[0], linkUserID))) {
+			return "", "", 0, errors.New("invalid link of the OAuth sign-in")
+		}
+		return parts[0], parts[1], linkUserID, nil
+	}
+	return "", "", 0, errors.New("invalid OAuth state")
+}
+
+// oauthCallback finishes the sign-in: it exchanges the code, signs in the local user of the account, linking or
+// creating it, and issues a token like POST /auth/login
+func (conf *Config) oauthCallback(w http.ResponseWriter, r *http.Request) {
+	name, provider := conf.oauthProvider(w, r)
+	if provider == nil {
+		return
+	}
+	// The cookie is used up whatever happens next
+	http.SetCookie(w, &http.Cookie{Name: OAUTH_STATE_COOKIE, Path: versionPrefix(r.URL.Path) + "/auth/oauth/" + name, MaxAge: -1, HttpOnly: true})
+
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		buildErrorResponse(w, nil, http.StatusUnauthorized, CODE_UNAUTHORIZED, "sign-in with "+name+" failed: "+reason)
+		return
+	}
+	cookie, err := r.Cookie(OAUTH_STATE_COOKIE)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_BAD_REQUEST, "the sign-in expired, start it again")
+		return
+	}
+	state, verifier, linkUserID, err := conf.parseOAuthState(cookie.Value)
+	if err != nil || query.Get("code") == "" || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_BAD_REQUEST, "the callback doesn't match the sign-in, start it again")
+		return
+	}
+
+	config := provider.Config
+	config.RedirectURL = conf.redirectURL(r, name)
+	token, err := config.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		slog.WarnContext(r.Context(), "OAuth code exchange failed", "provider", name, "error", err)
+		buildResponse(w, nil, http.StatusUnauthorized, MESSAGE_FAILED)
+		return
+	}
+	identity, err := provider.Identify(r.Context(), config.Client(r.Context(), token), provider.UserURL)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Reading the OAuth account failed", "provider", name, "error", err)
+		buildErrorResponse(w, nil, http.StatusBadGateway, CODE_UNAVAILABLE, "reading the account at "+name+" failed")
+		return
+	}
+
+	userID, err := conf.users().OAuthUser(r.Context(), name, identity, linkUserID)
+	if err == service.ErrIdentityLinked {
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_CONFLICT, err.Error())
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	issued, err := conf.signIn(r, userID)
+	if err == errUserDisabled {
+		buildErrorResponse(w, nil, http.StatusForbidden, CODE_UNAUTHORIZED, err.Error())
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	if conf.OAuth.SuccessURL != "" {
+		// The fragment stays in the browser, it isn't sent to the server of the page
+		fragment := url.Values{"token": {issued.Token}, "expires_at": {issued.ExpiresAt.UTC().Format(time.RFC3339)}}
+		if issued.RefreshToken != "" {
+			fragment.Set("refresh_token", issued.RefreshToken)
+			fragment.Set("refresh_expires_at", issued.RefreshExpiresAt.UTC().Format(time.RFC3339))
+		}
+		http.Redirect(w, r, conf.OAuth.SuccessURL+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+	buildResponse(w, issued, http.StatusOK, MESSAGE_SUCCESS)
+}
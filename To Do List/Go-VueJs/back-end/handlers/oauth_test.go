@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/oauth2"
+
+	"to-do-list/service"
+)
+
+// newTestGitHub serves the token endpoint and the user API of GitHub for the account 42
+func newTestGitHub(t *testing.T) *OAuthProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			if r.FormValue("code") != "the-code" || r.FormValue("code_verifier") != "the-verifier" {
+				http.Error(w, `{"error":"bad_verification_code"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token":"gho_token","token_type":"bearer"}`))
+		case "/user":
+			w.Write([]byte(`{"id":42,"login":"octo cat"}`))
+		case "/user/emails":
+			w.Write([]byte(`[{"email":"old@example.com","primary":false,"verified":true},{"email":"octo@example.com","primary":true,"verified":true}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &OAuthProvider{
+		Config: oauth2.Config{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			Endpoint:     oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"},
+		},
+		UserURL:  server.URL + "/user",
+		Identify: IdentifyGitHub,
+	}
+}
+
+func TestStartOAuth(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}, BaseURL: "https://todo.example.com"}
+
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oauth/github", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	if query.Get("redirect_uri") != "https://todo.example.com/auth/oauth/github/callback" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("redirect to %s", location)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !strings.HasPrefix(cookies[0].Value, query.Get("state")+".") || !cookies[0].HttpOnly {
+		t.Errorf("cookies = %+v, want the state %q", cookies, query.Get("state"))
+	}
+
+	_, response := serve(t, conf, http.MethodGet, "/auth/oauth/gitlab", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+}
+
+func TestOAuthCallback(t *testing.T) {
+	callback := func(conf *Config, state string, link ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oauth/github/callback?code=the-code&state="+state, nil)
+		req.AddCookie(&http.Cookie{Name: OAUTH_STATE_COOKIE, Value: strings.Join(append([]string{"the-state", "the-verifier"}, link...), ".")})
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("links the user with the verified email", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}}
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id FROM user_identity WHERE provider = $1 AND subject = $2")).
+			WithArgs(OAUTH_GITHUB, "42").WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM users WHERE email = $1 AND email_verified ORDER BY id LIMIT 2")).
+			WithArgs("octo@example.com").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identity(provider, subject, user_id) VALUES($1, $2, $3)")).
+			WithArgs(OAUTH_GITHUB, "42", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT disabled_at IS NOT NULL FROM users WHERE id = $1")).WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(false))
+
+		var response Response
+		if err := json.Unmarshal(callback(conf, "the-state").Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		checkResponse(t, response, http.StatusOK, "")
+		var token Token
+		decodeData(t, response, &token)
+		if userID, err := conf.parseToken(token.Token); err != nil || userID != 3 {
+			t.Errorf("token of user %d (%v), want 3", userID, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("creates a user", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}, SuccessURL: "https://app.example.com/login"}
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_identity")).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE email = $1")).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)")).
+			WithArgs("octo-cat").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users(username, password_hash, email, email_verified) VALUES($1, $2, $3, $4) RETURNING id")).
+			WithArgs("octo-cat", "", "octo@example.com", true).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identity")).WithArgs(OAUTH_GITHUB, "42", 9).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT disabled_at IS NOT NULL FROM users WHERE id = $1")).WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(false))
+
+		rec := callback(conf, "the-state")
+		location, err := url.Parse(rec.Header().Get("Location"))
+		if rec.Code != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), "https://app.example.com/login#") {
+			t.Fatalf("status = %d, redirect to %q", rec.Code, rec.Header().Get("Location"))
+		}
+		fragment, _ := url.ParseQuery(location.Fragment)
+		if userID, err := conf.parseToken(fragment.Get("token")); err != nil || userID != 9 {
+			t.Errorf("token of user %d (%v), want 9", userID, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("links the account to the signed in user", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}}
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_identity")).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identity")).WithArgs(OAUTH_GITHUB, "42", 5).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT disabled_at IS NOT NULL FROM users WHERE id = $1")).WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(false))
+
+		var response Response
+		if err := json.Unmarshal(callback(conf, "the-state", "5", conf.linkMAC("the-state", 5)).Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		checkResponse(t, response, http.StatusOK, "")
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("linked to another user", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}}
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_identity")).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+		mock.ExpectRollback()
+
+		var response Response
+		if err := json.Unmarshal(callback(conf, "the-state", "5", conf.linkMAC("the-state", 5)).Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		checkResponse(t, response, http.StatusConflict, CODE_CONFLICT)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("forged link", func(t *testing.T) {
+		conf, _ := newTestConfig(t)
+		conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}}
+		var response Response
+		if err := json.Unmarshal(callback(conf, "the-state", "3", conf.linkMAC("the-state", 5)).Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		checkResponse(t, response, http.StatusBadRequest, CODE_BAD_REQUEST)
+	})
+
+	t.Run("forged state", func(t *testing.T) {
+		conf, _ := newTestConfig(t)
+		conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}}
+		var response Response
+		if err := json.Unmarshal(callback(conf, "another-state").Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		checkResponse(t, response, http.StatusBadRequest, CODE_BAD_REQUEST)
+	})
+}
+
+func TestLinkOAuth(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.OAuth = &OAuthConfig{Providers: map[string]*OAuthProvider{OAUTH_GITHUB: newTestGitHub(t)}, BaseURL: "https://todo.example.com"}
+
+	rec, response := serve(t, conf, http.MethodPost, "/identities/github", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var link OAuthLink
+	decodeData(t, response, &link)
+	location, err := url.Parse(link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/auth/oauth/github" {
+		t.Fatalf("cookies = %+v, want the state of the callback", cookies)
+	}
+	state, _, linkUserID, err := conf.parseOAuthState(cookies[0].Value)
+	if err != nil || state != location.Query().Get("state") || linkUserID != testUserID {
+		t.Errorf("state %q of user %d (%v), want %q of the test user", state, linkUserID, err, location.Query().Get("state"))
+	}
+}
+
+func TestOAuthUsername(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"ada", "ada"},
+		{" Ada Lovelace ", "Ada-Lovelace"},
+		{"al", "al-github"},
+		{"", "github"},
+		{strings.Repeat("a", service.MAX_USERNAME_LENGTH), strings.Repeat("a", service.MAX_USERNAME_LENGTH-5)},
+	}
+	for _, tt := range tests {
+		if got := service.OAuthUsername(tt.name, OAUTH_GITHUB); got != tt.want {
+			t.Errorf("oauthUsername(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
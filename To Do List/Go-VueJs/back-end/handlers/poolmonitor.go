@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Number of consecutive intervals with new waits before the pool is reported as saturated
+const POOL_SATURATION_PERIODS = 3
+
+// PoolStats is the usage of the connection pool since the start, the go_sql_* metrics have the same numbers
+type PoolStats struct {
+	MaxOpen           int    `json:"max_open_connections"`
+	Open              int    `json:"open_connections"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDuration      string `json:"wait_duration"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// getPoolStats shows the connection pool usage to admins, to tell whether DB_MAX_OPEN_CONNS is too low
+func (conf *Config) getPoolStats(w http.ResponseWriter, r *http.Request) {
+	if !conf.isAdmin(r) {
+		buildResponse(w, nil, http.StatusForbidden, MESSAGE_FAILED)
+		return
+	}
+
+	stats := conf.Database.Stats()
+	buildResponse(w, PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDuration:      stats.WaitDuration.String(),
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// MonitorPool logs the connection pool usage every interval and warns when requests keep waiting for a connection
+func (conf *Config) MonitorPool(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastWaitCount := conf.Database.Stats().WaitCount
+	saturated := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Pool monitor stopped")
+			return
+		case <-ticker.C:
+		}
+
+		stats := conf.Database.Stats()
+		slog.Info("DB pool", "open", stats.OpenConnections, "in_use", stats.InUse, "idle", stats.Idle,
+			"max_open", stats.MaxOpenConnections, "wait_count", stats.WaitCount, "wait_duration", stats.WaitDuration)
+
+		if stats.WaitCount > lastWaitCount {
+			saturated++
+		} else {
+			saturated = 0
+		}
+		lastWaitCount = stats.WaitCount
+
+		if saturated >= POOL_SATURATION_PERIODS {
+			slog.Warn("DB pool saturated, requests are waiting for a connection",
+				"for", time.Duration(saturated)*interval, "in_use", stats.InUse, "max_open", stats.MaxOpenConnections)
+		}
+	}
+}
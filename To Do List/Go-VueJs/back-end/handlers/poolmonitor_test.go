@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetPoolStats(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.AdminKey = "admin-secret"
+	conf.Database.SetMaxOpenConns(7)
+
+	send := func(adminKey string) (*httptest.ResponseRecorder, Response) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/db/pool", nil)
+		req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+		req.Header.Set("X-Admin-Key", adminKey)
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, req)
+		var response Response
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec, response
+	}
+
+	if rec, _ := send("wrong"); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong admin key = %d, want 403", rec.Code)
+	}
+
+	rec, response := send("admin-secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin key = %d, want 200", rec.Code)
+	}
+	var stats PoolStats
+	decodeData(t, response, &stats)
+	if stats.MaxOpen != 7 || stats.WaitDuration != "0s" {
+		t.Errorf("stats = %+v", stats)
+	}
+}
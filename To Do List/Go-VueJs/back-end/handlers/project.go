@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"to-do-list/service"
+)
+
+const MAX_PROJECT_NAME_LENGTH = 100
+
+func validateProject(project service.Project) error {
+	var errs service.FieldErrors
+	errs.CheckLength("name", project.Name, true, MAX_PROJECT_NAME_LENGTH)
+	return errs.Err()
+}
+
+// projects is the ProjectRepository of the handlers
+func (conf *Config) projects() *service.ProjectRepository {
+	return &service.ProjectRepository{DB: conf.Database}
+}
+
+func (conf *Config) getProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := conf.projects().List(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, make([]service.Project, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, projects, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) getProject(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	project, err := conf.projects().Get(r.Context(), currentUser(r), projectID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, project, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) addProject(w http.ResponseWriter, r *http.Request) {
+	var newProject service.Project
+	if err := json.NewDecoder(r.Body).Decode(&newProject); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateProject(newProject); err != nil {
+		buildValidationResponse(w, newProject, err)
+		return
+	}
+
+	if err := conf.projects().Create(r.Context(), currentUser(r), &newProject); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, newProject, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) updateProject(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var updatedProject service.Project
+	if err := json.NewDecoder(r.Body).Decode(&updatedProject); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateProject(updatedProject); err != nil {
+		buildValidationResponse(w, updatedProject, err)
+		return
+	}
+
+	if err := conf.projects().Rename(r.Context(), currentUser(r), projectID, &updatedProject); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, updatedProject, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// deleteProject removes the project, its to-do list are kept without a project
+func (conf *Config) deleteProject(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	deletedProject, err := conf.projects().Delete(r.Context(), currentUser(r), projectID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, deletedProject, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getProjectTodos is GET /todo?project_id={id}, after checking the user owns the project or is a member of it
+func (conf *Config) getProjectTodos(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	if ok, err := conf.projects().Accessible(r.Context(), currentUser(r), projectID, service.ROLE_VIEWER); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	list := r.Clone(r.Context())
+	query := list.URL.Query()
+	query.Set("project_id", strconv.Itoa(projectID))
+	list.URL.RawQuery = query.Encode()
+	conf.getTodos(w, list)
+}
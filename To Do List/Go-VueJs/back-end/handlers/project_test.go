@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetProject(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, created_at FROM project WHERE id = $1 AND "+service.ProjectAccess("$2", service.ROLE_VIEWER))).
+		WithArgs(7, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(7, "Home", time.Now()))
+
+	_, response := serve(t, conf, http.MethodGet, "/project/7", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var project service.Project
+	decodeData(t, response, &project)
+	if project.ID != 7 || project.Name != "Home" {
+		t.Errorf("project = %+v", project)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProjectsOfInvalidIDs(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{method: http.MethodGet, target: "/project/abc"},
+		{method: http.MethodPut, target: "/project/abc"},
+		{method: http.MethodDelete, target: "/project/abc"},
+		{method: http.MethodGet, target: "/project/abc/todo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, tt.method, tt.target, `{"name":"Home"}`)
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"to-do-list/service"
+)
+
+func (conf *Config) queryTodos(w http.ResponseWriter, r *http.Request) {
+	var filter service.Filter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	todos, err := conf.queries().Query(r.Context(), currentUser(r), filter)
+	if err == service.ErrInvalidFilter {
+		buildResponse(w, make([]service.Todo, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, todos, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// explainQuery estimates the cost of a structured filter without running it
+func (conf *Config) explainQuery(w http.ResponseWriter, r *http.Request) {
+	var filter service.Filter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	plan, err := conf.queries().Explain(r.Context(), currentUser(r), filter)
+	if err == service.ErrInvalidFilter {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, plan, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// Clients idle for this long are forgotten, their next request starts with a full burst
+const RATE_LIMIT_IDLE = 10 * time.Minute
+
+// Time the Redis store gets per request before the request is let through unlimited
+const RATE_LIMIT_REDIS_TIMEOUT = 100 * time.Millisecond
+
+// rateResult is the state of the bucket of a client after taking a token
+type rateResult struct {
+	allowed   bool
+	remaining int
+	// Until the next token when not allowed, until the bucket is full again otherwise
+	retryAfter time.Duration
+	reset      time.Duration
+}
+
+// rateStore keeps the token buckets of the clients
+type rateStore interface {
+	take(ctx context.Context, key string, limit rate.Limit, burst int) (rateResult, error)
+}
+
+// RateLimiter allows each client limit requests per second with bursts up to burst. A client is the user the request
+// authenticated as, its IP otherwise
+type RateLimiter struct {
+	store rateStore
+	limit rate.Limit
+	burst int
+}
+
+func NewRateLimiter(perSecond, burst int) *RateLimiter {
+	return &RateLimiter{store: newMemoryRateStore(), limit: rate.Limit(perSecond), burst: burst}
+}
+
+// NewRedisRateLimiter shares the buckets through Redis, so the limits hold across replicas
+func NewRedisRateLimiter(client *redis.Client, perSecond, burst int) *RateLimiter {
+	return &RateLimiter{store: &redisRateStore{client: client}, limit: rate.Limit(perSecond), burst: burst}
+}
+
+// rateKey identifies the client of r by the user requireUser verified, never by the credential sent, so a new made up
+// token per request doesn't get a new bucket. Requests without a valid credential are counted by IP
+func rateKey(r *http.Request) string {
+	if userID := currentUser(r); userID != 0 {
+		return "user:" + strconv.Itoa(userID)
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// middleware sets the X-RateLimit-* headers and answers 429 with Retry-After once a client is over its limit, the
+// health probes are never limited. Requests go through unlimited when the store fails
+func (l *RateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isProbe(r.URL.Path) || l.allow(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow takes a token of the client of r and sets the X-RateLimit-* headers, it answers 429 and returns false when
+// the client is over its limit
+func (l *RateLimiter) allow(w http.ResponseWriter, r *http.Request) bool {
+	result, err := l.store.take(r.Context(), rateKey(r), l.limit, l.burst)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rate limit store failed, not limiting", "error", err)
+		return true
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+	if !result.allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+		buildResponse(w, nil, http.StatusTooManyRequests, MESSAGE_FAILED)
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Cleanup forgets the idle clients of the in-memory store, Redis expires them itself
+func (l *RateLimiter) Cleanup(ctx context.Context, interval time.Duration) {
+	if store, ok := l.store.(*memoryRateStore); ok {
+		store.cleanup(ctx, interval)
+	}
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// memoryRateStore keeps the buckets in the process, each replica limits on its own
+type memoryRateStore struct {
+	mu      sync.Mutex
+	clients map[string]*rateClient
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{clients: make(map[string]*rateClient)}
+}
+
+func (s *memoryRateStore) take(_ context.Context, key string, limit rate.Limit, burst int) (rateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	client, ok := s.clients[key]
+	if !ok {
+		client = &rateClient{limiter: rate.NewLimiter(limit, burst)}
+		s.clients[key] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+	tokens := client.limiter.TokensAt(now)
+	return bucketResult(delay == 0, tokens, limit, burst), nil
+}
+
+// bucketResult describes a bucket left with tokens
+func bucketResult(allowed bool, tokens float64, limit rate.Limit, burst int) rateResult {
+	result := rateResult{
+		allowed:   allowed,
+		remaining: int(math.Max(0, math.Floor(tokens))),
+		reset:     time.Duration((float64(burst) - tokens) / float64(limit) * float64(time.Second)),
+	}
+	if !allowed {
+		result.retryAfter = time.Duration((1 - tokens) / float64(limit) * float64(time.Second))
+	}
+	return result
+}
+
+// cleanup forgets the clients idle for RATE_LIMIT_IDLE so the map doesn't grow with every client ever seen
+func (s *memoryRateStore) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Rate limiter cleanup stopped")
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, client := range s.clients {
+				if now.Sub(client.lastSeen) > RATE_LIMIT_IDLE {
+					delete(s.clients, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// takeToken refills the bucket in KEYS[1] for the time since it was last seen, by the clock of Redis so the replicas
+// agree, and takes a token if there is one. The tokens are returned as a string, Redis would truncate a number
+var takeToken = redis.NewScript(`
+local limit, burst = tonumber(ARGV[1]), tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens, ts = tonumber(bucket[1]) or burst, tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * limit)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / limit * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// redisRateStore keeps the buckets in Redis, shared by every replica
+type redisRateStore struct {
+	client *redis.Client
+}
+
+func (s *redisRateStore) take(ctx context.Context, key string, limit rate.Limit, burst int) (rateResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, RATE_LIMIT_REDIS_TIMEOUT)
+	defer cancel()
+
+	reply, err := takeToken.Run(ctx, s.client, []string{"ratelimit:" + key}, float64(limit), burst).Slice()
+	if err != nil {
+		return rateResult{}, err
+	}
+	allowed, _ := reply[0].(int64)
+	tokensText, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if err != nil {
+		return rateResult{}, err
+	}
+	return bucketResult(allowed == 1, tokens, limit, burst), nil
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimiter(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+	})
+	handler := NewRateLimiter(1, 2).middleware(next)
+
+	send := func(path, remoteAddr string) (*httptest.ResponseRecorder, int) {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		var response Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+		}
+		return rec, response.Status
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, status := send("/todo", "10.0.0.1:1234"); status != http.StatusOK {
+			t.Fatalf("request %d within the burst: status = %d", i+1, status)
+		}
+	}
+
+	rec, status := send("/todo", "10.0.0.1:5678")
+	if status != http.StatusTooManyRequests {
+		t.Errorf("over the limit: status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+	}
+
+	if _, status := send("/todo", "10.0.0.2:1234"); status != http.StatusOK {
+		t.Errorf("another client: status = %d, want %d", status, http.StatusOK)
+	}
+	if _, status := send("/healthz", "10.0.0.1:1234"); status != http.StatusOK {
+		t.Errorf("health check: status = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+	})
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		replicas [2]*RateLimiter
+	}{
+		{name: "memory", replicas: [2]*RateLimiter{NewRateLimiter(1, 2), NewRateLimiter(1, 2)}},
+		{name: "redis", replicas: [2]*RateLimiter{NewRedisRateLimiter(client, 1, 2), NewRedisRateLimiter(client, 1, 2)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send := func(replica int, userID int) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+				req.RemoteAddr = "10.0.0.1:1234"
+				req = req.WithContext(context.WithValue(req.Context(), userKey{}, userID))
+				rec := httptest.NewRecorder()
+				tt.replicas[replica].middleware(next).ServeHTTP(rec, req)
+				return rec
+			}
+
+			// Both replicas spend the same bucket with Redis, only the first one without
+			first := send(0, 1)
+			if first.Header().Get("X-RateLimit-Limit") != "2" || first.Header().Get("X-RateLimit-Remaining") != "1" {
+				t.Errorf("headers = %v, want limit 2 with 1 remaining", first.Header())
+			}
+			second := send(1, 1)
+			wantRemaining := "0"
+			if tt.name == "memory" {
+				wantRemaining = "1"
+			}
+			if got := second.Header().Get("X-RateLimit-Remaining"); got != wantRemaining {
+				t.Errorf("remaining on the other replica = %s, want %s", got, wantRemaining)
+			}
+
+			send(0, 1)
+			limited := send(0, 1)
+			var response Response
+			json.Unmarshal(limited.Body.Bytes(), &response)
+			if response.Status != http.StatusTooManyRequests || limited.Header().Get("Retry-After") != "1" {
+				t.Errorf("over the limit = %d Retry-After %q, want 429 after 1s", response.Status, limited.Header().Get("Retry-After"))
+			}
+
+			// Another user from the same IP has a bucket of its own
+			if got := send(0, 2).Header().Get("X-RateLimit-Remaining"); got != "1" {
+				t.Errorf("remaining of another user = %s, want 1", got)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	// The headers are on every response the limiter lets through, whatever its status
+	statuses := []int{http.StatusOK, http.StatusNotFound, http.StatusInternalServerError}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		buildResponse(w, nil, status, MESSAGE_SUCCESS)
+	})
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	tests := []struct {
+		name    string
+		limiter *RateLimiter
+	}{
+		{name: "memory", limiter: NewRateLimiter(1, 3)},
+		{name: "redis", limiter: NewRedisRateLimiter(client, 1, 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.limiter.middleware(next)
+			send := func(status int) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/todo?status=%d", status), nil)
+				req.RemoteAddr = "10.0.0.1:1234"
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec
+			}
+
+			// Each request takes a token, the bucket is full again a second later per token taken
+			for i, status := range statuses {
+				rec := send(status)
+				if rec.Code != status {
+					t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, status)
+				}
+				want := [3]string{"3", strconv.Itoa(2 - i), strconv.Itoa(i + 1)}
+				got := [3]string{rec.Header().Get("X-RateLimit-Limit"), rec.Header().Get("X-RateLimit-Remaining"), rec.Header().Get("X-RateLimit-Reset")}
+				if got != want {
+					t.Errorf("request %d: limit, remaining, reset = %v, want %v", i+1, got, want)
+				}
+			}
+
+			limited := send(http.StatusOK)
+			if limited.Code != http.StatusTooManyRequests || limited.Header().Get("X-RateLimit-Remaining") != "0" || limited.Header().Get("X-RateLimit-Limit") != "3" {
+				t.Errorf("over the limit = %d with headers %v, want 429 with none remaining", limited.Code, limited.Header())
+			}
+		})
+	}
+}
+
+func TestRateLimiterCredentials(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	conf.RateLimiter = NewRateLimiter(1, 2)
+	handler := chain(conf.Router, conf.middlewares()...)
+	valid, _ := conf.issueToken(testUserID, time.Now())
+
+	send := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A made up credential per request is still the same client, its IP
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if status := send("Authorization", fmt.Sprintf("Bearer guess-%d", i)); status != want {
+			t.Errorf("guess %d: status = %d, want %d", i, status, want)
+		}
+	}
+	if status := send("X-API-Key", "guess"); status != http.StatusTooManyRequests {
+		t.Errorf("guessed API key: status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// The user who logged in from that IP has a bucket of its own
+	if status := send("Authorization", "Bearer "+valid.Token); status != http.StatusOK {
+		t.Errorf("logged in: status = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRedisRateStoreDown(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	server.Close()
+
+	handler := NewRedisRateLimiter(client, 1, 1).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todo", nil))
+	var response Response
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if response.Status != http.StatusOK {
+		t.Errorf("status = %d while Redis is down, want the request let through", response.Status)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"to-do-list/service"
+)
+
+const (
+	DEFAULT_PREVIEW_COUNT = 5
+	MAX_PREVIEW_COUNT     = 100
+)
+
+type RecurrencePreview struct {
+	Recurrence service.Recurrence `json:"recurrence"`
+	Start      string             `json:"start,omitempty"`
+	Count      int                `json:"count,omitempty"`
+}
+
+// parseTime accepts either a RFC3339 timestamp or a date in the given location
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(service.DATE_LAYOUT, value, loc)
+}
+
+func (conf *Config) previewRecurrence(w http.ResponseWriter, r *http.Request) {
+	var preview RecurrencePreview
+	if err := json.NewDecoder(r.Body).Decode(&preview); err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	if err := preview.Recurrence.Validate(); err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	if preview.Count == 0 {
+		preview.Count = DEFAULT_PREVIEW_COUNT
+	}
+	if preview.Count < 0 || preview.Count > MAX_PREVIEW_COUNT {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	start := time.Now().In(conf.Location)
+	if preview.Start != "" {
+		var err error
+		if start, err = parseTime(preview.Start, conf.Location); err != nil {
+			buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+			return
+		}
+	}
+
+	// The next occurrences come after the start itself
+	occurrences := make([]time.Time, 0, preview.Count)
+	for n := 1; n <= preview.Count; n++ {
+		occurrences = append(occurrences, preview.Recurrence.Occurrence(start, n))
+	}
+
+	buildResponse(w, occurrences, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// ScheduleRecurrences creates the next occurrence of recurring to-do list once they are done, until ctx is done
+// Every change triggers a sweep, so the to-do list done while the server was down are caught up on start
+func (conf *Config) ScheduleRecurrences(ctx context.Context) {
+	cursor := conf.Changes.Cursor()
+
+	for ctx.Err() == nil {
+		if created, err := conf.createOccurrences(ctx); err != nil {
+			slog.Error("Creating recurring to-do list failed", "error", err)
+		} else if created > 0 {
+			slog.Info("Created recurring to-do list", "count", created)
+		}
+
+		changes := conf.Changes.Wait(ctx, cursor, 0)
+		cursor = changes.Cursor
+	}
+	slog.Info("Recurrence job stopped")
+}
+
+// createOccurrences creates the next occurrences of the recurring to-do lists and publishes them
+func (conf *Config) createOccurrences(ctx context.Context) (int, error) {
+	created, err := conf.store().CreateOccurrences(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range created {
+		conf.todos().Publish(ctx, service.EVENT_CREATED, created[i].UserID, created[i].Todo)
+	}
+	return len(created), nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestCreateOccurrences(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET recurred = TRUE WHERE recurrence IS NOT NULL AND is_done AND NOT recurred")).
+		WillReturnRows(sqlmock.NewRows(todoColumns).AddRow(1, "Water plants", "", true, false, now, SOURCE_API, 2, []byte("{}"), now, now, nil, nil, []byte("{garden}"), service.PRIORITY_MEDIUM, nil, []byte(`{"frequency":"daily","interval":3}`), nil, service.STATUS_DONE, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo(title, description, source, metadata, priority, user_id, project_id, recurrence, due_date) SELECT")).
+		WithArgs(1, now.AddDate(0, 0, 3)).
+		WillReturnRows(sqlmock.NewRows(append([]string{"user_id"}, todoColumns...)).AddRow(testUserID, 2, "Water plants", "", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, now.AddDate(0, 0, 3), nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, []byte(`{"frequency":"daily","interval":3}`), nil, service.STATUS_BACKLOG, nil))
+	// The copy has the tags of the original
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO todo_tag(todo_id, tag_id) SELECT $1, tag_id FROM todo_tag WHERE todo_id = $2")).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO todo_history")).
+		WithArgs(2, nil, service.EVENT_CREATED, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectAudience(mock)
+
+	created, err := conf.createOccurrences(context.Background())
+	if err != nil || created != 1 {
+		t.Fatalf("createOccurrences = %d, %v, want 1", created, err)
+	}
+	changes := conf.Changes.Since(0, testUserID)
+	if len(changes.Events) != 1 || changes.Events[0].Type != service.EVENT_CREATED || changes.Events[0].TodoID != 2 {
+		t.Errorf("events = %+v, want the created to-do list", changes.Events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"to-do-list/service"
+)
+
+// Most reminders sent in one pass, the rest wait for the next tick
+const REMINDER_BATCH_SIZE = 100
+
+// Notifier delivers reminders, an error leaves the reminder to be retried on the next tick
+type Notifier interface {
+	Notify(ctx context.Context, reminder service.Reminder) error
+}
+
+// SendReminders notifies the due reminders every interval, until ctx is done
+func (conf *Config) SendReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Reminder job stopped")
+			return
+		case <-ticker.C:
+		}
+
+		sent, err := conf.sendDueReminders(ctx)
+		if err != nil {
+			slog.Error("Sending reminders failed", "error", err)
+		}
+		if sent > 0 {
+			slog.Info("Sent reminders", "count", sent)
+		}
+	}
+}
+
+// sendDueReminders notifies the reminders which are due and not sent yet, a failed one is tried again next time
+func (conf *Config) sendDueReminders(ctx context.Context) (int, error) {
+	return conf.store().SendDueReminders(ctx, REMINDER_BATCH_SIZE, func(reminder service.Reminder) error {
+		err := conf.Notifier.Notify(ctx, reminder)
+		if err != nil {
+			slog.Error("Notifying reminder failed", "todo_id", reminder.Todo.ID, "error", err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+// fakeNotifier records the reminders it sends and fails those of the to-do list in fail
+type fakeNotifier struct {
+	sent []service.Reminder
+	fail map[int]bool
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, reminder service.Reminder) error {
+	if n.fail[reminder.Todo.ID] {
+		return errors.New("mail server is down")
+	}
+	n.sent = append(n.sent, reminder)
+	return nil
+}
+
+func TestSendDueReminders(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	notifier := &fakeNotifier{fail: map[int]bool{2: true}}
+	conf.Notifier = notifier
+
+	now := time.Now()
+	rows := sqlmock.NewRows(append([]string{"user_id", "username", "email"}, todoColumns...))
+	for id := 1; id <= 2; id++ {
+		rows.AddRow(testUserID, "ana", "ana@example.com", id, "Call mum", "", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, now, service.STATUS_BACKLOG, nil)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE remind_at <= now() AND reminded_at IS NULL")).
+		WithArgs(REMINDER_BATCH_SIZE).
+		WillReturnRows(rows)
+	// Only the reminder which was delivered is recorded, the other one is retried
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE todo SET reminded_at = now() WHERE id = $1")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	sent, err := conf.sendDueReminders(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("sendDueReminders = %d, %v, want 1", sent, err)
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].UserID != testUserID || notifier.sent[0].Todo.ID != 1 {
+		t.Errorf("sent = %+v, want the reminder of to-do list 1", notifier.sent)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"to-do-list/service"
+)
+
+// ReorderRequest is either the new order of some of the to-do list the user may edit, the others following them in their
+// current order, or one to-do list moved after another
+type ReorderRequest struct {
+	IDs  []int     `json:"ids,omitempty"`
+	Move *MoveTodo `json:"move,omitempty"`
+}
+
+// MoveTodo moves the to-do list ID right after the one After, to the top when After is nil
+type MoveTodo struct {
+	ID    int  `json:"id"`
+	After *int `json:"after"`
+}
+
+// Reordered is the whole manual order of the to-do list the user may edit after a reorder
+type Reordered struct {
+	IDs []int `json:"ids"`
+}
+
+func validateReorder(request ReorderRequest) error {
+	var errs service.FieldErrors
+	if (len(request.IDs) == 0) == (request.Move == nil) {
+		errs = append(errs, service.NewFieldError("ids", service.RULE_REQUIRED, "either ids or move is required"))
+	} else {
+		seen := make(map[int]bool, len(request.IDs))
+		for _, id := range request.IDs {
+			if seen[id] {
+				errs = append(errs, service.NewFieldError("ids", RULE_UNIQUE, "ids has %d more than once", id))
+				break
+			}
+			seen[id] = true
+		}
+	}
+	return errs.Err()
+}
+
+// reorder returns current with the ids of request first, or with the move applied. Every id must be in current
+func reorder(current []int, request ReorderRequest) ([]int, error) {
+	known := make(map[int]bool, len(current))
+	for _, id := range current {
+		known[id] = true
+	}
+	var errs service.FieldErrors
+
+	if request.Move != nil {
+		if !known[request.Move.ID] {
+			errs = append(errs, service.NewFieldError("move.id", service.RULE_EXISTS, "to-do list %d is not found", request.Move.ID))
+		}
+		if after := request.Move.After; after != nil && !known[*after] {
+			errs = append(errs, service.NewFieldError("move.after", service.RULE_EXISTS, "to-do list %d is not found", *after))
+		}
+		if err := errs.Err(); err != nil {
+			return nil, err
+		}
+		// Moving after itself leaves it where it is
+		if after := request.Move.After; after != nil && *after == request.Move.ID {
+			return current, nil
+		}
+
+		order := make([]int, 0, len(current))
+		if request.Move.After == nil {
+			order = append(order, request.Move.ID)
+		}
+		for _, id := range current {
+			if id == request.Move.ID {
+				continue
+			}
+			order = append(order, id)
+			if after := request.Move.After; after != nil && id == *after {
+				order = append(order, request.Move.ID)
+			}
+		}
+		return order, nil
+	}
+
+	moved := make(map[int]bool, len(request.IDs))
+	for _, id := range request.IDs {
+		if !known[id] {
+			errs = append(errs, service.NewFieldError("ids", service.RULE_EXISTS, "to-do list %d is not found", id))
+		}
+		moved[id] = true
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	order := append(make([]int, 0, len(current)), request.IDs...)
+	for _, id := range current {
+		if !moved[id] {
+			order = append(order, id)
+		}
+	}
+	return order, nil
+}
+
+// reorderTodos saves a manual order of the to-do list the user may edit, which GET /todo lists them in unless sorted
+// otherwise. Every to-do list that isn't deleted is renumbered, so the positions stay consecutive
+func (conf *Config) reorderTodos(w http.ResponseWriter, r *http.Request) {
+	var request ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateReorder(request); err != nil {
+		buildValidationResponse(w, nil, err)
+		return
+	}
+
+	order, err := conf.store().Reorder(r.Context(), currentUser(r), func(current []int) ([]int, error) {
+		order, err := reorder(current, request)
+		if err != nil {
+			return nil, service.ValidationError{Err: err}
+		}
+		return order, nil
+	})
+	var invalid service.ValidationError
+	if errors.As(err, &invalid) {
+		buildValidationResponse(w, nil, err)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, Reordered{IDs: order}, http.StatusOK, MESSAGE_SUCCESS)
+}
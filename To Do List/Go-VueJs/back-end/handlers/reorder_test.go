@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestReorder(t *testing.T) {
+	after := func(id int) *int { return &id }
+	current := []int{1, 2, 3, 4}
+	tests := []struct {
+		name    string
+		request ReorderRequest
+		want    []int
+	}{
+		{"ids first", ReorderRequest{IDs: []int{3, 1}}, []int{3, 1, 2, 4}},
+		{"every id", ReorderRequest{IDs: []int{4, 3, 2, 1}}, []int{4, 3, 2, 1}},
+		{"move to the top", ReorderRequest{Move: &MoveTodo{ID: 3}}, []int{3, 1, 2, 4}},
+		{"move after", ReorderRequest{Move: &MoveTodo{ID: 1, After: after(3)}}, []int{2, 3, 1, 4}},
+		{"move to the bottom", ReorderRequest{Move: &MoveTodo{ID: 2, After: after(4)}}, []int{1, 3, 4, 2}},
+		{"move after itself", ReorderRequest{Move: &MoveTodo{ID: 2, After: after(2)}}, []int{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reorder(current, tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, request := range []ReorderRequest{{IDs: []int{1, 9}}, {Move: &MoveTodo{ID: 9}}, {Move: &MoveTodo{ID: 1, After: after(9)}}} {
+		if _, err := reorder(current, request); err == nil {
+			t.Errorf("reorder(%+v) succeeded with an unknown to-do list", request)
+		}
+	}
+}
+
+func TestReorderTodos(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM todo WHERE " + service.TodoAccess("", "$1", service.ROLE_EDITOR) + " AND deleted_at IS NULL ORDER BY position IS NULL, position, id FOR UPDATE")).
+		WithArgs(testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE todo SET position = o.position FROM unnest($2::int[]) WITH ORDINALITY")).
+		WithArgs(testUserID, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	_, response := serve(t, conf, http.MethodPost, "/todo/reorder", `{"move":{"id":3,"after":1}}`)
+	checkResponse(t, response, http.StatusOK, "")
+	var reordered Reordered
+	decodeData(t, response, &reordered)
+	if !reflect.DeepEqual(reordered.IDs, []int{1, 3, 2}) {
+		t.Errorf("ids = %v, want [1 3 2]", reordered.IDs)
+	}
+
+	// An id the user may not edit is unknown, nothing is renumbered
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM todo WHERE " + service.TodoAccess("", "$1", service.ROLE_EDITOR))).
+		WithArgs(testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectRollback()
+	_, response = serve(t, conf, http.MethodPost, "/todo/reorder", `{"ids":[2,7]}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	for _, body := range []string{`{}`, `{"ids":[1,1]}`, `{"ids":[1],"move":{"id":2}}`, `[1,2]`} {
+		_, response = serve(t, conf, http.MethodPost, "/todo/reorder", body)
+		checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"to-do-list/service"
+)
+
+// searchTodos ranks the to-do list of the user whose title or description match the full-text query q
+func (conf *Config) searchTodos(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		buildResponse(w, make([]service.Todo, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	todos, total, err := conf.queries().Search(r.Context(), currentUser(r), q, limit, offset)
+	if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	conf.buildPaginatedResponse(w, todos, newPagination(r, limit, offset, total), http.StatusOK, MESSAGE_SUCCESS)
+}
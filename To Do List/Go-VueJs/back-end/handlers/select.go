@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// A step of a select expression, either a field name or an array wildcard
+type selectStep struct {
+	field    string
+	wildcard bool
+}
+
+var errUnsupportedSelect = errors.New("unsupported select expression")
+
+// parseSelect accepts a JSONPath subset: "$" followed by ".field" and "[*]" steps, e.g. "$.data[*].title"
+func parseSelect(expr string) ([]selectStep, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, errUnsupportedSelect
+	}
+	expr = expr[1:]
+
+	var steps []selectStep
+	for expr != "" {
+		switch {
+		case strings.HasPrefix(expr, "[*]"):
+			steps = append(steps, selectStep{wildcard: true})
+			expr = expr[3:]
+		case expr[0] == '.':
+			end := 1
+			for end < len(expr) && isFieldChar(expr[end]) {
+				end++
+			}
+			if end == 1 {
+				return nil, errUnsupportedSelect
+			}
+			steps = append(steps, selectStep{field: expr[1:end]})
+			expr = expr[end:]
+		default:
+			return nil, errUnsupportedSelect
+		}
+	}
+	return steps, nil
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// evaluateSelect returns a list when the expression has a wildcard, otherwise a single value
+func evaluateSelect(steps []selectStep, document interface{}) interface{} {
+	nodes := []interface{}{document}
+	multiple := false
+
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			if step.wildcard {
+				if items, ok := node.([]interface{}); ok {
+					next = append(next, items...)
+				}
+				continue
+			}
+			if object, ok := node.(map[string]interface{}); ok {
+				if value, ok := object[step.field]; ok {
+					next = append(next, value)
+				}
+			}
+		}
+		nodes = next
+		multiple = multiple || step.wildcard
+	}
+
+	if multiple {
+		if nodes == nil {
+			return make([]interface{}, 0)
+		}
+		return nodes
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// Written once the body is reduced, Unwrap lets recordAbort reach it
+	w http.ResponseWriter
+	// The format the body is written in, the one of w when empty
+	format string
+}
+
+func (b *bufferedResponseWriter) Header() http.Header         { return b.header }
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponseWriter) WriteHeader(status int)      { b.status = status }
+func (b *bufferedResponseWriter) Unwrap() http.ResponseWriter { return b.w }
+func (b *bufferedResponseWriter) negotiatedFormat() string    { return b.format }
+
+// selectMiddleware reduces a JSON response to the part chosen by the "select" query parameter, then writes it in the
+// negotiated format
+func selectMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expr := r.URL.Query().Get("select")
+		if expr == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		steps, err := parseSelect(expr)
+		if err != nil {
+			buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+			return
+		}
+
+		buffered := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK, w: w, format: FORMAT_JSON}
+		next.ServeHTTP(buffered, r)
+
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(buffered.body.Bytes()))
+		decoder.UseNumber()
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") || decoder.Decode(&document) != nil {
+			w.WriteHeader(buffered.status)
+			w.Write(buffered.body.Bytes())
+			return
+		}
+
+		w.Header().Del("Content-Length")
+		writeBody(w, buffered.status, evaluateSelect(steps, document))
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// The plain HTTP listener only redirects, it gets short timeouts
+	REDIRECT_TIMEOUT = 5 * time.Second
+)
+
+// ServerTLS serves the API over HTTPS with the certificate of CertFile and KeyFile, or one Let's Encrypt issues for
+// the domains of the autocert manager
+type ServerTLS struct {
+	CertFile string
+	KeyFile  string
+	Manager  *autocert.Manager
+	// Address of the plain HTTP listener redirecting to HTTPS, empty for none. With autocert it also answers the
+	// HTTP-01 challenges
+	RedirectAddr string
+}
+
+// TLSConfig is the TLS config of the HTTPS server, the certificate files are passed to ListenAndServeTLS instead
+func (t *ServerTLS) TLSConfig() *tls.Config {
+	if t.Manager != nil {
+		// Adds the acme-tls/1 protocol, so the TLS-ALPN-01 challenge works without the redirect listener
+		config := t.Manager.TLSConfig()
+		config.MinVersion = tls.VersionTLS12
+		return config
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// serve runs server over HTTPS until it is shut down
+func (t *ServerTLS) serve(server *http.Server) error {
+	server.TLSConfig = t.TLSConfig()
+	return server.ListenAndServeTLS(t.CertFile, t.KeyFile)
+}
+
+// redirectServer is the plain HTTP listener sending clients to the HTTPS server on httpsAddr
+func (t *ServerTLS) redirectServer(httpsAddr string) *http.Server {
+	var handler http.Handler = redirectToHTTPS(httpsAddr)
+	if t.Manager != nil {
+		handler = t.Manager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              t.RedirectAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: REDIRECT_TIMEOUT,
+		ReadTimeout:       REDIRECT_TIMEOUT,
+		WriteTimeout:      REDIRECT_TIMEOUT,
+	}
+}
+
+// redirectToHTTPS redirects to the same URL on the HTTPS server, keeping the method and body with a 308
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// serveRedirects runs the redirect listener until ctx is done, or returns the error it failed with
+func (t *ServerTLS) serveRedirects(ctx context.Context, httpsAddr string) error {
+	server := t.redirectServer(httpsAddr)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), REDIRECT_TIMEOUT)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Redirecting HTTP to HTTPS", "addr", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("redirect server failed: %w", err)
+	}
+	return nil
+}
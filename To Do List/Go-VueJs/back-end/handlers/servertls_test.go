@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		target    string
+		want      string
+	}{
+		{name: "default port", httpsAddr: ":443", target: "http://todo.example.com/todo?page=2", want: "https://todo.example.com/todo?page=2"},
+		{name: "other port", httpsAddr: ":8443", target: "http://todo.example.com:8080/todo", want: "https://todo.example.com:8443/todo"},
+		{name: "IPv6", httpsAddr: ":443", target: "http://[::1]:8080/todo", want: "https://[::1]/todo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(tt.httpsAddr).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+			if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.want {
+				t.Errorf("redirect = %d %q, want 308 %q", rec.Code, rec.Header().Get("Location"), tt.want)
+			}
+		})
+	}
+}
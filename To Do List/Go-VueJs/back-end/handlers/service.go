@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"to-do-list/service"
+)
+
+// todos is the TodoService of the handlers
+func (conf *Config) todos() *service.TodoService {
+	return &service.TodoService{Repository: conf.todoRepository(nil), Changes: conf.Changes, LockCompleted: conf.LockCompleted, Transitions: conf.StatusTransitions}
+}
+
+// todosInTx is the TodoService within a transaction of the caller, who publishes the changes after its commit
+func (conf *Config) todosInTx(tx *sql.Tx) *service.TodoService {
+	return &service.TodoService{Repository: conf.todoRepository(tx), LockCompleted: conf.LockCompleted, Transitions: conf.StatusTransitions}
+}
+
+// todoRepository stores the to-do lists in the database of DB_DRIVER, within tx when it isn't nil
+func (conf *Config) todoRepository(tx *sql.Tx) service.TodoRepository {
+	return service.NewTodoRepository(conf.Database, conf.DBDriver, tx)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"to-do-list/service"
+)
+
+const (
+	MAX_USER_AGENT_LENGTH = 255
+)
+
+var (
+	errSessionRevoked = errors.New("the session of the token is revoked")
+	errUserDisabled   = errors.New("user is disabled")
+)
+
+// refreshTokenHash is what user_session stores of a refresh token, like APIKeyHash
+func refreshTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// userAgent is the User-Agent of the request cut to what user_session keeps, to tell the sessions apart
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+	for len(agent) > MAX_USER_AGENT_LENGTH || !utf8.ValidString(agent) {
+		_, size := utf8.DecodeLastRuneInString(agent)
+		agent = agent[:len(agent)-size]
+	}
+	return agent
+}
+
+// sessions is the SessionRepository of the handlers
+func (conf *Config) sessions() *service.SessionRepository {
+	return &service.SessionRepository{DB: conf.Database, Driver: conf.DBDriver}
+}
+
+// signIn issues the tokens of a login. With a REFRESH_TOKEN_TTL it starts a session and adds its refresh token, else
+// the token is all there is until it expires. A disabled user gets errUserDisabled
+func (conf *Config) signIn(r *http.Request, userID int) (Token, error) {
+	if disabled, err := conf.users().IsDisabled(r.Context(), userID); err != nil {
+		return Token{}, err
+	} else if disabled {
+		return Token{}, errUserDisabled
+	}
+
+	now := time.Now().UTC()
+	if conf.RefreshTokenTTL == 0 {
+		return conf.issueToken(userID, now)
+	}
+
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return Token{}, err
+	}
+	expiresAt := now.Add(conf.RefreshTokenTTL)
+	sessionID, err := conf.sessions().Start(r.Context(), userID, userAgent(r), refreshTokenHash(refresh), now, expiresAt)
+	if err != nil {
+		return Token{}, err
+	}
+	return conf.issueRefreshToken(userID, sessionID, refresh, now, expiresAt)
+}
+
+// newRefreshToken is a random refresh token, of which the database only stores the hash
+func newRefreshToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// issueRefreshToken returns the stored refresh token of the session with a token of the session
+func (conf *Config) issueRefreshToken(userID, sessionID int, refresh string, now, expiresAt time.Time) (Token, error) {
+	token, err := conf.issueSessionToken(userID, sessionID, now)
+	if err != nil {
+		return Token{}, err
+	}
+	token.RefreshToken = refresh
+	token.RefreshExpiresAt = &expiresAt
+	return token, nil
+}
+
+// checkSession refuses the token of a revoked or expired session with errSessionRevoked, a token without a session
+// only expires
+func (conf *Config) checkSession(ctx context.Context, userID, sessionID int) error {
+	if sessionID == 0 {
+		return nil
+	}
+	if active, err := conf.sessions().IsActive(ctx, userID, sessionID, time.Now().UTC()); err != nil {
+		return err
+	} else if !active {
+		return errSessionRevoked
+	}
+	return nil
+}
+
+// refreshToken exchanges a refresh token for a new token and refresh token. Each refresh token is used once: using
+// one again means it was copied, so the session is revoked and neither the thief nor the user refreshes any more
+func (conf *Config) refreshToken(w http.ResponseWriter, r *http.Request) {
+	if conf.RefreshTokenTTL == 0 {
+		buildErrorResponse(w, nil, http.StatusNotImplemented, CODE_UNAVAILABLE, "refresh tokens are disabled, REFRESH_TOKEN_TTL is 0")
+		return
+	}
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if input.RefreshToken == "" {
+		buildValidationResponse(w, nil, service.FieldErrors{service.NewFieldError("refresh_token", service.RULE_REQUIRED, "refresh_token is required")})
+		return
+	}
+
+	next, err := newRefreshToken()
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(conf.RefreshTokenTTL)
+	userID, sessionID, err := conf.sessions().Refresh(r.Context(), refreshTokenHash(input.RefreshToken), refreshTokenHash(next), now, expiresAt)
+	switch {
+	case err == service.ErrInvalidRefreshToken:
+		buildResponse(w, nil, http.StatusUnauthorized, MESSAGE_FAILED)
+		return
+	case err == service.ErrRefreshTokenReused:
+		buildErrorResponse(w, nil, http.StatusUnauthorized, CODE_UNAUTHORIZED, err.Error())
+		return
+	case err != nil:
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	token, err := conf.issueRefreshToken(userID, sessionID, next, now, expiresAt)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	buildResponse(w, token, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// logout revokes the session of the refresh token in the body, else the one of the bearer token. Every token of the
+// session stops working, logging out of an ended session is no error
+func (conf *Config) logout(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// The body is optional with a bearer token
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+
+	now := time.Now().UTC()
+	var err error
+	if input.RefreshToken != "" {
+		err = conf.sessions().RevokeRefreshToken(r.Context(), refreshTokenHash(input.RefreshToken), now)
+	} else {
+		bearer := r.Header.Get("Authorization")
+		userID, sessionID, parseErr := conf.parseSessionToken(strings.TrimPrefix(bearer, "Bearer "))
+		if !strings.HasPrefix(bearer, "Bearer ") || parseErr != nil || sessionID == 0 {
+			buildErrorResponse(w, nil, http.StatusUnauthorized, CODE_UNAUTHORIZED, "a refresh token or the token of a session is required")
+			return
+		}
+		err = conf.sessions().Revoke(r.Context(), userID, sessionID, now)
+	}
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getSessions lists the active sessions to admins, the last used first, of every user or the one of ?user_id=
+func (conf *Config) getSessions(w http.ResponseWriter, r *http.Request) {
+	if !conf.isAdmin(r) {
+		buildResponse(w, nil, http.StatusForbidden, MESSAGE_FAILED)
+		return
+	}
+
+	var userID int
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		var err error
+		if userID, err = strconv.Atoi(value); err != nil || userID <= 0 {
+			buildValidationResponse(w, nil, service.FieldErrors{service.NewFieldError("user_id", service.RULE_TYPE, "user_id must be a positive integer")})
+			return
+		}
+	}
+	sessions, err := conf.sessions().Active(r.Context(), time.Now().UTC(), userID)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, sessions, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// revokeSession ends a session for admins, like the logout of its user
+func (conf *Config) revokeSession(w http.ResponseWriter, r *http.Request) {
+	if !conf.isAdmin(r) {
+		buildResponse(w, nil, http.StatusForbidden, MESSAGE_FAILED)
+		return
+	}
+
+	sessionID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := conf.sessions().RevokeByID(r.Context(), sessionID, time.Now().UTC()); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
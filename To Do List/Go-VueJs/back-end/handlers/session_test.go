@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/crypto/bcrypt"
+
+	"to-do-list/service"
+)
+
+const REFRESH_QUERY = "SELECT s.id, s.user_id, s.expires_at, s.revoked_at, t.used_at FROM refresh_token t JOIN user_session s ON s.id = t.session_id WHERE t.token_hash = $1"
+
+func TestLoginStartsSession(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, mock := newTestConfig(t)
+	conf.RefreshTokenTTL = 24 * time.Hour
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash FROM users WHERE username = $1")).WithArgs("ana").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}).AddRow(7, string(hash)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT disabled_at IS NOT NULL FROM users WHERE id = $1")).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_session(user_id, user_agent, created_at, last_used_at, expires_at) VALUES($1, $2, $3, $4, $5) RETURNING id")).
+		WithArgs(7, "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO refresh_token(token_hash, session_id, created_at) VALUES($1, $2, $3)")).
+		WithArgs(sqlmock.AnyArg(), 3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, response := serve(t, conf, http.MethodPost, "/auth/login", `{"username":"ana","password":"correct horse"}`)
+	checkResponse(t, response, http.StatusOK, "")
+	var token Token
+	decodeData(t, response, &token)
+	if userID, sessionID, err := conf.parseSessionToken(token.Token); err != nil || userID != 7 || sessionID != 3 {
+		t.Errorf("token of user %d in session %d (%v), want 7 in 3", userID, sessionID, err)
+	}
+	if token.RefreshToken == "" || token.RefreshExpiresAt == nil || !token.RefreshExpiresAt.After(token.ExpiresAt) {
+		t.Errorf("token = %+v, want a refresh token outliving it", token)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	expectToken := func(mock sqlmock.Sqlmock, revokedAt, usedAt interface{}) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(REFRESH_QUERY)).WithArgs(refreshTokenHash("the-refresh-token")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "revoked_at", "used_at"}).AddRow(3, 7, time.Now().Add(time.Hour), revokedAt, usedAt))
+	}
+
+	t.Run("rotates the token", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.RefreshTokenTTL = 24 * time.Hour
+		expectToken(mock, nil, nil)
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE refresh_token SET used_at = $2 WHERE token_hash = $1 AND used_at IS NULL")).
+			WithArgs(refreshTokenHash("the-refresh-token"), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE user_session SET last_used_at = $2, expires_at = $3 WHERE id = $1")).
+			WithArgs(3, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO refresh_token")).WithArgs(sqlmock.AnyArg(), 3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, response := serve(t, conf, http.MethodPost, "/auth/refresh", `{"refresh_token":"the-refresh-token"}`)
+		checkResponse(t, response, http.StatusOK, "")
+		var token Token
+		decodeData(t, response, &token)
+		if userID, sessionID, err := conf.parseSessionToken(token.Token); err != nil || userID != 7 || sessionID != 3 {
+			t.Errorf("token of user %d in session %d (%v), want 7 in 3", userID, sessionID, err)
+		}
+		if token.RefreshToken == "" || token.RefreshToken == "the-refresh-token" {
+			t.Errorf("refresh token = %q, want a new one", token.RefreshToken)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("reuse revokes the session", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.RefreshTokenTTL = 24 * time.Hour
+		expectToken(mock, nil, time.Now().Add(-time.Minute))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE user_session SET revoked_at = $2 WHERE id = $1")).WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, response := serve(t, conf, http.MethodPost, "/auth/refresh", `{"refresh_token":"the-refresh-token"}`)
+		checkResponse(t, response, http.StatusUnauthorized, CODE_UNAUTHORIZED)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("revoked session", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		conf.RefreshTokenTTL = 24 * time.Hour
+		expectToken(mock, time.Now().Add(-time.Minute), nil)
+		mock.ExpectRollback()
+
+		_, response := serve(t, conf, http.MethodPost, "/auth/refresh", `{"refresh_token":"the-refresh-token"}`)
+		checkResponse(t, response, http.StatusUnauthorized, CODE_UNAUTHORIZED)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		conf, _ := newTestConfig(t)
+		_, response := serve(t, conf, http.MethodPost, "/auth/refresh", `{"refresh_token":"the-refresh-token"}`)
+		checkResponse(t, response, http.StatusNotImplemented, CODE_UNAVAILABLE)
+	})
+}
+
+func TestRequireUserSession(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	handler := conf.requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildResponse(w, currentUser(r), http.StatusOK, MESSAGE_SUCCESS)
+	}))
+	token, _ := conf.issueSessionToken(7, 3, time.Now())
+
+	for _, active := range []bool{true, false} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM user_session WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3)")).
+			WithArgs(3, 7, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(active))
+		req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if want := map[bool]int{true: http.StatusOK, false: http.StatusUnauthorized}[active]; rec.Code != want {
+			t.Errorf("active session %v: status = %d, want %d", active, rec.Code, want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_session SET revoked_at = $2 WHERE id IN (SELECT session_id FROM refresh_token WHERE token_hash = $1) AND revoked_at IS NULL")).
+		WithArgs(refreshTokenHash("the-refresh-token"), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	_, response := serve(t, conf, http.MethodPost, "/auth/logout", `{"refresh_token":"the-refresh-token"}`)
+	checkResponse(t, response, http.StatusOK, "")
+
+	// Without a body the session of the bearer token ends
+	token, _ := conf.issueSessionToken(7, 3, time.Now())
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_session SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL")).
+		WithArgs(3, 7, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("logout with the bearer = %d, want 200", rec.Code)
+	}
+
+	// A token without a session has nothing to revoke
+	sessionless, _ := conf.issueToken(7, time.Now())
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+sessionless.Token)
+	rec = httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("logout without a session = %d, want 401", rec.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	conf.AdminKey = "admin-secret"
+	send := func(method, target, adminKey string) Response {
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+		req.Header.Set("X-Admin-Key", adminKey)
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, req)
+		var response Response
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return response
+	}
+
+	checkResponse(t, send(http.MethodGet, "/admin/sessions", "wrong"), http.StatusForbidden, CODE_UNAUTHORIZED)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_session s JOIN users u ON u.id = s.user_id WHERE s.revoked_at IS NULL AND s.expires_at > $1 AND s.user_id = $2 ORDER BY s.last_used_at DESC, s.id DESC")).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "username", "user_agent", "created_at", "last_used_at", "expires_at"}).
+			AddRow(3, 7, "ana", "curl/8.0", now, now, now.Add(time.Hour)))
+	response := send(http.MethodGet, "/admin/sessions?user_id=7", "admin-secret")
+	checkResponse(t, response, http.StatusOK, "")
+	var sessions []service.Session
+	decodeData(t, response, &sessions)
+	if len(sessions) != 1 || sessions[0].Username != "ana" || sessions[0].UserAgent != "curl/8.0" {
+		t.Errorf("sessions = %+v", sessions)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_session SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL")).
+		WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	checkResponse(t, send(http.MethodDelete, "/admin/sessions/3", "admin-secret"), http.StatusNotFound, CODE_NOT_FOUND)
+	checkResponse(t, send(http.MethodDelete, "/admin/sessions/abc", "admin-secret"), http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+type Share struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// shares is the ShareRepository of the handlers
+func (conf *Config) shares() *service.ShareRepository {
+	return &service.ShareRepository{DB: conf.Database}
+}
+
+// shareTodo creates (or replaces) the read-only link of a to-do list
+func (conf *Config) shareTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	share := Share{Token: hex.EncodeToString(token)}
+
+	if err := conf.shares().Share(r.Context(), currentUser(r), todoID, share.Token); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	share.URL = scheme + "://" + r.Host + API_V1_PREFIX + "/shared/" + share.Token
+
+	buildResponse(w, share, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) unshareTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	if err := conf.shares().Unshare(r.Context(), currentUser(r), todoID); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getSharedTodo is public, the token itself is the permission to read
+func (conf *Config) getSharedTodo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+	render, err := parseRender(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	todo, err := conf.shares().Shared(r.Context(), token)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	if render {
+		renderDescription(&todo)
+	}
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestShareOfInvalidID(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, method, "/todo/abc/share", "")
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
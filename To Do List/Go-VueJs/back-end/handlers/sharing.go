@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"to-do-list/service"
+)
+
+func validateRole(role string) error {
+	var errs service.FieldErrors
+	if role != service.ROLE_VIEWER && role != service.ROLE_EDITOR {
+		errs = append(errs, service.NewFieldError("role", service.RULE_ONE_OF, "role must be %s or %s", service.ROLE_VIEWER, service.ROLE_EDITOR))
+	}
+	return errs.Err()
+}
+
+// inviteMember invites a user by username to a project of the user, inviting them again replaces the role
+func (conf *Config) inviteMember(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var input struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	var errs service.FieldErrors
+	errs.CheckLength("username", input.Username, true, service.MAX_USERNAME_LENGTH)
+	errs.Add("role", validateRole(input.Role))
+	if err := errs.Err(); err != nil {
+		buildValidationResponse(w, nil, err)
+		return
+	}
+
+	if owned, err := conf.projects().Owns(r.Context(), currentUser(r), projectID); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !owned {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	userID, member, err := conf.projects().FindInvitee(r.Context(), projectID, input.Username)
+	if err == service.ErrNotFound {
+		buildValidationResponse(w, nil, service.FieldErrors{service.NewFieldError("username", service.RULE_EXISTS, "username is not a user")})
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	if userID == currentUser(r) {
+		buildValidationResponse(w, nil, service.FieldErrors{service.NewFieldError("username", service.RULE_EXISTS, "the owner can't be invited to the project")})
+		return
+	} else if member {
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_CONFLICT, input.Username+" is already a member, change the role of the member instead")
+		return
+	}
+
+	invitation, err := conf.projects().Invite(r.Context(), projectID, userID, input.Role, currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, invitation, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// getProjectInvitations lists the pending invitations to a project of the user
+func (conf *Config) getProjectInvitations(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if owned, err := conf.projects().Owns(r.Context(), currentUser(r), projectID); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !owned {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	invitations, err := conf.projects().ProjectInvitations(r.Context(), projectID)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, invitations, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// revokeInvitation withdraws a pending invitation to a project of the user
+func (conf *Config) revokeInvitation(w http.ResponseWriter, r *http.Request) {
+	projectID, projectOK := pathID(r, "id")
+	invitationID, invitationOK := pathID(r, "invitationID")
+	if !projectOK || !invitationOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := conf.projects().RevokeInvitation(r.Context(), currentUser(r), projectID, invitationID); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getInvitations lists the pending invitations of the user to the projects of others
+func (conf *Config) getInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := conf.projects().UserInvitations(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, invitations, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// acceptInvitation makes the user a member of the project with the role of the invitation, which is used up
+func (conf *Config) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	project, err := conf.projects().AcceptInvitation(r.Context(), currentUser(r), invitationID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, project, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// declineInvitation turns down an invitation of the user
+func (conf *Config) declineInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := conf.projects().DeclineInvitation(r.Context(), currentUser(r), invitationID); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getMembers lists the owner and the members of a project the user owns or is a member of
+func (conf *Config) getMembers(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if ok, err := conf.projects().Accessible(r.Context(), currentUser(r), projectID, service.ROLE_VIEWER); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	} else if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	members, err := conf.projects().Members(r.Context(), projectID)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, members, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// updateMember changes the role of a member of a project of the user
+func (conf *Config) updateMember(w http.ResponseWriter, r *http.Request) {
+	projectID, projectOK := pathID(r, "id")
+	memberID, memberOK := pathID(r, "userID")
+	if !projectOK || !memberOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateRole(input.Role); err != nil {
+		buildValidationResponse(w, nil, err)
+		return
+	}
+
+	member, err := conf.projects().UpdateMember(r.Context(), currentUser(r), projectID, memberID, input.Role)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, member, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// removeMember stops sharing a project of the user with a member, or lets the user leave a project shared with them
+func (conf *Config) removeMember(w http.ResponseWriter, r *http.Request) {
+	projectID, projectOK := pathID(r, "id")
+	memberID, memberOK := pathID(r, "userID")
+	if !projectOK || !memberOK {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := conf.projects().RemoveMember(r.Context(), currentUser(r), projectID, memberID); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getSharedProjects lists the projects of others the user is a member of, with the owner and the role of the user
+func (conf *Config) getSharedProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := conf.projects().Shared(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, projects, http.StatusOK, MESSAGE_SUCCESS)
+}
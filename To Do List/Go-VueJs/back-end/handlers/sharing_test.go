@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"to-do-list/service"
+)
+
+func expectOwnsProject(mock sqlmock.Sqlmock, owned bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM project WHERE id = $1 AND user_id = $2)")).
+		WithArgs(7, testUserID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(owned))
+}
+
+func expectInvitee(mock sqlmock.Sqlmock, userID int, member bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT u.id, EXISTS(SELECT 1 FROM project_member m WHERE m.project_id = $2 AND m.user_id = u.id) FROM users u WHERE u.username = $1")).
+		WithArgs("grace", 7).WillReturnRows(sqlmock.NewRows([]string{"id", "member"}).AddRow(userID, member))
+}
+
+func TestInviteMember(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	expectOwnsProject(mock, true)
+	expectInvitee(mock, 2, false)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO project_invitation(project_id, user_id, role, invited_by) VALUES($1,$2,$3,$4) ON CONFLICT (project_id, user_id) DO UPDATE")).
+		WithArgs(7, 2, service.ROLE_EDITOR, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta(service.INVITATION_QUERY + " WHERE i.id = $1 ORDER BY i.id")).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "project_id", "name", "username", "role", "invited_by", "created_at"}).
+			AddRow(5, 7, "Groceries", "grace", service.ROLE_EDITOR, "ada", time.Now()))
+
+	_, response := serve(t, conf, http.MethodPost, "/project/7/invitations", `{"username":"grace","role":"editor"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	var invitation service.Invitation
+	decodeData(t, response, &invitation)
+	if invitation.ID != 5 || invitation.Project != "Groceries" || invitation.Username != "grace" || invitation.Role != service.ROLE_EDITOR {
+		t.Errorf("invitation = %+v", invitation)
+	}
+
+	// A member changes role with PUT /project/{id}/members/{userID} instead
+	expectOwnsProject(mock, true)
+	expectInvitee(mock, 2, true)
+	_, response = serve(t, conf, http.MethodPost, "/project/7/invitations", `{"username":"grace","role":"viewer"}`)
+	checkResponse(t, response, http.StatusConflict, CODE_CONFLICT)
+
+	expectOwnsProject(mock, true)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users u WHERE u.username = $1")).WithArgs("grace", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "member"}).AddRow(testUserID, false))
+	_, response = serve(t, conf, http.MethodPost, "/project/7/invitations", `{"username":"grace","role":"viewer"}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	// Only the owner invites, a member of the project doesn't see it as theirs
+	expectOwnsProject(mock, false)
+	_, response = serve(t, conf, http.MethodPost, "/project/7/invitations", `{"username":"grace","role":"viewer"}`)
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	for _, body := range []string{`{"username":"grace","role":"owner"}`, `{"role":"viewer"}`} {
+		_, response = serve(t, conf, http.MethodPost, "/project/7/invitations", body)
+		checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("WITH accepted AS (DELETE FROM project_invitation WHERE id = $1 AND user_id = $2 RETURNING project_id, user_id, role) INSERT INTO project_member")).
+		WithArgs(5, testUserID).WillReturnRows(sqlmock.NewRows([]string{"project_id", "name", "owner", "role"}).AddRow(7, "Groceries", "grace", service.ROLE_VIEWER))
+
+	_, response := serve(t, conf, http.MethodPost, "/invitations/5/accept", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var project service.Project
+	decodeData(t, response, &project)
+	if project.ID != 7 || project.Owner != "grace" || project.Role != service.ROLE_VIEWER {
+		t.Errorf("project = %+v", project)
+	}
+
+	// The invitation of another user, or one already used
+	mock.ExpectQuery(regexp.QuoteMeta("WITH accepted AS")).WithArgs(6, testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"project_id", "name", "owner", "role"}))
+	_, response = serve(t, conf, http.MethodPost, "/invitations/6/accept", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetMembers(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM project WHERE id = $1 AND "+service.ProjectAccess("$2", service.ROLE_VIEWER)+")")).
+		WithArgs(7, testUserID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("UNION ALL (SELECT m.user_id, u.username, m.role, m.created_at FROM project_member m")).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "role", "created_at"}).
+			AddRow(2, "grace", service.ROLE_OWNER, now).AddRow(testUserID, "ada", service.ROLE_VIEWER, now))
+
+	_, response := serve(t, conf, http.MethodGet, "/project/7/members", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var members []service.Member
+	decodeData(t, response, &members)
+	if len(members) != 2 || members[0].Role != service.ROLE_OWNER || members[1].Username != "ada" {
+		t.Errorf("members = %+v", members)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM project WHERE id = $1")).
+		WithArgs(8, testUserID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	_, response = serve(t, conf, http.MethodGet, "/project/8/members", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateAndRemoveMember(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE project_member m SET role = $4 FROM project p WHERE m.project_id = $1 AND m.user_id = $3 AND p.id = m.project_id AND p.user_id = $2")).
+		WithArgs(7, testUserID, 2, service.ROLE_EDITOR).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "role", "created_at"}).AddRow(2, "grace", service.ROLE_EDITOR, time.Now()))
+	_, response := serve(t, conf, http.MethodPut, "/project/7/members/2", `{"role":"editor"}`)
+	checkResponse(t, response, http.StatusOK, "")
+
+	_, response = serve(t, conf, http.MethodPut, "/project/7/members/2", `{"role":"owner"}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	// The owner removes anyone, a member only themselves
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM project_member m USING project p WHERE m.project_id = $1 AND m.user_id = $3 AND p.id = m.project_id AND (p.user_id = $2 OR m.user_id = $2)")).
+		WithArgs(7, testUserID, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, response = serve(t, conf, http.MethodDelete, "/project/7/members/2", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSharingOfInvalidIDs(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{method: http.MethodPost, target: "/project/abc/invitations"},
+		{method: http.MethodGet, target: "/project/abc/invitations"},
+		{method: http.MethodDelete, target: "/project/7/invitations/abc"},
+		{method: http.MethodGet, target: "/project/abc/members"},
+		{method: http.MethodPut, target: "/project/abc/members/2"},
+		{method: http.MethodDelete, target: "/project/7/members/abc"},
+		{method: http.MethodPost, target: "/invitations/abc/accept"},
+		{method: http.MethodDelete, target: "/invitations/abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, tt.method, tt.target, `{"username":"grace","role":"editor"}`)
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSharedTodoChanges(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	const owner, member = 2, 3
+	conf, mock := newTestConfig(t)
+	conf.Cache = &ResponseCache{Client: client}
+	handler := chain(conf.Router, conf.invalidateCache)
+
+	send := func(method, target string) Response {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var response Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+		}
+		return response
+	}
+
+	// The test user, an editor of the project, restores a to-do list of its owner
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id = $1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" FOR UPDATE")).
+		WithArgs(1, testUserID).
+		WillReturnRows(sqlmock.NewRows(todoColumns).AddRow(1, "Buy milk", "", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, now, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET deleted_at = NULL")).
+		WithArgs(1).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+	expectHistory(mock, service.EVENT_RESTORED)
+	mock.ExpectCommit()
+	expectAudience(mock, [2]int{1, owner}, [2]int{1, testUserID}, [2]int{1, member})
+	checkResponse(t, send(http.MethodPost, "/todo/1/restore"), http.StatusOK, "")
+
+	for _, userID := range []int{testUserID, owner, member} {
+		if events := conf.Changes.Since(0, userID).Events; len(events) != 1 || events[0].Type != service.EVENT_RESTORED || events[0].TodoID != 1 {
+			t.Errorf("events of user %d = %+v, want the restore", userID, events)
+		}
+		if generation, _ := conf.Cache.generation(context.Background(), userID); generation != "1" {
+			t.Errorf("cache generation of user %d = %s, want it invalidated", userID, generation)
+		}
+	}
+
+	// The completed to-do lists of the project are listed to its members
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE completed_at >= $1 AND completed_at < $2 AND " + service.TodoAccess("", "$5", service.ROLE_VIEWER) + " AND deleted_at IS NULL")).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", true))
+	response := send(http.MethodGet, "/todo/completed")
+	checkResponse(t, response, http.StatusOK, "")
+	var todos []service.Todo
+	decodeData(t, response, &todos)
+	if len(todos) != 1 {
+		t.Errorf("completed = %+v, want the shared one", todos)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// The test user is a member of the project of to-do list 1, which another user owns
+func TestMemberTodoEndpoints(t *testing.T) {
+	viewer := regexp.QuoteMeta(service.TodoAccess("", "$2", service.ROLE_VIEWER))
+	editor := regexp.QuoteMeta(service.TodoAccess("", "$2", service.ROLE_EDITOR))
+
+	t.Run("history", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM todo WHERE id = \\$1 AND "+viewer).
+			WithArgs(1, testUserID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo_history WHERE todo_id = $1")).
+			WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo_history WHERE todo_id = $1")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "action", "actor_id", "changes", "created_at"}).
+				AddRow(1, service.EVENT_CREATED, 2, []byte(`{"title":{"from":null,"to":"Buy milk"}}`), time.Now()))
+
+		_, response := serve(t, conf, http.MethodGet, "/todo/1/history", "")
+		checkResponse(t, response, http.StatusOK, "")
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("FROM todo WHERE id=\\$1 AND "+editor).WithArgs(1, testUserID).
+			WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+		expectSetTags(mock, 1, `{"work","home"}`)
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET version = version + 1")).
+			WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+		mock.ExpectCommit()
+		expectAudience(mock, [2]int{1, 2}, [2]int{1, testUserID})
+
+		_, response := serve(t, conf, http.MethodPut, "/todo/1/tag/home", "")
+		checkResponse(t, response, http.StatusOK, "")
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM todo WHERE " + regexp.QuoteMeta(service.TodoAccess("", "$1", service.ROLE_EDITOR))).
+			WithArgs(testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectExec("UPDATE todo SET position = o.position .* AND "+regexp.QuoteMeta(service.TodoAccess("todo.", "$1", service.ROLE_EDITOR))).
+			WithArgs(testUserID, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		_, response := serve(t, conf, http.MethodPost, "/todo/reorder", `{"ids":[2,1]}`)
+		checkResponse(t, response, http.StatusOK, "")
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("share", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectQuery("UPDATE todo SET share_token = \\$2 WHERE id = \\$1 AND "+regexp.QuoteMeta(service.TodoAccess("", "$3", service.ROLE_EDITOR))).
+			WithArgs(1, sqlmock.AnyArg(), testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		_, response := serve(t, conf, http.MethodPost, "/todo/1/share", "")
+		checkResponse(t, response, http.StatusCreated, "")
+
+		mock.ExpectQuery("UPDATE todo SET share_token = NULL WHERE id = \\$1 AND "+editor).
+			WithArgs(1, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		_, response = serve(t, conf, http.MethodDelete, "/todo/1/share", "")
+		checkResponse(t, response, http.StatusOK, "")
+
+		// A viewer of the project doesn't match the editor role
+		mock.ExpectQuery("UPDATE todo SET share_token = \\$2 WHERE id = \\$1 AND "+regexp.QuoteMeta(service.TodoAccess("", "$3", service.ROLE_EDITOR))).
+			WithArgs(1, sqlmock.AnyArg(), testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		_, response = serve(t, conf, http.MethodPost, "/todo/1/share", "")
+		checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
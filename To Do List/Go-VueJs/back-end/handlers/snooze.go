@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+// MAX_SNOOZE_DAYS is how far ahead a to-do list may be snoozed
+const MAX_SNOOZE_DAYS = 3650
+
+// SnoozeRequest hides the to-do list either for the duration, like "90m", "3d" or "2w", or until the RFC3339 time or
+// the date, which is the start of that day in APP_TIMEZONE
+type SnoozeRequest struct {
+	Duration string `json:"duration,omitempty"`
+	Until    string `json:"until,omitempty"`
+}
+
+// snoozeUntil is the time the request snoozes the to-do list until, which must be after now
+func (conf *Config) snoozeUntil(request SnoozeRequest, now time.Time) (time.Time, error) {
+	var (
+		until time.Time
+		err   error
+		field = "until"
+	)
+	switch {
+	case (request.Duration == "") == (request.Until == ""):
+		return until, service.FieldErrors{service.NewFieldError("duration", service.RULE_REQUIRED, "either duration or until is required")}
+	case request.Duration != "":
+		field = "duration"
+		if until, err = addSnoozeDuration(now.In(conf.Location), request.Duration); err != nil {
+			return until, service.FieldErrors{service.NewFieldError(field, service.RULE_TYPE, "duration must be like 90m, 3d or 2w")}
+		}
+	default:
+		if until, err = conf.parseImportTime(request.Until); err != nil {
+			return until, service.FieldErrors{service.NewFieldError(field, service.RULE_TYPE, "until must be an RFC3339 time or a date")}
+		}
+	}
+	if !until.After(now) || until.After(now.AddDate(0, 0, MAX_SNOOZE_DAYS)) {
+		return until, service.FieldErrors{service.NewFieldError(field, service.RULE_RANGE, "%s must be in the next %d days", field, MAX_SNOOZE_DAYS)}
+	}
+	return until, nil
+}
+
+// addSnoozeDuration adds a Go duration like "2h30m", or a whole number of days or weeks like "3d" and "2w", to now.
+// Days are calendar days in the location of now, a snooze across a DST change wakes at the same time of day
+func addSnoozeDuration(now time.Time, value string) (time.Time, error) {
+	for suffix, days := range map[string]int{"d": 1, "w": 7} {
+		if count, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil || n > MAX_SNOOZE_DAYS {
+				return now, errors.New("invalid duration")
+			}
+			return now.AddDate(0, 0, n*days), nil
+		}
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return now, err
+	}
+	return now.Add(duration), nil
+}
+
+// snoozeTodo hides the to-do list from the views until the time of the body, it comes back by itself once the time
+// has passed
+func (conf *Config) snoozeTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var request SnoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	until, err := conf.snoozeUntil(request, time.Now())
+	if err != nil {
+		buildValidationResponse(w, nil, err)
+		return
+	}
+
+	todo, err := conf.todos().Snooze(r.Context(), currentUser(r), todoID, &until)
+	writeSnoozed(w, todo, err)
+}
+
+// wakeTodo brings back a snoozed to-do list before its time, waking one which isn't snoozed is a no-op
+func (conf *Config) wakeTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	todo, err := conf.todos().Snooze(r.Context(), currentUser(r), todoID, nil)
+	writeSnoozed(w, todo, err)
+}
+
+func writeSnoozed(w http.ResponseWriter, todo service.Todo, err error) {
+	if err == service.ErrTodoNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+func TestSnoozeUntil(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip(err)
+	}
+	conf := &Config{Location: amsterdam}
+	// The night before the switch to summer time
+	now := time.Date(2024, 3, 30, 10, 0, 0, 0, amsterdam)
+
+	tests := []struct {
+		name    string
+		request SnoozeRequest
+		want    time.Time
+		field   string
+		rule    string
+	}{
+		{name: "hours", request: SnoozeRequest{Duration: "90m"}, want: now.Add(90 * time.Minute)},
+		{name: "days keep the time of day", request: SnoozeRequest{Duration: "3d"}, want: time.Date(2024, 4, 2, 10, 0, 0, 0, amsterdam)},
+		{name: "weeks", request: SnoozeRequest{Duration: "2w"}, want: time.Date(2024, 4, 13, 10, 0, 0, 0, amsterdam)},
+		{name: "time", request: SnoozeRequest{Until: "2024-04-01T08:00:00Z"}, want: time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{name: "date", request: SnoozeRequest{Until: "2024-04-01"}, want: time.Date(2024, 4, 1, 0, 0, 0, 0, amsterdam)},
+		{name: "neither", request: SnoozeRequest{}, field: "duration", rule: service.RULE_REQUIRED},
+		{name: "both", request: SnoozeRequest{Duration: "1d", Until: "2024-04-01"}, field: "duration", rule: service.RULE_REQUIRED},
+		{name: "invalid duration", request: SnoozeRequest{Duration: "soon"}, field: "duration", rule: service.RULE_TYPE},
+		{name: "fraction of a day", request: SnoozeRequest{Duration: "1.5d"}, field: "duration", rule: service.RULE_TYPE},
+		{name: "negative", request: SnoozeRequest{Duration: "-1h"}, field: "duration", rule: service.RULE_RANGE},
+		{name: "past", request: SnoozeRequest{Until: "2024-03-30"}, field: "until", rule: service.RULE_RANGE},
+		{name: "too far", request: SnoozeRequest{Until: "2100-01-01"}, field: "until", rule: service.RULE_RANGE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, err := conf.snoozeUntil(tt.request, now)
+			if tt.rule == "" {
+				if err != nil || !until.Equal(tt.want) {
+					t.Errorf("snoozeUntil = %v, %v, want %v", until, err, tt.want)
+				}
+				return
+			}
+			var errs service.FieldErrors
+			if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != tt.field || errs[0].Rule != tt.rule {
+				t.Errorf("snoozeUntil error = %v, want %s %s", err, tt.field, tt.rule)
+			}
+		})
+	}
+}
+
+func TestSnoozeTodo(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+
+	var todo service.Todo
+	_, response := serve(t, conf, http.MethodPost, "/todo", `{"title":"Renew passport"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	decodeData(t, response, &todo)
+
+	_, response = serve(t, conf, http.MethodPost, fmt.Sprintf("/todo/%d/snooze", todo.ID), `{"duration":"3d"}`)
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &todo)
+	if todo.SnoozedUntil == nil || todo.SnoozedUntil.Sub(time.Now().AddDate(0, 0, 3)).Abs() > time.Minute || todo.Version != 2 {
+		t.Fatalf("snoozed %+v", todo)
+	}
+
+	// A client replacing the to-do list doesn't know about the snooze
+	_, response = serve(t, conf, http.MethodPut, fmt.Sprintf("/todo/%d", todo.ID), `{"title":"Renew the passport","snoozed_until":null}`)
+	checkResponse(t, response, http.StatusOK, "")
+	var replaced service.Todo
+	decodeData(t, response, &replaced)
+	if replaced.SnoozedUntil == nil || !replaced.SnoozedUntil.Equal(*todo.SnoozedUntil) {
+		t.Errorf("replacing woke %+v", replaced)
+	}
+
+	_, response = serve(t, conf, http.MethodPost, fmt.Sprintf("/todo/%d/snooze", todo.ID), `{"until":"2000-01-01"}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	var woken service.Todo
+	_, response = serve(t, conf, http.MethodDelete, fmt.Sprintf("/todo/%d/snooze", todo.ID), "")
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &woken)
+	if woken.SnoozedUntil != nil || woken.Version != 4 {
+		t.Errorf("woken %+v", woken)
+	}
+
+	// Waking it again changes nothing
+	_, response = serve(t, conf, http.MethodDelete, fmt.Sprintf("/todo/%d/snooze", todo.ID), "")
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &woken)
+	if woken.Version != 4 {
+		t.Errorf("woken again %+v", woken)
+	}
+
+	_, response = serve(t, conf, http.MethodPost, "/todo/999/snooze", `{"duration":"1h"}`)
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+}
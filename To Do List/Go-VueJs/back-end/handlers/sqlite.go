@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+)
+
+// sqliteRoutes registers the routes of every database driver on api and the projects, which also run on the SQLite
+// schema
+func (r *Config) sqliteRoutes(api *mux.Router) {
+	r.portableRoutes(api)
+
+	// Get all projects
+	api.HandleFunc(`/project`, r.getProjects).Methods("GET")
+
+	// Add project
+	api.HandleFunc(`/project`, r.addProject).Methods("POST")
+
+	// Get detail project
+	api.HandleFunc(`/project/{id}`, r.getProject).Methods("GET")
+
+	// Rename project
+	api.HandleFunc(`/project/{id}`, r.updateProject).Methods("PUT")
+
+	// Remove project, its to-do list are kept without a project
+	api.HandleFunc(`/project/{id}`, r.deleteProject).Methods("DELETE")
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+// newSQLiteDatabase opens a migrated database file of the test, testUserID exists. It returns the path of the file
+func newSQLiteDatabase(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "todo.db")
+	// Not setupSQLite, its metrics can only be registered once
+	db := sql.OpenDB(service.NewSQLiteConnector(path))
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if version, err := service.ApplyMigrations(db, service.DB_DRIVER_SQLITE, path, "", false); err != nil || version != latestSQLiteVersion(t) {
+		t.Fatalf("migrated to version %d, %v", version, err)
+	}
+	if _, err := db.Exec("INSERT INTO users(id, username, password_hash) VALUES($1, 'test', '')", testUserID); err != nil {
+		t.Fatal(err)
+	}
+	return db, path
+}
+
+// newSQLiteConfig returns a Config with the SQLite routes on the database of newSQLiteDatabase, and the path of it
+func newSQLiteConfig(t *testing.T) (*Config, string) {
+	t.Helper()
+
+	db, path := newSQLiteDatabase(t)
+	conf := &Config{
+		Router:    mux.NewRouter(),
+		Database:  db,
+		DBDriver:  service.DB_DRIVER_SQLITE,
+		Location:  time.UTC,
+		Changes:   service.NewBroadcaster(service.DEFAULT_MAX_SUBSCRIBERS),
+		JWTSecret: testJWTSecret,
+		TokenTTL:  time.Hour,
+	}
+	conf.routes()
+	return conf, path
+}
+
+// latestSQLiteVersion is the last SQLite migration embedded in the binary
+func latestSQLiteVersion(t *testing.T) uint {
+	t.Helper()
+	version, err := service.LatestSchemaVersion(service.DB_DRIVER_SQLITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestSQLiteTodos(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+
+	var project service.Project
+	_, response := serve(t, conf, http.MethodPost, "/project", `{"name":"Home"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	decodeData(t, response, &project)
+
+	var todo service.Todo
+	_, response = serve(t, conf, http.MethodPost, "/todo", fmt.Sprintf(`{"title":"Buy milk","tags":["shop","home"],"metadata":{"aisle":3},"due_date":"2030-01-02T10:00:00+02:00","project_id":%d}`, project.ID))
+	checkResponse(t, response, http.StatusCreated, "")
+	decodeData(t, response, &todo)
+	if todo.ID == 0 || todo.Version != 1 || todo.Priority != service.PRIORITY_MEDIUM || len(todo.Tags) != 2 || todo.Metadata["aisle"] != float64(3) {
+		t.Fatalf("created %+v", todo)
+	}
+	if todo.DueDate == nil || !todo.DueDate.Equal(time.Date(2030, 1, 2, 8, 0, 0, 0, time.UTC)) || todo.CreatedAt == nil {
+		t.Errorf("times = due %v, created %v", todo.DueDate, todo.CreatedAt)
+	}
+
+	_, response = serve(t, conf, http.MethodPatch, fmt.Sprintf("/todo/%d", todo.ID), `{"is_done":true,"version":1}`)
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &todo)
+	if !todo.IsDone || todo.CompletedAt == nil || todo.Version != 2 {
+		t.Errorf("patched %+v", todo)
+	}
+
+	_, response = serve(t, conf, http.MethodPut, fmt.Sprintf("/todo/%d", todo.ID), `{"title":"Buy oat milk","version":1}`)
+	checkResponse(t, response, http.StatusConflict, CODE_VERSION_CONFLICT)
+
+	_, response = serve(t, conf, http.MethodPost, fmt.Sprintf("/todo/%d/reopen", todo.ID), "")
+	checkResponse(t, response, http.StatusOK, "")
+
+	_, response = serve(t, conf, http.MethodGet, "/todo?is_done=false&priority=medium", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var todos []service.Todo
+	decodeData(t, response, &todos)
+	if len(todos) != 1 || todos[0].IsDone || todos[0].CompletedAt != nil || todos[0].Title != "Buy milk" {
+		t.Errorf("listed %+v", todos)
+	}
+
+	_, response = serve(t, conf, http.MethodGet, fmt.Sprintf("/todo/%d/history", todo.ID), "")
+	checkResponse(t, response, http.StatusOK, "")
+	var history []service.HistoryEntry
+	decodeData(t, response, &history)
+	if len(history) != 3 || history[2].Action != service.EVENT_CREATED {
+		t.Errorf("history = %+v", history)
+	}
+
+	_, response = serve(t, conf, http.MethodDelete, fmt.Sprintf("/todo/%d", todo.ID), "")
+	checkResponse(t, response, http.StatusOK, "")
+	_, response = serve(t, conf, http.MethodGet, fmt.Sprintf("/todo/%d", todo.ID), "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	_, response = serve(t, conf, http.MethodPost, "/todo", `{"title":"Call mum","project_id":999}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+}
+
+func TestSQLiteRoutes(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+
+	_, response := serve(t, conf, http.MethodGet, "/todo?q=milk", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	_, response = serve(t, conf, http.MethodGet, "/todo?metadata.aisle=3", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	// Postgres only
+	_, response = serve(t, conf, http.MethodGet, "/todo/search?q=milk", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	_, response = serve(t, conf, http.MethodPost, "/auth/register", `{"username":"test","password":"correct horse battery"}`)
+	checkResponse(t, response, http.StatusConflict, CODE_CONFLICT)
+}
+
+func TestSQLiteSortByPriority(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	for _, priority := range []string{service.PRIORITY_HIGH, service.PRIORITY_LOW, service.PRIORITY_URGENT, service.PRIORITY_MEDIUM} {
+		_, response := serve(t, conf, http.MethodPost, "/todo", fmt.Sprintf(`{"title":"Todo","priority":%q}`, priority))
+		checkResponse(t, response, http.StatusCreated, "")
+	}
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{target: "/todo?sort=priority", want: []string{service.PRIORITY_LOW, service.PRIORITY_MEDIUM, service.PRIORITY_HIGH, service.PRIORITY_URGENT}},
+		{target: "/todo?sort=-priority", want: []string{service.PRIORITY_URGENT, service.PRIORITY_HIGH, service.PRIORITY_MEDIUM, service.PRIORITY_LOW}},
+	}
+	for _, tt := range tests {
+		_, response := serve(t, conf, http.MethodGet, tt.target, "")
+		checkResponse(t, response, http.StatusOK, "")
+		var todos []service.Todo
+		decodeData(t, response, &todos)
+		priorities := make([]string, len(todos))
+		for i, todo := range todos {
+			priorities[i] = todo.Priority
+		}
+		if !reflect.DeepEqual(priorities, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.target, priorities, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_STATS_WEEKS = 4
+	MAX_STATS_WEEKS     = 52
+)
+
+// getStats counts the open, done and overdue to-do list in one aggregate, with the completions per day of the last
+// ?weeks=N weeks up to today
+func (conf *Config) getStats(w http.ResponseWriter, r *http.Request) {
+	weeks := DEFAULT_STATS_WEEKS
+	if v := r.URL.Query().Get("weeks"); v != "" {
+		var err error
+		if weeks, err = strconv.Atoi(v); err != nil || weeks < 1 || weeks > MAX_STATS_WEEKS {
+			buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "weeks must be from 1 to "+strconv.Itoa(MAX_STATS_WEEKS))
+			return
+		}
+	}
+
+	stats, err := conf.queries().Stats(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	stats.Weeks = weeks
+
+	now := time.Now().In(conf.Location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, conf.Location)
+	completions, err := conf.queries().DailyCompletions(r.Context(), currentUser(r), conf.Location, to.AddDate(0, 0, -7*weeks+1), to)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	stats.Completions = completions
+
+	buildResponse(w, stats, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetStats(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	today := time.Now().In(conf.Location).Format(service.DATE_LAYOUT)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FILTER (WHERE NOT is_done)")).WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"open", "done", "overdue", "avg"}).AddRow(3, 5, 1, 7200.5))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT to_char(completed_at AT TIME ZONE $1, 'YYYY-MM-DD') AS day")).
+		WithArgs("UTC", sqlmock.AnyArg(), sqlmock.AnyArg(), testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "count"}).AddRow(today, 2))
+
+	_, response := serve(t, conf, http.MethodGet, "/stats?weeks=2", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var stats service.Stats
+	decodeData(t, response, &stats)
+	if stats.Open != 3 || stats.Done != 5 || stats.Overdue != 1 || stats.AverageCompletionSeconds == nil || *stats.AverageCompletionSeconds != 7200.5 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if len(stats.Completions) != 14 || stats.Completions[13] != (service.DailyCount{Date: today, Count: 2}) || stats.Completions[0].Count != 0 {
+		t.Errorf("completions = %+v, want 14 days ending with today", stats.Completions)
+	}
+
+	for _, weeks := range []string{"0", "53", "two"} {
+		_, response = serve(t, conf, http.MethodGet, "/stats?weeks="+weeks, "")
+		checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
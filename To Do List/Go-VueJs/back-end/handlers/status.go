@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"to-do-list/service"
+)
+
+// BoardColumn is the to-do list in one status, in the manual order
+type BoardColumn struct {
+	Status string         `json:"status"`
+	Todos  []service.Todo `json:"todos"`
+}
+
+// getBoard groups the to-do list of the user by status, a column for every status even when empty. It takes the
+// filters of GET /todo
+func (conf *Config) getBoard(w http.ResponseWriter, r *http.Request) {
+	filter, err := conf.parseListFilter(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+	render, err := parseRender(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	rows, err := conf.queries().Select(r.Context(), filter, service.Sort{})
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	defer rows.Close()
+
+	board := make([]BoardColumn, len(service.Statuses))
+	columns := make(map[string]*BoardColumn, len(service.Statuses))
+	for i, status := range service.Statuses {
+		board[i] = BoardColumn{Status: status, Todos: make([]service.Todo, 0)}
+		columns[status] = &board[i]
+	}
+	for rows.Next() {
+		todo := rows.Todo()
+		if render {
+			renderDescription(&todo)
+		}
+		column, ok := columns[todo.Status]
+		if !ok {
+			buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+			return
+		}
+		column.Todos = append(column.Todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, board, http.StatusOK, MESSAGE_SUCCESS)
+}
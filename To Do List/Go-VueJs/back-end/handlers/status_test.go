@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetBoard(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	rows := sqlmock.NewRows(todoColumns)
+	todoRow(rows, 1, "Buy milk", true)
+	todoRow(rows, 2, "Call mum", false)
+	todoRow(rows, 3, "Pay rent", false)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE "+service.TodoAccess("", "$1", service.ROLE_VIEWER)+" AND deleted_at IS NULL AND project_id = $2 AND archived = FALSE ORDER BY position IS NULL, position, id")).
+		WithArgs(testUserID, 4).WillReturnRows(rows)
+
+	_, response := serve(t, conf, http.MethodGet, "/todo/board?project_id=4", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var board []BoardColumn
+	decodeData(t, response, &board)
+	if len(board) != len(service.Statuses) {
+		t.Fatalf("board has %d columns, want %d", len(board), len(service.Statuses))
+	}
+	for i, want := range map[int][]int{0: {2, 3}, 1: nil, 2: nil, 3: {1}} {
+		var ids []int
+		for _, todo := range board[i].Todos {
+			ids = append(ids, todo.ID)
+		}
+		if board[i].Status != service.Statuses[i] || !reflect.DeepEqual(ids, want) {
+			t.Errorf("column %s has %v, want %s with %v", board[i].Status, ids, service.Statuses[i], want)
+		}
+	}
+
+	_, response = serve(t, conf, http.MethodGet, "/todo/board?status=waiting", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+func validateTag(tag service.Tag) error {
+	var errs service.FieldErrors
+	errs.CheckLength("name", tag.Name, true, service.MAX_TAG_LENGTH)
+	return errs.Err()
+}
+
+// tags is the TagRepository of the handlers
+func (conf *Config) tags() *service.TagRepository {
+	return &service.TagRepository{DB: conf.Database}
+}
+
+// getTags lists the tags of the user and of the to-do lists the user may view, most used first
+func (conf *Config) getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := conf.queries().Tags(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, make([]service.TagCount, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, tags, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// addTag creates a tag of the user, which no to-do list has yet
+func (conf *Config) addTag(w http.ResponseWriter, r *http.Request) {
+	var newTag service.Tag
+	if err := json.NewDecoder(r.Body).Decode(&newTag); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateTag(newTag); err != nil {
+		buildValidationResponse(w, newTag, err)
+		return
+	}
+
+	err := conf.tags().Create(r.Context(), currentUser(r), &newTag)
+	if isUniqueViolation(err) {
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_CONFLICT, "tag already exists")
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, newTag, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// deleteTag deletes the tag of the user and removes it from every to-do list the user may edit, returning how many
+// changed
+func (conf *Config) deleteTag(w http.ResponseWriter, r *http.Request) {
+	todos, err := conf.store().DeleteTag(r.Context(), currentUser(r), mux.Vars(r)["name"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	conf.todos().Publish(r.Context(), service.EVENT_UPDATED, currentUser(r), todos...)
+
+	buildResponse(w, BulkResult{Updated: len(todos)}, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) attachTag(w http.ResponseWriter, r *http.Request) {
+	conf.changeTags(w, r, func(tags service.Tags, tag string) service.Tags {
+		for _, existing := range tags {
+			if existing == tag {
+				return tags
+			}
+		}
+		return append(tags, tag)
+	})
+}
+
+func (conf *Config) detachTag(w http.ResponseWriter, r *http.Request) {
+	conf.changeTags(w, r, func(tags service.Tags, tag string) service.Tags {
+		kept := make(service.Tags, 0, len(tags))
+		for _, existing := range tags {
+			if existing != tag {
+				kept = append(kept, existing)
+			}
+		}
+		return kept
+	})
+}
+
+// changeTags applies change to the tags of the to-do list in the URL, attaching or detaching the tag in the URL
+func (conf *Config) changeTags(w http.ResponseWriter, r *http.Request, change func(tags service.Tags, tag string) service.Tags) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	tag := mux.Vars(r)["name"]
+
+	var invalid bool
+	todo, err := conf.store().ChangeTags(r.Context(), currentUser(r), todoID, func(tags service.Tags) (service.Tags, error) {
+		tags = change(tags, tag)
+		err := service.ValidateTags(tags)
+		invalid = err != nil
+		return tags, err
+	})
+	switch {
+	case err == service.ErrTodoNotFound:
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	case invalid:
+		buildValidationResponse(w, todo, err)
+		return
+	case err != nil:
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	conf.todos().Publish(r.Context(), service.EVENT_UPDATED, currentUser(r), todo)
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	"to-do-list/service"
+)
+
+func TestChangeTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		found  bool
+		tags   string
+		status int
+		code   string
+	}{
+		{name: "attach", method: http.MethodPut, target: "/todo/1/tag/home", found: true, tags: `{"work","home"}`, status: http.StatusOK},
+		{name: "attach twice", method: http.MethodPut, target: "/todo/1/tag/work", found: true, tags: `{"work"}`, status: http.StatusOK},
+		{name: "detach", method: http.MethodDelete, target: "/todo/1/tag/work", found: true, tags: `{}`, status: http.StatusOK},
+		{name: "not found", method: http.MethodPut, target: "/todo/1/tag/home", status: http.StatusNotFound, code: CODE_NOT_FOUND},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			mock.ExpectBegin()
+			query := mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE")).WithArgs(1, testUserID)
+			if tt.found {
+				query.WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+				expectSetTags(mock, 1, tt.tags)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET version = version + 1, updated_at = now() WHERE id = $1")).
+					WithArgs(1).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+				mock.ExpectCommit()
+				expectAudience(mock)
+			} else {
+				query.WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			}
+
+			_, response := serve(t, conf, tt.method, tt.target, "")
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestChangeTagsOfInvalidID(t *testing.T) {
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, method, "/todo/abc/tag/home", "")
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAddTag(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "success",
+			body: `{"name":"home"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tag(user_id, name) VALUES($1, $2) RETURNING id, created_at")).
+					WithArgs(testUserID, "home").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, time.Now()))
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "missing name",
+			body:   `{"name":" "}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+		},
+		{
+			name:   "name too long",
+			body:   `{"name":"` + strings.Repeat("a", service.MAX_TAG_LENGTH+1) + `"}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+		},
+		{
+			name: "already exists",
+			body: `{"name":"home"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO tag")).WillReturnError(&pq.Error{Code: "23505"})
+			},
+			status: http.StatusConflict,
+			code:   CODE_CONFLICT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodPost, "/tag", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			if tt.status == http.StatusCreated {
+				var tag service.Tag
+				decodeData(t, response, &tag)
+				if tag.ID != 3 || tag.Name != "home" {
+					t.Errorf("tag = %+v, want home with id 3", tag)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
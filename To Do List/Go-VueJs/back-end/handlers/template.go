@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"to-do-list/service"
+)
+
+type ApplyTemplate struct {
+	TemplateID int `json:"template_id"`
+}
+
+// templates is the TemplateRepository of the handlers
+func (conf *Config) templates() *service.TemplateRepository {
+	return &service.TemplateRepository{DB: conf.Database}
+}
+
+// getTemplates lists the templates of the user with their items
+func (conf *Config) getTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := conf.templates().List(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, make([]service.Template, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, templates, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) addTemplate(w http.ResponseWriter, r *http.Request) {
+	var newTemplate service.Template
+	if err := json.NewDecoder(r.Body).Decode(&newTemplate); err != nil || newTemplate.Name == "" || len(newTemplate.Items) == 0 {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	for _, item := range newTemplate.Items {
+		if item.Title == "" {
+			buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+			return
+		}
+	}
+
+	if err := conf.templates().Create(r.Context(), currentUser(r), &newTemplate); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, newTemplate, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// applyTemplate creates a to-do list of the user from each item of one of their templates, another user's is not found
+func (conf *Config) applyTemplate(w http.ResponseWriter, r *http.Request) {
+	var apply ApplyTemplate
+	if err := json.NewDecoder(r.Body).Decode(&apply); err != nil || apply.TemplateID == 0 {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	todos, err := conf.templates().Apply(r.Context(), currentUser(r), apply.TemplateID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	// Like every other way of creating them, once they are stored
+	conf.todos().Publish(r.Context(), service.EVENT_CREATED, currentUser(r), todos...)
+
+	buildResponse(w, todos, http.StatusCreated, MESSAGE_SUCCESS)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetTemplates(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM template t LEFT JOIN template_item i ON i.template_id = t.id WHERE t.user_id = $1")).
+		WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "title", "description"}).
+			AddRow(1, "Groceries", "Buy milk", "").
+			AddRow(1, "Groceries", "Buy eggs", "Free range").
+			AddRow(2, "Empty", nil, ""))
+
+	_, response := serve(t, conf, http.MethodGet, "/todo/template", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var templates []service.Template
+	decodeData(t, response, &templates)
+	if len(templates) != 2 || len(templates[0].Items) != 2 || len(templates[1].Items) != 0 {
+		t.Errorf("templates = %+v", templates)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddTemplate(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO template(name, user_id) VALUES($1, $2) RETURNING id")).
+		WithArgs("Groceries", testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO template_item(template_id, title, description)")).
+		WithArgs(3, "Buy milk", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	_, response := serve(t, conf, http.MethodPost, "/todo/template", `{"name":"Groceries","items":[{"title":"Buy milk"}]}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	t.Run("of the user", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM template WHERE id=$1 AND user_id=$2")).
+			WithArgs(1, testUserID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo(title, description, source, user_id) SELECT")).
+			WithArgs(1, service.SOURCE_TEMPLATE, testUserID).
+			WillReturnRows(todoRow(todoRow(sqlmock.NewRows(todoColumns), 7, "Buy milk", false), 8, "Buy eggs", false))
+		expectHistory(mock, service.EVENT_CREATED)
+		expectHistory(mock, service.EVENT_CREATED)
+		mock.ExpectCommit()
+		expectAudience(mock)
+
+		_, response := serve(t, conf, http.MethodPost, "/todo/template/apply", `{"template_id":1}`)
+		checkResponse(t, response, http.StatusCreated, "")
+		var todos []service.Todo
+		decodeData(t, response, &todos)
+		if len(todos) != 2 || todos[0].ID != 7 || todos[1].ID != 8 {
+			t.Errorf("todos = %+v", todos)
+		}
+		// One event per to-do list, for the SSE, WebSocket and long-poll clients
+		events := conf.Changes.Since(0, testUserID).Events
+		if len(events) != 2 || events[0].Type != service.EVENT_CREATED || events[0].TodoID != 7 || events[1].TodoID != 8 {
+			t.Errorf("events = %+v", events)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// The template of another user is as missing as one which doesn't exist
+	t.Run("of another user", func(t *testing.T) {
+		conf, mock := newTestConfig(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM template WHERE id=$1 AND user_id=$2")).
+			WithArgs(2, testUserID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		_, response := serve(t, conf, http.MethodPost, "/todo/template/apply", `{"template_id":2}`)
+		checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
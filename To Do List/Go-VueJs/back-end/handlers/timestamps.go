@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// todoTimestamps are the nullable timestamps of a Todo, left out of the JSON by default. NULL_TIMESTAMPS=null has the
+// responses emit the missing ones as explicit nulls
+var todoTimestamps = []string{"completed_at", "created_at", "updated_at", "due_date", "deleted_at", "next_due_date", "remind_at", "snoozed_until"}
+
+// todoKeys are always in the JSON of a Todo, an object with all of them is taken for one
+var todoKeys = []string{"is_done", "status", "archived", "tags"}
+
+// writesNullTimestamps tells whether the response written to w emits the missing timestamps as nulls, the first
+// wrapper knowing it tells
+func writesNullTimestamps(w http.ResponseWriter) bool {
+	for {
+		if encoding, ok := w.(interface{ nullTimestamps() bool }); ok {
+			return encoding.nullTimestamps()
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// marshalResponse encodes value like json.Marshal, with the missing timestamps of the to-do list as nulls when
+// nullTimestamps is set
+func marshalResponse(value interface{}, nullTimestamps bool) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil || !nullTimestamps {
+		return data, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var encoded bytes.Buffer
+	if err := writeNullTimestamps(decoder, &encoded); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
+
+// writeNullTimestamps copies the next JSON value of the decoder to encoded, adding the missing timestamps of every
+// to-do list in it as nulls. The order of the fields is kept
+func writeNullTimestamps(decoder *json.Decoder, encoded *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		data, err := json.Marshal(token)
+		encoded.Write(data)
+		return err
+	}
+
+	if delim == '[' {
+		encoded.WriteByte('[')
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				encoded.WriteByte(',')
+			}
+			if err := writeNullTimestamps(decoder, encoded); err != nil {
+				return err
+			}
+		}
+		encoded.WriteByte(']')
+		_, err := decoder.Token()
+		return err
+	}
+
+	encoded.WriteByte('{')
+	keys := make(map[string]bool)
+	for i := 0; decoder.More(); i++ {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		keys[key] = true
+		if i > 0 {
+			encoded.WriteByte(',')
+		}
+		data, _ := json.Marshal(key)
+		encoded.Write(data)
+		encoded.WriteByte(':')
+		if err := writeNullTimestamps(decoder, encoded); err != nil {
+			return err
+		}
+	}
+	if isTodo(keys) {
+		for _, key := range todoTimestamps {
+			if !keys[key] {
+				encoded.WriteString(`,"` + key + `":null`)
+			}
+		}
+	}
+	encoded.WriteByte('}')
+	_, err = decoder.Token()
+	return err
+}
+
+func isTodo(keys map[string]bool) bool {
+	for _, key := range todoKeys {
+		if !keys[key] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+func TestMarshalResponseTimestamps(t *testing.T) {
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	value := Response{
+		Data: ImportReport{Rows: []ImportRow{
+			{Row: 1, Todo: &service.Todo{ID: 1, Title: "Buy milk", Status: service.STATUS_BACKLOG, Tags: service.Tags{}, DueDate: &due, Checklist: &service.Checklist{Items: []service.Item{{ID: 2, Title: "Oat"}}}}},
+			{Row: 2, Errors: []service.FieldError{service.NewFieldError("title", service.RULE_REQUIRED, "title is required")}},
+		}},
+		Status: http.StatusOK,
+	}
+
+	tests := []struct {
+		name  string
+		nulls bool
+	}{
+		{name: "omit"},
+		{name: "null", nulls: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := marshalResponse(value, tt.nulls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				Data struct {
+					Rows []map[string]json.RawMessage `json:"rows"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("%s: %v", data, err)
+			}
+			var todo map[string]interface{}
+			json.Unmarshal(decoded.Data.Rows[0]["todo"], &todo)
+			if todo["due_date"] != "2030-01-02T00:00:00Z" {
+				t.Errorf("due_date = %v", todo["due_date"])
+			}
+			for _, key := range todoTimestamps {
+				if value, ok := todo[key]; key != "due_date" && (ok != tt.nulls || value != nil) {
+					t.Errorf("%s = %v, in the JSON %v", key, value, ok)
+				}
+			}
+			// Only the to-do list get the nulls, not the items of their checklist nor the other objects
+			if strings.Contains(string(data), `"title":"Oat","is_done":false,"completed_at"`) || strings.Contains(string(decoded.Data.Rows[1]["errors"]), "null") {
+				t.Errorf("nulls outside of the to-do list: %s", data)
+			}
+		})
+	}
+}
+
+func TestNullTimestampsResponses(t *testing.T) {
+	for _, nulls := range []bool{false, true} {
+		conf, _ := newSQLiteConfig(t)
+		conf.NullTimestamps = nulls
+		_, response := serve(t, conf, http.MethodPost, "/todo", `{"title":"Buy milk"}`)
+		checkResponse(t, response, http.StatusCreated, "")
+
+		for _, accept := range []string{"application/json", "application/yaml"} {
+			req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+			req.Header.Set("Accept", accept)
+			req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+			rec := httptest.NewRecorder()
+			conf.negotiateMiddleware(conf.Router).ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			hasNull := strings.Contains(body, `"due_date":null`) || strings.Contains(body, "due_date: null")
+			snoozeNull := strings.Contains(body, `"snoozed_until":null`) || strings.Contains(body, "snoozed_until: null")
+			if rec.Code != http.StatusOK || hasNull != nulls || snoozeNull != nulls || !strings.Contains(body, "created_at") {
+				t.Errorf("NULL_TIMESTAMPS null = %v, %s: %d %s", nulls, accept, rec.Code, body)
+			}
+		}
+	}
+}
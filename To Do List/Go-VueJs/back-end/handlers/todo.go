@@ -0,0 +1,1563 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+type Config struct {
+	Addr     string
+	Router   *mux.Router
+	Database *sql.DB
+	Location *time.Location
+	Changes  *service.Broadcaster
+
+	// DB_DRIVER_POSTGRES, or DB_DRIVER_SQLITE and DB_DRIVER_MYSQL serving only the routes their schema has
+	DBDriver string
+
+	// Address of the gRPC server, disabled when empty
+	GRPCAddr string
+
+	// Reject title/description edits of completed to-do list until reopened
+	LockCompleted bool
+
+	// Moves between statuses a to-do list may make, nil allows every move
+	StatusTransitions service.StatusTransitions
+
+	// Reject PUT and PATCH of a to-do list without an If-Match header, so concurrent edits can't overwrite each other
+	RequireIfMatch bool
+
+	// Key required by admin endpoints in the X-Admin-Key header
+	AdminKey string
+
+	// The responses emit the missing timestamps of the to-do list as nulls, with NULL_TIMESTAMPS=null
+	NullTimestamps bool
+
+	// Shape of the paginated lists, one of the PAGINATION_STYLE_* and PAGINATION_STYLE_BODY when empty
+	PaginationStyle string
+
+	// Key required by every endpoint except the health check, shared links and the calendar feed, no authentication when empty
+	APIKey string
+
+	// Requests per second allowed for each client IP, no limit when nil
+	RateLimiter *RateLimiter
+
+	// Caches GET /todo for CacheListTTL and GET /todo/{id} for CacheTodoTTL per user, disabled when nil
+	Cache        *ResponseCache
+	CacheListTTL time.Duration
+	CacheTodoTTL time.Duration
+
+	// Key signing the login tokens of users and how long a token is valid
+	JWTSecret []byte
+	TokenTTL  time.Duration
+
+	// How long a session lasts unused, its refresh token gets new tokens until then. No refresh tokens when zero
+	RefreshTokenTTL time.Duration
+
+	// Archive done to-do list older than ArchiveAfter every ArchiveInterval, disabled when zero
+	ArchiveAfter    time.Duration
+	ArchiveInterval time.Duration
+
+	// Deleted to-do list are purged from the trash after this long, never when zero
+	TrashRetention time.Duration
+
+	// Stores the files attached to to-do list, at most MaxAttachmentSize bytes of the AttachmentTypes, disabled when nil
+	Attachments       AttachmentStore
+	MaxAttachmentSize int64
+	AttachmentTypes   map[string]bool
+
+	// Delivers the reminders of to-do list, checked every ReminderInterval and disabled when zero
+	Notifier         Notifier
+	ReminderInterval time.Duration
+
+	// Failed webhook deliveries are retried until this many attempts, then marked dead
+	WebhookMaxAttempts int
+
+	// Origins, methods and headers allowed to call the API from a browser, none when nil
+	CORS *CORSPolicy
+
+	// Gzip the responses of clients accepting it
+	Compress bool
+
+	// Providers users may sign in with besides their password, none when nil
+	OAuth *OAuthConfig
+
+	// The built Vue app, served on the paths outside of the API. The API alone when nil
+	Frontend fs.FS
+
+	// Serves HTTPS itself instead of behind a reverse proxy, plain HTTP when nil
+	TLS *ServerTLS
+
+	// Limits on reading a request and writing its response, no limit when zero
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// On SIGTERM the health check fails for ShutdownDelay, so the load balancer stops sending requests before
+	// the server stops accepting them, then in-flight requests get ShutdownTimeout to finish
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	// Set once shutdown started
+	draining atomic.Bool
+
+	// Migration version this build needs, the readiness probe fails while the database is behind it
+	SchemaVersion uint
+}
+
+type Response struct {
+	Data    interface{} `json:"data"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Status  int         `json:"status"`
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message"`
+	// Fields that failed validation, with Code VALIDATION_ERROR
+	Errors []service.FieldError `json:"errors,omitempty"`
+}
+
+type Pagination struct {
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Page   int    `json:"page"`
+	Pages  int    `json:"pages"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+
+	// Links to the first and the last page, only sent in the Link header
+	first, last string
+}
+
+// Shapes of a page of a list, chosen with PAGINATION_STYLE
+const (
+	// The items in data and the Pagination in meta
+	PAGINATION_STYLE_BODY = "body"
+	// The items alone in data, the total in X-Total-Count and the neighbour pages in a Link header (RFC 8288)
+	PAGINATION_STYLE_LINK = "link"
+	// data is {"items": [...], "page": Pagination}
+	PAGINATION_STYLE_ENVELOPE = "envelope"
+)
+
+// pageEnvelope is the data of a page with PAGINATION_STYLE_ENVELOPE
+type pageEnvelope struct {
+	Items interface{} `json:"items"`
+	Page  Pagination  `json:"page"`
+}
+
+const (
+	MESSAGE_SUCCESS = "Success"
+	MESSAGE_FAILED  = "Failed"
+	MESSAGE_INVALID = "Invalid input"
+)
+
+// Machine-readable reason of a failed response
+const (
+	CODE_BAD_REQUEST      = "BAD_REQUEST"
+	CODE_VALIDATION_ERROR = "VALIDATION_ERROR"
+	CODE_UNAUTHORIZED     = "UNAUTHORIZED"
+	CODE_NOT_FOUND        = "NOT_FOUND"
+	CODE_CONFLICT         = "CONFLICT"
+	CODE_TODO_LOCKED      = "TODO_LOCKED"
+	CODE_VERSION_CONFLICT = "VERSION_CONFLICT"
+	// PUT or PATCH without If-Match while RequireIfMatch is set
+	CODE_PRECONDITION_REQUIRED = "PRECONDITION_REQUIRED"
+	CODE_DB_ERROR              = "DB_ERROR"
+	CODE_UNAVAILABLE           = "UNAVAILABLE"
+	// A handler panicked
+	CODE_INTERNAL_ERROR = "INTERNAL_ERROR"
+)
+
+// Origin of a to-do list
+const (
+	SOURCE_API    = "api"
+	SOURCE_IMPORT = "import"
+	SOURCE_EMAIL  = "email"
+	SOURCE_WEB    = "web"
+	SOURCE_GRPC   = "grpc"
+)
+
+const (
+	DEFAULT_STATS_DAYS     = 30
+	DEFAULT_COMPLETED_DAYS = 7
+	MAX_RANGE_DAYS         = 366
+	DEFAULT_LIMIT          = 20
+	MAX_LIMIT              = 100
+	MAX_OFFSET             = 1<<31 - 1 - MAX_LIMIT // Far past any list, a page of it and the link to the next one stay within an int32
+	STREAM_FLUSH_ROWS      = 100
+	MAX_LONG_POLL_WAIT     = 60 * time.Second
+)
+
+func buildResponse(w http.ResponseWriter, data interface{}, status int, message string) {
+	buildErrorResponse(w, data, status, errorCode(status), message)
+}
+
+// buildErrorResponse is buildResponse with a code more specific than the one implied by the status
+func buildErrorResponse(w http.ResponseWriter, data interface{}, status int, code string, message string) {
+	buildResponseWithErrors(w, data, status, code, message, nil)
+}
+
+// buildResponseWithErrors is buildErrorResponse listing the fields that failed validation
+func buildResponseWithErrors(w http.ResponseWriter, data interface{}, status int, code string, message string, errs []service.FieldError) {
+	result := Response{
+		Data:    data,
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Errors:  errs,
+	}
+	writeBody(w, status, result)
+}
+
+// errorCode is the default code of a status, empty on success. Internal errors come from the database
+func errorCode(status int) string {
+	switch {
+	case status < 400:
+		return ""
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return CODE_UNAUTHORIZED
+	case status == http.StatusNotFound:
+		return CODE_NOT_FOUND
+	case status == http.StatusConflict:
+		return CODE_CONFLICT
+	case status == http.StatusServiceUnavailable:
+		return CODE_UNAVAILABLE
+	case status >= 500:
+		return CODE_DB_ERROR
+	}
+	return CODE_BAD_REQUEST
+}
+
+// buildPaginatedResponse writes a page of a list in the shape of the PaginationStyle, the paginated routes all answer
+// through it
+func (conf *Config) buildPaginatedResponse(w http.ResponseWriter, data interface{}, pagination Pagination, status int, message string) {
+	switch conf.PaginationStyle {
+	case PAGINATION_STYLE_LINK:
+		w.Header().Set("X-Total-Count", strconv.Itoa(pagination.Total))
+		// Added, a deprecated path already links to its successor
+		for _, link := range []struct{ rel, url string }{
+			{"first", pagination.first}, {"prev", pagination.Prev}, {"next", pagination.Next}, {"last", pagination.last},
+		} {
+			if link.url != "" {
+				w.Header().Add("Link", "<"+link.url+`>; rel="`+link.rel+`"`)
+			}
+		}
+		buildResponse(w, data, status, message)
+	case PAGINATION_STYLE_ENVELOPE:
+		buildResponse(w, pageEnvelope{Items: data, Page: pagination}, status, message)
+	default:
+		writeBody(w, status, Response{
+			Data:    data,
+			Meta:    pagination,
+			Status:  status,
+			Message: message,
+		})
+	}
+}
+
+func isValidSource(source string) bool {
+	switch source {
+	case SOURCE_API, SOURCE_IMPORT, SOURCE_EMAIL, SOURCE_WEB, service.SOURCE_TEMPLATE, SOURCE_GRPC:
+		return true
+	}
+	return false
+}
+
+// routes registers the handlers on the router
+func (r *Config) routes() {
+	// Partial response via ?select=
+	r.Router.Use(selectMiddleware)
+
+	// The unversioned paths say they are deprecated
+	r.Router.Use(deprecationMiddleware)
+
+	// Infrastructure, outside of the API versions
+	r.probeRoutes(r.Router)
+
+	// A future /api/v2 registers its own routes on a subrouter of its own. They may wrap the handlers of v1 to change
+	// the shape of their responses, while /api/v1 keeps answering as before
+	r.v1Routes(r.Router.PathPrefix(API_V1_PREFIX).Subrouter())
+
+	// The paths of before the versioning, aliases of /api/v1
+	r.v1Routes(r.Router)
+}
+
+// probeRoutes registers the health probes and the metrics, which the orchestrator and Prometheus scrape
+func (r *Config) probeRoutes(router *mux.Router) {
+	// Liveness probe
+	router.HandleFunc(`/healthz`, r.getHealth).Methods("GET")
+
+	// Readiness probe for the load balancer
+	router.HandleFunc(`/readyz`, r.getReady).Methods("GET")
+
+	// Startup probe
+	router.HandleFunc(`/startupz`, r.getStartup).Methods("GET")
+
+	// Prometheus metrics, for the X-Admin-Key
+	router.HandleFunc(`/metrics`, r.getMetrics).Methods("GET")
+}
+
+// v1Routes registers version 1 of the API on api, the routes the database driver supports
+func (r *Config) v1Routes(api *mux.Router) {
+	switch r.DBDriver {
+	case service.DB_DRIVER_SQLITE:
+		r.sqliteRoutes(api)
+	case service.DB_DRIVER_MYSQL:
+		r.portableRoutes(api)
+	default:
+		r.postgresRoutes(api)
+	}
+}
+
+// postgresRoutes registers every route of version 1 on api
+func (r *Config) postgresRoutes(api *mux.Router) {
+	// Get all to-do list
+	api.HandleFunc(`/todo`, r.cached(r.getTodos, r.CacheListTTL)).Methods("GET")
+
+	// Full-text search of the to-do list, best match first
+	api.HandleFunc(`/todo/search`, r.searchTodos).Methods("GET")
+
+	// Download to-do list as CSV or JSON
+	api.HandleFunc(`/todo/export`, r.exportTodos).Methods("GET")
+
+	// Get the to-do list grouped by status
+	api.HandleFunc(`/todo/board`, r.cached(r.getBoard, r.CacheListTTL)).Methods("GET")
+
+	// Get the to-do list due today, urgent or woken from a snooze today
+	api.HandleFunc(`/todo/views/today`, r.cached(r.getView(service.VIEW_TODAY), r.CacheListTTL)).Methods("GET")
+
+	// Get the to-do list due or waking from a snooze in the next days
+	api.HandleFunc(`/todo/views/upcoming`, r.cached(r.getView(service.VIEW_UPCOMING), r.CacheListTTL)).Methods("GET")
+
+	// Get the to-do list without a due date nor a snooze
+	api.HandleFunc(`/todo/views/someday`, r.cached(r.getView(service.VIEW_SOMEDAY), r.CacheListTTL)).Methods("GET")
+
+	// iCalendar feed of the to-do list with a due date, by the token of the feed
+	api.HandleFunc(`/todo/calendar.ics`, r.getCalendar).Methods("GET")
+
+	// Create the token of the calendar feed, replacing the previous one
+	api.HandleFunc(`/todo/calendar/token`, r.createCalendarToken).Methods("POST")
+
+	// Revoke the token of the calendar feed
+	api.HandleFunc(`/todo/calendar/token`, r.revokeCalendarToken).Methods("DELETE")
+
+	// Get the deleted to-do list
+	api.HandleFunc(`/todo/trash`, r.getTrash).Methods("GET")
+
+	// Stream change events as Server-Sent Events
+	api.HandleFunc(`/todo/events`, r.streamTodoEvents).Methods("GET")
+
+	// Get completed to-do list within a date range
+	api.HandleFunc(`/todo/completed`, r.getCompletedTodos).Methods("GET")
+
+	// Get count of completed to-do list per day
+	api.HandleFunc(`/todo/stats/daily`, r.getDailyStats).Methods("GET")
+
+	// Summary of the to-do list for a dashboard, with the completions per day of the last weeks
+	api.HandleFunc(`/stats`, r.getStats).Methods("GET")
+
+	// Backup all tables (admin only)
+	api.HandleFunc(`/todo/backup`, r.getBackup).Methods("GET")
+
+	// Search to-do list with a structured filter
+	api.HandleFunc(`/todo/query`, r.queryTodos).Methods("POST")
+
+	// Estimate the cost of a structured filter
+	api.HandleFunc(`/todo/query/explain`, r.explainQuery).Methods("POST")
+
+	// Preview the next dates of a recurrence rule
+	api.HandleFunc(`/todo/recurrence/preview`, r.previewRecurrence).Methods("POST")
+
+	// Get all to-do list template
+	api.HandleFunc(`/todo/template`, r.getTemplates).Methods("GET")
+
+	// Add to-do list template
+	api.HandleFunc(`/todo/template`, r.addTemplate).Methods("POST")
+
+	// Create to-do list from a template
+	api.HandleFunc(`/todo/template/apply`, r.applyTemplate).Methods("POST")
+
+	// Mark every to-do list as done
+	api.HandleFunc(`/todo/complete-all`, r.completeAllTodos).Methods("POST")
+
+	// Mark every to-do list as not done
+	api.HandleFunc(`/todo/incomplete-all`, r.incompleteAllTodos).Methods("POST")
+
+	// Archive every done to-do list
+	api.HandleFunc(`/todo/archive-completed`, r.archiveCompletedTodos).Methods("POST")
+
+	// Add many to-do list at once
+	api.HandleFunc(`/todo/batch`, r.addTodoBatch).Methods("POST")
+
+	// Save the manual order of the to-do list
+	api.HandleFunc(`/todo/reorder`, r.reorderTodos).Methods("POST")
+
+	// Import to-do list from a CSV, JSON or Todoist file
+	api.HandleFunc(`/todo/import`, r.importTodos).Methods("POST")
+
+	// Get detail to-do list
+	api.HandleFunc(`/todo/{id}`, r.cached(r.getTodo, r.CacheTodoTTL)).Methods("GET")
+
+	// Add to-do list
+	api.HandleFunc(`/todo`, r.addTodo).Methods("POST")
+
+	// Update to-do list
+	api.HandleFunc(`/todo/{id}`, r.updateTodo).Methods("PUT")
+
+	// Partially update to-do list
+	api.HandleFunc(`/todo/{id}`, r.patchTodo).Methods("PATCH")
+
+	// Reopen completed to-do list
+	api.HandleFunc(`/todo/{id}/reopen`, r.reopenTodo).Methods("POST")
+
+	// Hide to-do list from the views for a duration or until a time
+	api.HandleFunc(`/todo/{id}/snooze`, r.snoozeTodo).Methods("POST")
+
+	// Bring back snoozed to-do list to the views
+	api.HandleFunc(`/todo/{id}/snooze`, r.wakeTodo).Methods("DELETE")
+
+	// Archive to-do list, hiding it from the default list
+	api.HandleFunc(`/todo/{id}/archive`, r.archiveTodo).Methods("POST")
+
+	// Bring back archived to-do list to the default list
+	api.HandleFunc(`/todo/{id}/unarchive`, r.unarchiveTodo).Methods("POST")
+
+	// Get the changes of to-do list
+	api.HandleFunc(`/todo/{id}/history`, r.getTodoHistory).Methods("GET")
+
+	// Restore deleted to-do list
+	api.HandleFunc(`/todo/{id}/restore`, r.restoreTodo).Methods("POST")
+
+	// Get all projects
+	api.HandleFunc(`/project`, r.getProjects).Methods("GET")
+
+	// Add project
+	api.HandleFunc(`/project`, r.addProject).Methods("POST")
+
+	// Get the projects of others shared with the user
+	api.HandleFunc(`/project/shared`, r.getSharedProjects).Methods("GET")
+
+	// Get to-do list of project, with the filters of GET /todo
+	api.HandleFunc(`/project/{id}/todo`, r.getProjectTodos).Methods("GET")
+
+	// Invite a user to project
+	api.HandleFunc(`/project/{id}/invitations`, r.inviteMember).Methods("POST")
+
+	// Get the pending invitations to project
+	api.HandleFunc(`/project/{id}/invitations`, r.getProjectInvitations).Methods("GET")
+
+	// Revoke an invitation to project
+	api.HandleFunc(`/project/{id}/invitations/{invitationID}`, r.revokeInvitation).Methods("DELETE")
+
+	// Get the owner and members of project
+	api.HandleFunc(`/project/{id}/members`, r.getMembers).Methods("GET")
+
+	// Change the role of a member of project
+	api.HandleFunc(`/project/{id}/members/{userID}`, r.updateMember).Methods("PUT")
+
+	// Remove a member from project, or leave it
+	api.HandleFunc(`/project/{id}/members/{userID}`, r.removeMember).Methods("DELETE")
+
+	// Get the pending invitations of the user
+	api.HandleFunc(`/invitations`, r.getInvitations).Methods("GET")
+
+	// Accept an invitation to a project
+	api.HandleFunc(`/invitations/{id}/accept`, r.acceptInvitation).Methods("POST")
+
+	// Decline an invitation to a project
+	api.HandleFunc(`/invitations/{id}`, r.declineInvitation).Methods("DELETE")
+
+	// Get detail project
+	api.HandleFunc(`/project/{id}`, r.getProject).Methods("GET")
+
+	// Rename project
+	api.HandleFunc(`/project/{id}`, r.updateProject).Methods("PUT")
+
+	// Remove project, its to-do list are kept without a project
+	api.HandleFunc(`/project/{id}`, r.deleteProject).Methods("DELETE")
+
+	// Add checklist item to to-do list
+	api.HandleFunc(`/todo/{id}/items`, r.addItem).Methods("POST")
+
+	// Update checklist item
+	api.HandleFunc(`/todo/{id}/items/{itemID}`, r.updateItem).Methods("PUT")
+
+	// Remove checklist item
+	api.HandleFunc(`/todo/{id}/items/{itemID}`, r.deleteItem).Methods("DELETE")
+
+	// Comment on a to-do list
+	api.HandleFunc(`/todo/{id}/comments`, r.addComment).Methods("POST")
+
+	// List the comments of a to-do list
+	api.HandleFunc(`/todo/{id}/comments`, r.getComments).Methods("GET")
+
+	// Remove a comment
+	api.HandleFunc(`/todo/{id}/comments/{commentID}`, r.deleteComment).Methods("DELETE")
+
+	// Upload a file attached to a to-do list
+	api.HandleFunc(`/todo/{id}/attachments`, r.uploadAttachment).Methods("POST")
+
+	// List the attachments of a to-do list
+	api.HandleFunc(`/todo/{id}/attachments`, r.getAttachments).Methods("GET")
+
+	// Download an attachment
+	api.HandleFunc(`/todo/{id}/attachments/{attachmentID}`, r.downloadAttachment).Methods("GET")
+
+	// Remove an attachment with its file
+	api.HandleFunc(`/todo/{id}/attachments/{attachmentID}`, r.deleteAttachment).Methods("DELETE")
+
+	// Add tag to to-do list
+	api.HandleFunc(`/todo/{id}/tag/{name}`, r.attachTag).Methods("PUT")
+
+	// Remove tag from to-do list
+	api.HandleFunc(`/todo/{id}/tag/{name}`, r.detachTag).Methods("DELETE")
+
+	// Create read-only link of to-do list
+	api.HandleFunc(`/todo/{id}/share`, r.shareTodo).Methods("POST")
+
+	// Revoke read-only link of to-do list
+	api.HandleFunc(`/todo/{id}/share`, r.unshareTodo).Methods("DELETE")
+
+	// Get to-do list by its read-only link
+	api.HandleFunc(`/shared/{token}`, r.getSharedTodo).Methods("GET")
+
+	// Permanently delete a to-do list of the trash
+	api.HandleFunc(`/todo/{id}/purge`, r.purgeTodo).Methods("DELETE")
+
+	// Remove to-do list
+	api.HandleFunc(`/todo/{id}`, r.deleteTodo).Methods("DELETE")
+
+	// Get tags in use with their count
+	api.HandleFunc(`/tag`, r.getTags).Methods("GET")
+
+	// Create tag
+	api.HandleFunc(`/tag`, r.addTag).Methods("POST")
+
+	// Remove tag from every to-do list
+	api.HandleFunc(`/tag/{name}`, r.deleteTag).Methods("DELETE")
+
+	// Get the connection pool usage (admin only)
+	api.HandleFunc(`/admin/db/pool`, r.getPoolStats).Methods("GET")
+
+	// Get the active sessions of the users (admin only)
+	api.HandleFunc(`/admin/sessions`, r.getSessions).Methods("GET")
+
+	// Revoke a session (admin only)
+	api.HandleFunc(`/admin/sessions/{id}`, r.revokeSession).Methods("DELETE")
+
+	// Create user account
+	api.HandleFunc(`/auth/register`, r.register).Methods("POST")
+
+	// Log in and get a token
+	api.HandleFunc(`/auth/login`, r.login).Methods("POST")
+
+	// Exchange a refresh token for new tokens
+	api.HandleFunc(`/auth/refresh`, r.refreshToken).Methods("POST")
+
+	// Log out, revoking the session of the tokens
+	api.HandleFunc(`/auth/logout`, r.logout).Methods("POST")
+
+	// Sign in with an OAuth provider, redirects to it
+	api.HandleFunc(`/auth/oauth/{provider}`, r.startOAuth).Methods("GET")
+
+	// The provider redirects back here, gets a token like the login
+	api.HandleFunc(`/auth/oauth/{provider}/callback`, r.oauthCallback).Methods("GET")
+
+	// Link an account of an OAuth provider to the user, returns where to sign in at the provider
+	api.HandleFunc(`/identities/{provider}`, r.linkOAuth).Methods("POST")
+
+	// Get the API keys of the user
+	api.HandleFunc(`/apikeys`, r.getAPIKeys).Methods("GET")
+
+	// Create an API key, shown only in the response
+	api.HandleFunc(`/apikeys`, r.createAPIKey).Methods("POST")
+
+	// Revoke an API key
+	api.HandleFunc(`/apikeys/{id}`, r.revokeAPIKey).Methods("DELETE")
+
+	// Get enabled optional features
+	api.HandleFunc(`/capabilities`, r.getCapabilities).Methods("GET")
+
+	// GraphQL API over the to-do list, tags and projects
+	api.Handle(`/graphql`, r.graphqlHandler()).Methods("POST")
+
+	// OpenAPI document of the routes
+	api.HandleFunc(`/openapi.json`, r.getOpenAPI).Methods("GET")
+
+	// Swagger UI of the OpenAPI document
+	api.HandleFunc(`/docs`, r.getDocs).Methods("GET")
+
+	// Live change events over a WebSocket
+	api.HandleFunc(`/ws`, r.streamChanges).Methods("GET")
+
+	// Get all webhooks
+	api.HandleFunc(`/webhooks`, r.getWebhooks).Methods("GET")
+
+	// Register webhook
+	api.HandleFunc(`/webhooks`, r.addWebhook).Methods("POST")
+
+	// Get webhook delivery status
+	api.HandleFunc(`/webhooks/deliveries`, r.getWebhookDeliveries).Methods("GET")
+
+	// Change URL and events of webhook
+	api.HandleFunc(`/webhooks/{id}`, r.updateWebhook).Methods("PUT")
+
+	// Remove webhook
+	api.HandleFunc(`/webhooks/{id}`, r.deleteWebhook).Methods("DELETE")
+
+}
+
+// postgresOnlyFilters are the filters of GET /todo built on Postgres operators and functions, e.g. ILIKE and @>, or on
+// the projects, which only Postgres has
+var postgresOnlyFilters = []string{"q", "title_contains", "tag", "overdue", "project_id"}
+
+// portableRoutes registers the routes whose queries run on every database driver: the to-do lists with their history,
+// the accounts and the docs. Without Postgres the other routes answer 404
+func (r *Config) portableRoutes(api *mux.Router) {
+	// Get all to-do list
+	api.HandleFunc(`/todo`, rejectFilters(r.cached(r.getTodos, r.CacheListTTL), postgresOnlyFilters...)).Methods("GET")
+
+	// Get the to-do list grouped by status
+	api.HandleFunc(`/todo/board`, rejectFilters(r.cached(r.getBoard, r.CacheListTTL), postgresOnlyFilters...)).Methods("GET")
+
+	// Get the to-do list due today, urgent or woken from a snooze today
+	api.HandleFunc(`/todo/views/today`, rejectFilters(r.cached(r.getView(service.VIEW_TODAY), r.CacheListTTL), postgresOnlyFilters...)).Methods("GET")
+
+	// Get the to-do list due or waking from a snooze in the next days
+	api.HandleFunc(`/todo/views/upcoming`, rejectFilters(r.cached(r.getView(service.VIEW_UPCOMING), r.CacheListTTL), postgresOnlyFilters...)).Methods("GET")
+
+	// Get the to-do list without a due date nor a snooze
+	api.HandleFunc(`/todo/views/someday`, rejectFilters(r.cached(r.getView(service.VIEW_SOMEDAY), r.CacheListTTL), postgresOnlyFilters...)).Methods("GET")
+
+	// Get detail to-do list
+	api.HandleFunc(`/todo/{id}`, r.cached(r.getTodo, r.CacheTodoTTL)).Methods("GET")
+
+	// Add to-do list
+	api.HandleFunc(`/todo`, r.addTodo).Methods("POST")
+
+	// Import to-do list from a CSV, JSON or Todoist file
+	api.HandleFunc(`/todo/import`, r.importTodos).Methods("POST")
+
+	// Update to-do list
+	api.HandleFunc(`/todo/{id}`, r.updateTodo).Methods("PUT")
+
+	// Partially update to-do list
+	api.HandleFunc(`/todo/{id}`, r.patchTodo).Methods("PATCH")
+
+	// Reopen completed to-do list
+	api.HandleFunc(`/todo/{id}/reopen`, r.reopenTodo).Methods("POST")
+
+	// Hide to-do list from the views for a duration or until a time
+	api.HandleFunc(`/todo/{id}/snooze`, r.snoozeTodo).Methods("POST")
+
+	// Bring back snoozed to-do list to the views
+	api.HandleFunc(`/todo/{id}/snooze`, r.wakeTodo).Methods("DELETE")
+
+	// Get the changes of to-do list
+	api.HandleFunc(`/todo/{id}/history`, r.getTodoHistory).Methods("GET")
+
+	// Remove to-do list
+	api.HandleFunc(`/todo/{id}`, r.deleteTodo).Methods("DELETE")
+
+	// Get the connection pool usage (admin only)
+	api.HandleFunc(`/admin/db/pool`, r.getPoolStats).Methods("GET")
+
+	// Get the active sessions of the users (admin only)
+	api.HandleFunc(`/admin/sessions`, r.getSessions).Methods("GET")
+
+	// Revoke a session (admin only)
+	api.HandleFunc(`/admin/sessions/{id}`, r.revokeSession).Methods("DELETE")
+
+	// Create user account
+	api.HandleFunc(`/auth/register`, r.register).Methods("POST")
+
+	// Log in and get a token
+	api.HandleFunc(`/auth/login`, r.login).Methods("POST")
+
+	// Exchange a refresh token for new tokens
+	api.HandleFunc(`/auth/refresh`, r.refreshToken).Methods("POST")
+
+	// Log out, revoking the session of the tokens
+	api.HandleFunc(`/auth/logout`, r.logout).Methods("POST")
+
+	// Sign in with an OAuth provider, redirects to it
+	api.HandleFunc(`/auth/oauth/{provider}`, r.startOAuth).Methods("GET")
+
+	// The provider redirects back here, gets a token like the login
+	api.HandleFunc(`/auth/oauth/{provider}/callback`, r.oauthCallback).Methods("GET")
+
+	// Link an account of an OAuth provider to the user, returns where to sign in at the provider
+	api.HandleFunc(`/identities/{provider}`, r.linkOAuth).Methods("POST")
+
+	// Get the API keys of the user
+	api.HandleFunc(`/apikeys`, r.getAPIKeys).Methods("GET")
+
+	// Create an API key, shown only in the response
+	api.HandleFunc(`/apikeys`, r.createAPIKey).Methods("POST")
+
+	// Revoke an API key
+	api.HandleFunc(`/apikeys/{id}`, r.revokeAPIKey).Methods("DELETE")
+
+	// Get enabled optional features, fewer without Postgres
+	api.HandleFunc(`/capabilities`, r.getCapabilities).Methods("GET")
+
+	// OpenAPI document of the routes
+	api.HandleFunc(`/openapi.json`, r.getOpenAPI).Methods("GET")
+
+	// Swagger UI of the OpenAPI document
+	api.HandleFunc(`/docs`, r.getDocs).Methods("GET")
+}
+
+// rejectFilters answers 400 to a request with one of the query parameters instead of passing it to next
+func rejectFilters(next http.HandlerFunc, params ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, param := range params {
+			if r.URL.Query().Has(param) {
+				buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, param+" is not supported without Postgres")
+				return
+			}
+		}
+		for param := range r.URL.Query() {
+			if strings.HasPrefix(param, "metadata.") {
+				buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, "metadata filters are not supported without Postgres")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// rateLimit wraps next with the per client limit when one is configured
+func (r *Config) rateLimit(next http.Handler) http.Handler {
+	if r.RateLimiter == nil {
+		return next
+	}
+	return r.RateLimiter.middleware(next)
+}
+
+// unauthorized refuses a request without a valid credential with 401, or 429 once its IP is over the rate limit. The
+// rate limit runs after the authentication, which would answer a guess per request unlimited otherwise
+func (r *Config) unauthorized(w http.ResponseWriter, req *http.Request) {
+	if r.RateLimiter != nil && !r.RateLimiter.allow(w, req) {
+		return
+	}
+	buildResponse(w, nil, http.StatusUnauthorized, MESSAGE_FAILED)
+}
+
+// cached serves next from the response cache for ttl when one is configured
+func (r *Config) cached(next http.HandlerFunc, ttl time.Duration) http.HandlerFunc {
+	if r.Cache == nil || ttl <= 0 {
+		return next
+	}
+	return r.Cache.handler(next, ttl)
+}
+
+// invalidateCache wraps next with the invalidation of the cached responses when a cache is configured
+func (r *Config) invalidateCache(next http.Handler) http.Handler {
+	if r.Cache == nil {
+		return next
+	}
+	return r.Cache.middleware(r.Changes, next)
+}
+
+// authenticate wraps next with the API key check when a key is configured
+func (r *Config) authenticate(next http.Handler) http.Handler {
+	if r.APIKey == "" {
+		return next
+	}
+	return apiKeyMiddleware(r.APIKey, r.unauthorized, next)
+}
+
+// cors wraps next with the CORS policy when one is configured
+func (r *Config) cors(next http.Handler) http.Handler {
+	if r.CORS == nil {
+		return next
+	}
+	return r.CORS.middleware(next)
+}
+
+// compress wraps next with the gzip compression of responses when it is enabled
+func (r *Config) compress(next http.Handler) http.Handler {
+	if !r.Compress {
+		return next
+	}
+	return compressMiddleware(next)
+}
+
+// middlewares is the stack around the router, outermost first. It wraps the router instead of being added with
+// Router.Use so that unmatched paths and preflight requests go through it too
+func (r *Config) middlewares() []middleware {
+	return []middleware{
+		r.tracingMiddleware,
+		r.metricsMiddleware,
+		requestIDMiddleware,
+		loggingMiddleware,
+		// Outside of recoverMiddleware, so the 500 of a panic is compressed like any response and the gzip stream ends
+		r.compress,
+		// Inside the access log so a panic is logged with its 500, outside of everything else that may panic
+		recoverMiddleware,
+		// Inside recoverMiddleware, whose 500 is JSON whatever the client asked for
+		r.negotiateMiddleware,
+		r.cors,
+		// Before the rate limit and the authentication, a page load fetches many public files
+		r.frontend,
+		r.authenticate,
+		r.requireUser,
+		// Inside requireUser, so each user has a bucket whatever credential it sent. The refused credentials count
+		// against the IP in unauthorized
+		r.rateLimit,
+		// Inside requireUser, which sets the user whose cached responses a write invalidates
+		r.invalidateCache,
+	}
+}
+
+// Handler registers the routes and serves them until ctx is done, then drains the in-flight requests. It returns the
+// error of a server which failed before
+func (r *Config) Handler(ctx context.Context) error {
+	r.routes()
+
+	server := &http.Server{
+		Addr:         r.Addr,
+		Handler:      chain(r.Router, r.middlewares()...),
+		ReadTimeout:  r.ReadTimeout,
+		WriteTimeout: r.WriteTimeout,
+	}
+
+	failed := make(chan error, 2)
+	go func() {
+		slog.Info("Server listening", "addr", server.Addr, "tls", r.TLS != nil)
+		serve := server.ListenAndServe
+		if r.TLS != nil {
+			serve = func() error { return r.TLS.serve(server) }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
+			failed <- fmt.Errorf("server failed: %w", err)
+		}
+	}()
+	if r.TLS != nil && r.TLS.RedirectAddr != "" {
+		go func() {
+			if err := r.TLS.serveRedirects(ctx, r.Addr); err != nil {
+				failed <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-failed:
+		server.Close()
+		return err
+	case <-ctx.Done():
+	}
+	r.draining.Store(true)
+	if r.ShutdownDelay > 0 {
+		slog.Info("Draining, shutting down server after the delay", "delay", r.ShutdownDelay)
+		time.Sleep(r.ShutdownDelay)
+	}
+	slog.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// Event streams and requests still running past the timeout are cut off
+		slog.Warn("Server shutdown timed out, closing the remaining connections", "error", err)
+		server.Close()
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// parseListFilter reads the filter of the list of the user from the query parameters of GET /todo
+func (conf *Config) parseListFilter(r *http.Request) (service.ListFilter, error) {
+	filter := service.ListFilter{UserID: currentUser(r), IncludeArchived: r.URL.Query().Get("include_archived") == "true"}
+	if source := r.URL.Query().Get("source"); source != "" {
+		if !isValidSource(source) {
+			return filter, fmt.Errorf("invalid source %q", source)
+		}
+		filter.Source = source
+	}
+	if isDone := r.URL.Query().Get("is_done"); isDone != "" {
+		if isDone != "true" && isDone != "false" {
+			return filter, fmt.Errorf("invalid is_done %q", isDone)
+		}
+		done := isDone == "true"
+		filter.IsDone = &done
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if !service.IsValidStatus(status) {
+			return filter, fmt.Errorf("invalid status %q", status)
+		}
+		filter.Status = status
+	}
+	if projectID := r.URL.Query().Get("project_id"); projectID != "" {
+		id, err := strconv.Atoi(projectID)
+		if err != nil {
+			return filter, fmt.Errorf("invalid project_id %q", projectID)
+		}
+		filter.ProjectID = &id
+	}
+	if priority := r.URL.Query().Get("priority"); priority != "" {
+		if !service.IsValidPriority(priority) {
+			return filter, fmt.Errorf("invalid priority %q", priority)
+		}
+		filter.Priority = priority
+	}
+	if overdue := r.URL.Query().Get("overdue"); overdue != "" {
+		if overdue != "true" && overdue != "false" {
+			return filter, fmt.Errorf("invalid overdue %q", overdue)
+		}
+		isOverdue := overdue == "true"
+		filter.Overdue = &isOverdue
+	}
+	// due_before and due_after are RFC3339 instants, exclusive
+	for _, bound := range []struct {
+		param string
+		due   **time.Time
+	}{{"due_before", &filter.DueBefore}, {"due_after", &filter.DueAfter}} {
+		if v := r.URL.Query().Get(bound.param); v != "" {
+			due, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %q", bound.param, v)
+			}
+			*bound.due = &due
+		}
+	}
+	// due=today is the current calendar day in the configured timezone
+	if due := r.URL.Query().Get("due"); due != "" {
+		if due != "today" {
+			return filter, fmt.Errorf("invalid due %q", due)
+		}
+		now := time.Now().In(conf.Location)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, conf.Location)
+		tomorrow := today.AddDate(0, 0, 1)
+		filter.DueFrom, filter.DueUntil = &today, &tomorrow
+	}
+	// title_contains is the same search as q
+	for _, param := range []string{"q", "title_contains"} {
+		if q := r.URL.Query().Get(param); q != "" {
+			filter.TitleContains = append(filter.TitleContains, q)
+		}
+	}
+	// Repeated tag parameters are ANDed, the to-do list must have every tag
+	if tags := r.URL.Query()["tag"]; len(tags) > 0 {
+		filter.Tags = service.Tags(tags)
+	}
+	// metadata.<key>=<value> matches the value stored under key
+	for param, values := range r.URL.Query() {
+		if key := strings.TrimPrefix(param, "metadata."); key != param && key != "" {
+			if filter.Metadata == nil {
+				filter.Metadata = make(map[string]string)
+			}
+			filter.Metadata[key] = values[0]
+		}
+	}
+	return filter, nil
+}
+
+func (conf *Config) getTodos(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("wait") {
+		conf.waitTodoChanges(w, r)
+		return
+	}
+
+	todos := make([]service.Todo, 0)
+
+	filter, err := conf.parseListFilter(r)
+	if err != nil {
+		buildResponse(w, todos, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	sort, err := parseSort(r)
+	if err != nil {
+		buildResponse(w, todos, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	render, err := parseRender(r)
+	if err != nil {
+		buildErrorResponse(w, todos, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	// Streaming is meant for the whole list, so it isn't paginated
+	if r.URL.Query().Get("stream") == "true" {
+		rows, err := conf.queries().Select(r.Context(), filter, sort)
+		if err != nil {
+			buildResponse(w, todos, http.StatusInternalServerError, MESSAGE_FAILED)
+			return
+		}
+		defer rows.Close()
+
+		streamTodos(r.Context(), w, rows, render)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		buildResponse(w, todos, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	todos, total, err := conf.queries().List(r.Context(), filter, sort, limit, offset)
+	if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	if render {
+		for i := range todos {
+			renderDescription(&todos[i])
+		}
+	}
+
+	// Like GET /todo/{id}, polling clients only download the page again once it changed
+	setLastModified(w, todos...)
+	if hasFeature(r, FEATURE_TOTAL_COUNT) {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	}
+	if etag, err := todosETag(todos, total); err == nil && notModified(w, r, etag) {
+		return
+	}
+
+	conf.buildPaginatedResponse(w, todos, newPagination(r, limit, offset, total), http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// streamTodos writes the response envelope with the data array encoded row by row instead of buffering it, with the
+// rendered descriptions when render is set
+func streamTodos(ctx context.Context, w http.ResponseWriter, rows *service.TodoRows, render bool) {
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+
+	w.Write([]byte(`{"data":[`))
+	var err error
+	for i := 0; rows.Next(); i++ {
+		todo := rows.Todo()
+		if render {
+			renderDescription(&todo)
+		}
+		var data []byte
+		if data, err = marshalResponse(todo, writesNullTimestamps(w)); err != nil {
+			break
+		}
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		w.Write(data)
+
+		if flusher != nil && (i+1)%STREAM_FLUSH_ROWS == 0 {
+			flusher.Flush()
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+
+	// The 200 is already sent, so a failure is reported after the rows written so far
+	if err != nil {
+		slog.ErrorContext(ctx, "Streaming to-do list failed", "error", err)
+		fmt.Fprintf(w, `],"status":%d,"code":%q,"message":%q,"error":"stream interrupted"}`, http.StatusInternalServerError, CODE_DB_ERROR, MESSAGE_FAILED)
+		return
+	}
+	fmt.Fprintf(w, `],"status":%d,"message":%q}`, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// waitTodoChanges long-polls for changes newer than the "since" cursor
+func (conf *Config) waitTodoChanges(w http.ResponseWriter, r *http.Request) {
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil || wait < 0 {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	if wait > MAX_LONG_POLL_WAIT {
+		wait = MAX_LONG_POLL_WAIT
+	}
+
+	// Without a cursor only the changes from now on are returned
+	since := conf.Changes.Cursor()
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+			return
+		}
+	}
+
+	release, ok := conf.Changes.Subscribe()
+	if !ok {
+		buildResponse(w, nil, http.StatusServiceUnavailable, MESSAGE_FAILED)
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	buildResponse(w, conf.Changes.Wait(ctx, since, currentUser(r)), http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// pathID is the number of the URL variable name, false when it isn't one and so can't be the id of anything
+func pathID(r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	return id, err == nil
+}
+
+func (conf *Config) getTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	render, err := parseRender(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+	include, err := parseInclude(r)
+	if err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	todo, err := conf.todos().Get(r.Context(), currentUser(r), todoID)
+	if err == service.ErrTodoNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	checklist, err := conf.checklists().Load(r.Context(), todo.ID)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+	todo.Checklist = checklist
+	if include[INCLUDE_COMMENTS] {
+		if todo.Comments, err = conf.comments().List(r.Context(), todo.ID); err != nil {
+			buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+			return
+		}
+	}
+	if render {
+		renderDescription(&todo)
+		renderComments(todo.Comments)
+	}
+
+	// Polling clients only download the to-do list again once it changed, the ETag covers the checklist and comments
+	setLastModified(w, todo)
+	if etag, err := todoETag(todo); err == nil && notModified(w, r, etag) {
+		return
+	}
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// addTodo creates a to-do list. A retry with the Idempotency-Key of an earlier request gets its to-do list instead of a second one
+func (conf *Config) addTodo(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	key, hash := r.Header.Get("Idempotency-Key"), requestHash(body)
+	if len(key) > MAX_IDEMPOTENCY_KEY_LENGTH {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, fmt.Sprintf("Idempotency-Key must not be longer than %d characters", MAX_IDEMPOTENCY_KEY_LENGTH))
+		return
+	}
+	if key != "" {
+		if stored, err := conf.idempotencyKeys().Stored(r.Context(), currentUser(r), key, hash); err == service.ErrIdempotencyMismatch {
+			buildErrorResponse(w, nil, http.StatusConflict, CODE_CONFLICT, err.Error())
+			return
+		} else if err != nil {
+			buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+			return
+		} else if stored != nil {
+			w.Header().Set("Idempotent-Replayed", "true")
+			buildResponse(w, stored, http.StatusCreated, MESSAGE_SUCCESS)
+			return
+		}
+	}
+
+	var newTodo service.Todo
+	if err := json.Unmarshal(body, &newTodo); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	newTodo.Source = SOURCE_API
+
+	todos := conf.todos()
+	if key == "" {
+		err = todos.Create(r.Context(), currentUser(r), &newTodo)
+	} else if err = todos.Check(r.Context(), currentUser(r), &newTodo); err == nil {
+		var replayed bool
+		if replayed, err = conf.idempotencyKeys().CreateOnce(r.Context(), currentUser(r), key, hash, &newTodo); replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		} else if err == nil {
+			todos.Publish(r.Context(), service.EVENT_CREATED, currentUser(r), newTodo)
+		}
+	}
+	var invalid service.ValidationError
+	if errors.As(err, &invalid) {
+		buildValidationResponse(w, newTodo, err)
+		return
+	} else if err == service.ErrIdempotencyMismatch {
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_CONFLICT, err.Error())
+		return
+	} else if err != nil {
+		buildResponse(w, newTodo, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, newTodo, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) updateTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var updatedTodo service.Todo
+	if err = json.NewDecoder(r.Body).Decode(&updatedTodo); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	var ifMatch bool
+	if updatedTodo.Version, ifMatch, err = conf.expectedVersion(r, updatedTodo.Version); err == errPreconditionRequired {
+		buildErrorResponse(w, nil, http.StatusPreconditionRequired, CODE_PRECONDITION_REQUIRED, err.Error())
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	err = conf.todos().Replace(r.Context(), currentUser(r), todoID, &updatedTodo)
+	var invalid service.ValidationError
+	switch {
+	case err == nil:
+		buildResponse(w, updatedTodo, http.StatusOK, MESSAGE_SUCCESS)
+	case errors.As(err, &invalid):
+		buildValidationResponse(w, updatedTodo, err)
+	case err == service.ErrTodoNotFound:
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+	case err == service.ErrTodoLocked:
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_TODO_LOCKED, MESSAGE_FAILED)
+	case err == service.ErrVersionConflict:
+		buildErrorResponse(w, nil, versionConflictStatus(ifMatch), CODE_VERSION_CONFLICT, MESSAGE_FAILED)
+	default:
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+	}
+}
+
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// expectedVersion prefers the If-Match header over the version in the body, zero means unconditional
+// ifMatch reports whether the header was sent, without it errPreconditionRequired is returned when RequireIfMatch is set
+func (conf *Config) expectedVersion(r *http.Request, bodyVersion int) (version int, ifMatch bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if conf.RequireIfMatch {
+			return 0, false, errPreconditionRequired
+		}
+		return bodyVersion, false, nil
+	}
+	// Any version is fine
+	if header == "*" {
+		return 0, true, nil
+	}
+	// Either a bare version or an ETag of GET /todo/{id}, which starts with the version
+	raw, _, _ := strings.Cut(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), "-")
+	version, err = strconv.Atoi(raw)
+	return version, true, err
+}
+
+// versionConflictStatus is 412 when the stale version came in If-Match, 409 when it came in the body
+func versionConflictStatus(ifMatch bool) int {
+	if ifMatch {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
+
+func (conf *Config) patchTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	var patch service.TodoPatch
+	if err = json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	var ifMatch bool
+	if patch.Version, ifMatch, err = conf.expectedVersion(r, patch.Version); err == errPreconditionRequired {
+		buildErrorResponse(w, nil, http.StatusPreconditionRequired, CODE_PRECONDITION_REQUIRED, err.Error())
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	_, updatedTodo, err := conf.todos().Patch(r.Context(), currentUser(r), todoID, patch)
+	var invalid service.ValidationError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid):
+		buildValidationResponse(w, nil, err)
+		return
+	case err == service.ErrTodoNotFound:
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	case err == service.ErrTodoLocked:
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_TODO_LOCKED, MESSAGE_FAILED)
+		return
+	case err == service.ErrVersionConflict:
+		buildErrorResponse(w, nil, versionConflictStatus(ifMatch), CODE_VERSION_CONFLICT, MESSAGE_FAILED)
+		return
+	default:
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, updatedTodo, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) deleteTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	deletedTodo, err := conf.todos().Delete(r.Context(), currentUser(r), todoID)
+	if err == service.ErrTodoNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, service.Todo{Title: deletedTodo.Title, Description: deletedTodo.Description}, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// parseDateRange reads the inclusive "from" and "to" dates, defaulting to the last defaultDays days
+func (conf *Config) parseDateRange(r *http.Request, defaultDays int) (from, to time.Time, err error) {
+	now := time.Now().In(conf.Location)
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, conf.Location)
+	from = to.AddDate(0, 0, -(defaultDays - 1))
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.ParseInLocation(service.DATE_LAYOUT, v, conf.Location); err != nil {
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.ParseInLocation(service.DATE_LAYOUT, v, conf.Location); err != nil {
+			return
+		}
+	}
+	// Counted in calendar days, a day of a change to or from summer time isn't 24 hours long
+	if to.Before(from) || !to.Before(from.AddDate(0, 0, MAX_RANGE_DAYS)) {
+		err = errors.New("invalid date range")
+	}
+	return
+}
+
+// parseSort reads ?sort=key or ?sort=-key (descending), the manual order of POST /todo/reorder when unset. ?order=asc
+// or ?order=desc sets the direction of a key without the prefix
+func parseSort(r *http.Request) (service.Sort, error) {
+	key, order := r.URL.Query().Get("sort"), r.URL.Query().Get("order")
+	if key == "" && order == "" {
+		return service.Sort{}, nil
+	}
+	if key == "" {
+		key = "id"
+	}
+
+	var sort service.Sort
+	if strings.HasPrefix(key, "-") {
+		key, sort.Desc = key[1:], true
+		if order != "" {
+			return sort, fmt.Errorf("sort %q already has a direction", "-"+key)
+		}
+	}
+	switch order {
+	case "", "asc":
+	case "desc":
+		sort.Desc = true
+	default:
+		return sort, fmt.Errorf("invalid order %q", order)
+	}
+	if !service.IsSortKey(key) {
+		return sort, fmt.Errorf("invalid sort %q", key)
+	}
+	sort.Key = key
+	return sort, nil
+}
+
+// parsePagination reads "limit" and "offset" or the 1-based "page", defaulting to the first DEFAULT_LIMIT rows
+func parsePagination(r *http.Request) (limit, offset int, err error) {
+	limit, offset = DEFAULT_LIMIT, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return
+		}
+	}
+	if v := r.URL.Query().Get("page"); v != "" {
+		var page int
+		if page, err = strconv.Atoi(v); err != nil {
+			return
+		}
+		// Checked before multiplying, a huge page would overflow into a negative offset
+		if page < 1 || limit < 1 || page-1 > MAX_OFFSET/limit || r.URL.Query().Has("offset") {
+			err = errors.New("invalid pagination")
+			return
+		}
+		offset = (page - 1) * limit
+	}
+	if limit < 1 || limit > MAX_LIMIT || offset < 0 || offset > MAX_OFFSET {
+		err = errors.New("invalid pagination")
+	}
+	return
+}
+
+// newPagination describes the page of the request, with links to its neighbours keeping the other parameters
+func newPagination(r *http.Request, limit, offset, total int) Pagination {
+	pagination := Pagination{
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+		Page:   offset/limit + 1,
+		Pages:  (total + limit - 1) / limit,
+	}
+	link := func(offset int) string {
+		query := r.URL.Query()
+		query.Del("page")
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return r.URL.Path + "?" + query.Encode()
+	}
+	if offset+limit < total {
+		pagination.Next = link(offset + limit)
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		pagination.Prev = link(prev)
+	}
+	pagination.first = link(0)
+	if pagination.Pages > 0 {
+		pagination.last = link((pagination.Pages - 1) * limit)
+	}
+	return pagination
+}
+
+func (conf *Config) getDailyStats(w http.ResponseWriter, r *http.Request) {
+	from, to, err := conf.parseDateRange(r, DEFAULT_STATS_DAYS)
+	if err != nil {
+		buildResponse(w, nil, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	stats, err := conf.queries().DailyCompletions(r.Context(), currentUser(r), conf.Location, from, to)
+	if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, stats, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// reopenTodo marks a completed to-do list as not done, which also unlocks it for editing
+func (conf *Config) reopenTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	todo, err := conf.todos().SetDone(r.Context(), currentUser(r), todoID, false)
+	var invalid service.ValidationError
+	switch {
+	case err == nil:
+	// The status transitions may not allow leaving done
+	case errors.As(err, &invalid):
+		buildValidationResponse(w, nil, err)
+		return
+	case err == service.ErrTodoNotFound:
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	case err == service.ErrTodoLocked:
+		buildErrorResponse(w, nil, http.StatusConflict, CODE_TODO_LOCKED, MESSAGE_FAILED)
+		return
+	default:
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// restoreTodo brings back a deleted to-do list, restoring one which isn't deleted is a no-op
+func (conf *Config) restoreTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+
+	todo, err := conf.todos().Restore(r.Context(), currentUser(r), todoID)
+	if err == service.ErrTodoNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// getCompletedTodos returns the to-do list completed within the date range, latest first
+func (conf *Config) getCompletedTodos(w http.ResponseWriter, r *http.Request) {
+	todos := make([]service.Todo, 0)
+
+	from, to, err := conf.parseDateRange(r, DEFAULT_COMPLETED_DAYS)
+	if err != nil {
+		buildResponse(w, todos, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		buildResponse(w, todos, http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	todos, err = conf.queries().Completed(r.Context(), currentUser(r), from, to.AddDate(0, 0, 1), limit, offset)
+	if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, todos, http.StatusOK, MESSAGE_SUCCESS)
+}
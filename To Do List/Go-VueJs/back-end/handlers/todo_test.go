@@ -0,0 +1,1243 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+
+	"to-do-list/service"
+)
+
+var errDatabase = errors.New("database is down")
+
+// testUserID is the user every request of serve is logged in as
+const testUserID = 1
+
+var todoColumns = []string{"id", "title", "description", "is_done", "archived", "completed_at", "source", "version", "metadata", "created_at", "updated_at", "due_date", "deleted_at", "tags", "priority", "project_id", "recurrence", "remind_at", "status", "snoozed_until"}
+
+// newTestConfig returns a Config with its routes registered on a mock database
+func newTestConfig(t *testing.T) (*Config, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	conf := &Config{
+		Router:    mux.NewRouter(),
+		Database:  db,
+		Location:  time.UTC,
+		Changes:   service.NewBroadcaster(service.DEFAULT_MAX_SUBSCRIBERS),
+		JWTSecret: testJWTSecret,
+		TokenTTL:  time.Hour,
+	}
+	conf.routes()
+	return conf, mock
+}
+
+// serve sends the request of testUserID through the router and decodes the JSON response
+func serve(t *testing.T, conf *Config, method, target, body string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	rec := httptest.NewRecorder()
+	conf.Router.ServeHTTP(rec, req)
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if rec.Code != response.Status {
+		t.Errorf("HTTP status = %d, the body says %d", rec.Code, response.Status)
+	}
+	return rec, response
+}
+
+func todoRow(rows *sqlmock.Rows, id int, title string, isDone bool) *sqlmock.Rows {
+	now, status := time.Now(), service.STATUS_BACKLOG
+	if isDone {
+		status = service.STATUS_DONE
+	}
+	return rows.AddRow(id, title, "", isDone, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{work}"), service.PRIORITY_MEDIUM, nil, nil, nil, status, nil)
+}
+
+// expectHistory expects the change of a to-do list to be recorded as action
+func expectHistory(mock sqlmock.Sqlmock, action string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO todo_history(todo_id, actor_id, action, changes)")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), action, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// expectSetTags expects the tags of to-do list id to be replaced with tags, given as a TEXT[] literal
+func expectSetTags(mock sqlmock.Sqlmock, id int, tags string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO tag(user_id, name) SELECT user_id, unnest($2::text[]) FROM todo WHERE id = $1")).
+		WithArgs(id, tags).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM todo_tag WHERE todo_id = $1")).
+		WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH added AS (INSERT INTO todo_tag(todo_id, tag_id)")).
+		WithArgs(id, tags).WillReturnRows(sqlmock.NewRows([]string{"tags"}).AddRow([]byte(tags)))
+}
+
+// expectAudience expects the lookup of who else sees the changed to-do lists, nobody unless the rows of to-do list id
+// and user id say otherwise
+func expectAudience(mock sqlmock.Sqlmock, rows ...[2]int) {
+	audience := sqlmock.NewRows([]string{"id", "user_id"})
+	for _, row := range rows {
+		audience.AddRow(row[0], row[1])
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id FROM todo WHERE id = ANY($1)")).WillReturnRows(audience)
+}
+
+func decodeData(t *testing.T, response Response, v interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(response.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decoding data %s: %v", data, err)
+	}
+}
+
+func checkResponse(t *testing.T, response Response, status int, code string) {
+	t.Helper()
+
+	if response.Status != status {
+		t.Errorf("status = %d, want %d", response.Status, status)
+	}
+	if response.Code != code {
+		t.Errorf("code = %q, want %q", response.Code, code)
+	}
+}
+
+func TestGetTodos(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+		count  int
+	}{
+		{
+			name:   "success",
+			target: "/todo",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND archived = FALSE")).
+					WithArgs(testUserID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				rows := sqlmock.NewRows(todoColumns)
+				todoRow(rows, 1, "Buy milk", false)
+				todoRow(rows, 2, "Walk the dog", true)
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND archived = FALSE ORDER BY position IS NULL, position, id LIMIT $2 OFFSET $3")).
+					WithArgs(testUserID, DEFAULT_LIMIT, 0).
+					WillReturnRows(rows)
+			},
+			status: http.StatusOK,
+			count:  2,
+		},
+		{
+			name:   "filters and sort",
+			target: "/todo?is_done=true&sort=-title&limit=5",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND is_done = $2")).
+					WithArgs(testUserID, true).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("ORDER BY title IS NULL, title DESC, id LIMIT $3 OFFSET $4")).
+					WithArgs(testUserID, true, 5, 0).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 2, "Walk the dog", true))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "done",
+			target: "/todo?is_done=true",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND is_done = $2")).
+					WithArgs(testUserID, true).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("AND is_done = $2")).
+					WithArgs(testUserID, true, DEFAULT_LIMIT, 0).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 2, "Walk the dog", true))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "not done",
+			target: "/todo?is_done=false",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND is_done = $2")).
+					WithArgs(testUserID, false).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("AND is_done = $2")).
+					WithArgs(testUserID, false, DEFAULT_LIMIT, 0).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "invalid done",
+			target: "/todo?is_done=maybe",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "every tag",
+			target: "/todo?tag=work&tag=urgent",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND "+service.TODO_TAGS+" @> $2")).
+					WithArgs(testUserID, `{"work","urgent"}`).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("AND "+service.TODO_TAGS+" @> $2 AND archived = FALSE ORDER BY position IS NULL, position, id")).
+					WithArgs(testUserID, `{"work","urgent"}`, DEFAULT_LIMIT, 0).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "page",
+			target: "/todo?page=2&limit=1",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectQuery(regexp.QuoteMeta("ORDER BY position IS NULL, position, id LIMIT $2 OFFSET $3")).
+					WithArgs(testUserID, 1, 1).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 2, "Walk the dog", true))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "invalid page",
+			target: "/todo?page=0",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "page overflowing the offset",
+			target: "/todo?page=922337203685477581&limit=10",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "offset too far",
+			target: "/todo?offset=9223372036854775807",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "part of the title",
+			target: "/todo?q=MIL",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND title ILIKE '%' || $2 || '%'")).
+					WithArgs(testUserID, "MIL").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("AND title ILIKE '%' || $2 || '%'")).
+					WithArgs(testUserID, "MIL", DEFAULT_LIMIT, 0).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "wildcards matched literally",
+			target: "/todo?q=" + url.QueryEscape(`50%_off\`),
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).
+					WithArgs(testUserID, `50\%\_off\\`).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("AND title ILIKE '%' || $2 || '%'")).
+					WithArgs(testUserID, `50\%\_off\\`, DEFAULT_LIMIT, 0).
+					WillReturnRows(sqlmock.NewRows(todoColumns))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "title contains and order",
+			target: "/todo?title_contains=groceries&sort=created_at&order=desc",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND title ILIKE '%' || $2 || '%'")).
+					WithArgs(testUserID, "groceries").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("ORDER BY created_at IS NULL, created_at DESC, id LIMIT $3 OFFSET $4")).
+					WithArgs(testUserID, "groceries", DEFAULT_LIMIT, 0).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy groceries", false))
+			},
+			status: http.StatusOK,
+			count:  1,
+		},
+		{
+			name:   "invalid order",
+			target: "/todo?sort=title&order=sideways",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "due today",
+			target: "/todo?due=today",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND due_date >= $2 AND due_date < $3")).
+					WithArgs(testUserID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("ORDER BY position IS NULL, position, id LIMIT $4 OFFSET $5")).
+					WillReturnRows(sqlmock.NewRows(todoColumns))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "invalid due before",
+			target: "/todo?due_before=tomorrow",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "invalid sort",
+			target: "/todo?sort=password",
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_BAD_REQUEST,
+		},
+		{
+			name:   "database error",
+			target: "/todo",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).WillReturnError(errDatabase)
+			},
+			status: http.StatusInternalServerError,
+			code:   CODE_DB_ERROR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodGet, tt.target, "")
+			checkResponse(t, response, tt.status, tt.code)
+
+			var todos []service.Todo
+			decodeData(t, response, &todos)
+			if len(todos) != tt.count {
+				t.Errorf("got %d to-do list, want %d", len(todos), tt.count)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// An empty table is an empty array, the list view iterates over data
+func TestGetTodosEmpty(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).
+		WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY position IS NULL, position, id LIMIT $2 OFFSET $3")).
+		WithArgs(testUserID, DEFAULT_LIMIT, 0).
+		WillReturnRows(sqlmock.NewRows(todoColumns))
+
+	rec, response := serve(t, conf, http.MethodGet, "/todo", "")
+	checkResponse(t, response, http.StatusOK, "")
+	if !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Errorf("body = %s, want data to be []", rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// The list selects the same columns as GET /todo/{id}, so it has the descriptions without asking for them. The
+// include_description=true of older clients changes nothing, and an empty description is left out
+func TestGetTodosIncludesDescription(t *testing.T) {
+	for _, target := range []string{"/todo", "/todo?include_description=true"} {
+		t.Run(target, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT "+service.TODO_COLUMNS+" FROM todo WHERE user_id = $1")).
+				WithArgs(testUserID, DEFAULT_LIMIT, 0).
+				WillReturnRows(sqlmock.NewRows(todoColumns).
+					AddRow(1, "Buy milk", "Oat milk", false, false, nil, SOURCE_API, 1, []byte("{}"), time.Now(), time.Now(), nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil).
+					AddRow(2, "Call mum", "", false, false, nil, SOURCE_API, 1, []byte("{}"), time.Now(), time.Now(), nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil))
+
+			rec, response := serve(t, conf, http.MethodGet, target, "")
+			checkResponse(t, response, http.StatusOK, "")
+			var todos []service.Todo
+			decodeData(t, response, &todos)
+			if len(todos) != 2 || todos[0].ID != 1 || todos[0].Description != "Oat milk" {
+				t.Errorf("todos = %+v, want the id and description", todos)
+			}
+			if strings.Count(rec.Body.String(), `"description"`) != 1 {
+				t.Errorf("body = %s, want only the description which isn't empty", rec.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		limit      int
+		offset     int
+		total      int
+		page       int
+		pages      int
+		next, prev string
+	}{
+		{name: "first", target: "/todo?is_done=false", limit: 10, offset: 0, total: 25, page: 1, pages: 3, next: "/todo?is_done=false&limit=10&offset=10"},
+		{name: "middle", target: "/todo?page=2&limit=10", limit: 10, offset: 10, total: 25, page: 2, pages: 3, next: "/todo?limit=10&offset=20", prev: "/todo?limit=10&offset=0"},
+		{name: "last", target: "/todo", limit: 10, offset: 20, total: 25, page: 3, pages: 3, prev: "/todo?limit=10&offset=10"},
+		{name: "empty", target: "/todo", limit: 10, offset: 0, total: 0, page: 1, pages: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pagination := newPagination(httptest.NewRequest(http.MethodGet, tt.target, nil), tt.limit, tt.offset, tt.total)
+			if pagination.Page != tt.page || pagination.Pages != tt.pages {
+				t.Errorf("page = %d of %d, want %d of %d", pagination.Page, pagination.Pages, tt.page, tt.pages)
+			}
+			if pagination.Next != tt.next || pagination.Prev != tt.prev {
+				t.Errorf("next = %q, prev = %q, want %q and %q", pagination.Next, pagination.Prev, tt.next, tt.prev)
+			}
+		})
+	}
+}
+
+func TestPaginationStyles(t *testing.T) {
+	page := Pagination{Total: 5, Limit: 2, Offset: 2, Page: 2, Pages: 3, Next: "/todo/trash?limit=2&offset=4", Prev: "/todo/trash?limit=2&offset=0"}
+	links := []string{
+		`</todo/trash?limit=2&offset=0>; rel="first"`,
+		`</todo/trash?limit=2&offset=0>; rel="prev"`,
+		`</todo/trash?limit=2&offset=4>; rel="next"`,
+		`</todo/trash?limit=2&offset=4>; rel="last"`,
+	}
+
+	tests := []struct {
+		style string
+		check func(t *testing.T, rec *httptest.ResponseRecorder, response Response)
+	}{
+		{
+			style: PAGINATION_STYLE_BODY,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, response Response) {
+				var body struct {
+					Data []service.Todo `json:"data"`
+					Meta Pagination     `json:"meta"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if len(body.Data) != 2 || body.Meta != page {
+					t.Errorf("data = %d to-do list, meta = %+v", len(body.Data), body.Meta)
+				}
+				if rec.Header().Get("X-Total-Count") != "" {
+					t.Errorf("X-Total-Count = %q, want none", rec.Header().Get("X-Total-Count"))
+				}
+			},
+		},
+		{
+			style: PAGINATION_STYLE_LINK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, response Response) {
+				var todos []service.Todo
+				decodeData(t, response, &todos)
+				if len(todos) != 2 || response.Meta != nil {
+					t.Errorf("data = %d to-do list, meta = %v", len(todos), response.Meta)
+				}
+				if rec.Header().Get("X-Total-Count") != "5" {
+					t.Errorf("X-Total-Count = %q, want 5", rec.Header().Get("X-Total-Count"))
+				}
+				// After the link of the deprecated path to its successor
+				got := rec.Header().Values("Link")
+				if len(got) != len(links)+1 || strings.Join(got[1:], ", ") != strings.Join(links, ", ") {
+					t.Errorf("Link = %q, want %q after the successor", got, links)
+				}
+			},
+		},
+		{
+			style: PAGINATION_STYLE_ENVELOPE,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, response Response) {
+				var envelope struct {
+					Items []service.Todo `json:"items"`
+					Page  Pagination     `json:"page"`
+				}
+				decodeData(t, response, &envelope)
+				if len(envelope.Items) != 2 || envelope.Page != page || response.Meta != nil {
+					t.Errorf("items = %d to-do list, page = %+v, meta = %v", len(envelope.Items), envelope.Page, response.Meta)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			conf.PaginationStyle = tt.style
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NOT NULL")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+			mock.ExpectQuery(regexp.QuoteMeta("ORDER BY deleted_at DESC, id LIMIT $2 OFFSET $3")).
+				WithArgs(testUserID, 2, 2).
+				WillReturnRows(todoRow(todoRow(sqlmock.NewRows(todoColumns), 3, "Buy milk", false), 4, "Walk the dog", false))
+
+			rec, response := serve(t, conf, http.MethodGet, "/todo/trash?limit=2&offset=2", "")
+			checkResponse(t, response, http.StatusOK, "")
+			tt.check(t, rec, response)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip(err)
+	}
+	conf := &Config{Location: amsterdam}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "one day", query: "from=2024-03-30&to=2024-03-30"},
+		{name: "to before from", query: "from=2024-03-30&to=2024-03-29", wantErr: true},
+		{name: "the most days", query: "from=2024-03-30&to=2025-03-30"},
+		// An hour short of MAX_RANGE_DAYS times 24 hours, summer time starts the day after from
+		{name: "one day too many over summer time", query: "from=2024-03-30&to=2025-03-31", wantErr: true},
+		{name: "invalid date", query: "from=30-03-2024", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todo/stats/daily?"+tt.query, nil)
+			if _, _, err := conf.parseDateRange(req, DEFAULT_STATS_DAYS); (err != nil) != tt.wantErr {
+				t.Errorf("parseDateRange(%q) error = %v, want an error %v", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetTodo(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "success",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+" AND deleted_at IS NULL")).
+					WithArgs(1, testUserID).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo_item WHERE todo_id = $1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(1, "Oat", true).AddRow(2, "Soy", false))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1")).WithArgs(1, testUserID).WillReturnError(sql.ErrNoRows)
+			},
+			status: http.StatusNotFound,
+			code:   CODE_NOT_FOUND,
+		},
+		{
+			name: "database error",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1")).WithArgs(1, testUserID).WillReturnError(errDatabase)
+			},
+			status: http.StatusInternalServerError,
+			code:   CODE_DB_ERROR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodGet, "/todo/1", "")
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// The query runs with the context of the request, which ends it once the client is gone or the deadline passed
+func TestGetTodoCancelled(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1")).
+		WithArgs(1, testUserID).
+		WillDelayFor(time.Minute).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), userKey{}, testUserID), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/todo/1", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	conf.Router.ServeHTTP(rec, req)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("answered after %v, the query wasn't cancelled", elapsed)
+	}
+
+	var response Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, response, http.StatusInternalServerError, CODE_DB_ERROR)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddTodo(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+		errors []service.FieldError
+	}{
+		{
+			name: "success",
+			body: `{"title":"Buy milk"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo(title, description, source, metadata, due_date, priority, user_id, project_id, recurrence, remind_at)")).
+					WithArgs("Buy milk", "", SOURCE_API, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, testUserID, nil, nil, nil).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 42, "Buy milk", false))
+				expectHistory(mock, service.EVENT_CREATED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "with tags",
+			body: `{"title":"Buy milk","tags":["home","errand"]}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo(title, description, source, metadata, due_date, priority, user_id, project_id, recurrence, remind_at)")).
+					WithArgs("Buy milk", "", SOURCE_API, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, testUserID, nil, nil, nil).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 42, "Buy milk", false))
+				expectSetTags(mock, 42, `{"home","errand"}`)
+				expectHistory(mock, service.EVENT_CREATED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "invalid JSON",
+			body:   `{"title":`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+			errors: []service.FieldError{{Rule: RULE_JSON, Message: "body must be a JSON object"}},
+		},
+		{
+			name:   "missing title",
+			body:   `{"title":"  "}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+			errors: []service.FieldError{{Field: "title", Rule: service.RULE_REQUIRED, Message: "title is required"}},
+		},
+		{
+			name:   "title too long",
+			body:   `{"title":"` + strings.Repeat("a", service.MAX_TITLE_LENGTH+1) + `"}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+			errors: []service.FieldError{{Field: "title", Rule: service.RULE_MAX_LENGTH, Message: "title must be at most 255 characters"}},
+		},
+		{
+			name:   "invalid priority",
+			body:   `{"title":"Buy milk","priority":"critical"}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+			errors: []service.FieldError{{Field: "priority", Rule: service.RULE_ONE_OF, Message: "priority must be one of low, medium, high or urgent"}},
+		},
+		{
+			name: "database error",
+			body: `{"title":"Buy milk"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO todo")).WillReturnError(errDatabase)
+				mock.ExpectRollback()
+			},
+			status: http.StatusInternalServerError,
+			code:   CODE_DB_ERROR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodPost, "/todo", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			if tt.code == CODE_VALIDATION_ERROR {
+				// What was wrong is in the errors, the message is the same for every input
+				if response.Message != MESSAGE_INVALID {
+					t.Errorf("message = %q, want %q", response.Message, MESSAGE_INVALID)
+				}
+				if !reflect.DeepEqual(response.Errors, tt.errors) {
+					t.Errorf("errors = %+v, want %+v", response.Errors, tt.errors)
+				}
+			}
+			if tt.status == http.StatusCreated {
+				var todo service.Todo
+				decodeData(t, response, &todo)
+				if todo.ID != 42 {
+					t.Errorf("id = %d, want the generated id 42", todo.ID)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdateTodo(t *testing.T) {
+	expectExisting := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE")).
+			WithArgs(1, testUserID).
+			WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "success",
+			body: `{"title":"Buy oat milk","is_done":true}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectExisting(mock)
+				expectSetTags(mock, 1, "{}")
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET title = $2")).
+					WithArgs(1, "Buy oat milk", "", true, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_DONE, nil).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy oat milk", true))
+				expectHistory(mock, service.EVENT_COMPLETED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "missing title",
+			body:   `{"is_done":true}`,
+			setup:  func(mock sqlmock.Sqlmock) {},
+			status: http.StatusBadRequest,
+			code:   CODE_VALIDATION_ERROR,
+		},
+		{
+			name: "not found",
+			body: `{"title":"Buy oat milk"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1")).WithArgs(1, testUserID).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			status: http.StatusNotFound,
+			code:   CODE_NOT_FOUND,
+		},
+		{
+			name: "version conflict",
+			body: `{"title":"Buy oat milk","version":3}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectExisting(mock)
+				expectSetTags(mock, 1, "{}")
+				mock.ExpectQuery(regexp.QuoteMeta("AND version = $13")).
+					WithArgs(1, "Buy oat milk", "", false, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil, 3).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			status: http.StatusConflict,
+			code:   CODE_VERSION_CONFLICT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodPut, "/todo/1", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			switch tt.status {
+			case http.StatusOK:
+				// The existing row was found and comes back updated
+				var todo service.Todo
+				decodeData(t, response, &todo)
+				if todo.ID != 1 || todo.Title != "Buy oat milk" {
+					t.Errorf("todo = %+v, want the updated to-do list 1", todo)
+				}
+			case http.StatusNotFound:
+				if response.Message != MESSAGE_FAILED {
+					t.Errorf("message = %q, want %q", response.Message, MESSAGE_FAILED)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdateTodoLockCompleted(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		lockCompleted bool
+		status        int
+		code          string
+	}{
+		{name: "blocked", body: `{"title":"Buy oat milk","is_done":true}`, lockCompleted: true, status: http.StatusConflict, code: CODE_TODO_LOCKED},
+		{name: "reopened", body: `{"title":"Buy oat milk","is_done":false}`, lockCompleted: true, status: http.StatusOK},
+		{name: "without the lock", body: `{"title":"Buy oat milk","is_done":true}`, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			conf.LockCompleted = tt.lockCompleted
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE")).
+				WithArgs(1, testUserID).
+				WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", true))
+			if tt.status == http.StatusOK {
+				expectSetTags(mock, 1, "{}")
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET title = $2")).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy oat milk", false))
+				expectHistory(mock, service.EVENT_UPDATED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			} else {
+				mock.ExpectRollback()
+			}
+
+			_, response := serve(t, conf, http.MethodPut, "/todo/1", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDeleteTodo(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(mock sqlmock.Sqlmock)
+		status int
+		code   string
+	}{
+		{
+			name: "success",
+			setup: func(mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET deleted_at = now()")).
+					WithArgs(1, testUserID).
+					WillReturnRows(sqlmock.NewRows(todoColumns).AddRow(1, "Buy milk", "", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, now, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil))
+				expectHistory(mock, service.EVENT_DELETED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET deleted_at = now()")).WithArgs(1, testUserID).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			status: http.StatusNotFound,
+			code:   CODE_NOT_FOUND,
+		},
+		{
+			name: "database error",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET deleted_at = now()")).WithArgs(1, testUserID).WillReturnError(errDatabase)
+				mock.ExpectRollback()
+			},
+			status: http.StatusInternalServerError,
+			code:   CODE_DB_ERROR,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodDelete, "/todo/1", "")
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPatchTodo(t *testing.T) {
+	expectExisting := func(mock sqlmock.Sqlmock, isDone bool) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE")).
+			WithArgs(1, testUserID).
+			WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", isDone))
+	}
+
+	tests := []struct {
+		name          string
+		body          string
+		lockCompleted bool
+		setup         func(mock sqlmock.Sqlmock)
+		status        int
+		code          string
+	}{
+		{
+			name: "only the given fields",
+			body: `{"is_done":true}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectExisting(mock, false)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET title = $2")).
+					WithArgs(1, "Buy milk", "", true, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_DONE, nil).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", true))
+				expectHistory(mock, service.EVENT_COMPLETED)
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "null clears",
+			body: `{"project_id":null,"remind_at":"2024-03-01T09:00:00Z"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectExisting(mock, false)
+				mock.ExpectQuery(regexp.QuoteMeta("project_id = $8, recurrence = $9, reminded_at = CASE WHEN remind_at IS DISTINCT FROM $10 THEN NULL ELSE reminded_at END, remind_at = $10")).
+					WithArgs(1, "Buy milk", "", false, sqlmock.AnyArg(), nil, service.PRIORITY_MEDIUM, nil, nil, time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), service.STATUS_BACKLOG, nil).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+				mock.ExpectCommit()
+				expectAudience(mock)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:          "locked when completed",
+			body:          `{"title":"Buy oat milk"}`,
+			lockCompleted: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectExisting(mock, true)
+				mock.ExpectRollback()
+			},
+			status: http.StatusConflict,
+			code:   CODE_TODO_LOCKED,
+		},
+		{
+			name: "not found",
+			body: `{"is_done":true}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1")).WithArgs(1, testUserID).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			status: http.StatusNotFound,
+			code:   CODE_NOT_FOUND,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			conf.LockCompleted = tt.lockCompleted
+			tt.setup(mock)
+
+			_, response := serve(t, conf, http.MethodPatch, "/todo/1", tt.body)
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestReopenTodo(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	conf.LockCompleted = true
+	var todo service.Todo
+	_, response := serve(t, conf, http.MethodPost, "/todo", `{"title":"Buy milk"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	decodeData(t, response, &todo)
+	target := fmt.Sprintf("/todo/%d", todo.ID)
+
+	_, response = serve(t, conf, http.MethodPatch, target, `{"is_done":true}`)
+	checkResponse(t, response, http.StatusOK, "")
+	_, response = serve(t, conf, http.MethodPatch, target, `{"title":"Buy oat milk"}`)
+	checkResponse(t, response, http.StatusConflict, CODE_TODO_LOCKED)
+
+	_, response = serve(t, conf, http.MethodPost, target+"/reopen", "")
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &todo)
+	if todo.IsDone || todo.CompletedAt != nil {
+		t.Errorf("reopened %+v", todo)
+	}
+
+	// Reopened it is editable again
+	_, response = serve(t, conf, http.MethodPatch, target, `{"title":"Buy oat milk"}`)
+	checkResponse(t, response, http.StatusOK, "")
+
+	_, response = serve(t, conf, http.MethodGet, target+"/history", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var history []service.HistoryEntry
+	decodeData(t, response, &history)
+	if len(history) != 4 || history[1].Action != service.EVENT_UPDATED || history[2].Action != service.EVENT_COMPLETED {
+		t.Errorf("history = %+v, want the reopen recorded", history)
+	}
+
+	_, response = serve(t, conf, http.MethodPost, "/todo/999/reopen", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+
+	// A workflow where done is final refuses the reopen
+	conf.StatusTransitions = service.StatusTransitions{
+		service.STATUS_BACKLOG:     {service.STATUS_IN_PROGRESS, service.STATUS_DONE},
+		service.STATUS_IN_PROGRESS: {service.STATUS_BACKLOG, service.STATUS_DONE},
+	}
+	_, response = serve(t, conf, http.MethodPatch, target, `{"is_done":true}`)
+	checkResponse(t, response, http.StatusOK, "")
+	_, response = serve(t, conf, http.MethodPost, target+"/reopen", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	_, response = serve(t, conf, http.MethodGet, target, "")
+	decodeData(t, response, &todo)
+	if !todo.IsDone {
+		t.Errorf("refused reopen changed %+v", todo)
+	}
+}
+
+func TestGetTodoConditional(t *testing.T) {
+	now := time.Now()
+	expectTodo := func(mock sqlmock.Sqlmock, version int) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_VIEWER)+" AND deleted_at IS NULL")).
+			WithArgs(1, testUserID).
+			WillReturnRows(sqlmock.NewRows(todoColumns).AddRow(1, "Buy milk", "", false, false, nil, SOURCE_API, version, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM todo_item")).WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}))
+	}
+	get := func(conf *Config, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/todo/1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	conf, mock := newTestConfig(t)
+	expectTodo(mock, 1)
+	expectTodo(mock, 1)
+	expectTodo(mock, 2)
+
+	first := get(conf, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: code = %d, ETag = %q", first.Code, etag)
+	}
+
+	unchanged := get(conf, etag)
+	if unchanged.Code != http.StatusNotModified {
+		t.Errorf("unchanged: code = %d, want %d", unchanged.Code, http.StatusNotModified)
+	}
+	if unchanged.Body.Len() != 0 {
+		t.Errorf("unchanged: body = %q, want none", unchanged.Body.String())
+	}
+
+	updated := get(conf, etag)
+	if updated.Code != http.StatusOK || updated.Body.Len() == 0 {
+		t.Errorf("updated: code = %d with %d bytes, want the new version", updated.Code, updated.Body.Len())
+	}
+	if updated.Header().Get("ETag") == etag {
+		t.Error("updated: ETag did not change")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetTodosConditional(t *testing.T) {
+	now := time.Now()
+	expectPage := func(mock sqlmock.Sqlmock, titles ...string) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(len(titles)))
+		rows := sqlmock.NewRows(todoColumns)
+		for i, title := range titles {
+			rows.AddRow(i+1, title, "", false, false, nil, SOURCE_API, 1, []byte("{}"), now, now, nil, nil, []byte("{}"), service.PRIORITY_MEDIUM, nil, nil, nil, service.STATUS_BACKLOG, nil)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("ORDER BY position IS NULL, position, id LIMIT $2 OFFSET $3")).WillReturnRows(rows)
+	}
+	get := func(conf *Config, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+		req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		conf.Router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	conf, mock := newTestConfig(t)
+	expectPage(mock, "Buy milk")
+	expectPage(mock, "Buy milk")
+	// Another to-do list was added
+	expectPage(mock, "Buy milk", "Walk the dog")
+
+	first := get(conf, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") != now.UTC().Format(http.TimeFormat) {
+		t.Fatalf("first request: code = %d, ETag = %q, Last-Modified = %q", first.Code, etag, first.Header().Get("Last-Modified"))
+	}
+
+	if unchanged := get(conf, etag); unchanged.Code != http.StatusNotModified || unchanged.Body.Len() != 0 {
+		t.Errorf("unchanged: code = %d with %d bytes, want %d without a body", unchanged.Code, unchanged.Body.Len(), http.StatusNotModified)
+	}
+
+	if added := get(conf, etag); added.Code != http.StatusOK || added.Header().Get("ETag") == etag {
+		t.Errorf("added: code = %d, ETag = %q, want a new page", added.Code, added.Header().Get("ETag"))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateTodoIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		stale   bool
+		status  int
+		code    string
+	}{
+		{name: "version", ifMatch: `"1"`, status: http.StatusOK},
+		{name: "ETag of GET", ifMatch: `"1-0123456789abcdef"`, status: http.StatusOK},
+		{name: "any version", ifMatch: "*", status: http.StatusOK},
+		{name: "stale", ifMatch: `"1"`, stale: true, status: http.StatusPreconditionFailed, code: CODE_VERSION_CONFLICT},
+		{name: "missing", status: http.StatusPreconditionRequired, code: CODE_PRECONDITION_REQUIRED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			conf.RequireIfMatch = true
+			if tt.ifMatch != "" {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("FROM todo WHERE id=$1 AND "+service.TodoAccess("", "$2", service.ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE")).
+					WithArgs(1, testUserID).
+					WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+				expectSetTags(mock, 1, "{}")
+				query := mock.ExpectQuery(regexp.QuoteMeta("UPDATE todo SET title = $2"))
+				if tt.stale {
+					query.WillReturnError(sql.ErrNoRows)
+					mock.ExpectRollback()
+				} else {
+					query.WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy oat milk", false))
+					expectHistory(mock, service.EVENT_UPDATED)
+					mock.ExpectCommit()
+					expectAudience(mock)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/todo/1", strings.NewReader(`{"title":"Buy oat milk"}`))
+			req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			conf.Router.ServeHTTP(rec, req)
+
+			var response Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Two clients read version 1, the second to save it overwrites nothing
+func TestUpdateTodoStaleVersion(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	var todo service.Todo
+	_, response := serve(t, conf, http.MethodPost, "/todo", `{"title":"Buy milk"}`)
+	checkResponse(t, response, http.StatusCreated, "")
+	decodeData(t, response, &todo)
+	target := fmt.Sprintf("/todo/%d", todo.ID)
+
+	_, response = serve(t, conf, http.MethodPut, target, `{"title":"Buy oat milk","version":1}`)
+	checkResponse(t, response, http.StatusOK, "")
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		_, response = serve(t, conf, method, target, `{"title":"Buy soy milk","version":1}`)
+		checkResponse(t, response, http.StatusConflict, CODE_VERSION_CONFLICT)
+	}
+
+	_, response = serve(t, conf, http.MethodGet, target, "")
+	checkResponse(t, response, http.StatusOK, "")
+	decodeData(t, response, &todo)
+	if todo.Title != "Buy oat milk" || todo.Version != 2 {
+		t.Errorf("todo = %+v, want only the first update", todo)
+	}
+}
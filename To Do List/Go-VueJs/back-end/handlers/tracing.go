@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRACER_NAME = "to-do-list"
+
+var Tracer = otel.Tracer(TRACER_NAME)
+
+// tracingMiddleware starts the server span of each request as a child of the traceparent it carries
+func (r *Config) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := r.routeOf(req)
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := Tracer.Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(req.URL.Path),
+				semconv.UserAgentOriginal(req.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, req.WithContext(ctx))
+
+		status := rw.statusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		// Client errors are the caller's fault, only failures of the server mark the span
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// recordSpans sends the spans of the test to a recorder instead of the global provider
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous, propagator := Tracer, otel.GetTextMapPropagator()
+	Tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(TRACER_NAME)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		Tracer = previous
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+	conf, _ := newTestConfig(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/abc", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, testUserID))
+	conf.tracingMiddleware(conf.Router).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended %d spans, want the server span", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /todo/{id}" {
+		t.Errorf("name = %q, want the route template", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace = %s, want the one of the traceparent", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent = %s, want the caller's span", got)
+	}
+	if !hasAttribute(span, semconv.HTTPResponseStatusCode(http.StatusNotFound)) {
+		t.Errorf("attributes = %v, want the status of the body", span.Attributes())
+	}
+	if span.Status().Code == codes.Error {
+		t.Error("a not found marked the span failed")
+	}
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, want attribute.KeyValue) bool {
+	for _, attr := range span.Attributes() {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"to-do-list/service"
+)
+
+// getTrash lists the deleted to-do list of the user, most recently deleted first
+func (conf *Config) getTrash(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	todos, total, err := conf.queries().Trash(r.Context(), currentUser(r), limit, offset)
+	if err != nil {
+		buildResponse(w, make([]service.Todo, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	conf.buildPaginatedResponse(w, todos, newPagination(r, limit, offset, total), http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// purgeTodo permanently deletes a to-do list of the trash, a to-do list which isn't deleted first is not found
+func (conf *Config) purgeTodo(w http.ResponseWriter, r *http.Request) {
+	todoID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := conf.store().Purge(r.Context(), currentUser(r), todoID); err == service.ErrTodoNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, nil, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// PurgeTrash periodically deletes the to-do list which have been in the trash for longer than age, until ctx is done.
+// It also deletes the files of the purged to-do list, including the ones purged by the user
+func (conf *Config) PurgeTrash(ctx context.Context, interval, age time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Trash purge stopped")
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := conf.store().PurgeDeleted(ctx, time.Now().Add(-age))
+		if err != nil {
+			slog.Error("Trash purge failed", "error", err)
+			continue
+		}
+		slog.Info("Purged deleted to-do list", "count", purged)
+
+		if conf.Attachments != nil {
+			deleted, err := conf.deleteOrphanAttachments(ctx)
+			if err != nil {
+				slog.Error("Deleting attachments of purged to-do list failed", "error", err)
+			}
+			if deleted > 0 {
+				slog.Info("Deleted attachments of purged to-do list", "count", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestGetTrash(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NOT NULL")).
+		WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT $2 OFFSET $3")).
+		WithArgs(testUserID, DEFAULT_LIMIT, 0).
+		WillReturnRows(todoRow(sqlmock.NewRows(todoColumns), 1, "Buy milk", false))
+
+	_, response := serve(t, conf, http.MethodGet, "/todo/trash", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var todos []service.Todo
+	decodeData(t, response, &todos)
+	if len(todos) != 1 {
+		t.Errorf("got %d to-do list, want 1", len(todos))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetTrashPagination(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NOT NULL")).
+		WithArgs(testUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY deleted_at DESC, id LIMIT $2 OFFSET $3")).
+		WithArgs(testUserID, 2, 2).
+		WillReturnRows(todoRow(todoRow(sqlmock.NewRows(todoColumns), 3, "Buy milk", false), 4, "Walk the dog", false))
+
+	rec, response := serve(t, conf, http.MethodGet, "/todo/trash?limit=2&offset=2", "")
+	checkResponse(t, response, http.StatusOK, "")
+	var page struct {
+		Meta Pagination `json:"meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	want := Pagination{Total: 5, Limit: 2, Offset: 2, Page: 2, Pages: 3, Next: "/todo/trash?limit=2&offset=4", Prev: "/todo/trash?limit=2&offset=0"}
+	if page.Meta != want {
+		t.Errorf("meta = %+v, want %+v", page.Meta, want)
+	}
+
+	for _, target := range []string{"/todo/trash?limit=0", "/todo/trash?offset=-1", "/todo/trash?page=abc"} {
+		_, response = serve(t, conf, http.MethodGet, target, "")
+		checkResponse(t, response, http.StatusBadRequest, CODE_BAD_REQUEST)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPurgeTodo(t *testing.T) {
+	tests := []struct {
+		name   string
+		purged int64
+		status int
+		code   string
+	}{
+		{name: "purged", purged: 1, status: http.StatusOK},
+		{name: "not in the trash", purged: 0, status: http.StatusNotFound, code: CODE_NOT_FOUND},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM todo WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL")).
+				WithArgs(1, testUserID).
+				WillReturnResult(sqlmock.NewResult(0, tt.purged))
+
+			_, response := serve(t, conf, http.MethodDelete, "/todo/1/purge", "")
+			checkResponse(t, response, tt.status, tt.code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPurgeTodoOfInvalidID(t *testing.T) {
+	conf, mock := newTestConfig(t)
+
+	_, response := serve(t, conf, http.MethodDelete, "/todo/abc/purge", "")
+	checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
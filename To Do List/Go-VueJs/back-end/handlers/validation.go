@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"to-do-list/service"
+)
+
+// Rule a field broke, stable for clients to branch on
+const (
+	RULE_UNIQUE = "unique"
+	// The body is not JSON at all, Field is empty
+	RULE_JSON = "json"
+)
+
+// decodeError describes why a body didn't decode, naming the field of a value of the wrong type
+func decodeError(err error) service.FieldErrors {
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var fieldErr service.FieldError
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &syntax):
+		return service.FieldErrors{{Rule: RULE_JSON, Message: "body must be a JSON object"}}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return service.FieldErrors{service.NewFieldError(typeErr.Field, service.RULE_TYPE, "%s must be %s", typeErr.Field, jsonType(typeErr.Type.Kind().String()))}
+	case errors.As(err, &fieldErr):
+		// Custom UnmarshalJSON of a field rejected its value
+		return service.FieldErrors{fieldErr}
+	}
+	return service.FieldErrors{{Rule: RULE_JSON, Message: err.Error()}}
+}
+
+// jsonType names a Go kind the way a JSON client knows it
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "bool":
+		return "a boolean"
+	case kind == "slice", kind == "array":
+		return "an array"
+	case kind == "map", kind == "struct":
+		return "an object"
+	}
+	return "a " + kind
+}
+
+// fieldErrors are the field errors within err, none when it doesn't name a field
+func fieldErrors(err error) service.FieldErrors {
+	var errs service.FieldErrors
+	var one service.FieldError
+	if errors.As(err, &errs) {
+		return errs
+	} else if errors.As(err, &one) {
+		return service.FieldErrors{one}
+	}
+	return nil
+}
+
+// buildValidationResponse answers 400 VALIDATION_ERROR with the field errors of err in Response.Errors.
+// The message is always MESSAGE_INVALID, what was wrong is only told by the errors
+func buildValidationResponse(w http.ResponseWriter, data interface{}, err error) {
+	var errs service.FieldErrors
+	errs.Add("", err)
+	buildResponseWithErrors(w, data, http.StatusBadRequest, CODE_VALIDATION_ERROR, MESSAGE_INVALID, errs)
+}
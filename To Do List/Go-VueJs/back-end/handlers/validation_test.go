@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestValidateTodoFieldErrors(t *testing.T) {
+	todo := service.Todo{
+		Title:      "  ",
+		Priority:   "critical",
+		Tags:       service.Tags{"home", ""},
+		Recurrence: &service.Recurrence{Frequency: "yearly", Interval: -1},
+		Metadata:   service.Metadata{"b": []interface{}{}, "a": map[string]interface{}{}},
+	}
+
+	err := service.ValidateTodo(todo)
+	var got []string
+	for _, fieldErr := range fieldErrors(err) {
+		got = append(got, fieldErr.Field+" "+fieldErr.Rule)
+	}
+	want := []string{
+		"title required",
+		"priority one_of",
+		"tags[1] required",
+		"recurrence.frequency one_of",
+		"recurrence.interval range",
+		"metadata.a type",
+		"metadata.b type",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field errors = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(err.Error(), "title is required; priority must be one of") {
+		t.Errorf("message = %q, want the messages joined", err.Error())
+	}
+
+	if err := service.ValidateTodo(service.Todo{Title: "Buy milk", Priority: service.PRIORITY_LOW}); err != nil {
+		t.Errorf("valid to-do list failed with %v", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want service.FieldError
+	}{
+		{name: "truncated", body: `{"title":`, want: service.FieldError{Rule: RULE_JSON, Message: "body must be a JSON object"}},
+		{name: "syntax", body: `{title}`, want: service.FieldError{Rule: RULE_JSON, Message: "body must be a JSON object"}},
+		{name: "string", body: `{"title":1}`, want: service.FieldError{Field: "title", Rule: service.RULE_TYPE, Message: "title must be a string"}},
+		{name: "array", body: `{"tags":"home"}`, want: service.FieldError{Field: "tags", Rule: service.RULE_TYPE, Message: "tags must be an array"}},
+		{name: "boolean", body: `{"is_done":"yes"}`, want: service.FieldError{Field: "is_done", Rule: service.RULE_TYPE, Message: "is_done must be a boolean"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var todo service.Todo
+			err := json.Unmarshal([]byte(tt.body), &todo)
+			if err == nil {
+				t.Fatal("decoding succeeded")
+			}
+			if got := decodeError(err); !reflect.DeepEqual(got, service.FieldErrors{tt.want}) {
+				t.Errorf("decodeError = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   []service.FieldError
+	}{
+		{
+			name:   "every field",
+			method: http.MethodPost,
+			target: "/todo",
+			body:   `{"title":"","priority":"critical"}`,
+			want: []service.FieldError{
+				{Field: "title", Rule: service.RULE_REQUIRED, Message: "title is required"},
+				{Field: "priority", Rule: service.RULE_ONE_OF, Message: "priority must be one of low, medium, high or urgent"},
+			},
+		},
+		{
+			name:   "decode error on update",
+			method: http.MethodPut,
+			target: "/todo/1",
+			body:   `{"title":["Buy milk"]}`,
+			want:   []service.FieldError{{Field: "title", Rule: service.RULE_TYPE, Message: "title must be a string"}},
+		},
+		{
+			name:   "project",
+			method: http.MethodPost,
+			target: "/project",
+			body:   `{"name":" "}`,
+			want:   []service.FieldError{{Field: "name", Rule: service.RULE_REQUIRED, Message: "name is required"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, _ := newTestConfig(t)
+			_, response := serve(t, conf, tt.method, tt.target, tt.body)
+			checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+			if !reflect.DeepEqual(response.Errors, tt.want) {
+				t.Errorf("errors = %+v, want %+v", response.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownProjectFieldError(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM project")).WithArgs(7, testUserID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, response := serve(t, conf, http.MethodPost, "/todo", `{"title":"Buy milk","project_id":7}`)
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	if want := []service.FieldError{service.ErrUnknownProject}; !reflect.DeepEqual(response.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", response.Errors, want)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// API_V1_PREFIX mounts version 1 of the API, the unversioned paths of before are its deprecated aliases
+const API_V1_PREFIX = "/api/v1"
+
+// unversionedPath is the path without its version prefix, which the checks of the public paths compare
+func unversionedPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, API_V1_PREFIX); ok && (rest == "" || rest[0] == '/') {
+		return rest
+	}
+	return path
+}
+
+// versionPrefix is the version prefix of the path, empty for an unversioned one. URLs the client is sent to next, like
+// the OAuth callback, keep the version it called
+func versionPrefix(path string) string {
+	if unversionedPath(path) != path {
+		return API_V1_PREFIX
+	}
+	return ""
+}
+
+// deprecationMiddleware marks the responses of the unversioned paths as deprecated, with a link to their path under
+// /api/v1. The probes and the metrics aren't versioned, they aren't deprecated
+func deprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if versionPrefix(r.URL.Path) == "" && !isProbe(r.URL.Path) && r.URL.Path != "/metrics" {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+API_V1_PREFIX+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	tests := []struct {
+		target     string
+		deprecated bool
+		link       string
+	}{
+		{target: "/api/v1/openapi.json"},
+		{target: "/openapi.json", deprecated: true, link: `</api/v1/openapi.json>; rel="successor-version"`},
+		{target: "/healthz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			conf.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d", rec.Code)
+			}
+			if deprecated := rec.Header().Get("Deprecation") == "true"; deprecated != tt.deprecated {
+				t.Errorf("deprecated = %v, want %v", deprecated, tt.deprecated)
+			}
+			if link := rec.Header().Get("Link"); link != tt.link {
+				t.Errorf("Link = %q, want %q", link, tt.link)
+			}
+		})
+	}
+}
+
+func TestUnversionedPath(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/todo/1": "/todo/1",
+		"/api/v1":        "",
+		"/todo/1":        "/todo/1",
+		"/api/v10/todo":  "/api/v10/todo",
+	}
+	for path, want := range tests {
+		if got := unversionedPath(path); got != want {
+			t.Errorf("unversionedPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"to-do-list/service"
+)
+
+const DEFAULT_UPCOMING_DAYS = 7
+
+// parseView reads the view at now, with ?days= of VIEW_UPCOMING
+func (conf *Config) parseView(r *http.Request, name string, now time.Time) (service.View, error) {
+	view := service.View{Name: name, Days: DEFAULT_UPCOMING_DAYS, Now: now, Location: conf.Location}
+	if v := r.URL.Query().Get("days"); v != "" && name == service.VIEW_UPCOMING {
+		var err error
+		if view.Days, err = strconv.Atoi(v); err != nil || view.Days < 1 || view.Days > MAX_RANGE_DAYS {
+			return view, fmt.Errorf("invalid days %q", v)
+		}
+	}
+	return view, nil
+}
+
+// getView lists a page of the view, it takes the filters of GET /todo
+func (conf *Config) getView(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		todos := make([]service.Todo, 0)
+
+		filter, err := conf.parseListFilter(r)
+		if err != nil {
+			buildErrorResponse(w, todos, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+			return
+		}
+		view, err := conf.parseView(r, name, time.Now())
+		if err != nil {
+			buildErrorResponse(w, todos, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+			return
+		}
+		render, err := parseRender(r)
+		if err != nil {
+			buildErrorResponse(w, todos, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+			return
+		}
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			buildErrorResponse(w, todos, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+			return
+		}
+
+		todos, total, err := conf.queries().View(r.Context(), filter, view, limit, offset)
+		if err != nil {
+			buildResponse(w, make([]service.Todo, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+			return
+		}
+		if render {
+			for i := range todos {
+				renderDescription(&todos[i])
+			}
+		}
+
+		conf.buildPaginatedResponse(w, todos, newPagination(r, limit, offset, total), http.StatusOK, MESSAGE_SUCCESS)
+	}
+}
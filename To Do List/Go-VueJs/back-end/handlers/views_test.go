@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"to-do-list/service"
+)
+
+func TestViews(t *testing.T) {
+	conf, _ := newSQLiteConfig(t)
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	ids := make(map[string]int)
+	for _, body := range []string{
+		fmt.Sprintf(`{"title":"Overdue","due_date":%q}`, now.AddDate(0, 0, -2).Format(time.RFC3339)),
+		`{"title":"Urgent","priority":"urgent"}`,
+		fmt.Sprintf(`{"title":"Next week","due_date":%q}`, today.AddDate(0, 0, 5).Format(time.RFC3339)),
+		fmt.Sprintf(`{"title":"Next month","due_date":%q}`, today.AddDate(0, 0, 30).Format(time.RFC3339)),
+		`{"title":"Someday"}`,
+		`{"title":"Snoozed"}`,
+		`{"title":"Woken"}`,
+		fmt.Sprintf(`{"title":"Done","due_date":%q}`, now.AddDate(0, 0, -1).Format(time.RFC3339)),
+	} {
+		var todo service.Todo
+		_, response := serve(t, conf, http.MethodPost, "/todo", body)
+		checkResponse(t, response, http.StatusCreated, "")
+		decodeData(t, response, &todo)
+		ids[todo.Title] = todo.ID
+	}
+
+	_, response := serve(t, conf, http.MethodPost, fmt.Sprintf("/todo/%d/snooze", ids["Snoozed"]), `{"duration":"3d"}`)
+	checkResponse(t, response, http.StatusOK, "")
+	_, response = serve(t, conf, http.MethodPost, fmt.Sprintf("/todo/%d/snooze", ids["Woken"]), `{"duration":"1m"}`)
+	checkResponse(t, response, http.StatusOK, "")
+	_, response = serve(t, conf, http.MethodPatch, fmt.Sprintf("/todo/%d", ids["Done"]), `{"is_done":true}`)
+	checkResponse(t, response, http.StatusOK, "")
+
+	list := func(target string) string {
+		t.Helper()
+		_, response := serve(t, conf, http.MethodGet, target, "")
+		checkResponse(t, response, http.StatusOK, "")
+		var todos []service.Todo
+		decodeData(t, response, &todos)
+		titles := make([]string, len(todos))
+		for i, todo := range todos {
+			titles[i] = todo.Title
+		}
+		return fmt.Sprint(titles)
+	}
+	checkView := func(target, want string) {
+		t.Helper()
+		if got := list(target); got != want {
+			t.Errorf("%s = %s, want %s", target, got, want)
+		}
+	}
+
+	checkView("/todo/views/today", "[Urgent Overdue]")
+	checkView("/todo/views/upcoming", "[Snoozed Next week]")
+	checkView("/todo/views/upcoming?days=60", "[Snoozed Next week Next month]")
+	checkView("/todo/views/someday", "[Someday]")
+
+	// The snooze ends, nothing but the time changes for the to-do list to come back
+	if _, err := conf.Database.Exec("UPDATE todo SET snoozed_until = $1 WHERE id = $2", now.Add(-time.Second), ids["Woken"]); err != nil {
+		t.Fatal(err)
+	}
+	checkView("/todo/views/today", "[Urgent Overdue Woken]")
+	checkView("/todo/views/today?priority=medium", "[Overdue Woken]")
+	checkView("/todo/views/someday", "[Someday]")
+
+	_, response = serve(t, conf, http.MethodGet, "/todo/views/upcoming?days=0", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+	_, response = serve(t, conf, http.MethodGet, "/todo/views/today?q=milk", "")
+	checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+}
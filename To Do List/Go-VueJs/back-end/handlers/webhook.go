@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"to-do-list/service"
+)
+
+const (
+	WEBHOOK_TIMEOUT       = 10 * time.Second
+	WEBHOOK_POLL_INTERVAL = time.Second
+	WEBHOOK_BATCH_SIZE    = 10
+	WEBHOOK_BASE_BACKOFF  = 10 * time.Second
+	WEBHOOK_MAX_BACKOFF   = time.Hour
+
+	// How long a claimed delivery is hidden from other workers while it's being posted. The batch is posted one delivery
+	// after the other, so the lease outlasts every one of them timing out with a minute to record the attempts
+	WEBHOOK_LEASE = WEBHOOK_BATCH_SIZE*WEBHOOK_TIMEOUT + time.Minute
+
+	DEFAULT_WEBHOOK_MAX_ATTEMPTS = 5
+)
+
+// Status of a queued delivery, dead ones gave up after the maximum attempts
+const (
+	DELIVERY_DELIVERED = "delivered"
+	DELIVERY_DEAD      = "dead"
+)
+
+func isValidEvent(event string) bool {
+	switch event {
+	case service.EVENT_CREATED, service.EVENT_UPDATED, service.EVENT_COMPLETED, service.EVENT_DELETED, service.EVENT_RESTORED:
+		return true
+	}
+	return false
+}
+
+// validateWebhook checks the URL and the events, no events meaning every event
+func validateWebhook(webhook *service.Webhook) error {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+
+	if len(webhook.Events) == 0 {
+		webhook.Events = []string{service.EVENT_CREATED, service.EVENT_UPDATED, service.EVENT_COMPLETED, service.EVENT_DELETED, service.EVENT_RESTORED}
+	}
+	for _, event := range webhook.Events {
+		if !isValidEvent(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// webhooks is the WebhookRepository of the handlers and workers
+func (conf *Config) webhooks() *service.WebhookRepository {
+	return &service.WebhookRepository{DB: conf.Database}
+}
+
+// getWebhooks lists the webhooks of the user, without their secret
+func (conf *Config) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := conf.webhooks().List(r.Context(), currentUser(r))
+	if err != nil {
+		buildResponse(w, make([]service.Webhook, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, webhooks, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) addWebhook(w http.ResponseWriter, r *http.Request) {
+	var newWebhook service.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&newWebhook); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateWebhook(&newWebhook); err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+
+	// The secret is only shown once, receivers use it to verify the signature
+	if newWebhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+			return
+		}
+		newWebhook.Secret = hex.EncodeToString(secret)
+	}
+
+	if err := conf.webhooks().Create(r.Context(), currentUser(r), &newWebhook); err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, newWebhook, http.StatusCreated, MESSAGE_SUCCESS)
+}
+
+// updateWebhook replaces the URL and the events, the secret stays the same
+func (conf *Config) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	var updatedWebhook service.Webhook
+	webhookID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&updatedWebhook); err != nil {
+		buildValidationResponse(w, nil, decodeError(err))
+		return
+	}
+	if err := validateWebhook(&updatedWebhook); err != nil {
+		buildErrorResponse(w, nil, http.StatusBadRequest, CODE_VALIDATION_ERROR, err.Error())
+		return
+	}
+	updatedWebhook.Secret = ""
+
+	if err := conf.webhooks().Update(r.Context(), currentUser(r), webhookID, &updatedWebhook); err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, updatedWebhook, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// deleteWebhook removes the webhook with its queued deliveries
+func (conf *Config) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(r, "id")
+	if !ok {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	}
+	deletedWebhook, err := conf.webhooks().Delete(r.Context(), currentUser(r), webhookID)
+	if err == service.ErrNotFound {
+		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+		return
+	} else if err != nil {
+		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, deletedWebhook, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+func (conf *Config) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		buildResponse(w, make([]service.WebhookDelivery, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != service.DELIVERY_PENDING && status != DELIVERY_DELIVERED && status != DELIVERY_DEAD {
+		buildResponse(w, make([]service.WebhookDelivery, 0), http.StatusBadRequest, MESSAGE_FAILED)
+		return
+	}
+
+	deliveries, err := conf.webhooks().Deliveries(r.Context(), currentUser(r), status, limit, offset)
+	if err != nil {
+		buildResponse(w, make([]service.WebhookDelivery, 0), http.StatusInternalServerError, MESSAGE_FAILED)
+		return
+	}
+
+	buildResponse(w, deliveries, http.StatusOK, MESSAGE_SUCCESS)
+}
+
+// QueueWebhooks follows the change events and queues a delivery for every subscribed webhook of the owner, until ctx is done
+func (conf *Config) QueueWebhooks(ctx context.Context) {
+	cursor := conf.Changes.Cursor()
+
+	for ctx.Err() == nil {
+		changes := conf.Changes.Wait(ctx, cursor, 0)
+		cursor = changes.Cursor
+
+		for _, event := range changes.Events {
+			payload, err := marshalResponse(event, conf.NullTimestamps)
+			if err != nil {
+				slog.Error("Encoding webhook payload failed", "error", err)
+				continue
+			}
+			if err := conf.webhooks().Queue(ctx, event.UserID, event.Type, payload); err != nil {
+				slog.Error("Queueing webhooks failed", "error", err)
+			}
+		}
+	}
+	slog.Info("Webhook queue stopped")
+}
+
+// DeliverWebhooks drains the queue, retrying failed deliveries with exponential backoff, until ctx is done
+func (conf *Config) DeliverWebhooks(ctx context.Context) {
+	client := newWebhookClient(isPublicAddress)
+	ticker := time.NewTicker(WEBHOOK_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Webhook worker stopped")
+			return
+		case <-ticker.C:
+		}
+
+		deliveries, webhooks, err := conf.claimDeliveries(ctx)
+		if err != nil {
+			slog.Error("Claiming webhook deliveries failed", "error", err)
+			continue
+		}
+		for i := range deliveries {
+			conf.deliverWebhook(ctx, client, webhooks[i], deliveries[i])
+		}
+	}
+}
+
+// carrierGradeNAT is shared address space, where some clouds serve their metadata
+var carrierGradeNAT = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddress tells whether a webhook may be delivered to ip, not to the loopback, private, link-local (and the
+// cloud metadata there) or shared addresses around the server
+func isPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !carrierGradeNAT.Contains(ip)
+}
+
+// newWebhookClient posts only to the addresses allowed, checked once the name is resolved so a DNS answer can't send
+// a delivery elsewhere. Redirects aren't followed, a 3xx is a failed delivery
+func newWebhookClient(allowed func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: WEBHOOK_TIMEOUT,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allowed(addrPort.Addr()) {
+				return fmt.Errorf("webhook address %s is not allowed", address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be the one dialing the receiver
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   WEBHOOK_TIMEOUT,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// claimDeliveries leases a batch of the due deliveries for WEBHOOK_LEASE, so other workers skip them while they're posted
+func (conf *Config) claimDeliveries(ctx context.Context) ([]service.WebhookDelivery, []service.Webhook, error) {
+	return conf.webhooks().Claim(ctx, time.Now().Add(WEBHOOK_LEASE), WEBHOOK_BATCH_SIZE)
+}
+
+// deliverWebhook makes one attempt, then records it and schedules the retry or the final status
+func (conf *Config) deliverWebhook(ctx context.Context, client *http.Client, webhook service.Webhook, delivery service.WebhookDelivery) {
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(delivery.Payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	statusCode, err := postWebhook(ctx, client, webhook.URL, delivery.Event, signature, delivery.Payload)
+	delivery.Attempts++
+
+	delivery.Status, delivery.NextAttemptAt, delivery.LastStatusCode, delivery.LastError = DELIVERY_DELIVERED, time.Now(), statusCode, nil
+	if err != nil {
+		message := err.Error()
+		delivery.LastError = &message
+		delivery.Status, delivery.NextAttemptAt = service.DELIVERY_PENDING, time.Now().Add(webhookBackoff(delivery.Attempts))
+		if delivery.Attempts >= conf.WebhookMaxAttempts {
+			delivery.Status = DELIVERY_DEAD
+			slog.Warn("Webhook gave up on delivery", "webhook_id", webhook.ID, "delivery_id", delivery.ID, "attempts", delivery.Attempts)
+		}
+	}
+
+	if err := conf.webhooks().RecordAttempt(ctx, delivery); err != nil {
+		slog.Error("Recording webhook delivery failed", "webhook_id", webhook.ID, "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// webhookBackoff doubles the wait after every failed attempt, up to WEBHOOK_MAX_BACKOFF
+func webhookBackoff(attempts int) time.Duration {
+	backoff := WEBHOOK_BASE_BACKOFF
+	for i := 1; i < attempts && backoff < WEBHOOK_MAX_BACKOFF; i++ {
+		backoff *= 2
+	}
+	if backoff > WEBHOOK_MAX_BACKOFF {
+		backoff = WEBHOOK_MAX_BACKOFF
+	}
+	return backoff
+}
+
+// postWebhook returns the status code (nil when no response) and an error for anything but 2xx
+func postWebhook(ctx context.Context, client *http.Client, target, event, signature string, payload []byte) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Signature", signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return &resp.StatusCode, nil
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"to-do-list/service"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	conf, mock := newTestConfig(t)
+	conf.WebhookMaxAttempts = DEFAULT_WEBHOOK_MAX_ATTEMPTS
+	webhook := service.Webhook{ID: 3, URL: receiver.URL, Secret: "secret"}
+	delivery := service.WebhookDelivery{ID: 8, WebhookID: 3, Event: service.EVENT_CREATED, Payload: []byte(`{}`), Attempts: 1}
+
+	// The failed attempt is scheduled for a retry and recorded in one transaction
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_queue SET status = $2, attempts = $3")).
+		WithArgs(8, service.DELIVERY_PENDING, 2, sqlmock.AnyArg(), http.StatusInternalServerError, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_delivery")).
+		WithArgs(3, 8, service.EVENT_CREATED, 2, http.StatusInternalServerError, sqlmock.AnyArg()).
+		WillReturnError(errDatabase)
+	mock.ExpectRollback()
+
+	conf.deliverWebhook(context.Background(), receiver.Client(), webhook, delivery)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// leaseArg matches a lease outlasting a batch of deliveries which all time out
+type leaseArg struct{}
+
+func (leaseArg) Match(v driver.Value) bool {
+	until, ok := v.(time.Time)
+	return ok && time.Until(until) > WEBHOOK_BATCH_SIZE*WEBHOOK_TIMEOUT
+}
+
+func TestClaimDeliveriesLease(t *testing.T) {
+	conf, mock := newTestConfig(t)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhook_queue q SET next_attempt_at = $1")).
+		WithArgs(leaseArg{}, service.DELIVERY_PENDING, WEBHOOK_BATCH_SIZE).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event", "payload", "attempts", "id", "url", "secret"}).AddRow(8, service.EVENT_CREATED, []byte(`{}`), 0, 3, "https://example.com/hook", "secret"))
+
+	deliveries, webhooks, err := conf.claimDeliveries(context.Background())
+	if err != nil || len(deliveries) != 1 || webhooks[0].ID != 3 {
+		t.Fatalf("claimed %+v of %+v: %v", deliveries, webhooks, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{ip: "93.184.216.34", public: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", public: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "fd00:ec2::254"},
+		{ip: "169.254.169.254"},
+		{ip: "fe80::1"},
+		{ip: "100.100.100.200"},
+		{ip: "0.0.0.0"},
+		{ip: "::"},
+		{ip: "224.0.0.1"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "::ffff:10.0.0.1"},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddress(netip.MustParseAddr(tt.ip)); got != tt.public {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	var received int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/hook", http.StatusFound)
+			return
+		}
+		received++
+	}))
+	defer receiver.Close()
+
+	// The receiver runs on the loopback, like the services next to the server
+	_, err := postWebhook(context.Background(), newWebhookClient(isPublicAddress), receiver.URL+"/hook", service.EVENT_CREATED, "sha256=", []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") || received != 0 {
+		t.Errorf("posted to the loopback: %v, received %d", err, received)
+	}
+	// Nor by a name resolving to it
+	_, err = postWebhook(context.Background(), newWebhookClient(isPublicAddress), strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)+"/hook", service.EVENT_CREATED, "sha256=", []byte(`{}`))
+	if err == nil || received != 0 {
+		t.Errorf("posted to localhost: %v, received %d", err, received)
+	}
+
+	loopback := func(ip netip.Addr) bool { return ip.IsLoopback() }
+	status, err := postWebhook(context.Background(), newWebhookClient(loopback), receiver.URL+"/moved", service.EVENT_CREATED, "sha256=", []byte(`{}`))
+	if err == nil || status == nil || *status != http.StatusFound || received != 0 {
+		t.Errorf("redirect: %v, %v, received %d", status, err, received)
+	}
+	if _, err := postWebhook(context.Background(), newWebhookClient(loopback), receiver.URL+"/hook", service.EVENT_CREATED, "sha256=", []byte(`{}`)); err != nil || received != 1 {
+		t.Errorf("allowed address: %v, received %d", err, received)
+	}
+}
+
+func TestWebhookOfMalformedBody(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{method: http.MethodPost, target: "/webhooks"},
+		{method: http.MethodPut, target: "/webhooks/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, tt.method, tt.target, `{"url":`)
+			checkResponse(t, response, http.StatusBadRequest, CODE_VALIDATION_ERROR)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWebhookOfInvalidID(t *testing.T) {
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			conf, mock := newTestConfig(t)
+
+			_, response := serve(t, conf, method, "/webhooks/abc", `{"url":"https://example.com/hook"}`)
+			checkResponse(t, response, http.StatusNotFound, CODE_NOT_FOUND)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
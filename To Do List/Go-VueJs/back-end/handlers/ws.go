@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// A ping goes out after this long without events, so proxies keep the connection open
+	WS_PING_INTERVAL = 30 * time.Second
+	WS_WRITE_TIMEOUT = 10 * time.Second
+)
+
+// streamChanges upgrades to a WebSocket and sends every change event of the user as a JSON message
+// Browsers can't set headers on a WebSocket, so the login token may also come as ?access_token=
+func (conf *Config) streamChanges(w http.ResponseWriter, r *http.Request) {
+	release, ok := conf.Changes.Subscribe()
+	if !ok {
+		buildResponse(w, nil, http.StatusServiceUnavailable, MESSAGE_FAILED)
+		return
+	}
+	defer release()
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || conf.CORS.allowsOrigin(origin)
+		},
+	}
+	// Upgrade answers the failed handshakes itself
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Messages from the client are discarded, reading notices when it goes away
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	userID := currentUser(r)
+	cursor := conf.Changes.Cursor()
+	for ctx.Err() == nil {
+		wait, stop := context.WithTimeout(ctx, WS_PING_INTERVAL)
+		changes := conf.Changes.Wait(wait, cursor, userID)
+		stop()
+		cursor = changes.Cursor
+
+		conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+		if len(changes.Events) == 0 && ctx.Err() == nil {
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		}
+		for _, event := range changes.Events {
+			var data []byte
+			if data, err = marshalResponse(event, conf.NullTimestamps); err != nil {
+				break
+			}
+			if err = conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			slog.InfoContext(ctx, "WebSocket closed", "error", err)
+			return
+		}
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(WS_WRITE_TIMEOUT))
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"to-do-list/service"
+)
+
+func TestStreamChanges(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	conf.CORS = NewCORSPolicy("*", DEFAULT_CORS_METHODS, DEFAULT_CORS_HEADERS, "", 0, false)
+	token, err := conf.issueToken(testUserID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(loggingMiddleware(conf.requireUser(conf.Router)))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	if _, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		t.Fatal("connected without a token")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?access_token="+token.Token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Wait for the handler to take its cursor before publishing
+	time.Sleep(50 * time.Millisecond)
+	conf.Changes.Publish(service.EVENT_CREATED, testUserID+1, 7, &service.Todo{ID: 7})
+	conf.Changes.Publish(service.EVENT_CREATED, testUserID, 8, &service.Todo{ID: 8})
+
+	var event service.ChangeEvent
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != service.EVENT_CREATED || event.TodoID != 8 {
+		t.Errorf("event = %+v, want the created todo 8 of the user", event)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"to-do-list/handlers"
+)
+
+// setupLogger makes slog, and the log package through it, write JSON lines to stdout. LOG_FORMAT=text writes
+// key=value lines for reading in a terminal, levelName is one of debug, info, warn and error
+func setupLogger(levelName string) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelName)); err != nil {
+		fatal("Invalid log level", "error", err)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, options)
+	if getEnv("LOG_FORMAT", "json") == "text" {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	}
+	slog.SetDefault(slog.New(handlers.ContextHandler{Handler: handler}))
+}
+
+// fatal logs the error and exits, slog has no log.Fatal of its own
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
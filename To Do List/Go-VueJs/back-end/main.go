@@ -1,241 +1,471 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"database/sql/driver"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
+	"net/url"
 	"os"
-	"path/filepath"
-	"runtime"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-)
-
-type Config struct {
-	Router   *mux.Router
-	Database *sql.DB
-}
+	"github.com/lib/pq"
 
-type Todo struct {
-	ID          int    `json:"id,omitempty"`
-	Title       string `json:"title,omitempty"`
-	Description string `json:"description,omitempty"`
-	IsDone      bool   `json:"is_done"`
-}
+	"to-do-list/handlers"
+	"to-do-list/service"
+)
 
-type Response struct {
-	Data    interface{} `json:"data"`
-	Status  int         `json:"status"`
-	Message string      `json:"message"`
-}
+const (
+	DEFAULT_SHUTDOWN_TIMEOUT = 10 * time.Second
+)
 
+// Connection pool defaults, kept below the default max_connections of Postgres
 const (
-	MESSAGE_SUCCESS = "Success"
-	MESSAGE_FAILED  = "Failed"
+	DEFAULT_MAX_OPEN_CONNS     = 25
+	DEFAULT_MAX_IDLE_CONNS     = 25
+	DEFAULT_CONN_MAX_LIFETIME  = 30 * time.Minute
+	DEFAULT_CONN_MAX_IDLE_TIME = 5 * time.Minute
+	DB_PING_TIMEOUT            = 5 * time.Second
+	// The database may still be starting, e.g. in docker-compose, so the first ping is retried with a backoff
+	// doubling from DB_CONNECT_BACKOFF up to MAX_DB_CONNECT_BACKOFF
+	DEFAULT_DB_CONNECT_ATTEMPTS = 10
+	DEFAULT_DB_CONNECT_BACKOFF  = time.Second
+	MAX_DB_CONNECT_BACKOFF      = 30 * time.Second
+	// Postgres cancels a statement running longer, so a slow query fails the request instead of hanging it
+	DEFAULT_STATEMENT_TIMEOUT = 30 * time.Second
 )
 
-func buildResponse(w http.ResponseWriter, data interface{}, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	result := Response{
-		Data:    data,
-		Status:  status,
-		Message: message,
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
 	}
-	json.NewEncoder(w).Encode(result)
+	return fallback
 }
 
-func setupDatabase() *sql.DB {
-	// Get data from .env
-	err := godotenv.Load()
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, strconv.FormatBool(fallback)))
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		fatal("Invalid environment variable", "key", key, "error", err)
 	}
+	return value
+}
 
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-
-	// Connection to database postgresql local
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName,
-	)
-
-	db, err := sql.Open("postgres", connStr)
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(fallback)))
 	if err != nil {
-		log.Fatal(err)
+		fatal("Invalid environment variable", "key", key, "error", err)
 	}
-
-	migrations(connStr, db)
-	return db
+	return value
 }
 
-func migrations(connStr string, db *sql.DB) {
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		log.Fatal("Failed to get current directory")
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, fallback.String()))
+	if err != nil {
+		fatal("Invalid environment variable", "key", key, "error", err)
 	}
+	return value
+}
 
-	dir := filepath.Dir(filename)
-	sourceURL := "file://" + filepath.Join(dir, "schema")
-	fmt.Println("source URL: ", sourceURL)
-
-	// Migrasi database
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+// getEnvOrFile prefers the content of the file named by KEY_FILE (Docker/Kubernetes secrets) over KEY
+func getEnvOrFile(key string) string {
+	value, err := readEnvOrFile(key)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Error reading the file of an environment variable", "key", key+"_FILE", "error", err)
 	}
+	return value
+}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		sourceURL,
-		"postgres",
-		driver,
-	)
+// readEnvOrFile is getEnvOrFile returning the error of a KEY_FILE which can't be read, without the trailing newline
+// editors and echo leave in the file
+func readEnvOrFile(key string) (string, error) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return os.Getenv(key), nil
+}
 
-	if err != nil {
-		log.Fatal(err)
+// setupGRPCAddr returns the address of the gRPC server, empty when GRPC_PORT is not set
+func setupGRPCAddr() string {
+	port := getEnvInt("GRPC_PORT", 0)
+	if port == 0 {
+		return ""
 	}
+	if port < 1 || port > 65535 {
+		fatal("Invalid GRPC_PORT, it is not between 1 and 65535", "port", port)
+	}
+	return ":" + strconv.Itoa(port)
+}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		log.Fatal(err)
+func setupLocation() *time.Location {
+	loc, err := time.LoadLocation(getEnv("APP_TIMEZONE", "UTC"))
+	if err != nil {
+		fatal("Invalid APP_TIMEZONE", "error", err)
 	}
-	log.Println("Migrations applied successfully...")
+	return loc
 }
 
-func (r *Config) Handler() {
-	// Get all to-do list
-	r.Router.HandleFunc(`/todo`, r.getTodos).Methods("GET")
+// setupPaginationStyle reads the shape of the paginated lists, body by default
+func setupPaginationStyle() string {
+	style := getEnv("PAGINATION_STYLE", handlers.PAGINATION_STYLE_BODY)
+	switch style {
+	case handlers.PAGINATION_STYLE_BODY, handlers.PAGINATION_STYLE_LINK, handlers.PAGINATION_STYLE_ENVELOPE:
+		return style
+	}
+	fatal("Invalid PAGINATION_STYLE, want body, link or envelope", "style", style)
+	return ""
+}
 
-	// Get detail to-do list
-	r.Router.HandleFunc(`/todo/{id}`, r.getTodo).Methods("GET")
+// setupDatabase connects to the database of databaseURL, or of DB_HOST and friends when it is empty
+func setupDatabase(databaseURL string) *sql.DB {
+	var err error
+	dbHost := getEnvOrFile("DB_HOST")
+	connStr := fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s",
+		dbHost, getEnvOrFile("DB_PORT"), getEnvOrFile("DB_USER"), getEnvOrFile("DB_PASSWORD"), getEnvOrFile("DB_NAME"),
+	)
+	sslMode := getEnv("DB_SSLMODE", "disable")
+	if databaseURL != "" {
+		if connStr, err = pq.ParseURL(databaseURL); err != nil {
+			fatal("Invalid database URL", "error", err)
+		}
+		// The URL was validated with the settings
+		u, _ := url.Parse(databaseURL)
+		dbHost = u.Hostname()
+		sslMode = getEnv("DB_SSLMODE", u.Query().Get("sslmode"))
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+	}
 
-	// Add to-do list
-	r.Router.HandleFunc(`/todo`, r.addTodo).Methods("POST")
+	// TLS is negotiated by our own dialer to control its config, so pq itself always runs with sslmode=disable. Later
+	// keys win, zero DB_STATEMENT_TIMEOUT lets statements run as long as they take
+	connStr += fmt.Sprintf(" sslmode=disable statement_timeout=%d", getEnvDuration("DB_STATEMENT_TIMEOUT", DEFAULT_STATEMENT_TIMEOUT).Milliseconds())
+	var connector driver.Connector
+	if sslMode == "disable" {
+		connector, err = pq.NewConnector(connStr)
+		if err != nil {
+			fatal("Invalid database settings", "error", err)
+		}
+	} else {
+		tlsConfig, err := buildTLSConfig(sslMode, getEnv("DB_SSLROOTCERT", ""), getEnv("DB_SSLCERT", ""), getEnv("DB_SSLKEY", ""), getEnv("DB_TLS_MIN_VERSION", ""), dbHost)
+		if err != nil {
+			fatal("Invalid database TLS settings", "error", err)
+		}
+		connector = tlsConnector{dsn: connStr, dialer: tlsDialer{config: tlsConfig}}
+	}
+	// Every statement is timed for the db_query_duration_seconds metric and gets a span in the trace of its request
+	db := sql.OpenDB(instrumentedConnector{connector})
+	registerDBMetrics(db)
 
-	// Update to-do list
-	r.Router.HandleFunc(`/todo/{id}`, r.updateTodo).Methods("PUT")
+	configurePool(db)
 
-	// Remove to-do list
-	r.Router.HandleFunc(`/todo/{id}`, r.deleteTodo).Methods("DELETE")
+	// Fail on startup instead of the first query when the database is unreachable or the credentials are wrong
+	if err := pingDatabase(db, getEnvInt("DB_CONNECT_ATTEMPTS", DEFAULT_DB_CONNECT_ATTEMPTS), getEnvDuration("DB_CONNECT_BACKOFF", DEFAULT_DB_CONNECT_BACKOFF)); err != nil {
+		fatal("Error connecting to database", "error", err)
+	}
 
-	fmt.Println("Server listening on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", r.Router))
+	return db
 }
 
-func (conf *Config) getTodos(w http.ResponseWriter, r *http.Request) {
-	var todos []Todo
-	rows, err := conf.Database.Query("SELECT id, title, is_done FROM todo")
-	if err != nil {
-		buildResponse(w, todos, http.StatusInternalServerError, MESSAGE_FAILED)
-		return
+// pingDatabase pings db up to attempts times, waiting backoff after the first failure and twice as long after each
+// further one, up to MAX_DB_CONNECT_BACKOFF. It returns the error of the last attempt
+func pingDatabase(db *sql.DB, attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		return fmt.Errorf("DB_CONNECT_ATTEMPTS must be at least 1, not %d", attempts)
 	}
-	defer rows.Close()
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), DB_PING_TIMEOUT)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil || attempt == attempts {
+			return err
+		}
 
-	for rows.Next() {
-		var todo Todo
-		err := rows.Scan(&todo.ID, &todo.Title, &todo.IsDone)
-		if err != nil {
-			buildResponse(w, todos, http.StatusInternalServerError, MESSAGE_FAILED)
-			return
+		slog.Warn("Database not reachable yet, retrying", "attempt", attempt, "attempts", attempts, "retry_in", backoff, "error", err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > MAX_DB_CONNECT_BACKOFF {
+			backoff = MAX_DB_CONNECT_BACKOFF
 		}
-		todos = append(todos, todo)
 	}
+}
 
-	buildResponse(w, todos, http.StatusOK, MESSAGE_SUCCESS)
+// openDatabase connects to the database of the settings
+func openDatabase(settings Settings) *sql.DB {
+	switch settings.DBDriver {
+	case service.DB_DRIVER_SQLITE:
+		return setupSQLite(settings.DatabaseURL)
+	case service.DB_DRIVER_MYSQL:
+		return setupMySQL(settings.DatabaseURL)
+	}
+	return setupDatabase(settings.DatabaseURL)
 }
 
-func (conf *Config) getTodo(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	todoID := vars["id"]
+// openMigrate reads the migrations of the settings for db
+func openMigrate(db *sql.DB, settings Settings) (*migrate.Migrate, source.Driver) {
+	m, migrationSource, err := service.NewMigrate(db, settings.DBDriver, settings.DatabaseURL, settings.MigrationsDir)
+	if err != nil {
+		fatal("Error reading migrations", "error", err)
+	}
+	return m, migrationSource
+}
 
-	var todo Todo
-	if err := conf.Database.QueryRow("SELECT title, description, is_done FROM todo WHERE id=$1", todoID).Scan(&todo.Title, &todo.Description, &todo.IsDone); err == sql.ErrNoRows {
-		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
-		return
+// migrations applies the pending migrations and returns the version of the database
+func migrations(db *sql.DB, settings Settings) uint {
+	version, err := service.ApplyMigrations(db, settings.DBDriver, settings.DatabaseURL, settings.MigrationsDir, getEnvBool("DB_MIGRATE_FORCE", false))
+	var dirty service.DirtyError
+	if errors.As(err, &dirty) {
+		fatal("Migration failed halfway and left the database dirty, fix it by hand or set DB_MIGRATE_FORCE=true to retry it", "version", dirty.Version)
 	} else if err != nil {
-		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
-		return
+		fatal("Error applying migrations", "error", err)
 	}
-
-	buildResponse(w, todo, http.StatusOK, MESSAGE_SUCCESS)
+	slog.Info("Migrations applied successfully")
+	return version
 }
 
-func (conf *Config) addTodo(w http.ResponseWriter, r *http.Request) {
-	var newTodo Todo
-	json.NewDecoder(r.Body).Decode(&newTodo)
-
-	if _, err := conf.Database.Exec("INSERT INTO todo(title, description) VALUES($1,$2)", newTodo.Title, newTodo.Description); err != nil {
-		buildResponse(w, newTodo, http.StatusInternalServerError, MESSAGE_FAILED)
-		return
+// runMigrate runs the migrate command of the settings
+func runMigrate(db *sql.DB, settings Settings) {
+	switch settings.MigrateAction {
+	case MIGRATE_UP:
+		migrations(db, settings)
+	case MIGRATE_DOWN:
+		version, dirty, err := service.RollbackMigrations(db, settings.DBDriver, settings.DatabaseURL, settings.MigrationsDir, settings.MigrateArg)
+		if err != nil {
+			fatal("Error rolling back migrations", "error", err)
+		}
+		if version < 0 {
+			slog.Info("Migrations rolled back, no migration applied")
+			return
+		}
+		slog.Info("Migrations rolled back", "version", version, "dirty", dirty)
+	case MIGRATE_VERSION:
+		m, migrationSource := openMigrate(db, settings)
+		defer m.Close()
+		version, dirty, err := service.MigrationVersion(m)
+		if err != nil {
+			fatal("Error reading the migration version", "error", err)
+		}
+		latest, err := service.LatestVersion(migrationSource)
+		if err != nil {
+			fatal("Error reading migrations", "error", err)
+		}
+		status := ""
+		if dirty {
+			status = ", dirty"
+		}
+		fmt.Printf("version %d of %d%s\n", version, latest, status)
+	case MIGRATE_FORCE:
+		m, _ := openMigrate(db, settings)
+		defer m.Close()
+		if err := m.Force(settings.MigrateArg); err != nil {
+			fatal("Error forcing migration version", "version", settings.MigrateArg, "error", err)
+		}
+		slog.Info("Migration version forced", "version", settings.MigrateArg)
 	}
+}
 
-	buildResponse(w, newTodo, http.StatusCreated, MESSAGE_SUCCESS)
+// runAdmin runs an admin command on a database the server could run on, with the configuration it needs
+func runAdmin(settings Settings) {
+	config := &handlers.Config{
+		Database:    openDatabase(settings),
+		DBDriver:    settings.DBDriver,
+		Location:    setupLocation(),
+		Attachments: setupAttachments(),
+	}
+	defer config.Database.Close()
+	config.SchemaVersion = checkSchema(config.Database, settings)
+	if err := config.RunAdmin(context.Background(), settings.Command, settings.Admin, os.Stdin, os.Stdout); err != nil {
+		config.Database.Close()
+		fatal("Admin command failed", "command", settings.Command, "error", err)
+	}
 }
 
-func (conf *Config) updateTodo(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	todoID := vars["id"]
+// checkSchema returns the version of the database after checking the server can run on it. The migrations are only
+// applied with DB_AUTO_MIGRATE, otherwise a database behind the server fails the startup until "migrate up" ran
+func checkSchema(db *sql.DB, settings Settings) uint {
+	if getEnvBool("DB_AUTO_MIGRATE", false) {
+		return migrations(db, settings)
+	}
 
-	var (
-		updatedTodo, existingTodo Todo
-		err                       error
-	)
-	json.NewDecoder(r.Body).Decode(&updatedTodo)
+	m, migrationSource := openMigrate(db, settings)
+	defer m.Close()
+	version, dirty, err := service.MigrationVersion(m)
+	if err != nil {
+		fatal("Error reading the migration version", "error", err)
+	}
+	latest, err := service.LatestVersion(migrationSource)
+	if err != nil {
+		fatal("Error reading migrations", "error", err)
+	}
+	switch {
+	case dirty:
+		fatal("Migration failed halfway and left the database dirty, fix it by hand and run migrate force", "version", version)
+	case version < latest:
+		fatal("Database schema is behind the server, run migrate up or set DB_AUTO_MIGRATE=true", "version", version, "latest", latest)
+	case version > latest:
+		// An older server rolled out again, the newer migrations are expected to be compatible with it
+		slog.Warn("Database schema is newer than the server", "version", version, "latest", latest)
+	}
+	return version
+}
 
-	if err = conf.Database.QueryRow("SELECT id FROM todo WHERE id=$1", todoID).Scan(existingTodo.ID); err == sql.ErrNoRows {
-		fmt.Println(err)
-		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
+func main() {
+	settings, err := loadSettings(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	} else if err != nil {
-		fmt.Println(err)
-		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
-		return
+		fatal("Invalid configuration", "error", err)
 	}
-	fmt.Println("ERROR: ", err)
-	fmt.Println("TODO ID:", todoID)
+	setupLogger(settings.LogLevel)
 
-	if _, err = conf.Database.Exec("UPDATE todo SET title = $2, description = $3, is_done = $4 WHERE id = $1", todoID, updatedTodo.Title, updatedTodo.Description, updatedTodo.IsDone); err != nil {
-		buildResponse(w, updatedTodo, http.StatusInternalServerError, MESSAGE_FAILED)
+	if settings.Command == COMMAND_MIGRATE {
+		db := openDatabase(settings)
+		defer db.Close()
+		runMigrate(db, settings)
+		return
+	}
+	if settings.Command != COMMAND_SERVE {
+		runAdmin(settings)
 		return
 	}
 
-	buildResponse(w, updatedTodo, http.StatusOK, MESSAGE_SUCCESS)
-}
+	config := &handlers.Config{
+		Router:   mux.NewRouter(),
+		Database: openDatabase(settings),
+		DBDriver: settings.DBDriver,
+	}
+	config.SchemaVersion = checkSchema(config.Database, settings)
+	config.Addr = ":" + strconv.Itoa(settings.Port)
+	config.GRPCAddr = setupGRPCAddr()
+	config.Location = setupLocation()
+	config.NullTimestamps = getEnv("NULL_TIMESTAMPS", "omit") == "null"
+	config.PaginationStyle = setupPaginationStyle()
+	config.Changes = service.NewBroadcaster(getEnvInt("MAX_SUBSCRIBERS", service.DEFAULT_MAX_SUBSCRIBERS))
+	config.LockCompleted = getEnvBool("LOCK_COMPLETED", false)
+	config.StatusTransitions = setupStatusTransitions()
+	config.RequireIfMatch = getEnvBool("REQUIRE_IF_MATCH", false)
+	config.AdminKey = getEnvOrFile("ADMIN_API_KEY")
+	config.APIKey = getEnvOrFile("API_KEY")
+	if config.APIKey == "" {
+		slog.Warn("API_KEY is not set, the API is open to anyone who can reach it")
+	}
+	config.ArchiveAfter = getEnvDuration("ARCHIVE_DONE_AFTER", 0)
+	config.ArchiveInterval = getEnvDuration("ARCHIVE_INTERVAL", time.Hour)
+	config.TrashRetention = getEnvDuration("TRASH_RETENTION", DEFAULT_TRASH_RETENTION)
+	config.CORS = setupCORS()
+	config.Compress = getEnvBool("COMPRESS_RESPONSES", true)
+	config.OAuth = setupOAuth()
+	config.Frontend = setupFrontend()
+	config.TLS = setupServerTLS()
+	config.Notifier = logNotifier{}
+	if notifier := newSMTPNotifier(config.Location); notifier != nil {
+		config.Notifier = notifier
+	}
+	config.ReminderInterval = getEnvDuration("REMINDER_INTERVAL", time.Minute)
+	config.WebhookMaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", handlers.DEFAULT_WEBHOOK_MAX_ATTEMPTS)
+	config.JWTSecret = []byte(getEnvOrFile("JWT_SECRET"))
+	if len(config.JWTSecret) < MIN_JWT_SECRET_LENGTH {
+		fatal("JWT_SECRET is too short", "min_bytes", MIN_JWT_SECRET_LENGTH)
+	}
+	config.TokenTTL = getEnvDuration("TOKEN_TTL", DEFAULT_TOKEN_TTL)
+	config.RefreshTokenTTL = getEnvDuration("REFRESH_TOKEN_TTL", DEFAULT_REFRESH_TOKEN_TTL)
+	if limit := getEnvInt("RATE_LIMIT", 0); limit > 0 {
+		config.RateLimiter = setupRateLimiter(limit, getEnvInt("RATE_LIMIT_BURST", limit))
+	}
+	config.Attachments = setupAttachments()
+	config.MaxAttachmentSize = int64(getEnvInt("ATTACHMENT_MAX_SIZE", DEFAULT_MAX_ATTACHMENT_SIZE))
+	config.AttachmentTypes = setupAttachmentTypes()
+	config.Cache = setupCache()
+	config.CacheListTTL = getEnvDuration("CACHE_LIST_TTL", DEFAULT_CACHE_LIST_TTL)
+	config.CacheTodoTTL = getEnvDuration("CACHE_TODO_TTL", DEFAULT_CACHE_TODO_TTL)
+	config.ReadTimeout = getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second)
+	config.WriteTimeout = getEnvDuration("SERVER_WRITE_TIMEOUT", 90*time.Second)
+	config.ShutdownDelay = getEnvDuration("SHUTDOWN_DELAY", 0)
+	config.ShutdownTimeout = getEnvDuration("SHUTDOWN_TIMEOUT", DEFAULT_SHUTDOWN_TIMEOUT)
+	if config.ArchiveAfter > 0 && config.ArchiveInterval <= 0 {
+		fatal("ARCHIVE_INTERVAL must be positive")
+	}
+	// Long-polling requests must be able to wait out MAX_LONG_POLL_WAIT
+	if config.WriteTimeout > 0 && config.WriteTimeout <= handlers.MAX_LONG_POLL_WAIT {
+		fatal("SERVER_WRITE_TIMEOUT must be longer than the longest long poll", "min", handlers.MAX_LONG_POLL_WAIT)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing := setupTracing(ctx)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
 
-func (conf *Config) deleteTodo(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	todoID := vars["id"]
-	var deletedTodo Todo
+	// The database is closed only after the server, the gRPC server and the jobs have stopped
+	var workers sync.WaitGroup
+	defer config.Database.Close()
+	defer workers.Wait()
+	run := func(worker func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker()
+		}()
+	}
 
-	if err := conf.Database.QueryRow("SELECT title, description FROM todo WHERE id=$1", todoID).Scan(&deletedTodo.Title, &deletedTodo.Description); err == sql.ErrNoRows {
-		buildResponse(w, nil, http.StatusNotFound, MESSAGE_FAILED)
-		return
-	} else if err != nil {
-		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
-		return
+	run(func() { config.PruneIdempotencyKeys(ctx, time.Hour) })
+
+	if interval := getEnvDuration("POOL_MONITOR_INTERVAL", time.Minute); interval > 0 {
+		run(func() { config.MonitorPool(ctx, interval) })
 	}
 
-	if _, err := conf.Database.Exec("DELETE FROM todo WHERE id = $1", todoID); err != nil {
-		buildResponse(w, nil, http.StatusInternalServerError, MESSAGE_FAILED)
-		return
+	if config.RateLimiter != nil {
+		run(func() { config.RateLimiter.Cleanup(ctx, time.Minute) })
 	}
 
-	buildResponse(w, deletedTodo, http.StatusOK, MESSAGE_SUCCESS)
-}
+	if config.Cache != nil {
+		run(func() { config.Cache.FollowChanges(ctx, config.Changes) })
+	}
 
-func main() {
-	config := &Config{
-		Router:   mux.NewRouter(),
-		Database: setupDatabase(),
+	// The SQLite and MySQL schemas only have the tables of their routes, the jobs and the gRPC server need Postgres
+	if config.DBDriver == service.DB_DRIVER_POSTGRES {
+		if config.ArchiveAfter > 0 {
+			run(func() { config.ArchiveDoneTodos(ctx, config.ArchiveInterval, config.ArchiveAfter) })
+		}
+		if config.TrashRetention > 0 {
+			run(func() { config.PurgeTrash(ctx, time.Hour, config.TrashRetention) })
+		}
+		run(func() { config.QueueWebhooks(ctx) })
+		run(func() { config.DeliverWebhooks(ctx) })
+		run(func() { config.RecordEvents(ctx) })
+		if config.GRPCAddr != "" {
+			run(func() {
+				if err := config.ServeGRPC(ctx, config.GRPCAddr); err != nil {
+					fatal("gRPC server failed", "error", err)
+				}
+			})
+		}
+		run(func() { config.ScheduleRecurrences(ctx) })
+		if config.ReminderInterval > 0 {
+			run(func() { config.SendReminders(ctx, config.ReminderInterval) })
+		}
+	}
+
+	if err := config.Handler(ctx); err != nil {
+		fatal("Server failed", "error", err)
 	}
-	defer config.Database.Close()
-	config.Handler()
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var errDatabase = errors.New("database is down")
+
+// testUserID is the user every request of serve is logged in as
+const testUserID = 1
+
+func TestPingDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Still starting for the first two attempts
+	mock.ExpectPing().WillReturnError(errDatabase)
+	mock.ExpectPing().WillReturnError(errDatabase)
+	mock.ExpectPing()
+	if err := pingDatabase(db, 3, time.Millisecond); err != nil {
+		t.Errorf("pingDatabase = %v, want connected on the third attempt", err)
+	}
+
+	mock.ExpectPing().WillReturnError(errDatabase)
+	mock.ExpectPing().WillReturnError(errDatabase)
+	if err := pingDatabase(db, 2, time.Millisecond); err != errDatabase {
+		t.Errorf("pingDatabase = %v, want the error of the last attempt", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if err := pingDatabase(db, 0, time.Millisecond); err == nil {
+		t.Error("pingDatabase without attempts succeeded")
+	}
+}
+
+func TestReadEnvOrFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("s3cret\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "variable", value: "plain", want: "plain"},
+		{name: "file wins", value: "plain", file: secret, want: "s3cret"},
+		{name: "unset", want: ""},
+		{name: "unreadable file", value: "plain", file: filepath.Join(dir, "missing"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_PASSWORD", tt.value)
+			t.Setenv("DB_PASSWORD_FILE", tt.file)
+
+			got, err := readEnvOrFile("DB_PASSWORD")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("readEnvOrFile = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"to-do-list/handlers"
+)
+
+func sampleCount(t *testing.T, histogram prometheus.Observer) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := histogram.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// dsnConnector opens the connections of driver d, sql.OpenDB needs a connector to wrap
+type dsnConnector struct {
+	d   driver.Driver
+	dsn string
+}
+
+func (c dsnConnector) Connect(_ context.Context) (driver.Conn, error) { return c.d.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                          { return c.d }
+
+func TestInstrumentedConnector(t *testing.T) {
+	mockDB, mock, err := sqlmock.NewWithDSN("metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sql.OpenDB(instrumentedConnector{dsnConnector{mockDB.Driver(), "metrics"}})
+	defer db.Close()
+
+	selects, updates := sampleCount(t, handlers.DBQueryDuration.WithLabelValues("select")), sampleCount(t, handlers.DBQueryDuration.WithLabelValues("update"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 1")).WillReturnRows(sqlmock.NewRows([]string{"one"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE todo")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var one int
+	if err := db.QueryRow("SELECT 1").Scan(&one); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE todo SET is_done = true"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sampleCount(t, handlers.DBQueryDuration.WithLabelValues("select")) - selects; got != 1 {
+		t.Errorf("select durations grew by %d, want 1", got)
+	}
+	if got := sampleCount(t, handlers.DBQueryDuration.WithLabelValues("update")) - updates; got != 1 {
+		t.Errorf("update durations grew by %d, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryOperation(t *testing.T) {
+	for query, want := range map[string]string{
+		"SELECT id FROM todo":           "select",
+		"\n\t\tinsert INTO todo":        "insert",
+		"SELECT\n\tid FROM todo":        "select",
+		"WITH moved AS (UPDATE todo)":   "with",
+		"SET LOCAL statement_timeout=0": "other",
+	} {
+		if got := queryOperation(query); got != want {
+			t.Errorf("queryOperation(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
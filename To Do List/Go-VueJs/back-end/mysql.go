@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+
+	"to-do-list/service"
+)
+
+// setupMySQL connects to the MySQL or MariaDB database of databaseURL, with the pool settings of Postgres
+func setupMySQL(databaseURL string) *sql.DB {
+	config, err := service.MySQLConfig(databaseURL)
+	if err != nil {
+		fatal("Invalid database URL", "error", err)
+	}
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		fatal("Invalid database settings", "error", err)
+	}
+	db := sql.OpenDB(instrumentedConnector{rebindConnector{connector}})
+	registerDBMetrics(db)
+
+	configurePool(db)
+
+	if err := pingDatabase(db, getEnvInt("DB_CONNECT_ATTEMPTS", DEFAULT_DB_CONNECT_ATTEMPTS), getEnvDuration("DB_CONNECT_BACKOFF", DEFAULT_DB_CONNECT_BACKOFF)); err != nil {
+		fatal("Error connecting to database", "error", err)
+	}
+	return db
+}
+
+// rebind replaces the $1 placeholders of Postgres in query with the ? of MySQL. order is the argument of every ?, so
+// a placeholder used twice gets its argument twice. Quoted strings and identifiers are left alone
+func rebind(query string) (rebound string, order []int) {
+	var (
+		b     strings.Builder
+		quote byte
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			order = append(order, n-1)
+			b.WriteByte('?')
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), order
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// rebindArgs orders args for the placeholders of rebind, a query without $ placeholders keeps them
+func rebindArgs(args []driver.NamedValue, order []int) ([]driver.NamedValue, error) {
+	if len(order) == 0 {
+		return args, nil
+	}
+	rebound := make([]driver.NamedValue, len(order))
+	for i, n := range order {
+		if n < 0 || n >= len(args) {
+			return nil, fmt.Errorf("placeholder $%d has no argument", n+1)
+		}
+		rebound[i] = driver.NamedValue{Ordinal: i + 1, Value: args[n].Value}
+	}
+	return rebound, nil
+}
+
+// rebindConnector lets the queries shared with Postgres run on MySQL, rebinding their placeholders
+type rebindConnector struct {
+	driver.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{conn}, nil
+}
+
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query, order := rebind(query)
+	args, err := rebindArgs(args, order)
+	if err != nil {
+		return nil, err
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query, order := rebind(query)
+	args, err := rebindArgs(args, order)
+	if err != nil {
+		return nil, err
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+// Prepare is only reached when the driver can't interpolate the arguments. A prepared statement takes its arguments
+// as they are, so the placeholders must be in order
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	query, order := rebind(query)
+	for i, n := range order {
+		if n != i {
+			return nil, errors.New("statement repeats or reorders its placeholders, it can't be prepared on MySQL")
+		}
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query     string
+		want      string
+		wantOrder []int
+	}{
+		{query: "SELECT id FROM users WHERE username = $1", want: "SELECT id FROM users WHERE username = ?", wantOrder: []int{0}},
+		{query: "UPDATE todo SET a = $2, b = CASE WHEN $2 THEN $1 END WHERE id = $10", want: "UPDATE todo SET a = ?, b = CASE WHEN ? THEN ? END WHERE id = ?", wantOrder: []int{1, 1, 0, 9}},
+		{query: "SELECT '$1', `$2`, \"$3\" FROM todo WHERE id = $1", want: "SELECT '$1', `$2`, \"$3\" FROM todo WHERE id = ?", wantOrder: []int{0}},
+		{query: "SELECT id FROM todo WHERE id = ? AND price > $", want: "SELECT id FROM todo WHERE id = ? AND price > $"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, order := rebind(tt.query)
+			if got != tt.want || !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("rebind = %q %v, want %q %v", got, order, tt.want, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestRebindArgs(t *testing.T) {
+	args := []driver.NamedValue{{Ordinal: 1, Value: "a"}, {Ordinal: 2, Value: int64(2)}}
+
+	got, err := rebindArgs(args, []int{1, 0, 1})
+	want := []driver.NamedValue{{Ordinal: 1, Value: int64(2)}, {Ordinal: 2, Value: "a"}, {Ordinal: 3, Value: int64(2)}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("rebindArgs = %v, %v, want %v", got, err, want)
+	}
+	if got, _ := rebindArgs(args, nil); !reflect.DeepEqual(got, args) {
+		t.Errorf("arguments of ? placeholders = %v, want them kept", got)
+	}
+	if _, err := rebindArgs(args, []int{2}); err == nil {
+		t.Error("$3 without an argument rebound")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"to-do-list/handlers"
+)
+
+// setupOAuth reads the providers from OAUTH_GOOGLE_CLIENT_ID and OAUTH_GOOGLE_CLIENT_SECRET, and the GitHub ones, a
+// provider without both is disabled. OAUTH_BASE_URL and OAUTH_SUCCESS_URL are the URLs of OAuthConfig. nil when no
+// provider is configured
+func setupOAuth() *handlers.OAuthConfig {
+	config := &handlers.OAuthConfig{
+		Providers:  make(map[string]*handlers.OAuthProvider),
+		BaseURL:    strings.TrimRight(getEnv("OAUTH_BASE_URL", ""), "/"),
+		SuccessURL: getEnv("OAUTH_SUCCESS_URL", ""),
+	}
+	for name, provider := range map[string]*handlers.OAuthProvider{
+		handlers.OAUTH_GOOGLE: {
+			Config: oauth2.Config{
+				Endpoint: oauth2.Endpoint{AuthURL: "https://accounts.google.com/o/oauth2/auth", TokenURL: "https://oauth2.googleapis.com/token"},
+				Scopes:   []string{"openid", "email", "profile"},
+			},
+			UserURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+			Identify: handlers.IdentifyGoogle,
+		},
+		handlers.OAUTH_GITHUB: {
+			Config: oauth2.Config{
+				Endpoint: oauth2.Endpoint{AuthURL: "https://github.com/login/oauth/authorize", TokenURL: "https://github.com/login/oauth/access_token"},
+				Scopes:   []string{"read:user", "user:email"},
+			},
+			UserURL:  "https://api.github.com/user",
+			Identify: handlers.IdentifyGitHub,
+		},
+	} {
+		prefix := "OAUTH_" + strings.ToUpper(name)
+		provider.Config.ClientID = getEnv(prefix+"_CLIENT_ID", "")
+		provider.Config.ClientSecret = getEnvOrFile(prefix + "_CLIENT_SECRET")
+		if provider.Config.ClientID == "" && provider.Config.ClientSecret == "" {
+			continue
+		} else if provider.Config.ClientID == "" || provider.Config.ClientSecret == "" {
+			fatal("OAuth provider needs both a client id and a client secret", "provider", name)
+		}
+		config.Providers[name] = provider
+	}
+	if len(config.Providers) == 0 {
+		return nil
+	}
+	if config.SuccessURL != "" {
+		if u, err := url.Parse(config.SuccessURL); err != nil || !u.IsAbs() {
+			fatal("OAUTH_SUCCESS_URL must be an absolute URL", "url", config.SuccessURL)
+		}
+	}
+	return config
+}
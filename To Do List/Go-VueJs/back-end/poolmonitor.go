@@ -0,0 +1,20 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+)
+
+// configurePool sizes the connection pool of db from DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and
+// DB_CONN_MAX_IDLE_TIME. database/sql lowers the idle connections to the open ones, so a higher DB_MAX_IDLE_CONNS warns
+func configurePool(db *sql.DB) {
+	maxOpen := getEnvInt("DB_MAX_OPEN_CONNS", DEFAULT_MAX_OPEN_CONNS)
+	maxIdle := getEnvInt("DB_MAX_IDLE_CONNS", DEFAULT_MAX_IDLE_CONNS)
+	if maxOpen > 0 && maxIdle > maxOpen {
+		slog.Warn("DB_MAX_IDLE_CONNS is above DB_MAX_OPEN_CONNS, only DB_MAX_OPEN_CONNS are kept idle", "max_idle", maxIdle, "max_open", maxOpen)
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(getEnvDuration("DB_CONN_MAX_LIFETIME", DEFAULT_CONN_MAX_LIFETIME))
+	db.SetConnMaxIdleTime(getEnvDuration("DB_CONN_MAX_IDLE_TIME", DEFAULT_CONN_MAX_IDLE_TIME))
+}
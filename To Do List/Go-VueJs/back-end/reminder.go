@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"to-do-list/service"
+)
+
+// logNotifier only logs reminders, it is used when SMTP is not configured
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, reminder service.Reminder) error {
+	slog.InfoContext(ctx, "Reminder", "user_id", reminder.UserID, "todo_id", reminder.Todo.ID, "title", reminder.Todo.Title)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"to-do-list/handlers"
+)
+
+const (
+	DEFAULT_AUTOCERT_CACHE = "autocert-cache"
+)
+
+// setupServerTLS reads TLS_CERT_FILE and TLS_KEY_FILE, or TLS_AUTOCERT_DOMAINS with TLS_AUTOCERT_EMAIL and
+// TLS_AUTOCERT_CACHE, and HTTP_REDIRECT_PORT. It returns nil, serving plain HTTP, when neither is set
+func setupServerTLS() *handlers.ServerTLS {
+	certFile, keyFile := getEnvOrFile("TLS_CERT_FILE"), getEnvOrFile("TLS_KEY_FILE")
+	domains := handlers.SplitList(getEnv("TLS_AUTOCERT_DOMAINS", ""), strings.ToLower)
+	redirectPort := getEnvInt("HTTP_REDIRECT_PORT", 0)
+
+	switch {
+	case certFile == "" && keyFile == "" && len(domains) == 0:
+		if redirectPort != 0 {
+			fatal("HTTP_REDIRECT_PORT needs TLS_CERT_FILE and TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS")
+		}
+		return nil
+	case (certFile == "") != (keyFile == ""):
+		fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case certFile != "" && len(domains) > 0:
+		fatal("TLS_AUTOCERT_DOMAINS can't be combined with TLS_CERT_FILE")
+	}
+	if redirectPort < 0 || redirectPort > 65535 {
+		fatal("Invalid HTTP_REDIRECT_PORT, it is not between 1 and 65535", "port", redirectPort)
+	}
+
+	config := &handlers.ServerTLS{CertFile: certFile, KeyFile: keyFile}
+	if redirectPort != 0 {
+		config.RedirectAddr = ":" + strconv.Itoa(redirectPort)
+	}
+	if len(domains) > 0 {
+		config.Manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(getEnv("TLS_AUTOCERT_CACHE", DEFAULT_AUTOCERT_CACHE)),
+			Email:      getEnv("TLS_AUTOCERT_EMAIL", ""),
+		}
+		slog.Info("Certificates issued by Let's Encrypt", "domains", domains)
+	} else if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		// Fail on startup instead of on the first handshake
+		fatal("Error loading the TLS certificate", "error", err)
+	}
+	return config
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key for localhost, returning their paths
+func writeCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestSetupServerTLS(t *testing.T) {
+	unsetEnv(t, "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_AUTOCERT_DOMAINS", "HTTP_REDIRECT_PORT")
+	if config := setupServerTLS(); config != nil {
+		t.Errorf("TLS = %+v without certificates, want plain HTTP", config)
+	}
+
+	certFile, keyFile := writeCertificate(t)
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	t.Setenv("HTTP_REDIRECT_PORT", "8081")
+	config := setupServerTLS()
+	if config == nil || config.Manager != nil || config.RedirectAddr != ":8081" {
+		t.Fatalf("TLS = %+v, want the certificate files and the redirect listener", config)
+	}
+
+	unsetEnv(t, "TLS_CERT_FILE", "TLS_KEY_FILE")
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "Todo.example.com, api.example.com")
+	t.Setenv("TLS_AUTOCERT_CACHE", t.TempDir())
+	config = setupServerTLS()
+	if config == nil || config.Manager == nil {
+		t.Fatalf("TLS = %+v, want autocert", config)
+	}
+	if protos := config.TLSConfig().NextProtos; !slices.Contains(protos, "acme-tls/1") {
+		t.Errorf("NextProtos = %q, want the TLS-ALPN-01 challenge", protos)
+	}
+	if err := config.Manager.HostPolicy(nil, "todo.example.com"); err != nil {
+		t.Errorf("listed domain refused: %v", err)
+	}
+	if err := config.Manager.HostPolicy(nil, "evil.example.com"); err == nil {
+		t.Error("unlisted domain allowed")
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// last_used_at is only written when it is older than this, so every request doesn't write
+	API_KEY_USE_PRECISION = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKey lets scripts act as the user without the login, Key is only returned when it is created
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Hint       string     `json:"hint"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// APIKeyHash is what the database stores of a key, like calendarTokenHash
+func APIKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyRepository stores the API keys of the users, by the hash of the key
+type APIKeyRepository struct {
+	DB *sql.DB
+	// DB_DRIVER_MYSQL reads the id of a new key without RETURNING
+	Driver string
+}
+
+// Authenticate returns the user and the scope of the key, ErrInvalidAPIKey when it is unknown, revoked or of a
+// disabled user. The use is recorded at most every API_KEY_USE_PRECISION
+func (a *APIKeyRepository) Authenticate(ctx context.Context, key string) (int, string, error) {
+	var (
+		id, userID int
+		scope      string
+		lastUsedAt sql.NullTime
+	)
+	err := a.DB.QueryRowContext(ctx, "SELECT id, user_id, scope, last_used_at FROM api_key WHERE key_hash = $1 AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)", APIKeyHash(key)).
+		Scan(&id, &userID, &scope, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidAPIKey
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	if now := time.Now().UTC(); !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) > API_KEY_USE_PRECISION {
+		// Only informative, the request goes on without it
+		if _, err := a.DB.ExecContext(ctx, "UPDATE api_key SET last_used_at = $2 WHERE id = $1", id, now); err != nil {
+			slog.WarnContext(ctx, "Recording the use of an API key failed", "api_key_id", id, "error", err)
+		}
+	}
+	return userID, scope, nil
+}
+
+// List returns the API keys of the user, oldest first, without the keys themselves
+func (a *APIKeyRepository) List(ctx context.Context, userID int) ([]APIKey, error) {
+	rows, err := a.DB.QueryContext(ctx, "SELECT id, name, scope, hint, created_at, last_used_at FROM api_key WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Scope, &key.Hint, &key.CreatedAt, &key.LastUsedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Create stores the hash of the new key of the user and fills in its id
+func (a *APIKeyRepository) Create(ctx context.Context, userID int, key *APIKey) error {
+	var err error
+	key.ID, err = insertID(ctx, a.DB, a.Driver,
+		"INSERT INTO api_key(user_id, name, scope, key_hash, hint, created_at) VALUES($1, $2, $3, $4, $5, $6)",
+		userID, key.Name, key.Scope, APIKeyHash(key.Key), key.Hint, key.CreatedAt,
+	)
+	return err
+}
+
+// Revoke deletes an API key of the user
+func (a *APIKeyRepository) Revoke(ctx context.Context, userID, keyID int) error {
+	result, err := a.DB.ExecContext(ctx, "DELETE FROM api_key WHERE id = $1 AND user_id = $2", keyID, userID)
+	return deleted(result, err)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ArchiveDoneBefore archives the to-do lists of every user done before the time, for the archive job
+func (s *TodoStore) ArchiveDoneBefore(ctx context.Context, before time.Time) ([]Todo, error) {
+	return s.archive(ctx, 0, "completed_at < $1", before)
+}
+
+// ArchiveDone archives every done to-do list of the user
+func (s *TodoStore) ArchiveDone(ctx context.Context, userID int) ([]Todo, error) {
+	return s.archive(ctx, userID, "user_id = $1", userID)
+}
+
+// archive archives the done to-do list matching condition and records it, actorID is zero for the archive job
+func (s *TodoStore) archive(ctx context.Context, actorID int, condition string, args ...interface{}) (todos []Todo, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		if todos, err = queryTodos(ctx, tx, "UPDATE todo SET archived = TRUE, updated_at = now() WHERE is_done AND NOT archived AND deleted_at IS NULL AND "+condition+" RETURNING "+TODO_COLUMNS, args...); err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			// Only to-do list which weren't archived are updated
+			before := todo
+			before.Archived = false
+			if err := recordHistory(ctx, tx, actorID, EVENT_UPDATED, &before, todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return todos, err
+}
+
+// SetArchived archives or unarchives a to-do list the user may edit, whether it's done or not
+func (s *TodoStore) SetArchived(ctx context.Context, userID int, todoID int, archived bool) (todo Todo, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		existingTodo, err := lockTodo(ctx, tx, userID, todoID)
+		if err != nil {
+			return err
+		}
+		row := tx.QueryRowContext(ctx, "UPDATE todo SET archived = $1, updated_at = CASE WHEN archived = $1 THEN updated_at ELSE now() END WHERE id = $2 RETURNING "+TODO_COLUMNS, archived, existingTodo.ID)
+		if err := scanTodo(row, &todo); err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, EVENT_UPDATED, &existingTodo, todo)
+	})
+	return todo, err
+}
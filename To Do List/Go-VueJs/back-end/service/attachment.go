@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Attachment struct {
+	ID          int       `json:"id"`
+	TodoID      int       `json:"todo_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Accessible reports whether the to-do list exists, isn't deleted and the user may access it with role
+func (q *TodoQueries) Accessible(ctx context.Context, userID, todoID int, role string) (bool, error) {
+	var exists bool
+	err := q.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM todo WHERE id = $1 AND "+TodoAccess("", "$2", role)+" AND deleted_at IS NULL)", todoID, userID).Scan(&exists)
+	return exists, err
+}
+
+// AttachmentRepository stores the attachments of the to-do lists, their files are in the AttachmentStore. The methods
+// taking the user check the user may access the to-do list and return ErrNotFound otherwise
+type AttachmentRepository struct {
+	DB *sql.DB
+}
+
+// Create stores the attachment of the file under storageKey on the to-do list the user may edit, filling in the rest
+func (a *AttachmentRepository) Create(ctx context.Context, userID, todoID int, attachment *Attachment, storageKey string) error {
+	// Selecting the to-do list checks the user may still edit it
+	row := a.DB.QueryRowContext(ctx,
+		"INSERT INTO attachment(todo_id, filename, content_type, size, storage_key) SELECT id, $3, $4, $5, $6 FROM todo WHERE id = $1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL RETURNING id, todo_id, created_at",
+		todoID, userID, attachment.Filename, attachment.ContentType, attachment.Size, storageKey,
+	)
+	if err := row.Scan(&attachment.ID, &attachment.TodoID, &attachment.CreatedAt); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// List reads the attachments of the to-do list in the order they were uploaded
+func (a *AttachmentRepository) List(ctx context.Context, todoID int) ([]Attachment, error) {
+	rows, err := a.DB.QueryContext(ctx, "SELECT id, todo_id, filename, content_type, size, created_at FROM attachment WHERE todo_id = $1 ORDER BY id", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make([]Attachment, 0)
+	for rows.Next() {
+		var attachment Attachment
+		if err := rows.Scan(&attachment.ID, &attachment.TodoID, &attachment.Filename, &attachment.ContentType, &attachment.Size, &attachment.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// Find reads the attachment of the to-do list the user may view with the storage key of its file
+func (a *AttachmentRepository) Find(ctx context.Context, userID, todoID, attachmentID int) (attachment Attachment, storageKey string, err error) {
+	row := a.DB.QueryRowContext(ctx,
+		"SELECT a.filename, a.content_type, a.size, a.storage_key FROM attachment a JOIN todo t ON t.id = a.todo_id WHERE a.id = $3 AND a.todo_id = $1 AND "+TodoAccess("t.", "$2", ROLE_VIEWER)+" AND t.deleted_at IS NULL",
+		todoID, userID, attachmentID,
+	)
+	if err = row.Scan(&attachment.Filename, &attachment.ContentType, &attachment.Size, &storageKey); err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return attachment, storageKey, err
+}
+
+// Delete removes the attachment of the to-do list the user may edit, returning the storage key of its file
+func (a *AttachmentRepository) Delete(ctx context.Context, userID, todoID, attachmentID int) (string, error) {
+	var storageKey string
+	row := a.DB.QueryRowContext(ctx,
+		"DELETE FROM attachment a USING todo t WHERE a.id = $3 AND a.todo_id = $1 AND t.id = a.todo_id AND "+TodoAccess("t.", "$2", ROLE_EDITOR)+" AND t.deleted_at IS NULL RETURNING a.storage_key",
+		todoID, userID, attachmentID,
+	)
+	if err := row.Scan(&storageKey); err == sql.ErrNoRows {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return storageKey, nil
+}
+
+// Orphans maps at most limit attachments of purged to-do lists, whose todo_id was set to NULL, to their storage keys
+func (a *AttachmentRepository) Orphans(ctx context.Context, limit int) (map[int]string, error) {
+	rows, err := a.DB.QueryContext(ctx, "SELECT id, storage_key FROM attachment WHERE todo_id IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orphans := make(map[int]string)
+	for rows.Next() {
+		var (
+			id         int
+			storageKey string
+		)
+		if err := rows.Scan(&id, &storageKey); err != nil {
+			return nil, err
+		}
+		orphans[id] = storageKey
+	}
+	return orphans, rows.Err()
+}
+
+// DeleteOrphan removes the row of an orphan attachment once its file is deleted
+func (a *AttachmentRepository) DeleteOrphan(ctx context.Context, id int) error {
+	_, err := a.DB.ExecContext(ctx, "DELETE FROM attachment WHERE id = $1", id)
+	return err
+}
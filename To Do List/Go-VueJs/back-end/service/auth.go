@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	MIN_USERNAME_LENGTH = 3
+	MAX_USERNAME_LENGTH = 50
+)
+
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
+
+// UserRepository stores the accounts of the users
+type UserRepository struct {
+	DB *sql.DB
+	// DB_DRIVER_MYSQL reads the id of a new user without RETURNING
+	Driver string
+}
+
+// Create stores the user with the hash of the password and fills in its id, a taken username is a unique violation
+func (u *UserRepository) Create(ctx context.Context, user *User, passwordHash string) error {
+	var err error
+	email := sql.NullString{String: user.Email, Valid: user.Email != ""}
+	user.ID, err = insertID(ctx, u.DB, u.Driver, "INSERT INTO users(username, password_hash, email) VALUES($1, $2, $3)", user.Username, passwordHash, email)
+	return err
+}
+
+// PasswordHash returns the user of the username with the hash of the password, which is empty for the users of an
+// OAuth provider only. ErrNotFound when there is no such user
+func (u *UserRepository) PasswordHash(ctx context.Context, username string) (int, string, error) {
+	var (
+		userID int
+		hash   string
+	)
+	err := u.DB.QueryRowContext(ctx, "SELECT id, password_hash FROM users WHERE username = $1", username).Scan(&userID, &hash)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrNotFound
+	}
+	return userID, hash, err
+}
+
+// Lookup is the id of the user with the username, ErrNotFound when there is none
+func (u *UserRepository) Lookup(ctx context.Context, username string) (int, error) {
+	var userID int
+	err := u.DB.QueryRowContext(ctx, "SELECT id FROM users WHERE username = $1", username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
+
+// UserExists reports whether the user is stored, on db which may be the transaction of a restore
+func UserExists(ctx context.Context, db queryRower, userID int) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+	return exists, err
+}
+
+// IsDisabled reports whether the user may not sign in
+func (u *UserRepository) IsDisabled(ctx context.Context, userID int) (bool, error) {
+	var disabled bool
+	err := u.DB.QueryRowContext(ctx, "SELECT disabled_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&disabled)
+	return disabled, err
+}
+
+// Disable stops the user from signing in and revokes the sessions of the user, returning how many were revoked
+func (u *UserRepository) Disable(ctx context.Context, userID int, now time.Time) (revoked int64, err error) {
+	err = RunInTx(ctx, u.DB, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET disabled_at = COALESCE(disabled_at, $2) WHERE id = $1", userID, now); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "UPDATE user_session SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", userID, now)
+		if err != nil {
+			return err
+		}
+		revoked, err = result.RowsAffected()
+		return err
+	})
+	return revoked, err
+}
+
+// Enable lets a disabled user sign in again
+func (u *UserRepository) Enable(ctx context.Context, userID int) error {
+	_, err := u.DB.ExecContext(ctx, "UPDATE users SET disabled_at = NULL WHERE id = $1", userID)
+	return err
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// BackupTodo is a to-do list of the backup with its owner, which POST /todo/import restores it to
+type BackupTodo struct {
+	Todo
+	UserID *int `json:"user_id"`
+}
+
+type BackupTemplate struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	UserID *int   `json:"user_id"`
+}
+
+type BackupTemplateItem struct {
+	ID          int    `json:"id"`
+	TemplateID  int    `json:"template_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// BackupTables are the tables owned by the users which aren't to-do lists or templates, dumped as Postgres encodes
+// their rows to JSON. The passwords, key hashes and secrets are left out, the sessions, queues and events are transient
+var BackupTables = []struct {
+	Name    string
+	Columns string
+	OrderBy string
+}{
+	{"users", "id, username, email, email_verified, created_at, disabled_at", "id"},
+	{"user_identity", "provider, subject, user_id, created_at", "user_id, provider"},
+	{"api_key", "id, user_id, name, scope, hint, created_at, last_used_at", "id"},
+	{"project", "id, user_id, name, created_at", "id"},
+	{"tag", "id, user_id, name, created_at", "id"},
+	{"project_member", "project_id, user_id, role, created_at", "project_id, user_id"},
+	{"project_invitation", "id, project_id, user_id, role, invited_by, created_at", "id"},
+	{"todo_item", "id, todo_id, title, is_done", "id"},
+	{"todo_comment", "id, todo_id, author_id, body, created_at", "id"},
+	{"todo_history", "id, todo_id, actor_id, action, changes, created_at", "id"},
+	{"attachment", "id, todo_id, filename, content_type, size, storage_key, created_at", "id"},
+	{"webhook", "id, user_id, url, events", "id"},
+}
+
+// backupTable is how a table of the backup is read, each row scanned into the value written for it
+type backupTable struct {
+	name  string
+	query string
+	scan  func(rows *sql.Rows) (interface{}, error)
+}
+
+// BackupRepository reads the snapshots of the database which GET /todo/backup dumps
+type BackupRepository struct {
+	DB *sql.DB
+}
+
+// BackupSnapshot reads the tables of the backup as they were when it was taken, until it is closed
+type BackupSnapshot struct {
+	tx     *sql.Tx
+	tables []backupTable
+}
+
+// Snapshot takes a snapshot of the tables owned by the users, to-do lists and templates first
+func (b *BackupRepository) Snapshot(ctx context.Context) (*BackupSnapshot, error) {
+	// One snapshot keeps the tables consistent with each other, the dump may run longer than DB_STATEMENT_TIMEOUT allows a query
+	tx, err := b.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tables := []backupTable{
+		{"todo", "SELECT user_id, " + TODO_COLUMNS + " FROM todo ORDER BY id", func(rows *sql.Rows) (interface{}, error) {
+			var todo Todo
+			var userID sql.NullInt64
+			err := scanTodo(prefixScanner{rows, []interface{}{&userID}}, &todo)
+			backup := BackupTodo{Todo: todo}
+			if userID.Valid {
+				owner := int(userID.Int64)
+				backup.UserID = &owner
+			}
+			return backup, err
+		}},
+		{"template", "SELECT id, name, user_id FROM template ORDER BY id", func(rows *sql.Rows) (interface{}, error) {
+			var template BackupTemplate
+			var userID sql.NullInt64
+			err := rows.Scan(&template.ID, &template.Name, &userID)
+			if userID.Valid {
+				owner := int(userID.Int64)
+				template.UserID = &owner
+			}
+			return template, err
+		}},
+		{"template_item", "SELECT id, template_id, title, COALESCE(description, '') FROM template_item ORDER BY id", func(rows *sql.Rows) (interface{}, error) {
+			var item BackupTemplateItem
+			err := rows.Scan(&item.ID, &item.TemplateID, &item.Title, &item.Description)
+			return item, err
+		}},
+	}
+	for _, table := range BackupTables {
+		query := fmt.Sprintf("SELECT row_to_json(t) FROM (SELECT %s FROM %s ORDER BY %s) t", table.Columns, table.Name, table.OrderBy)
+		tables = append(tables, backupTable{table.Name, query, func(rows *sql.Rows) (interface{}, error) {
+			var row json.RawMessage
+			err := rows.Scan(&row)
+			return row, err
+		}})
+	}
+	return &BackupSnapshot{tx: tx, tables: tables}, nil
+}
+
+// SchemaVersion is the migration version of the snapshot, which tells a restore which schema the data belongs to
+func (s *BackupSnapshot) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := s.tx.QueryRowContext(ctx, "SELECT version FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Tables are the names of the tables of the backup, in the order they are dumped
+func (s *BackupSnapshot) Tables() []string {
+	names := make([]string, len(s.tables))
+	for i, table := range s.tables {
+		names[i] = table.name
+	}
+	return names
+}
+
+// Each passes the rows of the table to fn one after the other, without reading the whole table first. It stops at
+// the first error of fn
+func (s *BackupSnapshot) Each(ctx context.Context, name string, fn func(value interface{}) error) error {
+	for _, table := range s.tables {
+		if table.name != name {
+			continue
+		}
+		rows, err := s.tx.QueryContext(ctx, table.query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			value, err := table.scan(rows)
+			if err != nil {
+				return err
+			}
+			if err := fn(value); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}
+	return fmt.Errorf("table %s is not in the backup", name)
+}
+
+// Close ends the snapshot
+func (s *BackupSnapshot) Close() error {
+	return s.tx.Rollback()
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// BatchItemError is the failure of the item at index of a batch, which rolled back the whole batch
+type BatchItemError struct {
+	Index int
+	error
+}
+
+func (e BatchItemError) Unwrap() error {
+	return e.error
+}
+
+// CreateAll creates the to-do lists of the user in one transaction, the first one which can't be stored fails all of
+// them with a BatchItemError
+func (s *TodoStore) CreateAll(ctx context.Context, userID int, newTodos []Todo) (todos []Todo, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		todos = make([]Todo, 0, len(newTodos))
+		for i, newTodo := range newTodos {
+			var todo Todo
+			row := tx.QueryRowContext(ctx, "INSERT INTO todo(title, description, source, metadata, due_date, priority, user_id) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING "+TODO_COLUMNS, newTodo.Title, newTodo.Description, newTodo.Source, newTodo.Metadata, newTodo.DueDate, newTodo.Priority, userID)
+			if err := scanTodo(row, &todo); err != nil {
+				return BatchItemError{i, err}
+			}
+			if len(newTodo.Tags) > 0 {
+				tags, err := setTodoTags(ctx, tx, todo.ID, newTodo.Tags)
+				if err != nil {
+					return BatchItemError{i, err}
+				}
+				todo.Tags = tags
+			}
+			if err := recordHistory(ctx, tx, userID, EVENT_CREATED, nil, todo); err != nil {
+				return err
+			}
+			todos = append(todos, todo)
+		}
+		return nil
+	})
+	return todos, err
+}
+
+// InSavepoints runs count operations in one transaction, each within a savepoint: an error of run only undoes its
+// operation and is left to run to report, the other operations are committed
+func (s *TodoStore) InSavepoints(ctx context.Context, count int, run func(tx *sql.Tx, i int) error) error {
+	return RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		for i := 0; i < count; i++ {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT operation"); err != nil {
+				return err
+			}
+			savepoint := "RELEASE SAVEPOINT operation"
+			if err := run(tx, i); err != nil {
+				savepoint = "ROLLBACK TO SAVEPOINT operation"
+			}
+			if _, err := tx.ExecContext(ctx, savepoint); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetAllDone marks every to-do list of the user which isn't deleted as done or not done, returning those which changed
+func (s *TodoStore) SetAllDone(ctx context.Context, userID int, isDone bool, transitions StatusTransitions) (todos []Todo, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		// The rows stay locked until commit, so the history has them as they were right before the update
+		// A reopened to-do list goes back to the backlog, those which STATUS_TRANSITIONS don't allow to move are left as they are
+		status := STATUS_BACKLOG
+		if isDone {
+			status = STATUS_DONE
+		}
+		sources := pq.Array(transitions.Sources(status))
+		existingTodos, err := queryTodos(ctx, tx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE is_done <> $1 AND user_id = $2 AND deleted_at IS NULL AND status = ANY($3) FOR UPDATE", isDone, userID, sources)
+		if err != nil {
+			return err
+		}
+		if todos, err = queryTodos(ctx, tx,
+			"UPDATE todo SET is_done = $1, status = $4, completed_at = CASE WHEN $1 THEN COALESCE(completed_at, now()) END, version = version + 1, updated_at = now() WHERE is_done <> $1 AND user_id = $2 AND deleted_at IS NULL AND status = ANY($3) RETURNING "+TODO_COLUMNS,
+			isDone, userID, sources, status,
+		); err != nil {
+			return err
+		}
+		return recordHistories(ctx, tx, userID, existingTodos, todos)
+	})
+	return todos, err
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	EVENT_CREATED  = "created"
+	EVENT_UPDATED  = "updated"
+	EVENT_DELETED  = "deleted"
+	EVENT_RESTORED = "restored"
+
+	// An update which marked the to-do list as done is published as completed instead of updated
+	EVENT_COMPLETED = "completed"
+)
+
+// UpdateEvent is the type of the event of an update from existing to updated
+func UpdateEvent(existing, updated Todo) string {
+	if updated.IsDone && !existing.IsDone {
+		return EVENT_COMPLETED
+	}
+	return EVENT_UPDATED
+}
+
+// Number of recent change events kept in memory for clients to catch up
+const MAX_CHANGE_EVENTS = 1000
+
+type ChangeEvent struct {
+	Seq    uint64 `json:"seq"`
+	Type   string `json:"type"`
+	TodoID int    `json:"todo_id"`
+	Todo   *Todo  `json:"todo,omitempty"`
+	UserID int    `json:"-"`
+}
+
+type Changes struct {
+	Cursor uint64        `json:"cursor"`
+	Events []ChangeEvent `json:"events"`
+}
+
+// Broadcaster keeps the recent to-do list changes and wakes up everyone waiting for a newer one
+type Broadcaster struct {
+	mu     sync.Mutex
+	seq    uint64
+	events []ChangeEvent
+	notify chan struct{}
+
+	// Waiting clients, limited to maxSubscribers
+	subscribers    int
+	maxSubscribers int
+}
+
+func NewBroadcaster(maxSubscribers int) *Broadcaster {
+	return &Broadcaster{notify: make(chan struct{}), maxSubscribers: maxSubscribers}
+}
+
+// Subscribe reserves a slot for a waiting client, the returned release must be called on disconnect
+func (b *Broadcaster) Subscribe() (release func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers >= b.maxSubscribers {
+		return nil, false
+	}
+	b.subscribers++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.subscribers--
+			b.mu.Unlock()
+		})
+	}, true
+}
+
+// Publish records a change of a to-do list owned by userID
+func (b *Broadcaster) Publish(eventType string, userID, todoID int, todo *Todo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	b.events = append(b.events, ChangeEvent{Seq: b.seq, Type: eventType, TodoID: todoID, Todo: todo, UserID: userID})
+	if len(b.events) > MAX_CHANGE_EVENTS {
+		b.events = b.events[len(b.events)-MAX_CHANGE_EVENTS:]
+	}
+
+	// Closing the channel wakes up all waiters at once
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Cursor returns the sequence number of the latest change
+func (b *Broadcaster) Cursor() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Since returns the changes of userID newer than the cursor without blocking, of every user when userID is 0
+func (b *Broadcaster) Since(since uint64, userID int) Changes {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	changes, _ := b.since(since, userID)
+	return changes
+}
+
+// Wait blocks until there is a change of userID newer than the cursor or the context is done, of every user when userID is 0
+func (b *Broadcaster) Wait(ctx context.Context, since uint64, userID int) Changes {
+	for {
+		b.mu.Lock()
+		changes, notify := b.since(since, userID)
+		b.mu.Unlock()
+
+		if len(changes.Events) > 0 || notify == nil {
+			return changes
+		}
+
+		select {
+		case <-ctx.Done():
+			return changes
+		case <-notify:
+		}
+	}
+}
+
+// since must be called with the lock held, it also returns the channel to wait on when nothing is newer
+func (b *Broadcaster) since(since uint64, userID int) (Changes, chan struct{}) {
+	changes := Changes{Cursor: b.seq, Events: make([]ChangeEvent, 0)}
+
+	// A cursor from before a restart can't be resumed, let the client start over
+	if since > b.seq {
+		return changes, nil
+	}
+
+	for _, event := range b.events {
+		if event.Seq > since && (userID == 0 || event.UserID == userID) {
+			changes.Events = append(changes.Events, event)
+		}
+	}
+	return changes, b.notify
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SetCalendarToken stores the hash of the token of the calendar feed of the user, replacing the one before
+func (u *UserRepository) SetCalendarToken(ctx context.Context, userID int, tokenHash string) error {
+	_, err := u.DB.ExecContext(ctx, "UPDATE users SET calendar_token_hash = $2 WHERE id = $1", userID, tokenHash)
+	return err
+}
+
+// RevokeCalendarToken forgets the token of the calendar feed of the user
+func (u *UserRepository) RevokeCalendarToken(ctx context.Context, userID int) error {
+	_, err := u.DB.ExecContext(ctx, "UPDATE users SET calendar_token_hash = NULL WHERE id = $1", userID)
+	return err
+}
+
+// CalendarUser is the user whose calendar feed has the token of the hash, ErrNotFound when there is none
+func (u *UserRepository) CalendarUser(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := u.DB.QueryRowContext(ctx, "SELECT id FROM users WHERE calendar_token_hash = $1", tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
+
+// Calendar reads the to-do lists of the user with a due date which aren't archived, by due date, the done ones only
+// with includeDone
+func (q *TodoQueries) Calendar(ctx context.Context, userID int, includeDone bool) (*TodoRows, error) {
+	query := "SELECT " + TODO_COLUMNS + " FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND archived = FALSE AND due_date IS NOT NULL"
+	if !includeDone {
+		query += " AND is_done = FALSE"
+	}
+	return queryTodoRows(ctx, q.DB, query+" ORDER BY due_date, id", userID)
+}
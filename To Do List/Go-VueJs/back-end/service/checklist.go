@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Checklist is the subtasks of a to-do list with how many are done, like "3/5 done"
+type Checklist struct {
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	Items []Item `json:"items"`
+}
+
+type Item struct {
+	ID     int    `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	IsDone bool   `json:"is_done"`
+}
+
+// ChecklistRepository stores the items of the checklists, the methods taking the user check the user may edit the
+// to-do list and return ErrNotFound otherwise
+type ChecklistRepository struct {
+	DB *sql.DB
+}
+
+// Load reads the items of the to-do list in the order they were added
+func (c *ChecklistRepository) Load(ctx context.Context, todoID int) (*Checklist, error) {
+	rows, err := c.DB.QueryContext(ctx, "SELECT id, title, is_done FROM todo_item WHERE todo_id = $1 ORDER BY id", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checklist := &Checklist{Items: make([]Item, 0)}
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Title, &item.IsDone); err != nil {
+			return nil, err
+		}
+		if item.IsDone {
+			checklist.Done++
+		}
+		checklist.Items = append(checklist.Items, item)
+	}
+	checklist.Total = len(checklist.Items)
+	return checklist, rows.Err()
+}
+
+// Add appends the item to the checklist of the to-do list and fills in its id
+func (c *ChecklistRepository) Add(ctx context.Context, userID, todoID int, item *Item) error {
+	// Selecting the to-do list checks the user may edit it
+	row := c.DB.QueryRowContext(ctx,
+		"INSERT INTO todo_item(todo_id, title, is_done) SELECT id, $3, $4 FROM todo WHERE id = $1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL RETURNING id",
+		todoID, userID, item.Title, item.IsDone,
+	)
+	if err := row.Scan(&item.ID); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Update replaces the title and completion of the item of the checklist
+func (c *ChecklistRepository) Update(ctx context.Context, userID, todoID, itemID int, item *Item) error {
+	row := c.DB.QueryRowContext(ctx,
+		"UPDATE todo_item i SET title = $4, is_done = $5 FROM todo t WHERE i.id = $3 AND i.todo_id = $1 AND t.id = i.todo_id AND "+TodoAccess("t.", "$2", ROLE_EDITOR)+" AND t.deleted_at IS NULL RETURNING i.id",
+		todoID, userID, itemID, item.Title, item.IsDone,
+	)
+	if err := row.Scan(&item.ID); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the item of the checklist, returning it
+func (c *ChecklistRepository) Delete(ctx context.Context, userID, todoID, itemID int) (Item, error) {
+	var item Item
+	row := c.DB.QueryRowContext(ctx,
+		"DELETE FROM todo_item i USING todo t WHERE i.id = $3 AND i.todo_id = $1 AND t.id = i.todo_id AND "+TodoAccess("t.", "$2", ROLE_EDITOR)+" AND t.deleted_at IS NULL RETURNING i.id, i.title, i.is_done",
+		todoID, userID, itemID,
+	)
+	if err := row.Scan(&item.ID, &item.Title, &item.IsDone); err == sql.ErrNoRows {
+		return item, ErrNotFound
+	} else if err != nil {
+		return item, err
+	}
+	return item, nil
+}
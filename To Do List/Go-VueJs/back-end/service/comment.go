@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Comment is a Markdown note on a to-do list, BodyHTML is only filled with ?render=html
+type Comment struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todo_id"`
+	AuthorID  int       `json:"author_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	BodyHTML  string    `json:"body_html,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const COMMENT_COLUMNS = "c.id, c.todo_id, c.author_id, u.username, c.body, c.created_at"
+
+func scanComment(row Scanner, comment *Comment) error {
+	return row.Scan(&comment.ID, &comment.TodoID, &comment.AuthorID, &comment.Author, &comment.Body, &comment.CreatedAt)
+}
+
+// CommentRepository stores the comments of the to-do lists, the methods taking the user check the user may edit the
+// to-do list and return ErrNotFound otherwise
+type CommentRepository struct {
+	DB *sql.DB
+}
+
+// List reads the comments of the to-do list, oldest first
+func (c *CommentRepository) List(ctx context.Context, todoID int) ([]Comment, error) {
+	rows, err := c.DB.QueryContext(ctx, "SELECT "+COMMENT_COLUMNS+" FROM todo_comment c JOIN users u ON u.id = c.author_id WHERE c.todo_id = $1 ORDER BY c.id", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]Comment, 0)
+	for rows.Next() {
+		var comment Comment
+		if err := scanComment(rows, &comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// Add comments on the to-do list as the user and fills in the rest of the comment
+func (c *CommentRepository) Add(ctx context.Context, userID, todoID int, comment *Comment) error {
+	// Selecting the to-do list checks the user may edit it
+	row := c.DB.QueryRowContext(ctx,
+		"INSERT INTO todo_comment(todo_id, author_id, body) SELECT id, $2, $3 FROM todo WHERE id = $1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL "+
+			"RETURNING id, todo_id, author_id, (SELECT username FROM users WHERE id = author_id), body, created_at",
+		todoID, userID, comment.Body,
+	)
+	if err := scanComment(row, comment); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the comment of the to-do list
+func (c *CommentRepository) Delete(ctx context.Context, userID, todoID, commentID int) error {
+	return deleted(c.DB.ExecContext(ctx,
+		"DELETE FROM todo_comment c USING todo t WHERE c.id = $3 AND c.todo_id = $1 AND t.id = c.todo_id AND "+TodoAccess("t.", "$2", ROLE_EDITOR)+" AND t.deleted_at IS NULL",
+		todoID, userID, commentID,
+	))
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RecordedEvent is a change event as todo_event stores it, Payload is the to-do list in JSON
+type RecordedEvent struct {
+	ID      int64
+	Type    string
+	Payload []byte
+}
+
+// EventRepository stores the change events for the event streams, whose clients catch up by event id
+type EventRepository struct {
+	DB *sql.DB
+}
+
+// Record stores the event of the to-do list for the user
+func (e *EventRepository) Record(ctx context.Context, userID int, eventType string, todoID int, payload []byte) error {
+	_, err := e.DB.ExecContext(ctx, "INSERT INTO todo_event(user_id, type, todo_id, payload) VALUES($1, $2, $3, $4)", userID, eventType, todoID, payload)
+	return err
+}
+
+// Prune deletes the events recorded before the time
+func (e *EventRepository) Prune(ctx context.Context, before time.Time) error {
+	_, err := e.DB.ExecContext(ctx, "DELETE FROM todo_event WHERE created_at < $1", before)
+	return err
+}
+
+// LastID is the id of the latest event of the user, zero without any
+func (e *EventRepository) LastID(ctx context.Context, userID int) (int64, error) {
+	var lastID int64
+	err := e.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM todo_event WHERE user_id = $1", userID).Scan(&lastID)
+	return lastID, err
+}
+
+// After reads at most limit events of the user after lastID, oldest first
+func (e *EventRepository) After(ctx context.Context, userID int, lastID int64, limit int) ([]RecordedEvent, error) {
+	rows, err := e.DB.QueryContext(ctx, "SELECT id, type, payload FROM todo_event WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3", userID, lastID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []RecordedEvent
+	for rows.Next() {
+		var event RecordedEvent
+		if err := rows.Scan(&event.ID, &event.Type, &event.Payload); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
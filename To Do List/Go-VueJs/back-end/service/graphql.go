@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+)
+
+// TagCount counts the to-do lists of the user with the tag
+func (q *TodoQueries) TagCount(ctx context.Context, userID int, tag string) (int, error) {
+	var count int
+	err := q.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NULL AND $2 = ANY("+TODO_TAGS+")", userID, tag).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// FieldChange is the value of a field of the to-do list before and after a change, null when it was unset
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// HistoryEntry is one change of a to-do list, ActorID is nil for changes of the background jobs
+type HistoryEntry struct {
+	ID        int64                  `json:"id"`
+	Action    string                 `json:"action"`
+	ActorID   *int                   `json:"actor_id"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Fields which change along with every other change, or aren't stored, are left out of the history
+var historyIgnored = map[string]bool{"id": true, "version": true, "created_at": true, "updated_at": true, "next_due_date": true, "checklist": true, "comments": true, "description_html": true}
+
+// todoChanges returns the fields which differ between before and after, a nil before means the to-do list was created
+func todoChanges(before *Todo, after Todo) (map[string]FieldChange, error) {
+	fields := func(todo *Todo) (map[string]json.RawMessage, error) {
+		values := map[string]json.RawMessage{}
+		if todo == nil {
+			return values, nil
+		}
+		data, err := json.Marshal(todo)
+		if err != nil {
+			return nil, err
+		}
+		return values, json.Unmarshal(data, &values)
+	}
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := fields(&after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for name, value := range to {
+		if !historyIgnored[name] && !bytes.Equal(from[name], value) {
+			changes[name] = FieldChange{From: from[name], To: value}
+		}
+	}
+	// Fields left out of the JSON when empty were cleared
+	for name, value := range from {
+		if _, ok := to[name]; !ok && !historyIgnored[name] {
+			changes[name] = FieldChange{From: value}
+		}
+	}
+	return changes, nil
+}
+
+// recordHistory stores the change of the to-do list from before to after within tx, so it commits or rolls back with the change
+// actorID is the user making the change, zero for the background jobs, and a change of no field isn't stored
+func recordHistory(ctx context.Context, tx *sql.Tx, actorID int, action string, before *Todo, after Todo) error {
+	changes, err := todoChanges(before, after)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	actor := sql.NullInt64{Int64: int64(actorID), Valid: actorID != 0}
+	_, err = tx.ExecContext(ctx, "INSERT INTO todo_history(todo_id, actor_id, action, changes) VALUES($1, $2, $3, $4)", after.ID, actor, action, payload)
+	return err
+}
+
+// History returns a page of the changes of a to-do list the user may view, latest first, and how many there are in all.
+// It's ErrTodoNotFound unless the user may view the to-do list, also while it's in the trash
+func (q *TodoQueries) History(ctx context.Context, userID, todoID int, limit, offset int) ([]HistoryEntry, int, error) {
+	var exists bool
+	if err := q.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM todo WHERE id = $1 AND "+todoAccessOn(q.Driver, "", "$2", ROLE_VIEWER)+")", todoID, userID).Scan(&exists); err != nil {
+		return nil, 0, err
+	} else if !exists {
+		return nil, 0, ErrTodoNotFound
+	}
+	var total int
+	if err := q.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM todo_history WHERE todo_id = $1", todoID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := q.DB.QueryContext(ctx,
+		"SELECT id, action, actor_id, changes, created_at FROM todo_history WHERE todo_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3",
+		todoID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := make([]HistoryEntry, 0)
+	for rows.Next() {
+		var entry HistoryEntry
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.ActorID, &changes, &entry.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// recordHistories records the changes of the to-do list of a bulk update, matching each updated one to how it was before
+func recordHistories(ctx context.Context, tx *sql.Tx, actorID int, before, after []Todo) error {
+	existing := make(map[int]Todo, len(before))
+	for _, todo := range before {
+		existing[todo.ID] = todo
+	}
+	for _, todo := range after {
+		previous := existing[todo.ID]
+		if err := recordHistory(ctx, tx, actorID, UpdateEvent(previous, todo), &previous, todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTodoChanges(t *testing.T) {
+	now := time.Now()
+	before := Todo{ID: 1, Title: "Buy milk", Description: "Oat", Priority: PRIORITY_MEDIUM, Tags: Tags{"shop"}, Version: 1, UpdatedAt: &now}
+	after := before
+	after.Title, after.Description, after.IsDone, after.CompletedAt = "Buy oat milk", "", true, &now
+	after.Version, after.UpdatedAt = 2, timePtr(now.Add(time.Second))
+
+	nowJSON, _ := json.Marshal(now)
+	changes, err := todoChanges(&before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"title":        `"Buy milk" -> "Buy oat milk"`,
+		"description":  `"Oat" -> `,
+		"is_done":      `false -> true`,
+		"completed_at": ` -> ` + string(nowJSON),
+	}
+	if len(changes) != len(want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+	for field, change := range want {
+		if got := string(changes[field].From) + " -> " + string(changes[field].To); got != change {
+			t.Errorf("%s = %s, want %s", field, got, change)
+		}
+	}
+
+	if created, _ := todoChanges(nil, before); created["title"].From != nil || string(created["title"].To) != `"Buy milk"` {
+		t.Errorf("created title = %+v, want only the new value", created["title"])
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// Retries with the same Idempotency-Key within this long get the original response
+	IDEMPOTENCY_KEY_TTL = 24 * time.Hour
+)
+
+var ErrIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request")
+
+// IdempotencyRepository stores the Idempotency-Key of the users with the to-do list each created, see POST /todo
+type IdempotencyRepository struct {
+	DB *sql.DB
+	// DB_DRIVER_MYSQL quotes the key column, KEY is a reserved word there, and stores the key without ON CONFLICT
+	Driver string
+	// Todos creates the to-do list within the transaction of its key
+	Todos func(tx *sql.Tx) TodoRepository
+}
+
+// keyColumn is the key column of idempotency_key in the queries of the database driver
+func (k *IdempotencyRepository) keyColumn() string {
+	if k.Driver == DB_DRIVER_MYSQL {
+		return "`key`"
+	}
+	return "key"
+}
+
+// Stored returns the to-do list created earlier with the key of the user, nil when the key is new or expired
+func (k *IdempotencyRepository) Stored(ctx context.Context, userID int, key, hash string) (*Todo, error) {
+	var storedHash string
+	var response []byte
+	// In UTC, SQLite compares the times as text
+	err := k.DB.QueryRowContext(ctx, "SELECT request_hash, response FROM idempotency_key WHERE user_id = $1 AND "+k.keyColumn()+" = $2 AND created_at > $3", userID, key, time.Now().UTC().Add(-IDEMPOTENCY_KEY_TTL)).Scan(&storedHash, &response)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if storedHash != hash {
+		return nil, ErrIdempotencyMismatch
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(response, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// CreateOnce stores the checked to-do list together with the key, so its creation and the key commit together
+// When a concurrent request with the key got there first, todo is replaced by the one it created and replayed is true
+func (k *IdempotencyRepository) CreateOnce(ctx context.Context, userID int, key, hash string, todo *Todo) (replayed bool, err error) {
+	tx, err := k.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err = k.Todos(tx).Create(ctx, userID, todo); err != nil {
+		return false, err
+	}
+	response, err := json.Marshal(todo)
+	if err != nil {
+		return false, err
+	}
+	// The key is unique per user, a concurrent insert of it waits for the first to commit and then changes nothing
+	query := "INSERT INTO idempotency_key(user_id, key, request_hash, response) VALUES($1, $2, $3, $4) ON CONFLICT (user_id, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, response = EXCLUDED.response, created_at = CURRENT_TIMESTAMP WHERE idempotency_key.created_at <= $5"
+	if k.Driver == DB_DRIVER_MYSQL {
+		// The assignments run in order, created_at is the old one until the last. Assigning the same values affects
+		// no row, like the WHERE of ON CONFLICT
+		query = "INSERT INTO idempotency_key(user_id, `key`, request_hash, response) VALUES($1, $2, $3, $4) ON DUPLICATE KEY UPDATE " +
+			"request_hash = IF(created_at <= $5, VALUES(request_hash), request_hash), response = IF(created_at <= $5, VALUES(response), response), " +
+			"created_at = IF(created_at <= $5, CURRENT_TIMESTAMP(6), created_at)"
+	}
+	result, err := tx.ExecContext(ctx, query, userID, key, hash, response, time.Now().UTC().Add(-IDEMPOTENCY_KEY_TTL))
+	if err != nil {
+		return false, err
+	}
+	if stored, _ := result.RowsAffected(); stored == 0 {
+		tx.Rollback()
+		existing, err := k.Stored(ctx, userID, key, hash)
+		if err != nil {
+			return false, err
+		} else if existing == nil {
+			return false, errors.New("idempotency key is taken but not stored")
+		}
+		*todo = *existing
+		return true, nil
+	}
+	return false, tx.Commit()
+}
+
+// Prune deletes the expired idempotency keys
+func (k *IdempotencyRepository) Prune(ctx context.Context) error {
+	_, err := k.DB.ExecContext(ctx, "DELETE FROM idempotency_key WHERE created_at <= $1", time.Now().UTC().Add(-IDEMPOTENCY_KEY_TTL))
+	return err
+}
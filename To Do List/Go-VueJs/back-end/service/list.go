@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListFilter selects the to-do list of a user which GET /todo, its board, views and export list, the zero value of a
+// field matches every to-do list
+type ListFilter struct {
+	UserID    int
+	Source    string
+	IsDone    *bool
+	Status    string
+	ProjectID *int
+	Priority  string
+	// Overdue is undone and due before now, to-do list without a due date are never overdue
+	Overdue *bool
+	// Exclusive bounds of the due date
+	DueBefore *time.Time
+	DueAfter  *time.Time
+	// Due within [DueFrom, DueUntil), e.g. today
+	DueFrom  *time.Time
+	DueUntil *time.Time
+	// The title contains each, % and _ matched literally
+	TitleContains []string
+	// The to-do list has every tag
+	Tags Tags
+	// The value stored under each key of the metadata
+	Metadata        map[string]string
+	IncludeArchived bool
+}
+
+// where is the WHERE clause of the filter, with the arguments of its placeholders
+func (f ListFilter) where() (string, []interface{}) {
+	// Deleted to-do list are hidden until restored
+	var (
+		conditions = []string{"user_id = $1", "deleted_at IS NULL"}
+		args       = []interface{}{f.UserID}
+	)
+	if f.Source != "" {
+		args = append(args, f.Source)
+		conditions = append(conditions, fmt.Sprintf("source = $%d", len(args)))
+	}
+	if f.IsDone != nil {
+		args = append(args, *f.IsDone)
+		conditions = append(conditions, fmt.Sprintf("is_done = $%d", len(args)))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.ProjectID != nil {
+		args = append(args, *f.ProjectID)
+		conditions = append(conditions, fmt.Sprintf("project_id = $%d", len(args)))
+		// A project shared with the user lists the to-do list of every member in it
+		conditions[0] = TodoAccess("", "$1", ROLE_VIEWER)
+	}
+	if f.Priority != "" {
+		args = append(args, f.Priority)
+		conditions = append(conditions, fmt.Sprintf("priority = $%d", len(args)))
+	}
+	if f.Overdue != nil {
+		if *f.Overdue {
+			conditions = append(conditions, "due_date < now() AND is_done = FALSE")
+		} else {
+			conditions = append(conditions, "(due_date IS NULL OR due_date >= now() OR is_done)")
+		}
+	}
+	for _, bound := range []struct {
+		due      *time.Time
+		operator string
+	}{{f.DueBefore, "<"}, {f.DueAfter, ">"}} {
+		if bound.due != nil {
+			args = append(args, *bound.due)
+			conditions = append(conditions, fmt.Sprintf("due_date %s $%d", bound.operator, len(args)))
+		}
+	}
+	if f.DueFrom != nil && f.DueUntil != nil {
+		args = append(args, *f.DueFrom, *f.DueUntil)
+		conditions = append(conditions, fmt.Sprintf("due_date >= $%d AND due_date < $%d", len(args)-1, len(args)))
+	}
+	for _, title := range f.TitleContains {
+		args = append(args, escapeLike(title))
+		conditions = append(conditions, fmt.Sprintf("title ILIKE '%%' || $%d || '%%'", len(args)))
+	}
+	if len(f.Tags) > 0 {
+		args = append(args, f.Tags)
+		conditions = append(conditions, fmt.Sprintf("%s @> $%d", TODO_TAGS, len(args)))
+	}
+	for key, value := range f.Metadata {
+		args = append(args, key, value)
+		conditions = append(conditions, fmt.Sprintf("metadata->>$%d = $%d", len(args)-1, len(args)))
+	}
+	if !f.IncludeArchived {
+		conditions = append(conditions, "archived = FALSE")
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Only these keys may be sorted on, mapped to their column
+var sortColumns = map[string]string{
+	"id":           "id",
+	"title":        "title",
+	"due_date":     "due_date",
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"completed_at": "completed_at",
+	"position":     "position",
+	"priority":     PRIORITY_RANK,
+}
+
+// IsSortKey reports whether a list may be sorted on key
+func IsSortKey(key string) bool {
+	_, ok := sortColumns[key]
+	return ok
+}
+
+// Sort orders a list on Key, in the manual order of POST /todo/reorder when Key is empty
+type Sort struct {
+	Key  string
+	Desc bool
+}
+
+// orderBy is the ORDER BY clause of the sort
+func (s Sort) orderBy() string {
+	if s.Key == "" {
+		return MANUAL_ORDER
+	}
+	direction := "ASC"
+	if s.Desc {
+		direction = "DESC"
+	}
+	column := sortColumns[s.Key]
+	if column == "id" {
+		return "id " + direction
+	}
+	// Missing values go last either way, without NULLS LAST which MySQL lacks. Ties keep a stable order for pagination
+	return column + " IS NULL, " + column + " " + direction + ", id"
+}
+
+// TodoQueries reads the lists of to-do lists of the handlers, which TodoRepository leaves out. The lists of GET /todo,
+// its board and views run on every database driver, the other methods need Postgres
+type TodoQueries struct {
+	DB *sql.DB
+	// The database driver of DB, the to-do lists of shared projects are only on Postgres
+	Driver string
+}
+
+// TodoRows reads the to-do lists of a query one at a time, like sql.Rows
+type TodoRows struct {
+	rows *sql.Rows
+	todo Todo
+	err  error
+}
+
+// queryTodoRows runs the query of to-do lists on db
+func queryTodoRows(ctx context.Context, db execQueryRower, query string, args ...interface{}) (*TodoRows, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &TodoRows{rows: rows}, nil
+}
+
+// Next reads the next to-do list, false once there is none or reading it failed
+func (t *TodoRows) Next() bool {
+	if t.err != nil || !t.rows.Next() {
+		return false
+	}
+	t.todo = Todo{}
+	t.err = scanTodo(t.rows, &t.todo)
+	return t.err == nil
+}
+
+// Todo is the to-do list read by Next
+func (t *TodoRows) Todo() Todo {
+	return t.todo
+}
+
+// Err is the error which stopped Next, nil when all the to-do lists were read
+func (t *TodoRows) Err() error {
+	if t.err != nil {
+		return t.err
+	}
+	return t.rows.Err()
+}
+
+func (t *TodoRows) Close() error {
+	return t.rows.Close()
+}
+
+// collect reads the remaining to-do lists into a slice and closes the rows
+func (t *TodoRows) collect() ([]Todo, error) {
+	defer t.Close()
+
+	todos := make([]Todo, 0)
+	for t.Next() {
+		todos = append(todos, t.Todo())
+	}
+	return todos, t.Err()
+}
+
+// queryTodos reads the to-do list selected or returned by query on db
+func queryTodos(ctx context.Context, db execQueryRower, query string, args ...interface{}) ([]Todo, error) {
+	rows, err := queryTodoRows(ctx, db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows.collect()
+}
+
+// Select reads every to-do list of the filter in the order of sort, it isn't paginated
+func (q *TodoQueries) Select(ctx context.Context, filter ListFilter, sort Sort) (*TodoRows, error) {
+	where, args := filter.where()
+	return queryTodoRows(ctx, q.DB, "SELECT "+todoColumnsOn(q.Driver)+" FROM todo"+where+" ORDER BY "+sort.orderBy(), args...)
+}
+
+// List returns a page of the to-do lists of the filter in the order of sort and how many there are in all
+func (q *TodoQueries) List(ctx context.Context, filter ListFilter, sort Sort, limit, offset int) ([]Todo, int, error) {
+	where, args := filter.where()
+	return q.page(ctx, where, sort.orderBy(), args, limit, offset)
+}
+
+// page counts the to-do lists of the WHERE clause and reads the page of them
+func (q *TodoQueries) page(ctx context.Context, where, orderBy string, args []interface{}, limit, offset int) ([]Todo, int, error) {
+	var total int
+	if err := q.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM todo"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM todo%s ORDER BY %s LIMIT $%d OFFSET $%d", todoColumnsOn(q.Driver), where, orderBy, len(args)+1, len(args)+2)
+	todos, err := queryTodos(ctx, q.DB, query, append(args, limit, offset)...)
+	return todos, total, err
+}
+
+// Completed returns a page of the to-do lists the user sees which were completed within [from, to), latest first
+func (q *TodoQueries) Completed(ctx context.Context, userID int, from, to time.Time, limit, offset int) ([]Todo, error) {
+	return queryTodos(ctx, q.DB,
+		"SELECT "+TODO_COLUMNS+" FROM todo WHERE completed_at >= $1 AND completed_at < $2 AND "+TodoAccess("", "$5", ROLE_VIEWER)+" AND deleted_at IS NULL ORDER BY completed_at DESC, id LIMIT $3 OFFSET $4",
+		from, to, limit, offset, userID,
+	)
+}
+
+// Export reads the to-do lists of the user which aren't deleted, by id
+func (q *TodoQueries) Export(ctx context.Context, userID int) (*TodoRows, error) {
+	return queryTodoRows(ctx, q.DB, "SELECT "+todoColumnsOn(q.Driver)+" FROM todo WHERE user_id = $1 AND deleted_at IS NULL ORDER BY id", userID)
+}
+
+// OwnFilter selects among the to-do lists the user owns, unlike ListFilter without the ones of the projects shared
+// with the user. A nil field matches every to-do list, archived ones are left out unless IncludeArchived
+type OwnFilter struct {
+	ID              *int
+	IsDone          *bool
+	ProjectID       *int
+	Tag             *string
+	IncludeArchived bool
+}
+
+// where is the WHERE clause of the filter, with the arguments of its placeholders
+func (f OwnFilter) where(userID int) (string, []interface{}) {
+	where := " WHERE user_id = $1 AND deleted_at IS NULL"
+	args := []interface{}{userID}
+	if !f.IncludeArchived {
+		where += " AND NOT archived"
+	}
+	if f.ID != nil {
+		args = append(args, *f.ID)
+		where += fmt.Sprintf(" AND id = $%d", len(args))
+	}
+	if f.IsDone != nil {
+		args = append(args, *f.IsDone)
+		where += fmt.Sprintf(" AND is_done = $%d", len(args))
+	}
+	if f.ProjectID != nil {
+		args = append(args, *f.ProjectID)
+		where += fmt.Sprintf(" AND project_id = $%d", len(args))
+	}
+	if f.Tag != nil {
+		args = append(args, *f.Tag)
+		where += fmt.Sprintf(" AND $%d = ANY(%s)", len(args), TODO_TAGS)
+	}
+	return where, args
+}
+
+// Own returns a page of the to-do lists of the filter by id
+func (q *TodoQueries) Own(ctx context.Context, userID int, filter OwnFilter, limit, offset int) ([]Todo, error) {
+	where, args := filter.where(userID)
+	query := fmt.Sprintf("SELECT %s FROM todo%s ORDER BY id LIMIT $%d OFFSET $%d", todoColumnsOn(q.Driver), where, len(args)+1, len(args)+2)
+	return queryTodos(ctx, q.DB, query, append(args, limit, offset)...)
+}
+
+// OwnRows reads every to-do list of the filter by id, it isn't paginated
+func (q *TodoQueries) OwnRows(ctx context.Context, userID int, filter OwnFilter) (*TodoRows, error) {
+	where, args := filter.where(userID)
+	return queryTodoRows(ctx, q.DB, "SELECT "+todoColumnsOn(q.Driver)+" FROM todo"+where+" ORDER BY id", args...)
+}
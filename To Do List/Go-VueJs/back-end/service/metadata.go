@@ -0,0 +1,61 @@
+package service
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Maximum size of the encoded metadata of a to-do list
+const MAX_METADATA_SIZE = 4096
+
+// Metadata is a flat object of client defined values stored as JSONB
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, m)
+	case string:
+		return json.Unmarshal([]byte(data), m)
+	case nil:
+		*m = nil
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Metadata", src)
+}
+
+// validateMetadata only allows string, number, boolean and null values within the size limit
+func validateMetadata(m Metadata) error {
+	var errs FieldErrors
+	for key, value := range m {
+		switch value.(type) {
+		case string, float64, bool, nil:
+		default:
+			errs = append(errs, NewFieldError("metadata."+key, RULE_TYPE, "metadata %q must not be an object or array", key))
+		}
+	}
+	if len(errs) > 0 {
+		// Map order, the client gets the same list on every try
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return errs
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(data) > MAX_METADATA_SIZE {
+		return NewFieldError("metadata", RULE_MAX_SIZE, "metadata is too large")
+	}
+	return nil
+}
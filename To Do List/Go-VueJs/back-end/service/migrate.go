@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Migrations shipped in the binary, so it runs outside the source tree. SQLite and MySQL have sets of their own
+//
+//go:embed schema/*.sql schema_sqlite/*.sql schema_mysql/*.sql
+var schemaFS embed.FS
+
+// DirtyError is a migration which failed halfway and left the database dirty
+type DirtyError struct {
+	Version uint
+}
+
+func (e DirtyError) Error() string {
+	return fmt.Sprintf("migration %d failed halfway and left the database dirty", e.Version)
+}
+
+// openMigrations reads the migrations in dir, the ones of the database driver embedded in the binary when it is empty
+func openMigrations(dbDriver, dir string) (source.Driver, error) {
+	var fsys fs.FS = schemaFS
+	path := "schema"
+	if dbDriver != DB_DRIVER_POSTGRES {
+		path = "schema_" + dbDriver
+	}
+	if dir != "" {
+		fsys, path = os.DirFS(dir), "."
+	}
+	slog.Debug("Reading migrations", "dir", dir, "embedded", dir == "")
+	migrationSource, err := iofs.New(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations in %q: %w", dir, err)
+	}
+	return migrationSource, nil
+}
+
+// NewMigrate reads the migrations in dir for db, which is connected to the database of databaseURL
+func NewMigrate(db *sql.DB, dbDriver, databaseURL, dir string) (*migrate.Migrate, source.Driver, error) {
+	migrationSource, err := openMigrations(dbDriver, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m *migrate.Migrate
+	switch dbDriver {
+	case DB_DRIVER_SQLITE:
+		m, err = newSQLiteMigrate(databaseURL, migrationSource)
+	case DB_DRIVER_MYSQL:
+		m, err = newMySQLMigrate(databaseURL, migrationSource)
+	default:
+		m, err = newPostgresMigrate(db, migrationSource)
+	}
+	if err != nil {
+		migrationSource.Close()
+		return nil, nil, err
+	}
+	return m, migrationSource, nil
+}
+
+// newPostgresMigrate migrates the Postgres database of db
+func newPostgresMigrate(db *sql.DB, migrationSource source.Driver) (*migrate.Migrate, error) {
+	// Migrasi database on a connection of its own without the statement timeout, e.g. building an index may take longer
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("preparing migrations: %w", err)
+	}
+	if _, err = conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("preparing migrations: %w", err)
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("preparing migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance(
+		"iofs",
+		migrationSource,
+		"postgres",
+		driver,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+	return m, nil
+}
+
+// ApplyMigrations applies the pending migrations in dir and returns the version of the database. A dirty database
+// fails with a DirtyError unless force
+func ApplyMigrations(db *sql.DB, dbDriver, databaseURL, dir string, force bool) (uint, error) {
+	m, migrationSource, err := NewMigrate(db, dbDriver, databaseURL, dir)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Close()
+
+	// A dirty version is a migration which failed halfway. Our migrations are idempotent, so it is retried by forcing
+	// the version before it, but only when asked to since the failure may need a manual fix first
+	if version, dirty, err := m.Version(); err != nil && err != migrate.ErrNilVersion {
+		return 0, fmt.Errorf("reading the migration version: %w", err)
+	} else if dirty {
+		if !force {
+			return 0, DirtyError{version}
+		}
+		previous, err := previousVersion(migrationSource, version)
+		if err != nil {
+			return 0, err
+		}
+		slog.Warn("Migration is dirty, forcing the version before it to retry it", "version", version, "forced", previous)
+		if err := m.Force(previous); err != nil {
+			return 0, fmt.Errorf("forcing migration version %d: %w", previous, err)
+		}
+	}
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		version, dirty, _ := m.Version()
+		return 0, fmt.Errorf("applying migrations, stopped at version %d (dirty %t): %w", version, dirty, err)
+	}
+	version, _, err := MigrationVersion(m)
+	return version, err
+}
+
+// previousVersion is the migration before version, -1 (no migration) for the first one
+func previousVersion(migrationSource source.Driver, version uint) (int, error) {
+	previous, err := migrationSource.Prev(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("finding the migration before version %d: %w", version, err)
+	}
+	return int(previous), nil
+}
+
+// RollbackMigrations reverts the last steps migrations in dir, or all of them when steps is zero. The version of the
+// database is -1 once no migration is applied
+func RollbackMigrations(db *sql.DB, dbDriver, databaseURL, dir string, steps int) (version int, dirty bool, err error) {
+	m, _, err := NewMigrate(db, dbDriver, databaseURL, dir)
+	if err != nil {
+		return 0, false, err
+	}
+	defer m.Close()
+	if steps == 0 {
+		err = m.Down()
+	} else {
+		err = m.Steps(-steps)
+	}
+	if err != nil && err != migrate.ErrNoChange {
+		return 0, false, fmt.Errorf("rolling back migrations: %w", err)
+	}
+
+	current, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return -1, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("reading the migration version: %w", err)
+	}
+	return int(current), dirty, nil
+}
+
+// MigrationVersion is the version of the database, zero without migrations
+func MigrationVersion(m *migrate.Migrate) (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return 0, false, fmt.Errorf("reading the migration version: %w", err)
+	}
+	return version, dirty, nil
+}
+
+// LatestVersion is the last migration of the source, zero without migrations
+func LatestVersion(migrationSource source.Driver) (uint, error) {
+	version, err := migrationSource.First()
+	for err == nil {
+		var next uint
+		if next, err = migrationSource.Next(version); err == nil {
+			version = next
+		}
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("reading migrations: %w", err)
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion is the last migration of the database driver embedded in the binary
+func LatestSchemaVersion(dbDriver string) (uint, error) {
+	migrationSource, err := openMigrations(dbDriver, "")
+	if err != nil {
+		return 0, err
+	}
+	defer migrationSource.Close()
+	return LatestVersion(migrationSource)
+}
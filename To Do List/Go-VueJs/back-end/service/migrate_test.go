@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+// testUserID is the user every request of serve is logged in as
+const testUserID = 1
+
+func TestEmbeddedMigrations(t *testing.T) {
+	for _, dbDriver := range []string{DB_DRIVER_POSTGRES, DB_DRIVER_SQLITE, DB_DRIVER_MYSQL} {
+		t.Run(dbDriver, func(t *testing.T) {
+			dir := "schema"
+			if dbDriver != DB_DRIVER_POSTGRES {
+				dir += "_" + dbDriver
+			}
+			migrationSource, err := openMigrations(dbDriver, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer migrationSource.Close()
+
+			version, err := migrationSource.First()
+			for count := 1; ; count++ {
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, read := range []func(uint) (io.ReadCloser, string, error){migrationSource.ReadUp, migrationSource.ReadDown} {
+					body, _, err := read(version)
+					if err != nil {
+						t.Fatalf("migration %d: %v", version, err)
+					}
+					body.Close()
+				}
+
+				previous := version
+				if version, err = migrationSource.Next(version); errors.Is(err, fs.ErrNotExist) {
+					if entries, _ := os.ReadDir(dir); len(entries) != 2*count {
+						t.Errorf("%d migrations embedded, %s has %d files", count, dir, len(entries))
+					}
+					if latest, err := LatestSchemaVersion(dbDriver); err != nil || latest != previous {
+						t.Errorf("latest version = %d, %v, want %d", latest, err, previous)
+					}
+					return
+				}
+			}
+		})
+	}
+}
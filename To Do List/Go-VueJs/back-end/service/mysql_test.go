@@ -0,0 +1,25 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMySQLConfig(t *testing.T) {
+	config, err := MySQLConfig("mysql://todo:p%40ss@db/todo?tls=skip-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "todo" || config.Passwd != "p@ss" || config.Addr != "db:3306" || config.DBName != "todo" || config.TLSConfig != "skip-verify" {
+		t.Errorf("config = %+v", config)
+	}
+	if !config.ParseTime || config.Loc != time.UTC || !config.InterpolateParams || config.MultiStatements {
+		t.Errorf("config = %+v, want times in UTC and interpolated arguments", config)
+	}
+
+	for _, databaseURL := range []string{"", "postgres://db/todo", "mysql://db", "mysql:///todo"} {
+		if _, err := MySQLConfig(databaseURL); err == nil {
+			t.Errorf("%q accepted", databaseURL)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OAuthIdentity is the account a provider vouches for
+type OAuthIdentity struct {
+	// Subject is the stable id of the account at the provider, the username and email may change
+	Subject  string
+	Username string
+	// Email is only set when the provider verified it
+	Email string
+}
+
+// ErrIdentityLinked is the account of a provider which a user links while it's linked to another user
+var ErrIdentityLinked = errors.New("the account is linked to another user")
+
+// OAuthUser returns the local user of the account: the one it is linked to, else linkUserID signed in to link it,
+// else the only user whose email is verified to be its email, which it gets linked to, else a new user without a
+// password. An email given at registration isn't verified, it could be anyone's
+func (u *UserRepository) OAuthUser(ctx context.Context, provider string, identity OAuthIdentity, linkUserID int) (int, error) {
+	var userID int
+	err := RunInTx(ctx, u.DB, nil, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT user_id FROM user_identity WHERE provider = $1 AND subject = $2", provider, identity.Subject).Scan(&userID)
+		if err == nil && linkUserID != 0 && userID != linkUserID {
+			return ErrIdentityLinked
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+		userID = linkUserID
+
+		if userID == 0 && identity.Email != "" {
+			rows, err := tx.QueryContext(ctx, "SELECT id FROM users WHERE email = $1 AND email_verified ORDER BY id LIMIT 2", identity.Email)
+			if err != nil {
+				return err
+			}
+			var ids []int
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return err
+				}
+				ids = append(ids, id)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			// Several users with the email can't tell which one is the account's
+			if len(ids) == 1 {
+				userID = ids[0]
+			}
+		}
+
+		if userID == 0 {
+			username, err := freeUsername(ctx, tx, OAuthUsername(identity.Username, provider))
+			if err != nil {
+				return err
+			}
+			// An empty hash matches no password, the user signs in with the provider only. The provider verified the email
+			email := sql.NullString{String: identity.Email, Valid: identity.Email != ""}
+			if userID, err = insertID(ctx, tx, u.Driver, "INSERT INTO users(username, password_hash, email, email_verified) VALUES($1, $2, $3, $4)", username, "", email, email.Valid); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO user_identity(provider, subject, user_id) VALUES($1, $2, $3)", provider, identity.Subject, userID)
+		return err
+	})
+	return userID, err
+}
+
+// OAuthUsername turns the name at the provider into a valid username, leaving room for the suffix of freeUsername
+func OAuthUsername(name, provider string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if limit := MAX_USERNAME_LENGTH - 5; utf8.RuneCountInString(name) > limit {
+		name = string([]rune(name)[:limit])
+	}
+	if utf8.RuneCountInString(name) < MIN_USERNAME_LENGTH {
+		name = strings.TrimPrefix(name+"-"+provider, "-")
+	}
+	return name
+}
+
+// freeUsername is the username, or it with a random suffix when it is taken
+func freeUsername(ctx context.Context, tx *sql.Tx, username string) (string, error) {
+	candidate := username
+	for {
+		var taken bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", candidate).Scan(&taken); err != nil || !taken {
+			return candidate, err
+		}
+		suffix := make([]byte, 2)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = username + "-" + hex.EncodeToString(suffix)
+	}
+}
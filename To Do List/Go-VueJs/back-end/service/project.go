@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+var ErrUnknownProject = FieldError{Field: "project_id", Rule: RULE_EXISTS, Message: "project_id is not a project of the user"}
+
+// Project groups to-do list of a user
+type Project struct {
+	ID        int        `json:"id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// Only a project shared with the user has them, the username of its owner and the role of the user
+	Owner string `json:"owner,omitempty"`
+	Role  string `json:"role,omitempty"`
+}
+
+// ProjectRepository stores the projects of the users and who they are shared with
+// The methods return ErrNotFound for a project the user may not see or change
+type ProjectRepository struct {
+	DB *sql.DB
+}
+
+// List returns the projects the user owns
+func (p *ProjectRepository) List(ctx context.Context, userID int) ([]Project, error) {
+	rows, err := p.DB.QueryContext(ctx, "SELECT id, name, created_at FROM project WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make([]Project, 0)
+	for rows.Next() {
+		var project Project
+		if err := rows.Scan(&project.ID, &project.Name, &project.CreatedAt); err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// Get returns a project the user owns or is a member of
+func (p *ProjectRepository) Get(ctx context.Context, userID, projectID int) (Project, error) {
+	var project Project
+	row := p.DB.QueryRowContext(ctx, "SELECT id, name, created_at FROM project WHERE id = $1 AND "+ProjectAccess("$2", ROLE_VIEWER), projectID, userID)
+	if err := row.Scan(&project.ID, &project.Name, &project.CreatedAt); err == sql.ErrNoRows {
+		return project, ErrNotFound
+	} else if err != nil {
+		return project, err
+	}
+	return project, nil
+}
+
+// GetOwned returns a project the user owns, unlike Get not one the user is a member of
+func (p *ProjectRepository) GetOwned(ctx context.Context, userID, projectID int) (Project, error) {
+	var project Project
+	row := p.DB.QueryRowContext(ctx, "SELECT id, name, created_at FROM project WHERE id = $1 AND user_id = $2", projectID, userID)
+	if err := row.Scan(&project.ID, &project.Name, &project.CreatedAt); err == sql.ErrNoRows {
+		return project, ErrNotFound
+	} else if err != nil {
+		return project, err
+	}
+	return project, nil
+}
+
+// Create stores a new project of the user and fills in its id and creation time
+func (p *ProjectRepository) Create(ctx context.Context, userID int, project *Project) error {
+	return p.DB.QueryRowContext(ctx, "INSERT INTO project(user_id, name) VALUES($1,$2) RETURNING id, created_at", userID, project.Name).Scan(&project.ID, &project.CreatedAt)
+}
+
+// Rename renames a project the user owns and fills in its id and creation time
+func (p *ProjectRepository) Rename(ctx context.Context, userID, projectID int, project *Project) error {
+	row := p.DB.QueryRowContext(ctx, "UPDATE project SET name = $3 WHERE id = $1 AND user_id = $2 RETURNING id, created_at", projectID, userID, project.Name)
+	if err := row.Scan(&project.ID, &project.CreatedAt); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete removes a project the user owns, the foreign key leaves its to-do list without a project
+func (p *ProjectRepository) Delete(ctx context.Context, userID, projectID int) (Project, error) {
+	var project Project
+	row := p.DB.QueryRowContext(ctx, "DELETE FROM project WHERE id = $1 AND user_id = $2 RETURNING id, name, created_at", projectID, userID)
+	if err := row.Scan(&project.ID, &project.Name, &project.CreatedAt); err == sql.ErrNoRows {
+		return project, ErrNotFound
+	} else if err != nil {
+		return project, err
+	}
+	return project, nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	MAX_FILTER_DEPTH      = 5
+	MAX_FILTER_CONDITIONS = 50
+)
+
+// Filter is either a group (and/or of filters) or a single field condition
+type Filter struct {
+	And   []Filter    `json:"and,omitempty"`
+	Or    []Filter    `json:"or,omitempty"`
+	Field string      `json:"field,omitempty"`
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Kind of value a field accepts
+const (
+	FIELD_INT = iota
+	FIELD_STRING
+	FIELD_BOOL
+	FIELD_TIME
+)
+
+// Only these fields may be filtered on, mapped to their column
+var filterFields = map[string]struct {
+	column string
+	kind   int
+}{
+	"id":           {"id", FIELD_INT},
+	"title":        {"title", FIELD_STRING},
+	"description":  {"description", FIELD_STRING},
+	"is_done":      {"is_done", FIELD_BOOL},
+	"archived":     {"archived", FIELD_BOOL},
+	"source":       {"source", FIELD_STRING},
+	"priority":     {"priority", FIELD_STRING},
+	"status":       {"status", FIELD_STRING},
+	"completed_at": {"completed_at", FIELD_TIME},
+	"due_date":     {"due_date", FIELD_TIME},
+}
+
+// Only these operators may be used, mapped to their SQL
+var filterOps = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+}
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// escapeLike makes % and _ match literally in a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// buildFilter translates the filter into a parameterized condition, appending its values to args
+func buildFilter(filter Filter, args *[]interface{}, depth int, conditions *int) (string, error) {
+	if depth > MAX_FILTER_DEPTH {
+		return "", ErrInvalidFilter
+	}
+
+	if len(filter.And) > 0 || len(filter.Or) > 0 {
+		if filter.Field != "" || (len(filter.And) > 0 && len(filter.Or) > 0) {
+			return "", ErrInvalidFilter
+		}
+		group, joiner := filter.And, " AND "
+		if len(filter.Or) > 0 {
+			group, joiner = filter.Or, " OR "
+		}
+
+		parts := make([]string, 0, len(group))
+		for _, child := range group {
+			part, err := buildFilter(child, args, depth+1, conditions)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return "(" + strings.Join(parts, joiner) + ")", nil
+	}
+
+	*conditions++
+	if *conditions > MAX_FILTER_CONDITIONS {
+		return "", ErrInvalidFilter
+	}
+
+	field, ok := filterFields[filter.Field]
+	if !ok {
+		return "", ErrInvalidFilter
+	}
+
+	switch filter.Op {
+	case "is_null":
+		return field.column + " IS NULL", nil
+	case "not_null":
+		return field.column + " IS NOT NULL", nil
+	case "contains":
+		value, ok := filter.Value.(string)
+		if field.kind != FIELD_STRING || !ok {
+			return "", ErrInvalidFilter
+		}
+		*args = append(*args, escapeLike(value))
+		return fmt.Sprintf("%s ILIKE '%%' || $%d || '%%'", field.column, len(*args)), nil
+	}
+
+	op, ok := filterOps[filter.Op]
+	if !ok {
+		return "", ErrInvalidFilter
+	}
+	// Booleans and strings can only be compared for equality
+	if (field.kind == FIELD_BOOL || field.kind == FIELD_STRING) && op != "=" && op != "<>" {
+		return "", ErrInvalidFilter
+	}
+
+	value, err := filterValue(field.kind, filter.Value)
+	if err != nil {
+		return "", err
+	}
+	*args = append(*args, value)
+	return fmt.Sprintf("%s %s $%d", field.column, op, len(*args)), nil
+}
+
+// filterValue checks the JSON value against the kind of the field
+func filterValue(kind int, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		if kind == FIELD_INT && v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case string:
+		if kind == FIELD_STRING {
+			return v, nil
+		}
+		if kind == FIELD_TIME {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t, nil
+			}
+		}
+	case bool:
+		if kind == FIELD_BOOL {
+			return v, nil
+		}
+	}
+	return nil, ErrInvalidFilter
+}
+
+// buildQuery returns the SELECT for the to-do list of the user matching the filter
+func buildQuery(filter Filter, userID int) (string, []interface{}, error) {
+	var (
+		args       []interface{}
+		conditions int
+	)
+	where, err := buildFilter(filter, &args, 0, &conditions)
+	if err != nil {
+		return "", nil, err
+	}
+	args = append(args, userID)
+	return fmt.Sprintf("SELECT %s FROM todo WHERE user_id = $%d AND deleted_at IS NULL AND (%s) ORDER BY id", TODO_COLUMNS, len(args), where), args, nil
+}
+
+// Query returns the to-do lists of the user matching the filter, ErrInvalidFilter when it can't be translated
+func (q *TodoQueries) Query(ctx context.Context, userID int, filter Filter) ([]Todo, error) {
+	query, args, err := buildQuery(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+	return queryTodos(ctx, q.DB, query, args...)
+}
+
+type QueryPlan struct {
+	EstimatedRows float64 `json:"estimated_rows"`
+	TotalCost     float64 `json:"total_cost"`
+	UsesIndex     bool    `json:"uses_index"`
+}
+
+// Subset of a node of the EXPLAIN (FORMAT JSON) output
+type planNode struct {
+	NodeType  string     `json:"Node Type"`
+	PlanRows  float64    `json:"Plan Rows"`
+	TotalCost float64    `json:"Total Cost"`
+	Plans     []planNode `json:"Plans"`
+}
+
+func (node planNode) usesIndex() bool {
+	if strings.Contains(node.NodeType, "Index") {
+		return true
+	}
+	for _, child := range node.Plans {
+		if child.usesIndex() {
+			return true
+		}
+	}
+	return false
+}
+
+// Explain estimates the cost of the query of the filter without running it, ErrInvalidFilter when it can't be
+// translated
+func (q *TodoQueries) Explain(ctx context.Context, userID int, filter Filter) (QueryPlan, error) {
+	query, args, err := buildQuery(filter, userID)
+	if err != nil {
+		return QueryPlan{}, err
+	}
+
+	var output []byte
+	if err := q.DB.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&output); err != nil {
+		return QueryPlan{}, err
+	}
+
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(output, &plans); err != nil {
+		return QueryPlan{}, err
+	} else if len(plans) == 0 {
+		return QueryPlan{}, errors.New("EXPLAIN returned no plan")
+	}
+
+	// Only the estimates are returned, not the plan itself
+	plan := plans[0].Plan
+	return QueryPlan{
+		EstimatedRows: plan.PlanRows,
+		TotalCost:     plan.TotalCost,
+		UsesIndex:     plan.usesIndex(),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	FREQUENCY_DAILY   = "daily"
+	FREQUENCY_WEEKLY  = "weekly"
+	FREQUENCY_MONTHLY = "monthly"
+)
+
+const (
+	MAX_RECURRENCE_INTERVAL = 365
+)
+
+type Recurrence struct {
+	Frequency string `json:"frequency"`
+	Interval  int    `json:"interval,omitempty"`
+}
+
+func (rec *Recurrence) Validate() error {
+	var errs FieldErrors
+	switch rec.Frequency {
+	case FREQUENCY_DAILY, FREQUENCY_WEEKLY, FREQUENCY_MONTHLY:
+	default:
+		errs = append(errs, NewFieldError("recurrence.frequency", RULE_ONE_OF, "frequency must be daily, weekly or monthly"))
+	}
+	if rec.Interval == 0 {
+		rec.Interval = 1
+	}
+	if rec.Interval < 0 || rec.Interval > MAX_RECURRENCE_INTERVAL {
+		errs = append(errs, NewFieldError("recurrence.interval", RULE_RANGE, "interval is out of range"))
+	}
+	return errs.Err()
+}
+
+func (rec Recurrence) Value() (driver.Value, error) {
+	data, err := json.Marshal(rec)
+	return string(data), err
+}
+
+func (rec *Recurrence) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, rec)
+	case string:
+		return json.Unmarshal([]byte(data), rec)
+	}
+	return fmt.Errorf("cannot scan %T into Recurrence", src)
+}
+
+// Occurrence returns the n-th occurrence after start, n = 0 being start itself
+func (rec Recurrence) Occurrence(start time.Time, n int) time.Time {
+	switch rec.Frequency {
+	case FREQUENCY_DAILY:
+		return start.AddDate(0, 0, n*rec.Interval)
+	case FREQUENCY_WEEKLY:
+		return start.AddDate(0, 0, 7*n*rec.Interval)
+	}
+
+	// Stick to the last day of shorter months instead of overflowing into the next one
+	month := time.Date(start.Year(), start.Month()+time.Month(n*rec.Interval), 1, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	day := start.Day()
+	if last := month.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return month.AddDate(0, 0, day-1)
+}
+
+// nextDueDate is when the next occurrence of a recurring to-do list is due, counted from its due date or else its completion
+func nextDueDate(todo Todo) *time.Time {
+	if todo.Recurrence == nil {
+		return nil
+	}
+	start := todo.DueDate
+	if start == nil {
+		start = todo.CompletedAt
+	}
+	if start == nil {
+		return nil
+	}
+	next := todo.Recurrence.Occurrence(*start, 1)
+	return &next
+}
+
+// Occurrence is a to-do list created by the recurrence of another one, with the user it belongs to
+type Occurrence struct {
+	UserID int
+	Todo   Todo
+}
+
+// CreateOccurrences copies every done recurring to-do list, not yet copied, with the next due date
+func (s *TodoStore) CreateOccurrences(ctx context.Context) (created []Occurrence, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		// Marking the row as recurred in the same transaction makes sure it is copied only once
+		done, err := queryTodos(ctx, tx, "UPDATE todo SET recurred = TRUE WHERE recurrence IS NOT NULL AND is_done AND NOT recurred AND deleted_at IS NULL RETURNING "+TODO_COLUMNS)
+		if err != nil {
+			return err
+		}
+
+		created = make([]Occurrence, 0, len(done))
+		for _, todo := range done {
+			var next Occurrence
+			row := tx.QueryRowContext(ctx,
+				"INSERT INTO todo(title, description, source, metadata, priority, user_id, project_id, recurrence, due_date) SELECT title, description, source, metadata, priority, user_id, project_id, recurrence, $2 FROM todo WHERE id = $1 RETURNING user_id, "+TODO_COLUMNS,
+				todo.ID, nextDueDate(todo),
+			)
+			if err := scanTodo(prefixScanner{row, []interface{}{&next.UserID}}, &next.Todo); err != nil {
+				return err
+			}
+			if len(todo.Tags) > 0 {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO todo_tag(todo_id, tag_id) SELECT $1, tag_id FROM todo_tag WHERE todo_id = $2", next.Todo.ID, todo.ID); err != nil {
+					return err
+				}
+				next.Todo.Tags = todo.Tags
+			}
+			if err := recordHistory(ctx, tx, 0, EVENT_CREATED, nil, next.Todo); err != nil {
+				return err
+			}
+			created = append(created, next)
+		}
+		return nil
+	})
+	return created, err
+}
+
+// prefixScanner reads the columns selected in front of the columns of a to-do list into prefix
+type prefixScanner struct {
+	Scanner
+	prefix []interface{}
+}
+
+func (s prefixScanner) Scan(dest ...interface{}) error {
+	return s.Scanner.Scan(append(s.prefix, dest...)...)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDueDate(t *testing.T) {
+	due := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+	completed := time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		todo Todo
+		want *time.Time
+	}{
+		{name: "not recurring", todo: Todo{DueDate: &due}},
+		{name: "from due date", todo: Todo{DueDate: &due, CompletedAt: &completed, Recurrence: &Recurrence{Frequency: FREQUENCY_MONTHLY, Interval: 1}}, want: timePtr(time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC))},
+		{name: "from completion", todo: Todo{CompletedAt: &completed, Recurrence: &Recurrence{Frequency: FREQUENCY_WEEKLY, Interval: 2}}, want: timePtr(completed.AddDate(0, 0, 14))},
+		{name: "neither", todo: Todo{Recurrence: &Recurrence{Frequency: FREQUENCY_DAILY, Interval: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextDueDate(tt.todo)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("nextDueDate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Reminder is a to-do list whose reminder time has arrived, for its owner
+type Reminder struct {
+	UserID   int
+	Username string
+	Email    string
+	Todo     Todo
+}
+
+// SendDueReminders passes the reminders which are due and not sent yet to notify, at most limit, recording each one
+// notify sent. The rows stay locked until commit and other instances skip them, so a reminder is sent once
+func (s *TodoStore) SendDueReminders(ctx context.Context, limit int, notify func(reminder Reminder) error) (sent int, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			"SELECT user_id, u.username, COALESCE(u.email, ''), "+TODO_COLUMNS+" FROM todo, LATERAL (SELECT username, email FROM users WHERE users.id = todo.user_id) u WHERE remind_at <= now() AND reminded_at IS NULL AND NOT is_done AND deleted_at IS NULL AND user_id IS NOT NULL ORDER BY remind_at LIMIT $1 FOR UPDATE OF todo SKIP LOCKED",
+			limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var reminders []Reminder
+		for rows.Next() {
+			var reminder Reminder
+			if err := scanTodo(prefixScanner{rows, []interface{}{&reminder.UserID, &reminder.Username, &reminder.Email}}, &reminder.Todo); err != nil {
+				return err
+			}
+			reminders = append(reminders, reminder)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, reminder := range reminders {
+			if notify(reminder) != nil {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE todo SET reminded_at = now() WHERE id = $1", reminder.Todo.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
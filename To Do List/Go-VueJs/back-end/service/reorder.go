@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// MANUAL_ORDER sorts by the position of POST /todo/reorder, the to-do list never reordered come last by id
+const MANUAL_ORDER = "position IS NULL, position, id"
+
+// Reorder renumbers the to-do lists the user may edit which aren't deleted in the order which arrange returns for their
+// current manual order, an error of arrange changes nothing
+func (s *TodoStore) Reorder(ctx context.Context, userID int, arrange func(current []int) ([]int, error)) (order []int, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		// Locking the rows orders concurrent reorders of the user one after another
+		rows, err := tx.QueryContext(ctx, "SELECT id FROM todo WHERE "+TodoAccess("", "$1", ROLE_EDITOR)+" AND deleted_at IS NULL ORDER BY "+MANUAL_ORDER+" FOR UPDATE", userID)
+		if err != nil {
+			return err
+		}
+		var current []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			current = append(current, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if order, err = arrange(current); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE todo SET position = o.position FROM unnest($2::int[]) WITH ORDINALITY AS o(id, position) WHERE todo.id = o.id AND "+TodoAccess("todo.", "$1", ROLE_EDITOR),
+			userID, pq.Array(order),
+		)
+		return err
+	})
+	return order, err
+}
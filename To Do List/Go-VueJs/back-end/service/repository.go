@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// TodoRepository stores the to-do lists of the users, the rules around them are in TodoService
+// The methods return ErrTodoNotFound for a to-do list which doesn't belong to the user or is deleted
+type TodoRepository interface {
+	Get(ctx context.Context, userID, todoID int) (Todo, error)
+
+	// Create stores a new to-do list of the user and fills in what the storage sets, e.g. its id
+	Create(ctx context.Context, userID int, todo *Todo) error
+
+	// Update passes the stored to-do list to change, which it can't change concurrently meanwhile, and stores what change returns
+	// A non-zero version must match the stored one, otherwise ErrVersionConflict is returned
+	Update(ctx context.Context, userID, todoID, version int, change func(existing Todo) (Todo, error)) (existing, updated Todo, err error)
+
+	// Delete moves the to-do list to the trash
+	Delete(ctx context.Context, userID, todoID int) (Todo, error)
+
+	// Restore brings the to-do list back from the trash, one which isn't deleted is returned as it is
+	Restore(ctx context.Context, userID, todoID int) (Todo, error)
+
+	// HasProject reports whether the project belongs to the user
+	HasProject(ctx context.Context, userID, projectID int) (bool, error)
+
+	// Audience maps each to-do list to the other users who see it, its owner and the owner and members of its project
+	Audience(ctx context.Context, userID int, todoIDs []int) (map[int][]int, error)
+}
+
+// postgresTodoRepository stores the to-do lists in the todo table and records every change in todo_history with it
+type postgresTodoRepository struct {
+	db *sql.DB
+	// Set when the caller owns the transaction, e.g. a batch, the methods then run within it and leave the commit to the caller
+	tx *sql.Tx
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (p *postgresTodoRepository) conn() queryRower {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.db
+}
+
+func (p *postgresTodoRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return RunInTx(ctx, p.db, p.tx, fn)
+}
+
+// RunInTx runs fn within tx, or within a transaction of its own on db which is committed when fn succeeds
+func RunInTx(ctx context.Context, db *sql.DB, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	if tx != nil {
+		return fn(tx)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *postgresTodoRepository) Get(ctx context.Context, userID, todoID int) (Todo, error) {
+	var todo Todo
+	err := scanTodo(p.conn().QueryRowContext(ctx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE id=$1 AND "+TodoAccess("", "$2", ROLE_VIEWER)+" AND deleted_at IS NULL", todoID, userID), &todo)
+	if err == sql.ErrNoRows {
+		return todo, ErrTodoNotFound
+	}
+	return todo, err
+}
+
+func (p *postgresTodoRepository) Create(ctx context.Context, userID int, todo *Todo) error {
+	return p.withTx(ctx, func(tx *sql.Tx) error {
+		tags := todo.Tags
+		row := tx.QueryRowContext(ctx, "INSERT INTO todo(title, description, source, metadata, due_date, priority, user_id, project_id, recurrence, remind_at) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "+TODO_COLUMNS, todo.Title, todo.Description, todo.Source, todo.Metadata, todo.DueDate, todo.Priority, userID, todo.ProjectID, todo.Recurrence, todo.RemindAt)
+		if err := scanTodo(row, todo); err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			var err error
+			if todo.Tags, err = setTodoTags(ctx, tx, todo.ID, tags); err != nil {
+				return err
+			}
+		}
+		return recordHistory(ctx, tx, userID, EVENT_CREATED, nil, *todo)
+	})
+}
+
+func (p *postgresTodoRepository) Update(ctx context.Context, userID, todoID, version int, change func(existing Todo) (Todo, error)) (existingTodo, updatedTodo Todo, err error) {
+	err = p.withTx(ctx, func(tx *sql.Tx) error {
+		// The row stays locked until commit, so it can't change or disappear between change and the update
+		if err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE id=$1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE", todoID, userID), &existingTodo); err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		} else if err != nil {
+			return err
+		}
+
+		changed, err := change(existingTodo)
+		if err != nil {
+			return err
+		}
+
+		// Set before the update so that it returns them, a version conflict rolls them back with the rest
+		if !sameTags(existingTodo.Tags, changed.Tags) {
+			if _, err := setTodoTags(ctx, tx, todoID, changed.Tags); err != nil {
+				return err
+			}
+		}
+
+		query := "UPDATE todo SET title = $2, description = $3, is_done = $4, completed_at = CASE WHEN $4 THEN COALESCE(completed_at, now()) END, metadata = $5, due_date = $6, priority = $7, project_id = $8, recurrence = $9, reminded_at = CASE WHEN remind_at IS DISTINCT FROM $10 THEN NULL ELSE reminded_at END, remind_at = $10, status = $11, snoozed_until = $12, version = version + 1, updated_at = now() WHERE id = $1 AND deleted_at IS NULL"
+		args := []interface{}{todoID, changed.Title, changed.Description, changed.IsDone, changed.Metadata, changed.DueDate, changed.Priority, changed.ProjectID, changed.Recurrence, changed.RemindAt, changed.Status, changed.SnoozedUntil}
+		if version != 0 {
+			args = append(args, version)
+			query += " AND version = $13"
+		}
+
+		// The row exists, so no row updated means the caller has an older version
+		if err = scanTodo(tx.QueryRowContext(ctx, query+" RETURNING "+TODO_COLUMNS, args...), &updatedTodo); err == sql.ErrNoRows {
+			return ErrVersionConflict
+		} else if err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, UpdateEvent(existingTodo, updatedTodo), &existingTodo, updatedTodo)
+	})
+	return existingTodo, updatedTodo, err
+}
+
+func (p *postgresTodoRepository) Delete(ctx context.Context, userID, todoID int) (todo Todo, err error) {
+	err = p.withTx(ctx, func(tx *sql.Tx) error {
+		if err := scanTodo(tx.QueryRowContext(ctx, "UPDATE todo SET deleted_at = now(), updated_at = now() WHERE id = $1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL RETURNING "+TODO_COLUMNS, todoID, userID), &todo); err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		} else if err != nil {
+			return err
+		}
+		// Only deleted_at changed, besides the fields left out of the history
+		before := todo
+		before.DeletedAt = nil
+		return recordHistory(ctx, tx, userID, EVENT_DELETED, &before, todo)
+	})
+	return todo, err
+}
+
+func (p *postgresTodoRepository) Restore(ctx context.Context, userID, todoID int) (todo Todo, err error) {
+	err = p.withTx(ctx, func(tx *sql.Tx) error {
+		var deletedTodo Todo
+		if err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE id = $1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" FOR UPDATE", todoID, userID), &deletedTodo); err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		} else if err != nil {
+			return err
+		}
+		if err := scanTodo(tx.QueryRowContext(ctx, "UPDATE todo SET deleted_at = NULL, updated_at = CASE WHEN deleted_at IS NULL THEN updated_at ELSE now() END WHERE id = $1 RETURNING "+TODO_COLUMNS, todoID), &todo); err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, EVENT_RESTORED, &deletedTodo, todo)
+	})
+	return todo, err
+}
+
+func (p *postgresTodoRepository) HasProject(ctx context.Context, userID, projectID int) (bool, error) {
+	var id int
+	err := p.conn().QueryRowContext(ctx, "SELECT id FROM project WHERE id = $1 AND "+ProjectAccess("$2", ROLE_EDITOR), projectID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (p *postgresTodoRepository) Audience(ctx context.Context, userID int, todoIDs []int) (map[int][]int, error) {
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT id, user_id FROM todo WHERE id = ANY($1) "+
+			"UNION SELECT t.id, p.user_id FROM todo t JOIN project p ON p.id = t.project_id WHERE t.id = ANY($1) "+
+			"UNION SELECT t.id, m.user_id FROM todo t JOIN project_member m ON m.project_id = t.project_id WHERE t.id = ANY($1)",
+		pq.Array(todoIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	audience := make(map[int][]int)
+	for rows.Next() {
+		var todoID, memberID int
+		if err := rows.Scan(&todoID, &memberID); err != nil {
+			return nil, err
+		}
+		if memberID != userID {
+			audience[todoID] = append(audience[todoID], memberID)
+		}
+	}
+	return audience, rows.Err()
+}
+
+// ErrNotFound is returned by the repositories besides TodoRepository for a row which doesn't exist or the user may
+// not see
+var ErrNotFound = errors.New("not found")
+
+// deleted turns the result of a DELETE or UPDATE of one row into ErrNotFound when it matched none
+func deleted(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// execQueryRower is a database or a transaction
+type execQueryRower interface {
+	queryRower
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertID runs the insert on db and returns the id of the new row, read with RETURNING or on MySQL, which has none,
+// as the last insert id
+func insertID(ctx context.Context, db execQueryRower, dbDriver string, query string, args ...interface{}) (int, error) {
+	if dbDriver == DB_DRIVER_MYSQL {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		id, err := result.LastInsertId()
+		return int(id), err
+	}
+	var id int
+	err := db.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// TodoStore runs the changes of to-do lists which TodoRepository leaves out on Postgres: the bulk ones, those of the
+// jobs and the tags. Each change is recorded in todo_history in its transaction, the caller publishes it
+type TodoStore struct {
+	DB *sql.DB
+}
+
+// lockTodo reads the to-do list the user may edit and locks it until tx ends, ErrTodoNotFound when there is none
+func lockTodo(ctx context.Context, tx *sql.Tx, userID int, todoID int) (Todo, error) {
+	var todo Todo
+	err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE id=$1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE", todoID, userID), &todo)
+	if err == sql.ErrNoRows {
+		return todo, ErrTodoNotFound
+	}
+	return todo, err
+}
+
+// StoredSchemaVersion is the migration version of the database and whether a migration to it failed midway,
+// ErrNotFound before the first migration
+func StoredSchemaVersion(ctx context.Context, db queryRower) (version uint, dirty bool, err error) {
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return version, dirty, err
+}
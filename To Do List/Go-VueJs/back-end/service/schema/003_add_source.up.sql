@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'api';
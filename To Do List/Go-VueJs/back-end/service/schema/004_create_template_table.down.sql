@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS template_item;
+DROP TABLE IF EXISTS template;
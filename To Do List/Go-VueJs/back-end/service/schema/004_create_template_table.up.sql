@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS template(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS template_item(
+    id SERIAL PRIMARY KEY,
+    template_id INTEGER NOT NULL REFERENCES template(id) ON DELETE CASCADE,
+    title VARCHAR(100) NOT NULL,
+    description VARCHAR(255)
+);
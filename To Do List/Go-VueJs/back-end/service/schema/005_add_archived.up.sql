@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
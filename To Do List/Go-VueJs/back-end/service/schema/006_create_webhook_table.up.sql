@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS webhook(
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    secret VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery(
+    id SERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhook(id) ON DELETE CASCADE,
+    event VARCHAR(20) NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+ALTER TABLE webhook_delivery DROP COLUMN IF EXISTS queue_id;
+DROP TABLE IF EXISTS webhook_queue;
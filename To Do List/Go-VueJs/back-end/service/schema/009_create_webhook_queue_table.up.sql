@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS webhook_queue(
+    id SERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhook(id) ON DELETE CASCADE,
+    event VARCHAR(20) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_queue_pending_idx ON webhook_queue(next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE webhook_delivery ADD COLUMN IF NOT EXISTS queue_id INTEGER REFERENCES webhook_queue(id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS share_token VARCHAR(64) UNIQUE;
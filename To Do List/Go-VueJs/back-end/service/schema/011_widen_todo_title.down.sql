@@ -0,0 +1 @@
+ALTER TABLE todo ALTER COLUMN title TYPE VARCHAR(100);
@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS due_date TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS todo_tags_idx ON todo USING GIN (tags);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS todo_user_id_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS user_id;
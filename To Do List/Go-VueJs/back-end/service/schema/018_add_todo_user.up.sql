@@ -0,0 +1,2 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS todo_user_id_idx ON todo(user_id);
@@ -0,0 +1,3 @@
+UPDATE todo SET priority = 'high' WHERE priority = 'urgent';
+ALTER TABLE todo DROP CONSTRAINT IF EXISTS todo_priority_check;
+ALTER TABLE todo ADD CONSTRAINT todo_priority_check CHECK (priority IN ('low', 'medium', 'high'));
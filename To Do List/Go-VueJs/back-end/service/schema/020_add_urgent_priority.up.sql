@@ -0,0 +1,2 @@
+ALTER TABLE todo DROP CONSTRAINT IF EXISTS todo_priority_check;
+ALTER TABLE todo ADD CONSTRAINT todo_priority_check CHECK (priority IN ('low', 'medium', 'high', 'urgent'));
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS todo_item(
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    is_done BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS todo_item_todo_id_idx ON todo_item(todo_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS project(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS project_user_id_idx ON project(user_id);
+
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS project_id INTEGER REFERENCES project(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS todo_project_id_idx ON todo(project_id);
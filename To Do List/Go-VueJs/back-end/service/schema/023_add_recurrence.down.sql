@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS todo_recurrence_pending_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS recurred;
+ALTER TABLE todo DROP COLUMN IF EXISTS recurrence;
@@ -0,0 +1,3 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS recurrence JSONB;
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS recurred BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS todo_recurrence_pending_idx ON todo(id) WHERE recurrence IS NOT NULL AND is_done AND NOT recurred;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS todo_reminder_pending_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS reminded_at;
+ALTER TABLE todo DROP COLUMN IF EXISTS remind_at;
@@ -0,0 +1,3 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS remind_at TIMESTAMPTZ;
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS reminded_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS todo_reminder_pending_idx ON todo(remind_at) WHERE reminded_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS webhook_user_id_idx;
+ALTER TABLE webhook DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,2 @@
+ALTER TABLE webhook ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS webhook_user_id_idx ON webhook(user_id);
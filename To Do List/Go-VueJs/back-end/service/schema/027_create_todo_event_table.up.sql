@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS todo_event(
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL,
+    todo_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS todo_event_user_id_idx ON todo_event(user_id, id);
+CREATE INDEX IF NOT EXISTS todo_event_created_at_idx ON todo_event(created_at);
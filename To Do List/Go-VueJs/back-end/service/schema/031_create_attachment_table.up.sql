@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS attachment(
+    id SERIAL PRIMARY KEY,
+    -- NULL once the to-do list is purged, until the trash purge deletes the file
+    todo_id INTEGER REFERENCES todo(id) ON DELETE SET NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS attachment_todo_id_idx ON attachment(todo_id);
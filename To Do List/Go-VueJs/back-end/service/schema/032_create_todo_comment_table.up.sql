@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS todo_comment(
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS todo_comment_todo_id_idx ON todo_comment(todo_id, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS todo_user_id_position_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS position;
@@ -0,0 +1,3 @@
+-- Manual order of the to-do list of a user, NULL until it is reordered
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS position INTEGER;
+CREATE INDEX IF NOT EXISTS todo_user_id_position_idx ON todo(user_id, position);
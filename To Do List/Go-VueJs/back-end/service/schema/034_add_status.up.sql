@@ -0,0 +1,3 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'backlog' CHECK (status IN ('backlog', 'in_progress', 'blocked', 'done'));
+UPDATE todo SET status = 'done' WHERE is_done;
+CREATE INDEX IF NOT EXISTS todo_user_id_status_idx ON todo (user_id, status);
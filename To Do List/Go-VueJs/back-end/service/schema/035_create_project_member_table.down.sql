@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS project_invitation;
+DROP TABLE IF EXISTS project_member;
@@ -0,0 +1,12 @@
+-- Only the SHA-256 of a key is stored, the key itself is shown once when it is created
+CREATE TABLE IF NOT EXISTS api_key(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    scope TEXT NOT NULL CHECK (scope IN ('read', 'write')),
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    hint VARCHAR(12) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS api_key_user_id_idx ON api_key(user_id);
@@ -0,0 +1,9 @@
+-- Accounts at the OAuth providers a user signs in with, subject is the stable id of the account at the provider
+CREATE TABLE IF NOT EXISTS user_identity(
+    provider VARCHAR(20) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS user_identity_user_id_idx ON user_identity(user_id);
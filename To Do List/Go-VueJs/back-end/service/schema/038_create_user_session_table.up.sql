@@ -0,0 +1,20 @@
+-- A session is the family of refresh tokens rotated from one login, revoking it ends every token of the family
+CREATE TABLE IF NOT EXISTS user_session(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS user_session_user_id_idx ON user_session(user_id);
+
+-- Only the SHA-256 of a token is stored. A token is used once, presenting a used one again revokes its session
+CREATE TABLE IF NOT EXISTS refresh_token(
+    token_hash CHAR(64) PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES user_session(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS refresh_token_session_id_idx ON refresh_token(session_id);
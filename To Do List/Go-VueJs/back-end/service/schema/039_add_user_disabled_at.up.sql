@@ -0,0 +1,2 @@
+-- A disabled user can't sign in, set and cleared with the admin command user disable/enable
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- Only set for the emails an OAuth provider verified, a sign-in with the provider links to such a user by email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
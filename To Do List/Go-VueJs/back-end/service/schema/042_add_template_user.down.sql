@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS template_user_id_idx;
+ALTER TABLE template DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,3 @@
+-- Templates belong to the user who added them, the ones added before are nobody's and no longer listed
+ALTER TABLE template ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS template_user_id_idx ON template(user_id);
@@ -0,0 +1,6 @@
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS todo_tags_idx ON todo USING GIN (tags);
+UPDATE todo SET tags = ARRAY(SELECT tag.name FROM todo_tag JOIN tag ON tag.id = todo_tag.tag_id WHERE todo_tag.todo_id = todo.id ORDER BY tag.name);
+
+DROP TABLE IF EXISTS todo_tag;
+DROP TABLE IF EXISTS tag;
@@ -0,0 +1,26 @@
+-- The tags of a user, which exist before and after any to-do list uses them
+CREATE TABLE IF NOT EXISTS tag(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+-- A to-do list has the tags of its owner
+CREATE TABLE IF NOT EXISTS todo_tag(
+    todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tag(id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS todo_tag_tag_id_idx ON todo_tag(tag_id);
+
+-- The to-do lists from before the accounts belong to nobody and aren't listed, their tags are dropped
+INSERT INTO tag(user_id, name)
+SELECT DISTINCT todo.user_id, t.name FROM todo, unnest(todo.tags) AS t(name) WHERE todo.user_id IS NOT NULL
+ON CONFLICT (user_id, name) DO NOTHING;
+INSERT INTO todo_tag(todo_id, tag_id)
+SELECT DISTINCT todo.id, tag.id FROM todo, unnest(todo.tags) AS t(name), tag WHERE tag.user_id = todo.user_id AND tag.name = t.name;
+
+DROP INDEX IF EXISTS todo_tags_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS tags;
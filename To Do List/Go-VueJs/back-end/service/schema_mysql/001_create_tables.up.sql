@@ -0,0 +1,68 @@
+CREATE TABLE IF NOT EXISTS users(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    email VARCHAR(254),
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS project(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX project_user_id_idx (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Tags are stored in the text form of a Postgres array and metadata and recurrence as JSON text, so the same
+-- Scan and Value methods read and write them. The repository always writes both, TEXT can't have a default
+CREATE TABLE IF NOT EXISTS todo(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description VARCHAR(255),
+    is_done BOOLEAN NOT NULL DEFAULT FALSE,
+    completed_at DATETIME(6),
+    source VARCHAR(20) NOT NULL DEFAULT 'api',
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    version INT NOT NULL DEFAULT 1,
+    metadata TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    due_date DATETIME(6),
+    deleted_at DATETIME(6),
+    tags TEXT NOT NULL,
+    priority VARCHAR(10) NOT NULL DEFAULT 'medium',
+    user_id INT,
+    project_id INT,
+    recurrence TEXT,
+    remind_at DATETIME(6),
+    reminded_at DATETIME(6),
+    CONSTRAINT todo_priority_check CHECK (priority IN ('low', 'medium', 'high', 'urgent')),
+    INDEX todo_user_id_idx (user_id),
+    INDEX todo_project_id_idx (project_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES project(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS todo_item(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    todo_id INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    is_done BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX todo_item_todo_id_idx (todo_id),
+    FOREIGN KEY (todo_id) REFERENCES todo(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- changes is written as bytes, which MySQL refuses for a JSON column
+CREATE TABLE IF NOT EXISTS todo_history(
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    todo_id INT NOT NULL,
+    actor_id INT,
+    action VARCHAR(20) NOT NULL,
+    changes TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX todo_history_todo_id_idx (todo_id, id),
+    FOREIGN KEY (todo_id) REFERENCES todo(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
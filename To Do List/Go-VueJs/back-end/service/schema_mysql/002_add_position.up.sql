@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN position INT NULL;
@@ -0,0 +1 @@
+ALTER TABLE todo DROP CHECK todo_status_check, DROP COLUMN status;
@@ -0,0 +1,2 @@
+ALTER TABLE todo ADD COLUMN status VARCHAR(12) NOT NULL DEFAULT 'backlog', ADD CONSTRAINT todo_status_check CHECK (status IN ('backlog', 'in_progress', 'blocked', 'done'));
+UPDATE todo SET status = 'done' WHERE is_done;
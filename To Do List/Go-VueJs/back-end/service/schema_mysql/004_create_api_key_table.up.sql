@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_key(
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    scope VARCHAR(5) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    hint VARCHAR(12) NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    last_used_at DATETIME(6),
+    CONSTRAINT api_key_scope_check CHECK (scope IN ('read', 'write')),
+    INDEX api_key_user_id_idx (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- KEY is a reserved word of MySQL, the column is quoted wherever it is named
+CREATE TABLE IF NOT EXISTS idempotency_key(
+    user_id INT NOT NULL,
+    `key` VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (user_id, `key`),
+    INDEX idempotency_key_created_at_idx (created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS idempotency_key;
+DROP TABLE IF EXISTS todo_history;
+DROP TABLE IF EXISTS todo_item;
+DROP TABLE IF EXISTS todo;
+DROP TABLE IF EXISTS project;
+DROP TABLE IF EXISTS users;
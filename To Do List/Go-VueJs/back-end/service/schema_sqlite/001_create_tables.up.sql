@@ -0,0 +1,70 @@
+CREATE TABLE IF NOT EXISTS users(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    email VARCHAR(254),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS project(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS project_user_id_idx ON project(user_id);
+
+-- Tags are stored in the text form of a Postgres array and metadata and recurrence as JSON text, so the same
+-- Scan and Value methods read and write them
+CREATE TABLE IF NOT EXISTS todo(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(255) NOT NULL,
+    description VARCHAR(255),
+    is_done BOOLEAN NOT NULL DEFAULT FALSE,
+    completed_at DATETIME,
+    source VARCHAR(20) NOT NULL DEFAULT 'api',
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    version INTEGER NOT NULL DEFAULT 1,
+    metadata TEXT NOT NULL DEFAULT '{}',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    due_date DATETIME,
+    deleted_at DATETIME,
+    tags TEXT NOT NULL DEFAULT '{}',
+    priority TEXT NOT NULL DEFAULT 'medium' CHECK (priority IN ('low', 'medium', 'high', 'urgent')),
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    project_id INTEGER REFERENCES project(id) ON DELETE SET NULL,
+    recurrence TEXT,
+    remind_at DATETIME,
+    reminded_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS todo_user_id_idx ON todo(user_id);
+CREATE INDEX IF NOT EXISTS todo_project_id_idx ON todo(project_id);
+
+CREATE TABLE IF NOT EXISTS todo_item(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    is_done BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS todo_item_todo_id_idx ON todo_item(todo_id);
+
+CREATE TABLE IF NOT EXISTS todo_history(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(20) NOT NULL,
+    changes TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS todo_history_todo_id_idx ON todo_history(todo_id, id);
+
+CREATE TABLE IF NOT EXISTS idempotency_key(
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_key_created_at_idx ON idempotency_key(created_at);
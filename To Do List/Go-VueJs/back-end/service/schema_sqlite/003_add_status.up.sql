@@ -0,0 +1,2 @@
+ALTER TABLE todo ADD COLUMN status TEXT NOT NULL DEFAULT 'backlog' CHECK (status IN ('backlog', 'in_progress', 'blocked', 'done'));
+UPDATE todo SET status = 'done' WHERE is_done;
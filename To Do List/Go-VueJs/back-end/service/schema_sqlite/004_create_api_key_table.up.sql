@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_key(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    scope TEXT NOT NULL CHECK (scope IN ('read', 'write')),
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    hint VARCHAR(12) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS api_key_user_id_idx ON api_key(user_id);
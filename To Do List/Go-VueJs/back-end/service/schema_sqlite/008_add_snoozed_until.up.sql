@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN snoozed_until DATETIME;
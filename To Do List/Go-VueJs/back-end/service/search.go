@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+)
+
+// Search ranks the to-do lists of the user whose title or description match the full-text query q, a title match
+// weighs more than a description match. It returns a page of them and how many match in all
+func (q *TodoQueries) Search(ctx context.Context, userID int, query string, limit, offset int) ([]Todo, int, error) {
+	// websearch_to_tsquery accepts any input, quotes, "or" and "-" work like a search engine
+	const match = " FROM todo, websearch_to_tsquery('english', $2) query WHERE user_id = $1 AND deleted_at IS NULL AND search @@ query"
+	var total int
+	if err := q.DB.QueryRowContext(ctx, "SELECT COUNT(*)"+match, userID, query).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	todos, err := queryTodos(ctx, q.DB,
+		"SELECT "+TODO_COLUMNS+match+" ORDER BY ts_rank(search, query) DESC, id LIMIT $3 OFFSET $4",
+		userID, query, limit, offset,
+	)
+	return todos, total, err
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// TodoService holds the rules of the to-do lists shared by the REST, GraphQL and gRPC handlers, which only translate
+// requests and errors. Input the rules reject comes back as a ValidationError
+type TodoService struct {
+	Repository TodoRepository
+
+	// Gets every change once it's stored, nil leaves publishing to the caller
+	Changes *Broadcaster
+
+	// Reject title/description edits of completed to-do list until reopened
+	LockCompleted bool
+
+	// Moves between statuses a to-do list may make, nil allows every move
+	Transitions StatusTransitions
+}
+
+// NewTodoRepository stores the to-do lists in db of the database driver, within tx when it isn't nil
+func NewTodoRepository(db *sql.DB, dbDriver string, tx *sql.Tx) TodoRepository {
+	switch dbDriver {
+	case DB_DRIVER_SQLITE:
+		return &sqliteTodoRepository{db: db, tx: tx}
+	case DB_DRIVER_MYSQL:
+		return &mysqlTodoRepository{db: db, tx: tx}
+	}
+	return &postgresTodoRepository{db: db, tx: tx}
+}
+
+// Publish tells the user who changed the to-do lists and everyone else who sees them, e.g. the owner of one an
+// editor of its project changed. A deleted to-do list is published without its fields
+func (s *TodoService) Publish(ctx context.Context, eventType string, userID int, todos ...Todo) {
+	if s.Changes == nil || len(todos) == 0 {
+		return
+	}
+	todoIDs := make([]int, len(todos))
+	for i := range todos {
+		todoIDs[i] = todos[i].ID
+	}
+	audience, err := s.Repository.Audience(ctx, userID, todoIDs)
+	if err != nil {
+		slog.WarnContext(ctx, "Finding who sees the changed to-do lists failed, only telling the user", "error", err)
+	}
+
+	for i := range todos {
+		todo := &todos[i]
+		if eventType == EVENT_DELETED {
+			todo = nil
+		}
+		s.Changes.Publish(eventType, userID, todoIDs[i], todo)
+		for _, memberID := range audience[todoIDs[i]] {
+			s.Changes.Publish(eventType, memberID, todoIDs[i], todo)
+		}
+	}
+}
+
+// errUnchanged stops an Update in which change had nothing to do
+var errUnchanged = errors.New("to-do list is unchanged")
+
+// Check defaults the priority of a new or replacing to-do list and validates it
+func (s *TodoService) Check(ctx context.Context, userID int, todo *Todo) error {
+	if todo.Priority == "" {
+		todo.Priority = PRIORITY_MEDIUM
+	}
+	// Only rendered by the server, a client's own HTML is never stored nor echoed
+	todo.DescriptionHTML = ""
+	if err := ValidateTodo(*todo); err != nil {
+		return ValidationError{err}
+	}
+	return s.checkProject(ctx, userID, todo.ProjectID)
+}
+
+// checkProject fails unless the project is nil or belongs to the user
+func (s *TodoService) checkProject(ctx context.Context, userID int, projectID *int) error {
+	if projectID == nil {
+		return nil
+	}
+	if ok, err := s.Repository.HasProject(ctx, userID, *projectID); err != nil {
+		return err
+	} else if !ok {
+		return ValidationError{ErrUnknownProject}
+	}
+	return nil
+}
+
+// changeStatus resolves the status of the updated to-do list and fails unless Transitions allow its move
+func (s *TodoService) changeStatus(existing, updated Todo) (Todo, error) {
+	updated = resolveStatus(existing, updated)
+	if !s.Transitions.Allows(existing.Status, updated.Status) {
+		return updated, errTransition(existing.Status, updated.Status)
+	}
+	return updated, nil
+}
+
+// isLocked reports whether the change edits a completed to-do list which is frozen until reopened
+func (s *TodoService) isLocked(existing, updated Todo) bool {
+	return s.LockCompleted && existing.IsDone && updated.IsDone &&
+		(updated.Title != existing.Title || updated.Description != existing.Description)
+}
+
+func (s *TodoService) Get(ctx context.Context, userID, todoID int) (Todo, error) {
+	return s.Repository.Get(ctx, userID, todoID)
+}
+
+// Create checks and stores a new to-do list of the user, it starts undone in the backlog
+func (s *TodoService) Create(ctx context.Context, userID int, todo *Todo) error {
+	if err := s.Check(ctx, userID, todo); err != nil {
+		return err
+	}
+	if err := s.Repository.Create(ctx, userID, todo); err != nil {
+		return err
+	}
+	s.Publish(ctx, EVENT_CREATED, userID, *todo)
+	return nil
+}
+
+// Replace overwrites the to-do list of the user with the checked updated one
+// A non-zero updated.Version must match the stored version, otherwise ErrVersionConflict is returned
+func (s *TodoService) Replace(ctx context.Context, userID, todoID int, updatedTodo *Todo) error {
+	if err := s.Check(ctx, userID, updatedTodo); err != nil {
+		return err
+	}
+	existingTodo, todo, err := s.Repository.Update(ctx, userID, todoID, updatedTodo.Version, func(existing Todo) (Todo, error) {
+		updated, err := s.changeStatus(existing, *updatedTodo)
+		if err != nil {
+			return existing, err
+		}
+		if s.isLocked(existing, updated) {
+			return existing, ErrTodoLocked
+		}
+		// Only POST /todo/{id}/snooze changes the snooze, a client replacing the rest keeps it
+		updated.SnoozedUntil = existing.SnoozedUntil
+		return updated, nil
+	})
+	if err != nil {
+		return err
+	}
+	*updatedTodo = todo
+	s.Publish(ctx, UpdateEvent(existingTodo, todo), userID, todo)
+	return nil
+}
+
+// Patch applies the patch to the to-do list of the user, returning it from before and after
+// A non-zero patch.Version must match the stored version, otherwise ErrVersionConflict is returned
+func (s *TodoService) Patch(ctx context.Context, userID, todoID int, patch TodoPatch) (existingTodo, updatedTodo Todo, err error) {
+	existingTodo, updatedTodo, err = s.Repository.Update(ctx, userID, todoID, patch.Version, func(existing Todo) (Todo, error) {
+		// Validate the to-do list as it would be after the patch
+		patched := applyPatch(existing, patch)
+		if err := ValidateTodo(patched); err != nil {
+			return patched, ValidationError{err}
+		}
+		patched, err := s.changeStatus(existing, patched)
+		if err != nil {
+			return patched, err
+		}
+		if patch.ProjectID.Set {
+			if err := s.checkProject(ctx, userID, patched.ProjectID); err != nil {
+				return patched, err
+			}
+		}
+		if s.isLocked(existing, patched) {
+			return patched, ErrTodoLocked
+		}
+		return patched, nil
+	})
+	if err != nil {
+		return existingTodo, updatedTodo, err
+	}
+	s.Publish(ctx, UpdateEvent(existingTodo, updatedTodo), userID, updatedTodo)
+	return existingTodo, updatedTodo, nil
+}
+
+// SetDone completes or reopens the to-do list, one already in that state is returned as it is
+func (s *TodoService) SetDone(ctx context.Context, userID, todoID int, isDone bool) (Todo, error) {
+	existingTodo, todo, err := s.Repository.Update(ctx, userID, todoID, 0, func(existing Todo) (Todo, error) {
+		if existing.IsDone == isDone {
+			return existing, errUnchanged
+		}
+		updated := existing
+		updated.IsDone = isDone
+		return s.changeStatus(existing, updated)
+	})
+	if err == errUnchanged {
+		return existingTodo, nil
+	} else if err != nil {
+		return todo, err
+	}
+	s.Publish(ctx, UpdateEvent(existingTodo, todo), userID, todo)
+	return todo, nil
+}
+
+// Snooze hides the to-do list from the views until the time, nil wakes it. One already snoozed until then is returned
+// as it is
+func (s *TodoService) Snooze(ctx context.Context, userID, todoID int, until *time.Time) (Todo, error) {
+	existingTodo, todo, err := s.Repository.Update(ctx, userID, todoID, 0, func(existing Todo) (Todo, error) {
+		if until == nil && existing.SnoozedUntil == nil || until != nil && existing.SnoozedUntil != nil && until.Equal(*existing.SnoozedUntil) {
+			return existing, errUnchanged
+		}
+		updated := existing
+		updated.SnoozedUntil = until
+		return updated, nil
+	})
+	if err == errUnchanged {
+		return existingTodo, nil
+	} else if err != nil {
+		return todo, err
+	}
+	s.Publish(ctx, UpdateEvent(existingTodo, todo), userID, todo)
+	return todo, nil
+}
+
+// Delete moves the to-do list of the user to the trash, the row is kept so it can be restored
+func (s *TodoService) Delete(ctx context.Context, userID, todoID int) (Todo, error) {
+	todo, err := s.Repository.Delete(ctx, userID, todoID)
+	if err != nil {
+		return todo, err
+	}
+	s.Publish(ctx, EVENT_DELETED, userID, todo)
+	return todo, nil
+}
+
+// Restore brings the to-do list of the user back from the trash
+func (s *TodoService) Restore(ctx context.Context, userID, todoID int) (Todo, error) {
+	todo, err := s.Repository.Restore(ctx, userID, todoID)
+	if err != nil {
+		return todo, err
+	}
+	s.Publish(ctx, EVENT_RESTORED, userID, todo)
+	return todo, nil
+}
+
+// applyPatch returns the to-do list with the fields set in the patch
+func applyPatch(todo Todo, patch TodoPatch) Todo {
+	if patch.Title != nil {
+		todo.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		todo.Description = *patch.Description
+	}
+	if patch.IsDone != nil {
+		todo.IsDone = *patch.IsDone
+	}
+	if patch.Status != nil {
+		todo.Status = *patch.Status
+	}
+	if patch.Metadata != nil {
+		todo.Metadata = *patch.Metadata
+	}
+	if patch.Tags != nil {
+		todo.Tags = *patch.Tags
+	}
+	if patch.Priority != nil {
+		todo.Priority = *patch.Priority
+	}
+	if patch.DueDate != nil {
+		todo.DueDate = patch.DueDate
+	}
+	if patch.ProjectID.Set {
+		todo.ProjectID = patch.ProjectID.Value
+	}
+	if patch.Recurrence.Set {
+		todo.Recurrence = patch.Recurrence.Value
+	}
+	// A new reminder time is sent again, the repository clears reminded_at when remind_at changes
+	if patch.RemindAt.Set {
+		todo.RemindAt = patch.RemindAt.Value
+	}
+	return todo
+}
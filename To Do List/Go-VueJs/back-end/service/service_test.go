@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeTodoRepository keeps the to-do lists of one user in memory
+type fakeTodoRepository struct {
+	todos    map[int]Todo
+	projects map[int]bool
+	nextID   int
+}
+
+func newFakeTodoRepository(todos ...Todo) *fakeTodoRepository {
+	repo := &fakeTodoRepository{todos: map[int]Todo{}, projects: map[int]bool{}, nextID: 1}
+	for _, todo := range todos {
+		repo.todos[todo.ID] = todo
+		if todo.ID >= repo.nextID {
+			repo.nextID = todo.ID + 1
+		}
+	}
+	return repo
+}
+
+func (f *fakeTodoRepository) Get(_ context.Context, _, todoID int) (Todo, error) {
+	todo, ok := f.todos[todoID]
+	if !ok {
+		return todo, ErrTodoNotFound
+	}
+	return todo, nil
+}
+
+func (f *fakeTodoRepository) Create(_ context.Context, _ int, todo *Todo) error {
+	todo.ID, todo.Version = f.nextID, 1
+	f.nextID++
+	f.todos[todo.ID] = *todo
+	return nil
+}
+
+func (f *fakeTodoRepository) Update(_ context.Context, _, todoID, version int, change func(existing Todo) (Todo, error)) (Todo, Todo, error) {
+	existing, ok := f.todos[todoID]
+	if !ok {
+		return existing, Todo{}, ErrTodoNotFound
+	}
+	updated, err := change(existing)
+	if err != nil {
+		return existing, updated, err
+	}
+	if version != 0 && version != existing.Version {
+		return existing, updated, ErrVersionConflict
+	}
+	updated.ID, updated.Version = todoID, existing.Version+1
+	f.todos[todoID] = updated
+	return existing, updated, nil
+}
+
+func (f *fakeTodoRepository) Delete(_ context.Context, _, todoID int) (Todo, error) {
+	todo, ok := f.todos[todoID]
+	if !ok {
+		return todo, ErrTodoNotFound
+	}
+	delete(f.todos, todoID)
+	return todo, nil
+}
+
+func (f *fakeTodoRepository) Restore(_ context.Context, _, todoID int) (Todo, error) {
+	todo, ok := f.todos[todoID]
+	if !ok {
+		return todo, ErrTodoNotFound
+	}
+	todo.DeletedAt = nil
+	f.todos[todoID] = todo
+	return todo, nil
+}
+
+func (f *fakeTodoRepository) Audience(_ context.Context, _ int, _ []int) (map[int][]int, error) {
+	return nil, nil
+}
+
+func (f *fakeTodoRepository) HasProject(_ context.Context, _, projectID int) (bool, error) {
+	return f.projects[projectID], nil
+}
+
+func TestTodoServiceCreate(t *testing.T) {
+	repo := newFakeTodoRepository()
+	service := &TodoService{Repository: repo, Changes: NewBroadcaster(DEFAULT_MAX_SUBSCRIBERS)}
+
+	todo := Todo{Title: "Buy milk"}
+	if err := service.Create(context.Background(), testUserID, &todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.ID != 1 || todo.Priority != PRIORITY_MEDIUM {
+		t.Errorf("created = %+v, want id 1 with the default priority", todo)
+	}
+	if events := service.Changes.Since(0, testUserID).Events; len(events) != 1 || events[0].Type != EVENT_CREATED {
+		t.Errorf("events = %+v, want one creation", events)
+	}
+
+	unknownProject := 4
+	var invalid ValidationError
+	for _, todo := range []Todo{{Title: " "}, {Title: "Buy milk", ProjectID: &unknownProject}} {
+		if err := service.Create(context.Background(), testUserID, &todo); !errors.As(err, &invalid) {
+			t.Errorf("create %+v = %v, want a validation error", todo, err)
+		}
+	}
+	if len(repo.todos) != 1 {
+		t.Errorf("stored %d to-do lists, want only the valid one", len(repo.todos))
+	}
+}
+
+func TestTodoServiceReplace(t *testing.T) {
+	tests := []struct {
+		name          string
+		lockCompleted bool
+		updated       Todo
+		err           error
+	}{
+		{name: "replaced", updated: Todo{Title: "Buy oat milk", IsDone: true}},
+		{name: "locked", lockCompleted: true, updated: Todo{Title: "Buy oat milk", IsDone: true}, err: ErrTodoLocked},
+		{name: "reopened while locked", lockCompleted: true, updated: Todo{Title: "Buy oat milk"}},
+		{name: "current version", updated: Todo{Title: "Buy oat milk", Version: 2}},
+		{name: "stale version", updated: Todo{Title: "Buy oat milk", Version: 1}, err: ErrVersionConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTodoRepository(Todo{ID: 1, Title: "Buy milk", IsDone: true, Priority: PRIORITY_MEDIUM, Version: 2})
+			service := &TodoService{Repository: repo, LockCompleted: tt.lockCompleted}
+
+			updated := tt.updated
+			if err := service.Replace(context.Background(), testUserID, 1, &updated); err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			want := Todo{ID: 1, Title: "Buy milk", IsDone: true, Priority: PRIORITY_MEDIUM, Version: 2}
+			if tt.err == nil {
+				want = Todo{ID: 1, Title: tt.updated.Title, IsDone: tt.updated.IsDone, Priority: PRIORITY_MEDIUM, Version: 3}
+			}
+			if stored := repo.todos[1]; stored.Title != want.Title || stored.IsDone != want.IsDone || stored.Version != want.Version {
+				t.Errorf("stored = %+v, want %+v", stored, want)
+			}
+		})
+	}
+}
+
+func TestTodoServicePatch(t *testing.T) {
+	repo := newFakeTodoRepository(Todo{ID: 1, Title: "Buy milk", Description: "Oat", Priority: PRIORITY_MEDIUM, Version: 1})
+	service := &TodoService{Repository: repo}
+
+	title := "Buy soy milk"
+	existing, updated, err := service.Patch(context.Background(), testUserID, 1, TodoPatch{Title: &title})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing.Title != "Buy milk" || updated.Title != title || updated.Description != "Oat" {
+		t.Errorf("patched %+v to %+v, want only the title changed", existing, updated)
+	}
+
+	priority := "critical"
+	var invalid ValidationError
+	if _, _, err := service.Patch(context.Background(), testUserID, 1, TodoPatch{Priority: &priority}); !errors.As(err, &invalid) {
+		t.Errorf("invalid priority = %v, want a validation error", err)
+	}
+	if _, _, err := service.Patch(context.Background(), testUserID, 2, TodoPatch{Title: &title}); err != ErrTodoNotFound {
+		t.Errorf("missing = %v, want errTodoNotFound", err)
+	}
+}
+
+func TestTodoServiceSetDone(t *testing.T) {
+	repo := newFakeTodoRepository(Todo{ID: 1, Title: "Buy milk", Priority: PRIORITY_MEDIUM, Version: 1})
+	service := &TodoService{Repository: repo, Changes: NewBroadcaster(DEFAULT_MAX_SUBSCRIBERS)}
+
+	for i := 0; i < 2; i++ {
+		todo, err := service.SetDone(context.Background(), testUserID, 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !todo.IsDone || todo.Version != 2 {
+			t.Errorf("todo = %+v, want done at version 2", todo)
+		}
+	}
+	// Completing it again changed nothing, so there is nothing to tell the subscribers either
+	if events := service.Changes.Since(0, testUserID).Events; len(events) != 1 || events[0].Type != EVENT_COMPLETED {
+		t.Errorf("events = %+v, want one completion", events)
+	}
+}
+
+func TestTodoServiceRestore(t *testing.T) {
+	db, _ := newSQLiteDatabase(t)
+	service := &TodoService{Repository: NewTodoRepository(db, DB_DRIVER_SQLITE, nil), Changes: NewBroadcaster(DEFAULT_MAX_SUBSCRIBERS)}
+	ctx := context.Background()
+
+	todo := Todo{Title: "Buy milk"}
+	if err := service.Create(ctx, testUserID, &todo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Delete(ctx, testUserID, todo.ID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		restored, err := service.Restore(ctx, testUserID, todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.DeletedAt != nil || restored.Title != "Buy milk" {
+			t.Errorf("restored = %+v, want it out of the trash", restored)
+		}
+	}
+	if _, err := service.Get(ctx, testUserID, todo.ID); err != nil {
+		t.Errorf("get after restore = %v", err)
+	}
+	if events := service.Changes.Since(0, testUserID).Events; events[len(events)-1].Type != EVENT_RESTORED {
+		t.Errorf("events = %+v, want the restore last", events)
+	}
+	if _, err := service.Restore(ctx, testUserID+1, todo.ID); err != ErrTodoNotFound {
+		t.Errorf("restore of another user = %v, want errTodoNotFound", err)
+	}
+}
+
+func TestTodoServiceStatus(t *testing.T) {
+	repo := newFakeTodoRepository(Todo{ID: 1, Title: "Buy milk", Status: STATUS_BACKLOG, Priority: PRIORITY_MEDIUM, Version: 1})
+	service := &TodoService{Repository: repo, Transitions: StatusTransitions{
+		STATUS_BACKLOG:     {STATUS_IN_PROGRESS},
+		STATUS_IN_PROGRESS: {STATUS_BLOCKED, STATUS_DONE},
+	}}
+
+	status := STATUS_DONE
+	var invalid ValidationError
+	if _, _, err := service.Patch(context.Background(), testUserID, 1, TodoPatch{Status: &status}); !errors.As(err, &invalid) {
+		t.Errorf("backlog to done = %v, want a validation error", err)
+	}
+	if _, err := service.SetDone(context.Background(), testUserID, 1, true); !errors.As(err, &invalid) {
+		t.Errorf("completing from the backlog = %v, want a validation error", err)
+	}
+
+	status = STATUS_IN_PROGRESS
+	if _, todo, err := service.Patch(context.Background(), testUserID, 1, TodoPatch{Status: &status}); err != nil || todo.IsDone {
+		t.Fatalf("backlog to in_progress = %+v, %v", todo, err)
+	}
+	todo, err := service.SetDone(context.Background(), testUserID, 1, true)
+	if err != nil || todo.Status != STATUS_DONE || !todo.IsDone {
+		t.Errorf("completed = %+v, %v, want done", todo, err)
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("the refresh token was already used, its session is revoked")
+)
+
+// Session is a login and the refresh tokens rotated from it, as the admins see it
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SessionRepository stores the sessions of the logins and their refresh tokens, by the hash of the token
+type SessionRepository struct {
+	DB *sql.DB
+	// DB_DRIVER_MYSQL reads the id of a new session without RETURNING
+	Driver string
+}
+
+// Start stores a session of the user lasting until expiresAt with its first refresh token, returning its id
+func (s *SessionRepository) Start(ctx context.Context, userID int, userAgent, refreshHash string, now, expiresAt time.Time) (sessionID int, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		if sessionID, err = insertID(ctx, tx, s.Driver,
+			"INSERT INTO user_session(user_id, user_agent, created_at, last_used_at, expires_at) VALUES($1, $2, $3, $4, $5)",
+			userID, userAgent, now, now, expiresAt,
+		); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO refresh_token(token_hash, session_id, created_at) VALUES($1, $2, $3)", refreshHash, sessionID, now)
+		return err
+	})
+	return sessionID, err
+}
+
+// IsActive reports whether the session of the user is neither revoked nor expired at now
+func (s *SessionRepository) IsActive(ctx context.Context, userID, sessionID int, now time.Time) (bool, error) {
+	var active bool
+	err := s.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM user_session WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3)",
+		sessionID, userID, now).Scan(&active)
+	return active, err
+}
+
+// Refresh uses up the refresh token of hash, extends its session until expiresAt and stores the next refresh token of
+// nextHash, returning the user and the session. An unknown token or one of an ended session is
+// ErrInvalidRefreshToken, one used before is ErrRefreshTokenReused and revokes its session
+func (s *SessionRepository) Refresh(ctx context.Context, hash, nextHash string, now, expiresAt time.Time) (userID, sessionID int, err error) {
+	reused := false
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		var (
+			sessionExpiresAt  time.Time
+			revokedAt, usedAt sql.NullTime
+		)
+		err := tx.QueryRowContext(ctx, "SELECT s.id, s.user_id, s.expires_at, s.revoked_at, t.used_at FROM refresh_token t JOIN user_session s ON s.id = t.session_id WHERE t.token_hash = $1", hash).
+			Scan(&sessionID, &userID, &sessionExpiresAt, &revokedAt, &usedAt)
+		if err == sql.ErrNoRows {
+			return ErrInvalidRefreshToken
+		} else if err != nil {
+			return err
+		}
+		if revokedAt.Valid || !sessionExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		// The update only wins once, a concurrent refresh with the same token counts as a reuse
+		if !usedAt.Valid {
+			result, err := tx.ExecContext(ctx, "UPDATE refresh_token SET used_at = $2 WHERE token_hash = $1 AND used_at IS NULL", hash, now)
+			if err != nil {
+				return err
+			}
+			updated, _ := result.RowsAffected()
+			usedAt.Valid = updated == 0
+		}
+		if usedAt.Valid {
+			// Committed, the session stays revoked
+			reused = true
+			_, err := tx.ExecContext(ctx, "UPDATE user_session SET revoked_at = $2 WHERE id = $1", sessionID, now)
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE user_session SET last_used_at = $2, expires_at = $3 WHERE id = $1", sessionID, now, expiresAt); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO refresh_token(token_hash, session_id, created_at) VALUES($1, $2, $3)", nextHash, sessionID, now)
+		return err
+	})
+	if err == nil && reused {
+		err = ErrRefreshTokenReused
+	}
+	return userID, sessionID, err
+}
+
+// RevokeRefreshToken ends the session of the refresh token of hash, an ended one is no error
+func (s *SessionRepository) RevokeRefreshToken(ctx context.Context, hash string, now time.Time) error {
+	_, err := s.DB.ExecContext(ctx,
+		"UPDATE user_session SET revoked_at = $2 WHERE id IN (SELECT session_id FROM refresh_token WHERE token_hash = $1) AND revoked_at IS NULL",
+		hash, now,
+	)
+	return err
+}
+
+// Revoke ends a session of the user, an ended one is no error
+func (s *SessionRepository) Revoke(ctx context.Context, userID, sessionID int, now time.Time) error {
+	_, err := s.DB.ExecContext(ctx, "UPDATE user_session SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", sessionID, userID, now)
+	return err
+}
+
+// RevokeByID ends the session of any user, ErrNotFound when it is unknown or ended
+func (s *SessionRepository) RevokeByID(ctx context.Context, sessionID int, now time.Time) error {
+	result, err := s.DB.ExecContext(ctx, "UPDATE user_session SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", sessionID, now)
+	return deleted(result, err)
+}
+
+// Active lists the sessions active at now, the last used first, of every user or of the user when it isn't zero
+func (s *SessionRepository) Active(ctx context.Context, now time.Time, userID int) ([]Session, error) {
+	query := "SELECT s.id, s.user_id, u.username, s.user_agent, s.created_at, s.last_used_at, s.expires_at FROM user_session s JOIN users u ON u.id = s.user_id WHERE s.revoked_at IS NULL AND s.expires_at > $1"
+	args := []interface{}{now}
+	if userID != 0 {
+		query += " AND s.user_id = $2"
+		args = append(args, userID)
+	}
+	rows, err := s.DB.QueryContext(ctx, query+" ORDER BY s.last_used_at DESC, s.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.Username, &session.UserAgent, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
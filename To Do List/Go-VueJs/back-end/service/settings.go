@@ -0,0 +1,7 @@
+package service
+
+const (
+	DB_DRIVER_POSTGRES = "postgres"
+	DB_DRIVER_SQLITE   = "sqlite"
+	DB_DRIVER_MYSQL    = "mysql"
+)
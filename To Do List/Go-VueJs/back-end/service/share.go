@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ShareRepository stores the read-only links of the to-do lists
+type ShareRepository struct {
+	DB *sql.DB
+}
+
+// Share sets the token of the link of a to-do list the user may edit, replacing the previous one
+func (s *ShareRepository) Share(ctx context.Context, userID, todoID int, token string) error {
+	var id int
+	err := s.DB.QueryRowContext(ctx, "UPDATE todo SET share_token = $2 WHERE id = $1 AND "+TodoAccess("", "$3", ROLE_EDITOR)+" AND deleted_at IS NULL RETURNING id", todoID, token, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Unshare removes the link of a to-do list the user may edit
+func (s *ShareRepository) Unshare(ctx context.Context, userID, todoID int) error {
+	var id int
+	err := s.DB.QueryRowContext(ctx, "UPDATE todo SET share_token = NULL WHERE id = $1 AND "+TodoAccess("", "$2", ROLE_EDITOR)+" RETURNING id", todoID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Shared returns the to-do list of the token
+func (s *ShareRepository) Shared(ctx context.Context, token string) (Todo, error) {
+	var todo Todo
+	err := scanTodo(s.DB.QueryRowContext(ctx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE share_token = $1 AND deleted_at IS NULL", token), &todo)
+	if err == sql.ErrNoRows {
+		return todo, ErrNotFound
+	}
+	return todo, err
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Role of a user in a project, the owner is the user who created it and the others are members
+const (
+	ROLE_OWNER  = "owner"
+	ROLE_EDITOR = "editor"
+	ROLE_VIEWER = "viewer"
+)
+
+// memberRoles are the member roles which have role or more, in SQL
+func memberRoles(role string) string {
+	if role == ROLE_EDITOR {
+		return "'editor'"
+	}
+	return "'viewer', 'editor'"
+}
+
+// ProjectAccess is the condition on a row of project which the user in the placeholder may access with role: its
+// owner, and the members with role or more
+func ProjectAccess(user, role string) string {
+	return "(user_id = " + user + " OR id IN (SELECT project_id FROM project_member WHERE user_id = " + user + " AND role IN (" + memberRoles(role) + ")))"
+}
+
+// TodoAccess is the condition on a row of todo, its columns prefixed with table, which the user in the placeholder
+// may access with role: its owner, and whoever may access its project with role
+func TodoAccess(table, user, role string) string {
+	return "(" + table + "user_id = " + user + " OR " + table + "project_id IN (SELECT id FROM project WHERE " + ProjectAccess(user, role) + "))"
+}
+
+// todoAccessOn is TodoAccess on the database of dbDriver. The projects aren't shared on SQLite and MySQL, there only
+// the owner has access
+func todoAccessOn(dbDriver, table, user, role string) string {
+	if dbDriver == DB_DRIVER_SQLITE || dbDriver == DB_DRIVER_MYSQL {
+		return table + "user_id = " + user
+	}
+	return TodoAccess(table, user, role)
+}
+
+// Member is a user a project is shared with, or its owner
+type Member struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Invitation asks a user to join a project with a role until they accept or decline it
+type Invitation struct {
+	ID        int       `json:"id"`
+	ProjectID int       `json:"project_id"`
+	Project   string    `json:"project"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const INVITATION_QUERY = "SELECT i.id, i.project_id, p.name, u.username, i.role, b.username, i.created_at FROM project_invitation i " +
+	"JOIN project p ON p.id = i.project_id JOIN users u ON u.id = i.user_id JOIN users b ON b.id = i.invited_by"
+
+func (p *ProjectRepository) queryInvitations(ctx context.Context, condition string, args ...interface{}) ([]Invitation, error) {
+	rows, err := p.DB.QueryContext(ctx, INVITATION_QUERY+" WHERE "+condition+" ORDER BY i.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := make([]Invitation, 0)
+	for rows.Next() {
+		var invitation Invitation
+		if err := rows.Scan(&invitation.ID, &invitation.ProjectID, &invitation.Project, &invitation.Username, &invitation.Role, &invitation.InvitedBy, &invitation.CreatedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// Accessible reports whether the user may access the project with role
+func (p *ProjectRepository) Accessible(ctx context.Context, userID, projectID int, role string) (bool, error) {
+	var exists bool
+	err := p.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM project WHERE id = $1 AND "+ProjectAccess("$2", role)+")", projectID, userID).Scan(&exists)
+	return exists, err
+}
+
+// Owns reports whether the project belongs to the user, only the owner manages who it is shared with
+func (p *ProjectRepository) Owns(ctx context.Context, userID, projectID int) (bool, error) {
+	var exists bool
+	err := p.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM project WHERE id = $1 AND user_id = $2)", projectID, userID).Scan(&exists)
+	return exists, err
+}
+
+// FindInvitee looks up the user to invite to the project by username and whether they are a member already
+func (p *ProjectRepository) FindInvitee(ctx context.Context, projectID int, username string) (userID int, member bool, err error) {
+	err = p.DB.QueryRowContext(ctx,
+		"SELECT u.id, EXISTS(SELECT 1 FROM project_member m WHERE m.project_id = $2 AND m.user_id = u.id) FROM users u WHERE u.username = $1",
+		username, projectID,
+	).Scan(&userID, &member)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return userID, member, err
+}
+
+// Invite invites the user to the project with role, inviting them again replaces the role
+func (p *ProjectRepository) Invite(ctx context.Context, projectID, userID int, role string, invitedBy int) (Invitation, error) {
+	var id int
+	if err := p.DB.QueryRowContext(ctx,
+		"INSERT INTO project_invitation(project_id, user_id, role, invited_by) VALUES($1,$2,$3,$4) "+
+			"ON CONFLICT (project_id, user_id) DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, created_at = now() RETURNING id",
+		projectID, userID, role, invitedBy,
+	).Scan(&id); err != nil {
+		return Invitation{}, err
+	}
+	invitations, err := p.queryInvitations(ctx, "i.id = $1", id)
+	if err != nil {
+		return Invitation{}, err
+	} else if len(invitations) == 0 {
+		return Invitation{}, ErrNotFound
+	}
+	return invitations[0], nil
+}
+
+// ProjectInvitations lists the pending invitations to the project
+func (p *ProjectRepository) ProjectInvitations(ctx context.Context, projectID int) ([]Invitation, error) {
+	return p.queryInvitations(ctx, "i.project_id = $1", projectID)
+}
+
+// UserInvitations lists the pending invitations of the user to the projects of others
+func (p *ProjectRepository) UserInvitations(ctx context.Context, userID int) ([]Invitation, error) {
+	return p.queryInvitations(ctx, "i.user_id = $1", userID)
+}
+
+// RevokeInvitation withdraws a pending invitation to a project the user owns
+func (p *ProjectRepository) RevokeInvitation(ctx context.Context, userID, projectID, invitationID int) error {
+	result, err := p.DB.ExecContext(ctx,
+		"DELETE FROM project_invitation i USING project p WHERE i.id = $3 AND i.project_id = $1 AND p.id = i.project_id AND p.user_id = $2",
+		projectID, userID, invitationID,
+	)
+	return deleted(result, err)
+}
+
+// AcceptInvitation makes the user a member of the project with the role of the invitation, which is used up. The
+// project is returned with its owner and the role
+func (p *ProjectRepository) AcceptInvitation(ctx context.Context, userID, invitationID int) (Project, error) {
+	var project Project
+	err := p.DB.QueryRowContext(ctx,
+		"WITH accepted AS (DELETE FROM project_invitation WHERE id = $1 AND user_id = $2 RETURNING project_id, user_id, role) "+
+			"INSERT INTO project_member(project_id, user_id, role) SELECT project_id, user_id, role FROM accepted "+
+			"ON CONFLICT (project_id, user_id) DO UPDATE SET role = EXCLUDED.role "+
+			"RETURNING project_id, (SELECT name FROM project WHERE id = project_id), (SELECT u.username FROM project p JOIN users u ON u.id = p.user_id WHERE p.id = project_id), role",
+		invitationID, userID,
+	).Scan(&project.ID, &project.Name, &project.Owner, &project.Role)
+	if err == sql.ErrNoRows {
+		return project, ErrNotFound
+	}
+	return project, err
+}
+
+// DeclineInvitation turns down an invitation of the user
+func (p *ProjectRepository) DeclineInvitation(ctx context.Context, userID, invitationID int) error {
+	result, err := p.DB.ExecContext(ctx, "DELETE FROM project_invitation WHERE id = $1 AND user_id = $2", invitationID, userID)
+	return deleted(result, err)
+}
+
+// Members lists the owner and then the members of the project
+func (p *ProjectRepository) Members(ctx context.Context, projectID int) ([]Member, error) {
+	rows, err := p.DB.QueryContext(ctx,
+		"SELECT p.user_id, u.username, '"+ROLE_OWNER+"', p.created_at FROM project p JOIN users u ON u.id = p.user_id WHERE p.id = $1 "+
+			"UNION ALL (SELECT m.user_id, u.username, m.role, m.created_at FROM project_member m JOIN users u ON u.id = m.user_id WHERE m.project_id = $1 ORDER BY m.created_at, m.user_id)",
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]Member, 0)
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// UpdateMember changes the role of a member of a project the user owns
+func (p *ProjectRepository) UpdateMember(ctx context.Context, userID, projectID, memberID int, role string) (Member, error) {
+	var member Member
+	err := p.DB.QueryRowContext(ctx,
+		"UPDATE project_member m SET role = $4 FROM project p WHERE m.project_id = $1 AND m.user_id = $3 AND p.id = m.project_id AND p.user_id = $2 "+
+			"RETURNING m.user_id, (SELECT username FROM users WHERE id = m.user_id), m.role, m.created_at",
+		projectID, userID, memberID, role,
+	).Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+	if err == sql.ErrNoRows {
+		return member, ErrNotFound
+	}
+	return member, err
+}
+
+// RemoveMember stops sharing a project the user owns with a member, or lets the user leave a project shared with them
+func (p *ProjectRepository) RemoveMember(ctx context.Context, userID, projectID, memberID int) error {
+	result, err := p.DB.ExecContext(ctx,
+		"DELETE FROM project_member m USING project p WHERE m.project_id = $1 AND m.user_id = $3 AND p.id = m.project_id AND (p.user_id = $2 OR m.user_id = $2)",
+		projectID, userID, memberID,
+	)
+	return deleted(result, err)
+}
+
+// Shared lists the projects of others the user is a member of, with the owner and the role of the user
+func (p *ProjectRepository) Shared(ctx context.Context, userID int) ([]Project, error) {
+	rows, err := p.DB.QueryContext(ctx,
+		"SELECT p.id, p.name, p.created_at, u.username, m.role FROM project_member m JOIN project p ON p.id = m.project_id JOIN users u ON u.id = p.user_id WHERE m.user_id = $1 ORDER BY p.id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make([]Project, 0)
+	for rows.Next() {
+		var project Project
+		if err := rows.Scan(&project.ID, &project.Name, &project.CreatedAt, &project.Owner, &project.Role); err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	sqlitemigrate "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"modernc.org/sqlite"
+)
+
+const (
+	// How long a connection waits for another one to release its lock before the statement fails
+	SQLITE_BUSY_TIMEOUT = 5 * time.Second
+)
+
+// sqliteConnector opens the connections of the SQLite file, sql.OpenDB needs a connector to instrument them
+type sqliteConnector struct {
+	dsn string
+}
+
+// NewSQLiteConnector opens the connections of the SQLite database in path
+func NewSQLiteConnector(path string) driver.Connector {
+	return sqliteConnector{sqliteDSN(path)}
+}
+
+func (c sqliteConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.Driver().Open(c.dsn)
+}
+func (c sqliteConnector) Driver() driver.Driver { return &sqlite.Driver{} }
+
+// sqliteDSN opens path, a file name or a file: URI, with foreign keys checked as Postgres does. Times are stored as
+// text, which sorts like the times since the repository writes them in UTC
+func sqliteDSN(path string) string {
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + fmt.Sprintf("_pragma=foreign_keys(1)&_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_time_format=sqlite", SQLITE_BUSY_TIMEOUT.Milliseconds())
+}
+
+// sqliteTodoRepository stores the to-do lists in the todo table of the SQLite schema and records every change in
+// todo_history with it. The single connection serializes the transactions, so Update needs no row lock
+type sqliteTodoRepository struct {
+	db *sql.DB
+	// Set when the caller owns the transaction, the methods then run within it and leave the commit to the caller
+	tx *sql.Tx
+}
+
+func (s *sqliteTodoRepository) conn() queryRower {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+func (s *sqliteTodoRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return RunInTx(ctx, s.db, s.tx, fn)
+}
+
+func (s *sqliteTodoRepository) Get(ctx context.Context, userID, todoID int) (Todo, error) {
+	var todo Todo
+	err := scanTodo(s.conn().QueryRowContext(ctx, "SELECT "+PORTABLE_TODO_COLUMNS+" FROM todo WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", todoID, userID), &todo)
+	if err == sql.ErrNoRows {
+		return todo, ErrTodoNotFound
+	}
+	return todo, err
+}
+
+// inUTC is t in UTC for storing, nil stays nil
+func inUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// The timestamps are passed instead of set with CURRENT_TIMESTAMP, which has no fraction of a second
+func (s *sqliteTodoRepository) Create(ctx context.Context, userID int, todo *Todo) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, "INSERT INTO todo(title, description, source, metadata, due_date, tags, priority, user_id, project_id, recurrence, remind_at, created_at, updated_at) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$12) RETURNING "+PORTABLE_TODO_COLUMNS, todo.Title, todo.Description, todo.Source, todo.Metadata, inUTC(todo.DueDate), todo.Tags, todo.Priority, userID, todo.ProjectID, todo.Recurrence, inUTC(todo.RemindAt), time.Now().UTC())
+		if err := scanTodo(row, todo); err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, EVENT_CREATED, nil, *todo)
+	})
+}
+
+func (s *sqliteTodoRepository) Update(ctx context.Context, userID, todoID, version int, change func(existing Todo) (Todo, error)) (existingTodo, updatedTodo Todo, err error) {
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+PORTABLE_TODO_COLUMNS+" FROM todo WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", todoID, userID), &existingTodo); err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		} else if err != nil {
+			return err
+		}
+
+		changed, err := change(existingTodo)
+		if err != nil {
+			return err
+		}
+
+		query := "UPDATE todo SET title = $2, description = $3, is_done = $4, completed_at = CASE WHEN $4 THEN COALESCE(completed_at, $12) END, metadata = $5, due_date = $6, tags = $7, priority = $8, project_id = $9, recurrence = $10, reminded_at = CASE WHEN remind_at IS NOT $11 THEN NULL ELSE reminded_at END, remind_at = $11, status = $13, snoozed_until = $14, version = version + 1, updated_at = $12 WHERE id = $1 AND deleted_at IS NULL"
+		args := []interface{}{todoID, changed.Title, changed.Description, changed.IsDone, changed.Metadata, inUTC(changed.DueDate), changed.Tags, changed.Priority, changed.ProjectID, changed.Recurrence, inUTC(changed.RemindAt), time.Now().UTC(), changed.Status, inUTC(changed.SnoozedUntil)}
+		if version != 0 {
+			args = append(args, version)
+			query += " AND version = $15"
+		}
+
+		// The row exists, so no row updated means the caller has an older version
+		if err = scanTodo(tx.QueryRowContext(ctx, query+" RETURNING "+PORTABLE_TODO_COLUMNS, args...), &updatedTodo); err == sql.ErrNoRows {
+			return ErrVersionConflict
+		} else if err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, UpdateEvent(existingTodo, updatedTodo), &existingTodo, updatedTodo)
+	})
+	return existingTodo, updatedTodo, err
+}
+
+func (s *sqliteTodoRepository) Delete(ctx context.Context, userID, todoID int) (todo Todo, err error) {
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := scanTodo(tx.QueryRowContext(ctx, "UPDATE todo SET deleted_at = $3, updated_at = $3 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL RETURNING "+PORTABLE_TODO_COLUMNS, todoID, userID, time.Now().UTC()), &todo); err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		} else if err != nil {
+			return err
+		}
+		before := todo
+		before.DeletedAt = nil
+		return recordHistory(ctx, tx, userID, EVENT_DELETED, &before, todo)
+	})
+	return todo, err
+}
+
+func (s *sqliteTodoRepository) Restore(ctx context.Context, userID, todoID int) (todo Todo, err error) {
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		var deletedTodo Todo
+		if err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+PORTABLE_TODO_COLUMNS+" FROM todo WHERE id = $1 AND user_id = $2", todoID, userID), &deletedTodo); err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		} else if err != nil {
+			return err
+		}
+		if err := scanTodo(tx.QueryRowContext(ctx, "UPDATE todo SET deleted_at = NULL, updated_at = CASE WHEN deleted_at IS NULL THEN updated_at ELSE $2 END WHERE id = $1 RETURNING "+PORTABLE_TODO_COLUMNS, todoID, time.Now().UTC()), &todo); err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, EVENT_RESTORED, &deletedTodo, todo)
+	})
+	return todo, err
+}
+
+func (s *sqliteTodoRepository) HasProject(ctx context.Context, userID, projectID int) (bool, error) {
+	var id int
+	err := s.conn().QueryRowContext(ctx, "SELECT id FROM project WHERE id = $1 AND user_id = $2", projectID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Audience is nobody else, the projects aren't shared on SQLite
+func (s *sqliteTodoRepository) Audience(ctx context.Context, userID int, todoIDs []int) (map[int][]int, error) {
+	return nil, nil
+}
+
+// newSQLiteMigrate migrates the SQLite database in path. The migrate driver closes its database together with the
+// migrations, so it gets one of its own instead of the one of the server
+func newSQLiteMigrate(path string, migrationSource source.Driver) (*migrate.Migrate, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("opening the SQLite database %q: %w", path, err)
+	}
+	driver, err := sqlitemigrate.WithInstance(db, &sqlitemigrate.Config{})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("preparing migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", migrationSource, "sqlite", driver)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// newSQLiteDatabase opens a migrated database file of the test, testUserID exists. It returns the path of the file
+func newSQLiteDatabase(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "todo.db")
+	// Not setupSQLite, its metrics can only be registered once
+	db := sql.OpenDB(NewSQLiteConnector(path))
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if version, err := ApplyMigrations(db, DB_DRIVER_SQLITE, path, "", false); err != nil || version != latestSQLiteVersion(t) {
+		t.Fatalf("migrated to version %d, %v", version, err)
+	}
+	if _, err := db.Exec("INSERT INTO users(id, username, password_hash) VALUES($1, 'test', '')", testUserID); err != nil {
+		t.Fatal(err)
+	}
+	return db, path
+}
+
+// latestSQLiteVersion is the last SQLite migration embedded in the binary
+func latestSQLiteVersion(t *testing.T) uint {
+	t.Helper()
+	version, err := LatestSchemaVersion(DB_DRIVER_SQLITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	db, path := newSQLiteDatabase(t)
+
+	if version, _, err := RollbackMigrations(db, DB_DRIVER_SQLITE, path, "", 0); err != nil || version != -1 {
+		t.Fatalf("rolled back to version %d, %v", version, err)
+	}
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'todo'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("todo tables after rolling back = %d, %v", tables, err)
+	}
+
+	if version, err := ApplyMigrations(db, DB_DRIVER_SQLITE, path, "", false); err != nil || version != latestSQLiteVersion(t) {
+		t.Errorf("migrated again to version %d, %v", version, err)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// Stats summarizes the to-do list of the user that isn't deleted
+type Stats struct {
+	Open    int `json:"open"`
+	Done    int `json:"done"`
+	Overdue int `json:"overdue"`
+	// Mean time from creation to completion of the done to-do list, null without any
+	AverageCompletionSeconds *float64     `json:"average_completion_seconds"`
+	Weeks                    int          `json:"weeks"`
+	Completions              []DailyCount `json:"completions"`
+}
+
+// DailyCompletions counts the to-do list of the user completed on each day from "from" to "to", both included, in
+// the timezone of location. The days without any are zero
+func (q *TodoQueries) DailyCompletions(ctx context.Context, userID int, location *time.Location, from, to time.Time) ([]DailyCount, error) {
+	rows, err := q.DB.QueryContext(ctx,
+		"SELECT to_char(completed_at AT TIME ZONE $1, 'YYYY-MM-DD') AS day, COUNT(*) FROM todo WHERE completed_at >= $2 AND completed_at < $3 AND user_id = $4 AND deleted_at IS NULL GROUP BY day",
+		location.String(), from, to.AddDate(0, 0, 1), userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			day   string
+			count int
+		)
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := make([]DailyCount, 0)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(DATE_LAYOUT)
+		stats = append(stats, DailyCount{Date: date, Count: counts[date]})
+	}
+	return stats, nil
+}
+
+// Stats counts the open, done and overdue to-do lists of the user in one aggregate, without the completions per day
+func (q *TodoQueries) Stats(ctx context.Context, userID int) (Stats, error) {
+	var stats Stats
+	row := q.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FILTER (WHERE NOT is_done), COUNT(*) FILTER (WHERE is_done), COUNT(*) FILTER (WHERE NOT is_done AND due_date < now()), "+
+			"AVG(EXTRACT(EPOCH FROM completed_at - created_at)) FILTER (WHERE is_done AND completed_at IS NOT NULL) "+
+			"FROM todo WHERE user_id = $1 AND deleted_at IS NULL",
+		userID,
+	)
+	err := row.Scan(&stats.Open, &stats.Done, &stats.Overdue, &stats.AverageCompletionSeconds)
+	return stats, err
+}
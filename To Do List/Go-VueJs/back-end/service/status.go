@@ -0,0 +1,70 @@
+package service
+
+// Column of a to-do list on the board, is_done is true only in STATUS_DONE
+const (
+	STATUS_BACKLOG     = "backlog"
+	STATUS_IN_PROGRESS = "in_progress"
+	STATUS_BLOCKED     = "blocked"
+	STATUS_DONE        = "done"
+)
+
+// Statuses are the columns of the board, in the order it shows them
+var Statuses = []string{STATUS_BACKLOG, STATUS_IN_PROGRESS, STATUS_BLOCKED, STATUS_DONE}
+
+func IsValidStatus(status string) bool {
+	switch status {
+	case STATUS_BACKLOG, STATUS_IN_PROGRESS, STATUS_BLOCKED, STATUS_DONE:
+		return true
+	}
+	return false
+}
+
+// StatusTransitions maps a status to the ones a to-do list may move to from it, nil allows every move
+type StatusTransitions map[string][]string
+
+// Allows reports whether a to-do list may move from one status to the other, staying is always allowed
+func (t StatusTransitions) Allows(from, to string) bool {
+	if t == nil || from == to {
+		return true
+	}
+	for _, status := range t[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources are the statuses a to-do list may move to the status from, including itself
+func (t StatusTransitions) Sources(to string) []string {
+	var from []string
+	for _, status := range Statuses {
+		if t.Allows(status, to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+// resolveStatus settles the status of the updated to-do list against the existing one. A client only sending or
+// only changing is_done completes or reopens it, a reopened one going back to the backlog, otherwise the status
+// wins. is_done always follows the status
+func resolveStatus(existing, updated Todo) Todo {
+	if updated.Status == "" || (updated.Status == existing.Status && updated.IsDone != existing.IsDone) {
+		switch {
+		case updated.IsDone:
+			updated.Status = STATUS_DONE
+		case existing.Status == STATUS_DONE || existing.Status == "":
+			updated.Status = STATUS_BACKLOG
+		default:
+			updated.Status = existing.Status
+		}
+	}
+	updated.IsDone = updated.Status == STATUS_DONE
+	return updated
+}
+
+// errTransition rejects a move the STATUS_TRANSITIONS don't allow
+func errTransition(from, to string) error {
+	return ValidationError{NewFieldError("status", RULE_TRANSITION, "status can't move from %s to %s", from, to)}
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestResolveStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing Todo
+		updated  Todo
+		status   string
+	}{
+		{"is_done only", Todo{Status: STATUS_IN_PROGRESS}, Todo{IsDone: true}, STATUS_DONE},
+		{"reopened", Todo{Status: STATUS_DONE, IsDone: true}, Todo{Status: STATUS_DONE}, STATUS_BACKLOG},
+		{"undone stays", Todo{Status: STATUS_BLOCKED}, Todo{}, STATUS_BLOCKED},
+		{"status wins", Todo{Status: STATUS_BACKLOG}, Todo{Status: STATUS_IN_PROGRESS, IsDone: true}, STATUS_IN_PROGRESS},
+		{"status done", Todo{Status: STATUS_BLOCKED}, Todo{Status: STATUS_DONE}, STATUS_DONE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveStatus(tt.existing, tt.updated)
+			if got.Status != tt.status || got.IsDone != (tt.status == STATUS_DONE) {
+				t.Errorf("status = %s, is_done = %t, want %s", got.Status, got.IsDone, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const (
+	MAX_TAGS       = 20
+	MAX_TAG_LENGTH = 50
+)
+
+// Tags are the categories of a to-do list, stored as TEXT[] on SQLite and MySQL and in todo_tag on Postgres, always
+// encoded as a JSON array
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	return pq.StringArray(t).Value()
+}
+
+func (t *Tags) Scan(src interface{}) error {
+	var tags pq.StringArray
+	if err := tags.Scan(src); err != nil {
+		return err
+	}
+	*t = Tags(tags)
+	return nil
+}
+
+func (t Tags) MarshalJSON() ([]byte, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(t))
+}
+
+func ValidateTags(tags Tags) error {
+	if len(tags) > MAX_TAGS {
+		return NewFieldError("tags", RULE_MAX_ITEMS, "at most %d tags are allowed", MAX_TAGS)
+	}
+	for i, tag := range tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		if strings.TrimSpace(tag) == "" {
+			return NewFieldError(field, RULE_REQUIRED, "tags must not be empty")
+		}
+		if utf8.RuneCountInString(tag) > MAX_TAG_LENGTH {
+			return NewFieldError(field, RULE_MAX_LENGTH, "tag %q must be at most %d characters", tag, MAX_TAG_LENGTH)
+		}
+	}
+	return nil
+}
+
+// Tag is a tag of a user, POST /tag creates one before any to-do list has it
+type Tag struct {
+	ID        int        `json:"id,omitempty"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// sameTags reports whether a and b have the same tags, in any order
+func sameTags(a, b Tags) bool {
+	names := make(map[string]bool, len(a))
+	for _, tag := range a {
+		names[tag] = false
+	}
+	for _, tag := range b {
+		if _, ok := names[tag]; !ok {
+			return false
+		}
+		names[tag] = true
+	}
+	for _, found := range names {
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// setTodoTags replaces the tags of the to-do list with tags, creating the ones its owner doesn't have yet, and returns
+// them as TODO_TAGS reads them
+func setTodoTags(ctx context.Context, tx *sql.Tx, todoID int, tags Tags) (Tags, error) {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO tag(user_id, name) SELECT user_id, unnest($2::text[]) FROM todo WHERE id = $1 AND user_id IS NOT NULL ON CONFLICT (user_id, name) DO NOTHING", todoID, tags); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tag WHERE todo_id = $1", todoID); err != nil {
+		return nil, err
+	}
+	var stored Tags
+	err := tx.QueryRowContext(ctx,
+		"WITH added AS (INSERT INTO todo_tag(todo_id, tag_id) SELECT todo.id, tag.id FROM todo JOIN tag ON tag.user_id = todo.user_id WHERE todo.id = $1 AND tag.name = ANY($2) RETURNING tag_id) "+
+			"SELECT COALESCE(array_agg(tag.name ORDER BY tag.name), '{}') FROM added JOIN tag ON tag.id = added.tag_id",
+		todoID, tags,
+	).Scan(&stored)
+	return stored, err
+}
+
+// TagRepository stores the tags of the users
+type TagRepository struct {
+	DB *sql.DB
+}
+
+// Create stores the tag of the user and fills in its id, a name the user already has is a unique violation
+func (t *TagRepository) Create(ctx context.Context, userID int, tag *Tag) error {
+	return t.DB.QueryRowContext(ctx, "INSERT INTO tag(user_id, name) VALUES($1, $2) RETURNING id, created_at", userID, tag.Name).Scan(&tag.ID, &tag.CreatedAt)
+}
+
+// TagCount is a tag and how many to-do list have it
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Tags lists the tags of the user, also the unused ones, and those of the to-do lists the user may view, most used
+// first. The tags of the same name of different owners are counted together
+func (q *TodoQueries) Tags(ctx context.Context, userID int) ([]TagCount, error) {
+	rows, err := q.DB.QueryContext(ctx,
+		"SELECT tag.name, COUNT(todo.id) FROM tag LEFT JOIN todo_tag ON todo_tag.tag_id = tag.id "+
+			"LEFT JOIN todo ON todo.id = todo_tag.todo_id AND todo.deleted_at IS NULL AND "+TodoAccess("todo.", "$1", ROLE_VIEWER)+" "+
+			"WHERE tag.user_id = $1 OR todo.id IS NOT NULL GROUP BY tag.name ORDER BY COUNT(todo.id) DESC, tag.name",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]TagCount, 0)
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// DeleteTag removes the tag of the user, and the tag from every to-do list the user may edit, returning those which
+// changed
+func (s *TodoStore) DeleteTag(ctx context.Context, userID int, tag string) (todos []Todo, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		existingTodos, err := queryTodos(ctx, tx, "SELECT "+TODO_COLUMNS+" FROM todo WHERE $1 = ANY("+TODO_TAGS+") AND "+TodoAccess("", "$2", ROLE_EDITOR)+" AND deleted_at IS NULL FOR UPDATE", tag, userID)
+		if err != nil {
+			return err
+		}
+		ids := make([]int, len(existingTodos))
+		for i, todo := range existingTodos {
+			ids[i] = todo.ID
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tag USING tag WHERE tag.id = todo_tag.tag_id AND tag.name = $1 AND todo_tag.todo_id = ANY($2)", tag, pq.Array(ids)); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM tag WHERE user_id = $1 AND name = $2", userID, tag); err != nil {
+			return err
+		}
+		if todos, err = queryTodos(ctx, tx, "UPDATE todo SET version = version + 1, updated_at = now() WHERE id = ANY($1) RETURNING "+TODO_COLUMNS, pq.Array(ids)); err != nil {
+			return err
+		}
+		return recordHistories(ctx, tx, userID, existingTodos, todos)
+	})
+	return todos, err
+}
+
+// ChangeTags stores the tags change returns for the ones of a to-do list the user may edit. When change fails the
+// to-do list is returned as it is with its error
+func (s *TodoStore) ChangeTags(ctx context.Context, userID int, todoID int, change func(tags Tags) (Tags, error)) (todo Todo, err error) {
+	err = RunInTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		if todo, err = lockTodo(ctx, tx, userID, todoID); err != nil {
+			return err
+		}
+		tags, err := change(todo.Tags)
+		if err != nil {
+			return err
+		}
+
+		existingTodo := todo
+		if _, err := setTodoTags(ctx, tx, todo.ID, tags); err != nil {
+			return err
+		}
+		if err := scanTodo(tx.QueryRowContext(ctx, "UPDATE todo SET version = version + 1, updated_at = now() WHERE id = $1 RETURNING "+TODO_COLUMNS, todo.ID), &todo); err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, userID, EVENT_UPDATED, &existingTodo, todo)
+	})
+	return todo, err
+}
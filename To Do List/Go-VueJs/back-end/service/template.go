@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Template struct {
+	ID    int            `json:"id,omitempty"`
+	Name  string         `json:"name,omitempty"`
+	Items []TemplateItem `json:"items"`
+}
+
+type TemplateItem struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// TemplateRepository stores the templates of the users
+type TemplateRepository struct {
+	DB *sql.DB
+}
+
+// List returns the templates of the user with their items
+func (t *TemplateRepository) List(ctx context.Context, userID int) ([]Template, error) {
+	rows, err := t.DB.QueryContext(ctx, "SELECT t.id, t.name, i.title, COALESCE(i.description, '') FROM template t LEFT JOIN template_item i ON i.template_id = t.id WHERE t.user_id = $1 ORDER BY t.id, i.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]Template, 0)
+	for rows.Next() {
+		var (
+			template Template
+			title    sql.NullString
+			item     TemplateItem
+		)
+		if err := rows.Scan(&template.ID, &template.Name, &title, &item.Description); err != nil {
+			return nil, err
+		}
+
+		// Rows are ordered by template, so a new id starts a new template
+		if len(templates) == 0 || templates[len(templates)-1].ID != template.ID {
+			template.Items = make([]TemplateItem, 0)
+			templates = append(templates, template)
+		}
+		if title.Valid {
+			item.Title = title.String
+			last := &templates[len(templates)-1]
+			last.Items = append(last.Items, item)
+		}
+	}
+	return templates, nil
+}
+
+// Create stores a new template of the user with its items and fills in its id
+func (t *TemplateRepository) Create(ctx context.Context, userID int, template *Template) error {
+	return RunInTx(ctx, t.DB, nil, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, "INSERT INTO template(name, user_id) VALUES($1, $2) RETURNING id", template.Name, userID).Scan(&template.ID); err != nil {
+			return err
+		}
+		for _, item := range template.Items {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO template_item(template_id, title, description) VALUES($1,$2,$3)", template.ID, item.Title, item.Description); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Apply creates a to-do list of the user from each item of one of their templates and records their history, the
+// template of another user is ErrNotFound. The caller publishes the created to-do lists
+func (t *TemplateRepository) Apply(ctx context.Context, userID, templateID int) (todos []Todo, err error) {
+	err = RunInTx(ctx, t.DB, nil, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, "SELECT id FROM template WHERE id=$1 AND user_id=$2", templateID, userID).Scan(&templateID); err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if todos, err = queryTodos(ctx, tx,
+			"INSERT INTO todo(title, description, source, user_id) SELECT title, COALESCE(description, ''), $2, $3 FROM template_item WHERE template_id=$1 ORDER BY id RETURNING "+TODO_COLUMNS,
+			templateID, SOURCE_TEMPLATE, userID,
+		); err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			if err := recordHistory(ctx, tx, userID, EVENT_CREATED, nil, todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return todos, err
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type Todo struct {
+	ID          int         `json:"id,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	IsDone      bool        `json:"is_done"`
+	Status      string      `json:"status"`
+	Archived    bool        `json:"archived"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Source      string      `json:"source,omitempty"`
+	Version     int         `json:"version,omitempty"`
+	Metadata    Metadata    `json:"metadata,omitempty"`
+	Tags        Tags        `json:"tags"`
+	Priority    string      `json:"priority,omitempty"`
+	ProjectID   *int        `json:"project_id,omitempty"`
+	Recurrence  *Recurrence `json:"recurrence,omitempty"`
+	NextDueDate *time.Time  `json:"next_due_date,omitempty"`
+	RemindAt    *time.Time  `json:"remind_at,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time  `json:"updated_at,omitempty"`
+	DueDate     *time.Time  `json:"due_date,omitempty"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"`
+	// Hidden from the views until then, only set by POST /todo/{id}/snooze
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+
+	// Only with ?render=html, the description rendered from Markdown and sanitized
+	DescriptionHTML string `json:"description_html,omitempty"`
+
+	// Only GET /todo/{id} embeds the checklist
+	Checklist *Checklist `json:"checklist,omitempty"`
+
+	// Only GET /todo/{id}?include=comments embeds the comments
+	Comments []Comment `json:"comments,omitempty"`
+}
+
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// Origin of a to-do list
+const (
+	SOURCE_TEMPLATE = "template"
+)
+
+// Importance of a to-do list, medium when not given
+const (
+	PRIORITY_LOW    = "low"
+	PRIORITY_MEDIUM = "medium"
+	PRIORITY_HIGH   = "high"
+	PRIORITY_URGENT = "urgent"
+)
+
+const (
+	MAX_TITLE_LENGTH        = 255
+	MAX_DESCRIPTION_LENGTH  = 255
+	DATE_LAYOUT             = "2006-01-02"
+	DEFAULT_MAX_SUBSCRIBERS = 100
+)
+
+// TODO_TAGS are the names of the tags of the row of todo on Postgres, which keeps them in todo_tag
+const TODO_TAGS = "ARRAY(SELECT tag.name FROM todo_tag JOIN tag ON tag.id = todo_tag.tag_id WHERE todo_tag.todo_id = todo.id ORDER BY tag.name)"
+
+// Columns read by scanTodo on Postgres, in order
+const TODO_COLUMNS = "id, title, COALESCE(description, ''), is_done, archived, completed_at, source, version, metadata, created_at, updated_at, due_date, deleted_at, " + TODO_TAGS + ", priority, project_id, recurrence, remind_at, status, snoozed_until"
+
+// PORTABLE_TODO_COLUMNS are the TODO_COLUMNS of SQLite and MySQL, which keep the tags in a column of todo
+const PORTABLE_TODO_COLUMNS = "id, title, COALESCE(description, ''), is_done, archived, completed_at, source, version, metadata, created_at, updated_at, due_date, deleted_at, tags, priority, project_id, recurrence, remind_at, status, snoozed_until"
+
+// todoColumnsOn are the columns scanTodo reads on the database of dbDriver
+func todoColumnsOn(dbDriver string) string {
+	if dbDriver == DB_DRIVER_SQLITE || dbDriver == DB_DRIVER_MYSQL {
+		return PORTABLE_TODO_COLUMNS
+	}
+	return TODO_COLUMNS
+}
+
+// Scanner is satisfied by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTodo(rows Scanner, todo *Todo) error {
+	if err := rows.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.IsDone, &todo.Archived, &todo.CompletedAt, &todo.Source, &todo.Version, &todo.Metadata, &todo.CreatedAt, &todo.UpdatedAt, &todo.DueDate, &todo.DeletedAt, &todo.Tags, &todo.Priority, &todo.ProjectID, &todo.Recurrence, &todo.RemindAt, &todo.Status, &todo.SnoozedUntil); err != nil {
+		return err
+	}
+	todo.NextDueDate = nextDueDate(*todo)
+	return nil
+}
+
+// ValidateTodo checks the fields a client sends on create and update, the FieldErrors list every field that fails
+func ValidateTodo(todo Todo) error {
+	var errs FieldErrors
+	errs.CheckLength("title", todo.Title, true, MAX_TITLE_LENGTH)
+	errs.CheckLength("description", todo.Description, false, MAX_DESCRIPTION_LENGTH)
+	if !IsValidPriority(todo.Priority) {
+		errs = append(errs, NewFieldError("priority", RULE_ONE_OF, "priority must be one of %s, %s, %s or %s", PRIORITY_LOW, PRIORITY_MEDIUM, PRIORITY_HIGH, PRIORITY_URGENT))
+	}
+	// Left empty the status follows is_done
+	if todo.Status != "" && !IsValidStatus(todo.Status) {
+		errs = append(errs, NewFieldError("status", RULE_ONE_OF, "status must be one of %s, %s, %s or %s", STATUS_BACKLOG, STATUS_IN_PROGRESS, STATUS_BLOCKED, STATUS_DONE))
+	}
+	errs.Add("tags", ValidateTags(todo.Tags))
+	if todo.Recurrence != nil {
+		errs.Add("recurrence", todo.Recurrence.Validate())
+	}
+	errs.Add("metadata", validateMetadata(todo.Metadata))
+	return errs.Err()
+}
+
+func IsValidPriority(priority string) bool {
+	switch priority {
+	case PRIORITY_LOW, PRIORITY_MEDIUM, PRIORITY_HIGH, PRIORITY_URGENT:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrTodoNotFound    = errors.New("to-do list not found")
+	ErrTodoLocked      = errors.New("completed to-do list is locked")
+	ErrVersionConflict = errors.New("to-do list has a newer version")
+)
+
+// TodoPatch holds the fields of a partial update, nil means not provided
+type TodoPatch struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	IsDone      *bool     `json:"is_done"`
+	Status      *string   `json:"status"`
+	Metadata    *Metadata `json:"metadata"`
+	Tags        *Tags     `json:"tags"`
+	Priority    *string   `json:"priority"`
+	Version     int       `json:"version"`
+
+	// A null due_date leaves it unchanged, PUT clears it
+	DueDate *time.Time `json:"due_date"`
+
+	// These can be cleared with null, e.g. to move a to-do list out of its project
+	ProjectID  Optional[int]        `json:"project_id"`
+	Recurrence Optional[Recurrence] `json:"recurrence"`
+	RemindAt   Optional[time.Time]  `json:"remind_at"`
+}
+
+// Optional is a patch field which tells a null apart from a missing key: Set is false when missing, Value is nil when null
+type Optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	o.Value = new(T)
+	return json.Unmarshal(data, o.Value)
+}
+
+// ValidationError is an input the validation rejected, its message is shown to the client
+type ValidationError struct {
+	Err error
+}
+
+func (e ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap exposes the FieldErrors of the validation to Response.Errors
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// Trash returns a page of the deleted to-do lists of the user, most recently deleted first, and how many there are
+func (q *TodoQueries) Trash(ctx context.Context, userID, limit, offset int) ([]Todo, int, error) {
+	var total int
+	if err := q.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM todo WHERE user_id = $1 AND deleted_at IS NOT NULL", userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	todos, err := queryTodos(ctx, q.DB,
+		"SELECT "+TODO_COLUMNS+" FROM todo WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT $2 OFFSET $3",
+		userID, limit, offset,
+	)
+	return todos, total, err
+}
+
+// Purge permanently deletes a to-do list of the trash of the user, ErrTodoNotFound for one which isn't deleted
+func (s *TodoStore) Purge(ctx context.Context, userID, todoID int) error {
+	err := deleted(s.DB.ExecContext(ctx, "DELETE FROM todo WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL", todoID, userID))
+	if err == ErrNotFound {
+		return ErrTodoNotFound
+	}
+	return err
+}
+
+// PurgeDeleted permanently deletes the to-do list of every user deleted before the time
+func (s *TodoStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.DB.ExecContext(ctx, "DELETE FROM todo WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
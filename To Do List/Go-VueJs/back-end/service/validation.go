@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule a field broke, stable for clients to branch on
+const (
+	RULE_REQUIRED   = "required"
+	RULE_MAX_LENGTH = "max_length"
+	RULE_MAX_ITEMS  = "max_items"
+	RULE_MAX_SIZE   = "max_size"
+	RULE_ONE_OF     = "one_of"
+	RULE_RANGE      = "range"
+	RULE_TYPE       = "type"
+	RULE_EXISTS     = "exists"
+	RULE_TRANSITION = "transition"
+)
+
+// FieldError is one broken rule of a field, named by its JSON path like "recurrence.interval"
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+func NewFieldError(field, rule, format string, args ...interface{}) FieldError {
+	return FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+// FieldErrors are all the rules an input broke, Response.Errors lists them
+type FieldErrors []FieldError
+
+func (errs FieldErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add appends err, which is a FieldError or FieldErrors when it comes from a validator, to the errors of field
+func (errs *FieldErrors) Add(field string, err error) {
+	var one FieldError
+	var many FieldErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &many):
+		*errs = append(*errs, many...)
+	case errors.As(err, &one):
+		*errs = append(*errs, one)
+	default:
+		*errs = append(*errs, FieldError{Field: field, Rule: RULE_TYPE, Message: err.Error()})
+	}
+}
+
+// Err is nil without errors, so validators can return it as is
+func (errs FieldErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// CheckLength adds the errors of a required text field of at most max characters
+func (errs *FieldErrors) CheckLength(field, value string, required bool, max int) {
+	if required && strings.TrimSpace(value) == "" {
+		*errs = append(*errs, NewFieldError(field, RULE_REQUIRED, "%s is required", field))
+	} else if utf8.RuneCountInString(value) > max {
+		*errs = append(*errs, NewFieldError(field, RULE_MAX_LENGTH, "%s must be at most %d characters", field, max))
+	}
+}
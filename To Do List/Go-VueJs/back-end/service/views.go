@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Views of GET /todo/views/{view}, the undone to-do list of the user sorted out by due date, snooze and priority
+const (
+	// Due by the end of the day or overdue, urgent, or woken from a snooze today
+	VIEW_TODAY = "today"
+	// Due or waking from a snooze in the next ?days= days after today, one waking later today isn't in any view
+	VIEW_UPCOMING = "upcoming"
+	// Without a due date and not snoozed, nor in today
+	VIEW_SOMEDAY = "someday"
+)
+
+// PRIORITY_ORDER sorts the urgent to-do list first, it runs on every database driver
+const PRIORITY_ORDER = "CASE priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'medium' THEN 2 ELSE 3 END"
+
+// PRIORITY_RANK ranks the priorities from low to urgent for ?sort=priority, like PRIORITY_ORDER on every database driver
+const PRIORITY_RANK = "CASE priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'urgent' THEN 4 END"
+
+// View is one of VIEW_* at Now in Location, Days after today for VIEW_UPCOMING
+type View struct {
+	Name     string
+	Days     int
+	Now      time.Time
+	Location *time.Location
+}
+
+// query is the condition and the order of the view, with its arguments appended to args. The snoozes are compared to
+// now, a to-do list comes back into the views the moment its snooze ends without anything updating it
+func (v View) query(args []interface{}) (string, string, []interface{}, error) {
+	local := v.Now.In(v.Location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, v.Location)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	// The times are in UTC like the ones SQLite stores, which compares them as text
+	args = append(args, v.Now.UTC())
+	nowArg := len(args)
+	awake := fmt.Sprintf("(snoozed_until IS NULL OR snoozed_until <= $%d)", nowArg)
+	conditions := "is_done = FALSE"
+
+	switch v.Name {
+	case VIEW_TODAY:
+		args = append(args, today.UTC(), tomorrow.UTC())
+		conditions += fmt.Sprintf(" AND %s AND (due_date < $%d OR priority = '%s' OR snoozed_until >= $%d)", awake, len(args), PRIORITY_URGENT, len(args)-1)
+		return conditions, PRIORITY_ORDER + ", due_date IS NULL, due_date, id", args, nil
+	case VIEW_UPCOMING:
+		args = append(args, tomorrow.UTC(), tomorrow.AddDate(0, 0, v.Days).UTC())
+		from, to := len(args)-1, len(args)
+		conditions += fmt.Sprintf(" AND ((snoozed_until >= $%d AND snoozed_until < $%d) OR (%s AND due_date >= $%d AND due_date < $%d))", from, to, awake, from, to)
+		// By the day it shows up, the snoozed ones when they wake
+		shows := fmt.Sprintf("CASE WHEN snoozed_until > $%d THEN snoozed_until ELSE due_date END", nowArg)
+		return conditions, shows + ", " + PRIORITY_ORDER + ", id", args, nil
+	case VIEW_SOMEDAY:
+		args = append(args, today.UTC())
+		conditions += fmt.Sprintf(" AND %s AND due_date IS NULL AND priority <> '%s' AND (snoozed_until IS NULL OR snoozed_until < $%d)", awake, PRIORITY_URGENT, len(args))
+		return conditions, PRIORITY_ORDER + ", " + MANUAL_ORDER, args, nil
+	}
+	return "", "", nil, fmt.Errorf("invalid view %q", v.Name)
+}
+
+// View returns a page of the to-do lists of the filter in the view and how many there are in all
+func (q *TodoQueries) View(ctx context.Context, filter ListFilter, view View, limit, offset int) ([]Todo, int, error) {
+	where, args := filter.where()
+	conditions, orderBy, args, err := view.query(args)
+	if err != nil {
+		return nil, 0, err
+	}
+	return q.page(ctx, where+" AND "+conditions, orderBy, args, limit, offset)
+}
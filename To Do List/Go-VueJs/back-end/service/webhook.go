@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Status of a queued delivery, dead ones gave up after the maximum attempts
+const (
+	DELIVERY_PENDING = "pending"
+)
+
+type Webhook struct {
+	ID     int      `json:"id,omitempty"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// WebhookRepository stores the webhooks of the users and the queue of their deliveries. The methods taking the user
+// return ErrNotFound for a webhook of another user
+type WebhookRepository struct {
+	DB *sql.DB
+}
+
+// List reads the webhooks of the user by id, without their secret
+func (h *WebhookRepository) List(ctx context.Context, userID int) ([]Webhook, error) {
+	rows, err := h.DB.QueryContext(ctx, "SELECT id, url, events FROM webhook WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]Webhook, 0)
+	for rows.Next() {
+		var webhook Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events)); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// Create stores a new webhook of the user and fills in its id
+func (h *WebhookRepository) Create(ctx context.Context, userID int, webhook *Webhook) error {
+	return h.DB.QueryRowContext(ctx, "INSERT INTO webhook(url, events, secret, user_id) VALUES($1,$2,$3,$4) RETURNING id", webhook.URL, pq.Array(webhook.Events), webhook.Secret, userID).Scan(&webhook.ID)
+}
+
+// Update replaces the URL and the events of the webhook, filling in its id
+func (h *WebhookRepository) Update(ctx context.Context, userID, webhookID int, webhook *Webhook) error {
+	row := h.DB.QueryRowContext(ctx, "UPDATE webhook SET url = $3, events = $4 WHERE id = $1 AND user_id = $2 RETURNING id", webhookID, userID, webhook.URL, pq.Array(webhook.Events))
+	if err := row.Scan(&webhook.ID); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the webhook with its queued deliveries, returning it without its secret
+func (h *WebhookRepository) Delete(ctx context.Context, userID, webhookID int) (Webhook, error) {
+	var webhook Webhook
+	row := h.DB.QueryRowContext(ctx, "DELETE FROM webhook WHERE id = $1 AND user_id = $2 RETURNING id, url, events", webhookID, userID)
+	if err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events)); err == sql.ErrNoRows {
+		return webhook, ErrNotFound
+	} else if err != nil {
+		return webhook, err
+	}
+	return webhook, nil
+}
+
+// Deliveries reads a page of the queued deliveries of the webhooks of the user, the latest first, of every status
+// when status is empty
+func (h *WebhookRepository) Deliveries(ctx context.Context, userID int, status string, limit, offset int) ([]WebhookDelivery, error) {
+	query := "SELECT id, webhook_id, event, status, attempts, next_attempt_at, last_status_code, last_error, created_at FROM webhook_queue WHERE webhook_id IN (SELECT id FROM webhook WHERE user_id = $3)"
+	args := []interface{}{limit, offset, userID}
+	if status != "" {
+		args = append(args, status)
+		query += " AND status = $4"
+	}
+
+	rows, err := h.DB.QueryContext(ctx, query+" ORDER BY id DESC LIMIT $1 OFFSET $2", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery WebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// Queue queues a delivery of the payload for every webhook of the user subscribed to the event
+func (h *WebhookRepository) Queue(ctx context.Context, userID int, event string, payload []byte) error {
+	_, err := h.DB.ExecContext(ctx, "INSERT INTO webhook_queue(webhook_id, event, payload) SELECT id, $1, $2 FROM webhook WHERE $1 = ANY(events) AND user_id = $3", event, payload, userID)
+	return err
+}
+
+// Claim leases at most limit due deliveries until the time, so other workers skip them while they're posted. Each
+// comes with its webhook
+func (h *WebhookRepository) Claim(ctx context.Context, until time.Time, limit int) ([]WebhookDelivery, []Webhook, error) {
+	rows, err := h.DB.QueryContext(ctx,
+		`UPDATE webhook_queue q SET next_attempt_at = $1
+		FROM webhook w
+		WHERE w.id = q.webhook_id AND q.id IN (
+			SELECT id FROM webhook_queue WHERE status = $2 AND next_attempt_at <= now() ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING q.id, q.event, q.payload, q.attempts, w.id, w.url, w.secret`,
+		until, DELIVERY_PENDING, limit,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		deliveries []WebhookDelivery
+		webhooks   []Webhook
+	)
+	for rows.Next() {
+		var (
+			delivery WebhookDelivery
+			webhook  Webhook
+		)
+		if err := rows.Scan(&delivery.ID, &delivery.Event, &delivery.Payload, &delivery.Attempts, &webhook.ID, &webhook.URL, &webhook.Secret); err != nil {
+			return nil, nil, err
+		}
+		delivery.WebhookID = webhook.ID
+		deliveries = append(deliveries, delivery)
+		webhooks = append(webhooks, webhook)
+	}
+	return deliveries, webhooks, rows.Err()
+}
+
+// RecordAttempt stores the Status, Attempts, NextAttemptAt, LastStatusCode and LastError of the delivery after an
+// attempt, with the attempt in webhook_delivery. Together, so the attempts of the queue always match the recorded
+// deliveries
+func (h *WebhookRepository) RecordAttempt(ctx context.Context, delivery WebhookDelivery) error {
+	return RunInTx(ctx, h.DB, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE webhook_queue SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5, last_error = $6 WHERE id = $1", delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastStatusCode, delivery.LastError); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO webhook_delivery(webhook_id, queue_id, event, attempt, status_code, error) VALUES($1,$2,$3,$4,$5,$6)", delivery.WebhookID, delivery.ID, delivery.Event, delivery.Attempts, delivery.LastStatusCode, delivery.LastError)
+		return err
+	})
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	// A session unused for this long expires, every refresh pushes it back
+	DEFAULT_REFRESH_TOKEN_TTL = 30 * 24 * time.Hour
+)
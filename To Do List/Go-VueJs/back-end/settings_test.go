@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"to-do-list/handlers"
+	"to-do-list/service"
+)
+
+// unsetEnv clears the variables for the test, restoring them afterwards even when an env file sets them
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "test.env")
+	if err := os.WriteFile(envFile, []byte("SERVER_PORT=9000\nLOG_LEVEL=debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want Settings
+	}{
+		{
+			name: "defaults",
+			args: []string{"-env-file", os.DevNull},
+			want: Settings{Port: DEFAULT_SERVER_PORT, DBDriver: service.DB_DRIVER_POSTGRES, LogLevel: DEFAULT_LOG_LEVEL, Command: COMMAND_SERVE},
+		},
+		{
+			name: "env file",
+			args: []string{"-env-file", envFile},
+			want: Settings{Port: 9000, DBDriver: service.DB_DRIVER_POSTGRES, LogLevel: "debug", Command: COMMAND_SERVE},
+		},
+		{
+			name: "environment wins over the env file",
+			env:  map[string]string{"SERVER_PORT": "9100", "DATABASE_URL": "postgres://todo@db:5432/todo"},
+			args: []string{"-env-file", envFile},
+			want: Settings{Port: 9100, DBDriver: service.DB_DRIVER_POSTGRES, DatabaseURL: "postgres://todo@db:5432/todo", LogLevel: "debug", Command: COMMAND_SERVE},
+		},
+		{
+			name: "flags win over the environment",
+			env:  map[string]string{"SERVER_PORT": "9100", "LOG_LEVEL": "warn", "DB_MIGRATIONS_DIR": "missing"},
+			args: []string{"-env-file", envFile, "-port", "9200", "-log-level", "error", "-migrations", dir, "migrate", "down", "2"},
+			want: Settings{Port: 9200, DBDriver: service.DB_DRIVER_POSTGRES, LogLevel: "error", MigrationsDir: dir, Command: COMMAND_MIGRATE, MigrateAction: MIGRATE_DOWN, MigrateArg: 2},
+		},
+		{
+			name: "sqlite defaults to a file in the working directory",
+			env:  map[string]string{"DB_DRIVER": "postgres"},
+			args: []string{"-env-file", os.DevNull, "-db-driver", "sqlite"},
+			want: Settings{Port: DEFAULT_SERVER_PORT, DBDriver: service.DB_DRIVER_SQLITE, DatabaseURL: DEFAULT_SQLITE_PATH, LogLevel: DEFAULT_LOG_LEVEL, Command: COMMAND_SERVE},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "SERVER_PORT", "DB_DRIVER", "LOG_LEVEL", "DATABASE_URL", "DATABASE_URL_FILE", "DB_MIGRATIONS_DIR")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			got, err := loadSettings(tt.args, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("settings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSettingsErrors(t *testing.T) {
+	unsetEnv(t, "SERVER_PORT", "DB_DRIVER", "LOG_LEVEL", "DATABASE_URL", "DATABASE_URL_FILE", "DB_MIGRATIONS_DIR")
+
+	if _, err := loadSettings([]string{"-env-file", filepath.Join(t.TempDir(), "missing.env")}, io.Discard); err == nil {
+		t.Error("a missing -env-file loaded")
+	}
+
+	_, err := loadSettings([]string{"-env-file", os.DevNull, "-port", "70000", "-log-level", "loud", "-database-url", "mysql://db"}, io.Discard)
+	if err == nil {
+		t.Fatal("invalid settings loaded")
+	}
+	for _, want := range []string{"port 70000", "database URL", `log level "loud"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't report %s", err, want)
+		}
+	}
+
+	for _, args := range [][]string{{"-db-driver", "oracle"}, {"-db-driver", "mysql"}, {"-db-driver", "mysql", "-database-url", "postgres://db/todo"}, {"-db-driver", "sqlite", "-database-url", ":memory:"}} {
+		if _, err := loadSettings(append([]string{"-env-file", os.DevNull}, args...), io.Discard); err == nil {
+			t.Errorf("%q loaded", args)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    Settings
+		invalid bool
+	}{
+		{args: nil, want: Settings{Command: COMMAND_SERVE}},
+		{args: []string{"serve"}, want: Settings{Command: COMMAND_SERVE}},
+		{args: []string{"migrate", "up"}, want: Settings{Command: COMMAND_MIGRATE, MigrateAction: MIGRATE_UP}},
+		{args: []string{"migrate", "down"}, want: Settings{Command: COMMAND_MIGRATE, MigrateAction: MIGRATE_DOWN}},
+		{args: []string{"migrate", "down", "3"}, want: Settings{Command: COMMAND_MIGRATE, MigrateAction: MIGRATE_DOWN, MigrateArg: 3}},
+		{args: []string{"migrate", "version"}, want: Settings{Command: COMMAND_MIGRATE, MigrateAction: MIGRATE_VERSION}},
+		{args: []string{"migrate", "force", "-1"}, want: Settings{Command: COMMAND_MIGRATE, MigrateAction: MIGRATE_FORCE, MigrateArg: -1}},
+		{args: []string{"user", "disable", "ana"}, want: Settings{Command: handlers.COMMAND_USER, Admin: handlers.AdminCommand{Action: handlers.USER_DISABLE, Username: "ana"}}},
+		{args: []string{"serve", "now"}, invalid: true},
+		{args: []string{"backup"}, invalid: true},
+		{args: []string{"migrate"}, invalid: true},
+		{args: []string{"migrate", "sideways"}, invalid: true},
+		{args: []string{"migrate", "up", "2"}, invalid: true},
+		{args: []string{"migrate", "down", "0"}, invalid: true},
+		{args: []string{"migrate", "force"}, invalid: true},
+		{args: []string{"migrate", "force", "-2"}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			got, err := parseCommand(tt.args)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("err = %v, want invalid %t", err, tt.invalid)
+			}
+			if got != tt.want {
+				t.Errorf("command = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"to-do-list/service"
+)
+
+const (
+	DEFAULT_SQLITE_PATH = "todo.db"
+)
+
+// setupSQLite opens the SQLite database in path, so the to-do list API runs without a Postgres server
+func setupSQLite(path string) *sql.DB {
+	db := sql.OpenDB(instrumentedConnector{service.NewSQLiteConnector(path)})
+	registerDBMetrics(db)
+
+	// SQLite has a single writer, one connection queues the writes in the pool instead of failing them with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), DB_PING_TIMEOUT)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		fatal("Error opening the SQLite database", "path", path, "error", err)
+	}
+	return db
+}
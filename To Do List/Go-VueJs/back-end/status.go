@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+
+	"to-do-list/service"
+)
+
+// setupStatusTransitions reads the allowed moves from STATUS_TRANSITIONS, comma separated from:to pairs like
+// "backlog:in_progress,in_progress:done", every move is allowed when unset
+func setupStatusTransitions() service.StatusTransitions {
+	value := getEnv("STATUS_TRANSITIONS", "")
+	if value == "" {
+		return nil
+	}
+	transitions := make(service.StatusTransitions)
+	for _, pair := range strings.Split(value, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || !service.IsValidStatus(from) || !service.IsValidStatus(to) {
+			fatal("STATUS_TRANSITIONS has an invalid move", "move", pair)
+		}
+		transitions[from] = append(transitions[from], to)
+	}
+	return transitions
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"to-do-list/service"
+)
+
+func TestSetupStatusTransitions(t *testing.T) {
+	t.Setenv("STATUS_TRANSITIONS", "backlog:in_progress, in_progress:done,in_progress:blocked")
+	transitions := setupStatusTransitions()
+	want := service.StatusTransitions{service.STATUS_BACKLOG: {service.STATUS_IN_PROGRESS}, service.STATUS_IN_PROGRESS: {service.STATUS_DONE, service.STATUS_BLOCKED}}
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("transitions = %v, want %v", transitions, want)
+	}
+	if !transitions.Allows(service.STATUS_BLOCKED, service.STATUS_BLOCKED) || transitions.Allows(service.STATUS_BLOCKED, service.STATUS_DONE) {
+		t.Error("blocked may only stay blocked")
+	}
+	if sources := transitions.Sources(service.STATUS_DONE); !reflect.DeepEqual(sources, []string{service.STATUS_IN_PROGRESS, service.STATUS_DONE}) {
+		t.Errorf("sources of done = %v", sources)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"to-do-list/handlers"
+)
+
+// setupTracing exports the spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT (or its _TRACES_ variant) is set.
+// Endpoint, headers, sampler and batching are the standard OTEL_* variables read by the SDK; OTEL_SERVICE_NAME
+// overrides the service name. The returned function flushes the spans still buffered
+func setupTracing(ctx context.Context) func(context.Context) error {
+	// Pass the W3C traceparent of the callers on even when this service exports nothing itself
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if getEnvBool("OTEL_SDK_DISABLED", false) || getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")) == "" {
+		return func(context.Context) error { return nil }
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		fatal("Error creating the trace exporter", "error", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(handlers.TRACER_NAME)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		slog.Warn("Incomplete trace resource", "error", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	slog.Info("Exporting traces over OTLP")
+	return provider.Shutdown
+}
+
+// startQuerySpan starts the client span of a statement on the database
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := queryOperation(query)
+	return handlers.Tracer.Start(ctx, fmt.Sprintf("db.%s", operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(operation),
+			// Values are always bound as arguments, so the statement holds no user data
+			semconv.DBStatement(query),
+		),
+	)
+}
+
+// endQuerySpan ends the span of a statement, marking it failed unless database/sql only asked for a fallback
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil && err != driver.ErrSkip {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"to-do-list/handlers"
+)
+
+// recordSpans sends the spans of the test to a recorder instead of the global provider
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous, propagator := handlers.Tracer, otel.GetTextMapPropagator()
+	handlers.Tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(handlers.TRACER_NAME)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		handlers.Tracer = previous
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func TestQuerySpans(t *testing.T) {
+	recorder := recordSpans(t)
+	mockDB, mock, err := sqlmock.NewWithDSN("tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sql.OpenDB(instrumentedConnector{dsnConnector{mockDB.Driver(), "tracing"}})
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM todo")).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM todo")).WillReturnError(errDatabase)
+
+	ctx, parent := handlers.Tracer.Start(context.Background(), "request")
+	var id int
+	if err := db.QueryRowContext(ctx, "SELECT id FROM todo WHERE id = $1", 1).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM todo WHERE id = $1", 1); !errors.Is(err, errDatabase) {
+		t.Fatalf("err = %v, want errDatabase", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want both statements and the request", len(spans))
+	}
+	for i, want := range []struct {
+		name   string
+		status codes.Code
+	}{{"db.select", codes.Unset}, {"db.delete", codes.Error}} {
+		span := spans[i]
+		if span.Name() != want.name || span.Status().Code != want.status {
+			t.Errorf("span %d = %q %v, want %q %v", i, span.Name(), span.Status().Code, want.name, want.status)
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %q isn't a child of the request", span.Name())
+		}
+		if !hasAttribute(span, semconv.DBSystemPostgreSQL) {
+			t.Errorf("attributes of %q = %v, want db.system", span.Name(), span.Attributes())
+		}
+	}
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, want attribute.KeyValue) bool {
+	for _, attr := range span.Attributes() {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
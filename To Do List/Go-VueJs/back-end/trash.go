@@ -0,0 +1,8 @@
+package main
+
+import (
+	"time"
+)
+
+// Deleted to-do list are purged after this long unless TRASH_RETENTION says otherwise
+const DEFAULT_TRASH_RETENTION = 30 * 24 * time.Hour